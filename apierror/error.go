@@ -0,0 +1,242 @@
+package apierror
+
+/*
+网关错误模型
+按客户端协议输出对应的错误结构，官方 SDK 才能正确解析
+openai: {"error":{"message","type","code"}}
+gemini: {"error":{"code","message","status"}}
+claude: {"type":"error","error":{"type","message"}}
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// Code 网关错误码
+type Code string
+
+const (
+	CodeInvalidRequest      Code = "invalid_request"
+	CodeUnauthorized        Code = "unauthorized"
+	CodeForbidden           Code = "forbidden"
+	CodeRequestTooLarge     Code = "request_too_large"
+	CodeModelConfigNotFound Code = "model_config_not_found"
+	CodeUpstreamUnavailable Code = "upstream_unavailable"
+	CodeUpstreamTimeout     Code = "upstream_timeout"
+	CodeUpstreamError       Code = "upstream_error"
+	CodeStreamIdleTimeout   Code = "stream_idle_timeout"
+	CodeStreamInterrupted   Code = "stream_interrupted"
+	CodeClientClosed        Code = "client_closed"
+	CodeInternal            Code = "internal_error"
+	// 引用的之前的响应不存在、已过期或属于其它调用方
+	CodePreviousResponseNotFound Code = "previous_response_not_found"
+	// 脚本钩子拒绝请求或响应
+	CodeScriptRejected Code = "script_rejected"
+	// 命中内容安全规则
+	CodeGuardrailBlocked Code = "guardrail_blocked"
+	// 提示词注入检测拒绝请求
+	CodeInjectionBlocked Code = "injection_blocked"
+)
+
+type Error struct {
+	Code      Code
+	Status    int
+	Retryable bool
+	Message   string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(code Code, status int, retryable bool, msg string) *Error {
+	return &Error{Code: code, Status: status, Retryable: retryable, Message: msg}
+}
+
+func Wrap(err error, code Code, status int, retryable bool, msg string) *Error {
+	return &Error{Code: code, Status: status, Retryable: retryable, Message: msg, Err: err}
+}
+
+// From 把任意错误归类为网关错误
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return Wrap(err, CodeRequestTooLarge, http.StatusRequestEntityTooLarge, false, "request body too large")
+	case errors.Is(err, context.DeadlineExceeded):
+		return Wrap(err, CodeUpstreamTimeout, http.StatusGatewayTimeout, true, "upstream request timeout")
+	case errors.Is(err, context.Canceled):
+		return Wrap(err, CodeClientClosed, 499, false, "client closed request")
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return Wrap(err, CodeUpstreamTimeout, http.StatusGatewayTimeout, true, "upstream request timeout")
+		}
+		return Wrap(err, CodeUpstreamUnavailable, http.StatusBadGateway, true, "upstream unavailable")
+	}
+	// 内部错误的原因只记录日志，可能包含上游地址、文件路径，不返回给客户端
+	return Wrap(err, CodeInternal, http.StatusInternalServerError, false, "internal error")
+}
+
+// Body 按协议生成错误响应体
+func (e *Error) Body(dialect string) any {
+	switch dialect {
+	case constant.DialectGemini:
+		return map[string]any{
+			"error": map[string]any{
+				"code":    e.Status,
+				"message": e.Message,
+				"status":  geminiStatus(e.Status),
+				"details": []any{map[string]any{
+					"@type":    "type.googleapis.com/google.rpc.ErrorInfo",
+					"reason":   string(e.Code),
+					"domain":   "aiapi",
+					"metadata": map[string]string{"retryable": boolString(e.Retryable)},
+				}},
+			},
+		}
+	case constant.DialectOllama, constant.DialectOllamaGenerate:
+		return map[string]any{"error": e.Message}
+	case constant.DialectClaude:
+		return map[string]any{
+			"type": "error",
+			"error": map[string]any{
+				"type":    claudeType(e.Status),
+				"message": e.Message,
+			},
+		}
+	default:
+		return map[string]any{
+			"error": map[string]any{
+				"message": e.Message,
+				"type":    openaiType(e.Status),
+				"code":    string(e.Code),
+				"param":   nil,
+			},
+		}
+	}
+}
+
+func (e *Error) JSON(dialect string) []byte {
+	data, _ := json.Marshal(e.Body(dialect))
+	return data
+}
+
+// Event 流式响应中途出错时的 SSE 错误事件
+func (e *Error) Event(dialect string) sse.Event {
+	event := sse.Event{Data: string(e.JSON(dialect)), HasData: true}
+	switch dialect {
+	case constant.DialectClaude:
+		event.Event = "error"
+	case constant.DialectResponses:
+		// responses 的错误事件不嵌套 error 对象
+		data, _ := json.Marshal(map[string]any{
+			"type":    "error",
+			"code":    string(e.Code),
+			"message": e.Message,
+			"param":   nil,
+		})
+		event.Event, event.Data = "error", string(data)
+	}
+	return event
+}
+
+// Header 错误码与是否可重试写入响应头
+func (e *Error) Header(header http.Header) {
+	header.Set(constant.HeaderErrorCode, string(e.Code))
+	header.Set(constant.HeaderRetryable, boolString(e.Retryable))
+}
+
+func openaiType(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusGatewayTimeout:
+		return "timeout_error"
+	}
+	if status >= 500 {
+		return "server_error"
+	}
+	return "invalid_request_error"
+}
+
+func claudeType(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusGatewayTimeout:
+		return "timeout_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	}
+	if status >= 500 {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
+
+func geminiStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case 499:
+		return "CANCELLED"
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	}
+	if status >= 500 {
+		return "INTERNAL"
+	}
+	return "FAILED_PRECONDITION"
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,65 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+)
+
+func TestBody(t *testing.T) {
+	apiErr := New(CodeModelConfigNotFound, http.StatusNotFound, false, "model config not found")
+	cases := map[string]string{
+		constant.DialectOpenAI: `{"error":{"code":"model_config_not_found","message":"model config not found","param":null,"type":"not_found_error"}}`,
+		constant.DialectClaude: `{"error":{"message":"model config not found","type":"not_found_error"},"type":"error"}`,
+	}
+	for dialect, want := range cases {
+		if got := string(apiErr.JSON(dialect)); got != want {
+			t.Fatalf("%s 错误结构不一致: %s", dialect, got)
+		}
+	}
+	var gemini struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(apiErr.JSON(constant.DialectGemini), &gemini); err != nil {
+		t.Fatal(err)
+	}
+	if gemini.Error.Code != 404 || gemini.Error.Status != "NOT_FOUND" {
+		t.Fatalf("gemini 错误结构不一致: %+v", gemini)
+	}
+}
+
+func TestFrom(t *testing.T) {
+	wrapped := fmt.Errorf("proxy: %w", New(CodeInvalidRequest, http.StatusBadRequest, false, "bad"))
+	if got := From(wrapped); got.Code != CodeInvalidRequest {
+		t.Fatalf("包装的网关错误未识别: %v", got)
+	}
+	if got := From(context.DeadlineExceeded); got.Status != http.StatusGatewayTimeout || !got.Retryable {
+		t.Fatalf("超时错误归类错误: %v", got)
+	}
+	cause := errors.New("open /root/.aiapi/cache/up/entry: permission denied")
+	got := From(cause)
+	if got.Status != http.StatusInternalServerError || !errors.Is(got, cause) {
+		t.Fatalf("未知错误归类错误: %v", got)
+	}
+	// 原因只保留在错误链中，不返回给客户端
+	if body := string(got.JSON(constant.DialectOpenAI)); strings.Contains(body, "/root") || got.Message != "internal error" {
+		t.Fatalf("内部错误信息不应返回给客户端: %s", body)
+	}
+}
+
+func TestEvent(t *testing.T) {
+	event := New(CodeStreamIdleTimeout, http.StatusGatewayTimeout, true, "idle").Event(constant.DialectClaude)
+	if event.Event != "error" || !event.HasData {
+		t.Fatalf("claude 错误事件不正确: %+v", event)
+	}
+}
@@ -0,0 +1,73 @@
+package cache
+
+/*
+响应缓存
+memory: 进程内 LRU
+disk: 每个条目一个文件，索引在内存中按 LRU 淘汰
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lijcoder/aiapi/sse"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreDisk   = "disk"
+)
+
+// Entry 缓存的上游响应，非流式保存 Body，流式保存解析后的事件
+type Entry struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	Events     []sse.Event `json:"events,omitempty"`
+	ExpireAt   time.Time   `json:"expireAt"`
+}
+
+func (e *Entry) expired() bool {
+	return !e.ExpireAt.IsZero() && time.Now().After(e.ExpireAt)
+}
+
+func (e *Entry) size() int64 {
+	size := int64(len(e.Body))
+	for _, event := range e.Events {
+		size += int64(len(event.Data) + len(event.Event) + len(event.Id))
+	}
+	return size
+}
+
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+}
+
+type Config struct {
+	Store      string
+	Dir        string
+	Ttl        time.Duration
+	MaxEntries int
+	MaxBytes   int64
+}
+
+func New(config Config) (Store, error) {
+	if config.Store == StoreDisk {
+		return NewDisk(config.Dir, config.Ttl, config.MaxEntries, config.MaxBytes)
+	}
+	return NewMemory(config.Ttl, config.MaxEntries, config.MaxBytes), nil
+}
+
+// Key 各部分按 json 序列化后计算 sha256，结构体字段顺序固定、map 按 key 排序，结果稳定
+func Key(parts ...any) string {
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, part := range parts {
+		_ = encoder.Encode(part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lijcoder/aiapi/sse"
+)
+
+func TestMemoryEvict(t *testing.T) {
+	store := NewMemory(0, 2, 0)
+	store.Set("a", &Entry{Body: []byte("a")})
+	store.Set("b", &Entry{Body: []byte("b")})
+	store.Get("a")
+	store.Set("c", &Entry{Body: []byte("c")})
+	if _, ok := store.Get("b"); ok {
+		t.Fatal("最久未使用的条目没有被淘汰")
+	}
+	if _, ok := store.Get("a"); !ok {
+		t.Fatal("最近使用的条目被淘汰")
+	}
+}
+
+func TestMemoryTtl(t *testing.T) {
+	store := NewMemory(time.Millisecond, 0, 0)
+	store.Set("a", &Entry{Body: []byte("a")})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := store.Get("a"); ok {
+		t.Fatal("过期条目仍然命中")
+	}
+}
+
+func TestDiskReload(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDisk(dir, time.Minute, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []sse.Event{{Data: "a", HasData: true}, {Event: "done", Data: "[DONE]", HasData: true}}
+	store.Set("k", &Entry{StatusCode: 200, Events: events})
+	reload, err := NewDisk(dir, time.Minute, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := reload.Get("k")
+	if !ok || len(entry.Events) != 2 || entry.Events[1].Event != "done" {
+		t.Fatalf("重新加载后缓存不一致: %+v", entry)
+	}
+}
+
+func TestKey(t *testing.T) {
+	a := Key("openai", map[string]any{"x": 1, "y": 2})
+	b := Key("openai", map[string]any{"y": 2, "x": 1})
+	if a != b {
+		t.Fatal("相同内容的 key 不一致")
+	}
+}
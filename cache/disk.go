@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const diskFileSuffix = ".json"
+
+type Disk struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+	lru *lru
+}
+
+// NewDisk 启动时扫描目录重建索引，按修改时间从旧到新加入
+func NewDisk(dir string, ttl time.Duration, maxEntries int, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	d := &Disk{dir: dir, ttl: ttl}
+	d.lru = newLru(maxEntries, maxBytes, func(key string) {
+		_ = os.Remove(d.path(key))
+	})
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type fileInfo struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var infos []fileInfo
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), diskFileSuffix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, fileInfo{strings.TrimSuffix(file.Name(), diskFileSuffix), info.Size(), info.ModTime()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].modTime.Before(infos[j].modTime) })
+	for _, info := range infos {
+		d.lru.add(info.key, info.size, nil)
+	}
+	return d, nil
+}
+
+func (d *Disk) Get(key string) (*Entry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.lru.get(key); !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		d.lru.remove(key)
+		return nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.expired() {
+		d.lru.remove(key)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (d *Disk) Set(key string, entry *Entry) {
+	if d.ttl > 0 {
+		entry.ExpireAt = time.Now().Add(d.ttl)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp := d.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Warn("cache write fail.", "dir", d.dir, "errStack", err)
+		return
+	}
+	if err := os.Rename(tmp, d.path(key)); err != nil {
+		slog.Warn("cache write fail.", "dir", d.dir, "errStack", err)
+		return
+	}
+	d.lru.add(key, int64(len(data)), nil)
+}
+
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.dir, key+diskFileSuffix)
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Embedder 文本向量化
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// HttpEmbedder 调用 OpenAI 兼容的 /v1/embeddings 接口
+type HttpEmbedder struct {
+	Url     string
+	Model   string
+	Headers http.Header
+	Client  *http.Client
+}
+
+func (e *HttpEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, _ := json.Marshal(map[string]any{"model": e.Model, "input": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range e.Headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request fail. status: %d, body: %s", resp.StatusCode, data)
+	}
+	var result struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Data) == 0 {
+		return nil, errors.New("embedding response is empty")
+	}
+	return normalize(result.Data[0].Embedding), nil
+}
+
+// LocalEmbedder 本地替代实现，词与字符 trigram 做特征哈希，适合近似重复文本的匹配
+type LocalEmbedder struct {
+	Dim int
+}
+
+func (e *LocalEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	dim := e.Dim
+	if dim <= 0 {
+		dim = 512
+	}
+	vector := make([]float32, dim)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		addFeature(vector, "w:"+word, 1)
+		runes := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			addFeature(vector, string(runes[i:i+3]), 0.5)
+		}
+	}
+	return normalize(vector), nil
+}
+
+func addFeature(vector []float32, feature string, weight float32) {
+	hash := fnv.New64a()
+	hash.Write([]byte(feature))
+	sum := hash.Sum64()
+	index := sum % uint64(len(vector))
+	// 用另一位决定符号，减少哈希冲突带来的偏差
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[index] += weight
+}
+
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// Cosine 向量已经归一化，点积即余弦相似度
+func Cosine(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
@@ -0,0 +1,70 @@
+package cache
+
+import "container/list"
+
+// lru 按条数与字节数淘汰，非并发安全，由调用方加锁
+type lru struct {
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	ll         *list.List
+	items      map[string]*list.Element
+	onEvict    func(key string)
+}
+
+type lruItem struct {
+	key   string
+	size  int64
+	value any
+}
+
+func newLru(maxEntries int, maxBytes int64, onEvict func(key string)) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		onEvict:    onEvict,
+	}
+}
+
+func (l *lru) get(key string) (any, bool) {
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(element)
+	return element.Value.(*lruItem).value, true
+}
+
+func (l *lru) add(key string, size int64, value any) {
+	if element, ok := l.items[key]; ok {
+		item := element.Value.(*lruItem)
+		l.bytes += size - item.size
+		item.size = size
+		item.value = value
+		l.ll.MoveToFront(element)
+	} else {
+		l.items[key] = l.ll.PushFront(&lruItem{key: key, size: size, value: value})
+		l.bytes += size
+	}
+	for l.ll.Len() > 1 && ((l.maxEntries > 0 && l.ll.Len() > l.maxEntries) || (l.maxBytes > 0 && l.bytes > l.maxBytes)) {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+func (l *lru) remove(key string) {
+	if element, ok := l.items[key]; ok {
+		l.removeElement(element)
+	}
+}
+
+func (l *lru) removeElement(element *list.Element) {
+	item := element.Value.(*lruItem)
+	l.ll.Remove(element)
+	delete(l.items, item.key)
+	l.bytes -= item.size
+	if l.onEvict != nil {
+		l.onEvict(item.key)
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type Memory struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	lru *lru
+}
+
+func NewMemory(ttl time.Duration, maxEntries int, maxBytes int64) *Memory {
+	return &Memory{ttl: ttl, lru: newLru(maxEntries, maxBytes, nil)}
+}
+
+func (m *Memory) Get(key string) (*Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.lru.get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := value.(*Entry)
+	if entry.expired() {
+		m.lru.remove(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (m *Memory) Set(key string, entry *Entry) {
+	if m.ttl > 0 {
+		entry.ExpireAt = time.Now().Add(m.ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lru.add(key, entry.size(), entry)
+}
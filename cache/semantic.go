@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// VectorIndex 语义缓存的向量索引
+// scope 是除最后一轮用户输入之外的请求摘要，只在相同 scope 内比较相似度
+type VectorIndex interface {
+	Search(scope string, vector []float32) (*Entry, float32, bool)
+	Add(scope string, vector []float32, entry *Entry)
+}
+
+type vectorItem struct {
+	vector []float32
+	entry  *Entry
+}
+
+// MemoryIndex 进程内暴力检索，按 scope 分组，向量总数超过上限时淘汰最久未使用的 scope
+type MemoryIndex struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	perScope int
+	lru      *lru
+}
+
+func NewMemoryIndex(ttl time.Duration, maxEntries int) *MemoryIndex {
+	return &MemoryIndex{ttl: ttl, perScope: 64, lru: newLru(0, int64(maxEntries), nil)}
+}
+
+func (m *MemoryIndex) Search(scope string, vector []float32) (*Entry, float32, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.lru.get(scope)
+	if !ok {
+		return nil, 0, false
+	}
+	items := value.([]vectorItem)
+	var best *Entry
+	var bestScore float32 = -1
+	for _, item := range items {
+		if item.entry.expired() {
+			continue
+		}
+		if score := Cosine(vector, item.vector); score > bestScore {
+			best, bestScore = item.entry, score
+		}
+	}
+	return best, bestScore, best != nil
+}
+
+func (m *MemoryIndex) Add(scope string, vector []float32, entry *Entry) {
+	// 条目可能同时写入精确缓存，复制一份避免过期时间互相覆盖
+	copied := *entry
+	entry = &copied
+	if m.ttl > 0 {
+		entry.ExpireAt = time.Now().Add(m.ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []vectorItem
+	if value, ok := m.lru.get(scope); ok {
+		for _, item := range value.([]vectorItem) {
+			if !item.entry.expired() {
+				items = append(items, item)
+			}
+		}
+	}
+	items = append(items, vectorItem{vector: vector, entry: entry})
+	if len(items) > m.perScope {
+		items = items[len(items)-m.perScope:]
+	}
+	m.lru.add(scope, int64(len(items)), items)
+}
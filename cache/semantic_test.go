@@ -0,0 +1,26 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSemanticIndex(t *testing.T) {
+	embedder := &LocalEmbedder{}
+	index := NewMemoryIndex(0, 0)
+	vector, _ := embedder.Embed(context.Background(), "How do I reset my password on the portal?")
+	index.Add("scope", vector, &Entry{Body: []byte("answer")})
+
+	near, _ := embedder.Embed(context.Background(), "how do I reset my password in the portal")
+	entry, score, ok := index.Search("scope", near)
+	if !ok || string(entry.Body) != "answer" || score < 0.8 {
+		t.Fatalf("近似文本未命中, score: %f", score)
+	}
+	far, _ := embedder.Embed(context.Background(), "write a poem about the sea")
+	if _, score, _ := index.Search("scope", far); score > 0.5 {
+		t.Fatalf("无关文本相似度过高, score: %f", score)
+	}
+	if _, _, ok := index.Search("other", near); ok {
+		t.Fatal("不同 scope 之间不应该匹配")
+	}
+}
@@ -11,6 +11,16 @@ var (
 	PPROF     = false
 	MEMLIMIT  = 20
 	GCPERCENT = 100
+	// 流式响应默认值(秒)，路由未配置时使用
+	STREAM_HEARTBEAT    = 15
+	STREAM_IDLE_TIMEOUT = 120
+	REQUEST_TIMEOUT     = 600
+	MAX_BODY_SIZE       = 32
+	// 服务端保存对话的默认时间(秒)，路由未配置时使用
+	CONVERSATION_TTL = 30 * 24 * 3600
+	// 脚本钩子单次调用的执行步数与时间(毫秒)上限
+	SCRIPT_MAX_STEPS = 1000000
+	SCRIPT_TIMEOUT   = 100
 )
 
 func ParseAgrs() {
@@ -19,6 +29,13 @@ func ParseAgrs() {
 	flag.BoolVar(&PPROF, "add-pprof", false, "add pprof")
 	flag.IntVar(&MEMLIMIT, "mem", 20, "memory limit(MB)")
 	flag.IntVar(&GCPERCENT, "gc", 100, "gc percent")
+	flag.IntVar(&STREAM_HEARTBEAT, "stream-heartbeat", 15, "sse heartbeat interval(s) during upstream silence, 0 disable")
+	flag.IntVar(&STREAM_IDLE_TIMEOUT, "stream-idle-timeout", 120, "sse upstream idle timeout(s), 0 disable")
+	flag.IntVar(&REQUEST_TIMEOUT, "request-timeout", 600, "proxy request overall timeout(s), 0 disable")
+	flag.IntVar(&MAX_BODY_SIZE, "max-body-size", 32, "proxy request body limit(MB), 0 disable")
+	flag.IntVar(&CONVERSATION_TTL, "conversation-ttl", 30*24*3600, "server-side conversation retention(s), 0 never expire")
+	flag.IntVar(&SCRIPT_MAX_STEPS, "script-max-steps", 1000000, "script hook execution steps limit per call, 0 disable")
+	flag.IntVar(&SCRIPT_TIMEOUT, "script-timeout", 100, "script hook timeout(ms) per call, 0 disable")
 	flag.Parse()
 }
 
@@ -0,0 +1,41 @@
+package constant
+
+import "strings"
+
+// 客户端/上游使用的 API 协议
+const (
+	DialectOpenAI = "openai"
+	DialectGemini = "gemini"
+	DialectClaude = "claude"
+	// OpenAI Responses API，与 chat completions 的请求、响应结构不同
+	DialectResponses = "responses"
+	// 旧版 OpenAI completions，输入为单个 prompt
+	DialectCompletions = "completions"
+	// Ollama /api/chat 与 /api/generate，流式响应为 NDJSON
+	DialectOllama         = "ollama"
+	DialectOllamaGenerate = "ollama_generate"
+)
+
+// DetectDialect 根据请求路径推断协议，无法识别时返回空字符串
+func DetectDialect(path string) string {
+	// gemini 的 openai 兼容接口(v1beta/openai/chat/completions)按 openai 协议处理
+	compatible := strings.Contains("/"+path, "/openai/")
+	switch {
+	case !compatible && (strings.Contains(path, ":generateContent") || strings.Contains(path, ":streamGenerateContent") ||
+		strings.Contains(path, "v1beta/")):
+		return DialectGemini
+	case strings.Contains(path, "/messages"):
+		return DialectClaude
+	case strings.Contains(path, "/responses"):
+		return DialectResponses
+	case strings.Contains(path, "api/chat"):
+		return DialectOllama
+	case strings.Contains(path, "api/generate"):
+		return DialectOllamaGenerate
+	case strings.Contains(path, "chat/completions"), strings.Contains(path, "/embeddings"):
+		return DialectOpenAI
+	case strings.Contains(path, "/completions"):
+		return DialectCompletions
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package constant
+
+import "testing"
+
+func TestDetectDialect(t *testing.T) {
+	cases := map[string]string{
+		"v1beta/models/gemini-2.0-flash:generateContent":        DialectGemini,
+		"/v1beta/models/gemini-2.0-flash:streamGenerateContent": DialectGemini,
+		"v1beta/models/text-embedding-004:embedContent":         DialectGemini,
+		"v1beta/openai/chat/completions":                        DialectOpenAI,
+		"/v1beta/openai/embeddings":                             DialectOpenAI,
+		"v1/chat/completions":                                   DialectOpenAI,
+		"v1/messages":                                           DialectClaude,
+		"v1/responses":                                          DialectResponses,
+		"v1/completions":                                        DialectCompletions,
+		"api/chat":                                              DialectOllama,
+		"api/generate":                                          DialectOllamaGenerate,
+		"v1/unknown":                                            "",
+	}
+	for path, want := range cases {
+		if got := DetectDialect(path); got != want {
+			t.Errorf("DetectDialect(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
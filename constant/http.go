@@ -25,3 +25,29 @@ func BuildHttpResponseFail(msg string) HttpGeneralResp {
 		Msg:  msg,
 	}
 }
+
+// 网关自定义响应头
+const (
+	HeaderErrorCode = "X-Aiapi-Error-Code"
+	HeaderRetryable = "X-Aiapi-Retryable"
+	// 请求头 bypass 跳过缓存，响应头 hit/miss/bypass
+	HeaderCache = "X-Aiapi-Cache"
+	// 语义缓存 hit/miss/bypass 及命中的相似度
+	HeaderSemanticCache      = "X-Aiapi-Semantic-Cache"
+	HeaderSemanticCacheScore = "X-Aiapi-Semantic-Cache-Score"
+	// 协议转换时丢弃或改写的内容，多条以 ; 分隔
+	HeaderConversionWarnings = "X-Aiapi-Conversion-Warnings"
+	// token 计数由网关本地估算，而不是上游计数
+	HeaderTokenEstimate = "X-Aiapi-Token-Estimate"
+	// 请求头引用网关保存的对话，响应头返回本轮响应的 id，用于非 Responses API 的客户端
+	HeaderPreviousResponseId = "X-Aiapi-Previous-Response-Id"
+	HeaderResponseId         = "X-Aiapi-Response-Id"
+	// 本次请求生效的改写规则名称，多条以 , 分隔
+	HeaderTransforms = "X-Aiapi-Transforms"
+	// 本次请求执行的脚本名称，多条以 , 分隔；脚本改变路由时返回实际使用的路由
+	HeaderScripts = "X-Aiapi-Scripts"
+	HeaderRoute   = "X-Aiapi-Route"
+	// 提示词注入检测分数达到阈值且 action 为 flag 时返回分数与命中的规则，规则以 , 分隔
+	HeaderInjectionScore = "X-Aiapi-Injection-Score"
+	HeaderInjectionRules = "X-Aiapi-Injection-Rules"
+)
@@ -0,0 +1,62 @@
+package conversation
+
+/*
+服务端保存的对话状态
+每轮响应后保存截至该轮的对话历史(不含 system 指令)，请求引用之前的响应 id 时，转发给无状态的上游之前补齐历史
+存储复用响应缓存的 memory、disk 实现，按调用方隔离，过期后不能再引用
+*/
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/lijcoder/aiapi/cache"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// Conversation 截至某一轮响应的对话历史，最后一条为该轮的回答
+type Conversation struct {
+	Model    string            `json:"model,omitempty"`
+	Contents []general.Content `json:"contents"`
+}
+
+type Store struct {
+	store cache.Store
+}
+
+func New(config cache.Config) (*Store, error) {
+	store, err := cache.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{store: store}, nil
+}
+
+// Get owner 参与 key 的计算，其它调用方的响应 id 视为不存在
+func (s *Store) Get(owner string, id string) (*Conversation, bool) {
+	entry, ok := s.store.Get(cache.Key(owner, id))
+	if !ok {
+		return nil, false
+	}
+	var conversation Conversation
+	if err := json.Unmarshal(entry.Body, &conversation); err != nil {
+		return nil, false
+	}
+	return &conversation, true
+}
+
+func (s *Store) Save(owner string, id string, conversation *Conversation) {
+	data, err := json.Marshal(conversation)
+	if err != nil {
+		return
+	}
+	s.store.Set(cache.Key(owner, id), &cache.Entry{Body: data})
+}
+
+// NewId 与 Responses API 的响应 id 格式一致
+func NewId() string {
+	data := make([]byte, 24)
+	_, _ = rand.Read(data)
+	return "resp_" + hex.EncodeToString(data)
+}
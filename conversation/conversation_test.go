@@ -0,0 +1,34 @@
+package conversation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lijcoder/aiapi/cache"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+func TestStoreIsolation(t *testing.T) {
+	store, err := New(cache.Config{Store: cache.StoreDisk, Dir: t.TempDir(), Ttl: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "hi"
+	store.Save("a", "resp_1", &Conversation{Model: "m", Contents: []general.Content{{Role: general.RoleUser, Parts: []general.Part{{Text: &text}}}}})
+	conversation, ok := store.Get("a", "resp_1")
+	if !ok || len(conversation.Contents) != 1 || *conversation.Contents[0].Parts[0].Text != "hi" {
+		t.Fatalf("对话读取错误: %+v", conversation)
+	}
+	if _, ok := store.Get("b", "resp_1"); ok {
+		t.Fatal("其它调用方不能读取对话")
+	}
+}
+
+func TestStoreTtl(t *testing.T) {
+	store, _ := New(cache.Config{Ttl: time.Millisecond})
+	store.Save("a", "resp_1", &Conversation{})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := store.Get("a", "resp_1"); ok {
+		t.Fatal("过期的对话仍然可以引用")
+	}
+}
@@ -0,0 +1,359 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+// claude 服务端工具，code_execution 与 web_fetch 需要在路由请求头中配置对应的 anthropic-beta
+const (
+	claudeWebSearchType     = "web_search_20250305"
+	claudeWebSearchName     = "web_search"
+	claudeCodeExecutionType = "code_execution_20250825"
+	claudeCodeExecutionName = "code_execution"
+	claudeWebFetchType      = "web_fetch_20250910"
+	claudeWebFetchName      = "web_fetch"
+)
+
+// UnsupportedError 请求中的内容在目标协议中没有对应的功能，调用方按客户端协议返回 400
+type UnsupportedError struct {
+	Message string
+}
+
+func (e *UnsupportedError) Error() string {
+	return e.Message
+}
+
+func unsupported(format string, args ...any) *UnsupportedError {
+	return &UnsupportedError{Message: fmt.Sprintf(format, args...)}
+}
+
+// checkBuiltinTools openai chat completions 只有联网搜索，没有代码执行与网页读取；Responses API 没有网页读取；
+// completions 与 ollama 没有内置工具
+func checkBuiltinTools(dialect string, tools []general.Tool) error {
+	switch dialect {
+	case constant.DialectCompletions, constant.DialectOllama, constant.DialectOllamaGenerate:
+		for _, tool := range tools {
+			if isTrue(tool.WebSearch) || isTrue(tool.CodeExecution) || isTrue(tool.UrlContext) {
+				return unsupported("built-in tools are not supported by the upstream %s api", dialect)
+			}
+		}
+		return nil
+	}
+	if dialect == constant.DialectResponses {
+		for _, tool := range tools {
+			if isTrue(tool.UrlContext) {
+				return unsupported("url context tool is not supported by the upstream openai responses api")
+			}
+		}
+		return nil
+	}
+	if dialect != constant.DialectOpenAI {
+		return nil
+	}
+	for _, tool := range tools {
+		if isTrue(tool.CodeExecution) {
+			return unsupported("code execution tool is not supported by the upstream openai chat completions api")
+		}
+		if isTrue(tool.UrlContext) {
+			return unsupported("url context tool is not supported by the upstream openai chat completions api")
+		}
+	}
+	return nil
+}
+
+// openaiToolsError chat completions 中除 function 以外的工具在其它协议中没有对应
+func openaiToolsError(tools []openai.Tool) error {
+	for _, tool := range tools {
+		if tool.Type != "" && tool.Type != "function" {
+			return unsupported("tool type %s has no equivalent in the upstream dialect", tool.Type)
+		}
+	}
+	return nil
+}
+
+// claudeToolsError bash、text_editor、computer 等 claude 定义的工具在其它协议中没有对应
+func claudeToolsError(tools []claude.Tool) error {
+	for _, tool := range tools {
+		if claudeBuiltinTool(tool.Type) == nil && tool.Type != "" && tool.Type != "custom" {
+			return unsupported("tools.%s: tool type %s has no equivalent in the upstream dialect", tool.Name, tool.Type)
+		}
+	}
+	return nil
+}
+
+// claudeBuiltinTool 按类型前缀识别服务端工具，版本号不同的同类工具视为相同
+func claudeBuiltinTool(toolType string) *general.Tool {
+	switch {
+	case strings.HasPrefix(toolType, "web_search_"):
+		return &general.Tool{WebSearch: ptr(true)}
+	case strings.HasPrefix(toolType, "code_execution_"):
+		return &general.Tool{CodeExecution: ptr(true)}
+	case strings.HasPrefix(toolType, "web_fetch_"):
+		return &general.Tool{UrlContext: ptr(true)}
+	}
+	return nil
+}
+
+func generalBuiltinToolsToClaude(tools []general.Tool) []claude.Tool {
+	var result []claude.Tool
+	for _, tool := range tools {
+		if isTrue(tool.WebSearch) {
+			result = append(result, claude.Tool{Type: claudeWebSearchType, Name: claudeWebSearchName})
+		}
+		if isTrue(tool.CodeExecution) {
+			result = append(result, claude.Tool{Type: claudeCodeExecutionType, Name: claudeCodeExecutionName})
+		}
+		if isTrue(tool.UrlContext) {
+			result = append(result, claude.Tool{Type: claudeWebFetchType, Name: claudeWebFetchName})
+		}
+	}
+	return result
+}
+
+// generalBuiltinToolsToGemini 内置工具各自作为一个 tool
+func generalBuiltinToolsToGemini(tools []general.Tool) []gemini.Tool {
+	var result []gemini.Tool
+	for _, tool := range tools {
+		if isTrue(tool.WebSearch) {
+			result = append(result, gemini.Tool{GoogleSearch: &map[string]any{}})
+		}
+		if isTrue(tool.CodeExecution) {
+			result = append(result, gemini.Tool{CodeExecution: &map[string]any{}})
+		}
+		if isTrue(tool.UrlContext) {
+			result = append(result, gemini.Tool{UrlContext: &map[string]any{}})
+		}
+	}
+	return result
+}
+
+func hasWebSearch(tools []general.Tool) bool {
+	for _, tool := range tools {
+		if isTrue(tool.WebSearch) {
+			return true
+		}
+	}
+	return false
+}
+
+// claudeServerToolPart 代码执行的调用与结果转换为通用的代码块，其它服务端工具的过程不转换
+func claudeServerToolPart(block claude.ContentBlock) (general.Part, bool) {
+	switch block.Type {
+	case "server_tool_use":
+		if block.Input == nil {
+			return general.Part{}, false
+		}
+		input := *block.Input
+		switch block.Name {
+		case claudeCodeExecutionName:
+			code, _ := input["code"].(string)
+			return general.Part{ExecutableCode: &general.ExecutableCode{Language: "PYTHON", Code: code}}, true
+		case "bash_code_execution":
+			command, _ := input["command"].(string)
+			return general.Part{ExecutableCode: &general.ExecutableCode{Language: "BASH", Code: command}}, true
+		}
+	case "code_execution_tool_result", "bash_code_execution_tool_result":
+		if block.Content == nil || len(block.Content.Blocks) == 0 {
+			return general.Part{}, false
+		}
+		result := block.Content.Blocks[0]
+		outcome := "OUTCOME_OK"
+		if result.ReturnCode == nil || *result.ReturnCode != 0 {
+			outcome = "OUTCOME_FAILED"
+		}
+		return general.Part{CodeExecutionResult: &general.CodeExecutionResult{Outcome: outcome, Output: result.Stdout + result.Stderr}}, true
+	}
+	return general.Part{}, false
+}
+
+// geminiCitationsToGeneral groundingSupports 中的每个片段与来源对应一条引用，没有片段时来源作为没有位置的引用
+func geminiCitationsToGeneral(candidate gemini.Candidate) ([]general.Citation, []string) {
+	var citations []general.Citation
+	var queries []string
+	if grounding := candidate.GroundingMetadata; grounding != nil {
+		queries = grounding.WebSearchQueries
+		cited := map[int]bool{}
+		for _, support := range grounding.GroundingSupports {
+			for _, index := range support.GroundingChunkIndices {
+				if index < 0 || index >= len(grounding.GroundingChunks) || grounding.GroundingChunks[index].Web == nil {
+					continue
+				}
+				cited[index] = true
+				web := grounding.GroundingChunks[index].Web
+				citation := general.Citation{Uri: web.Uri, Title: web.Title}
+				if segment := support.Segment; segment != nil {
+					citation.StartIndex, citation.EndIndex, citation.Text = segment.StartIndex, segment.EndIndex, segment.Text
+					if citation.StartIndex == nil {
+						citation.StartIndex = ptr(0)
+					}
+				}
+				citations = append(citations, citation)
+			}
+		}
+		for index, chunk := range grounding.GroundingChunks {
+			if !cited[index] && chunk.Web != nil {
+				citations = append(citations, general.Citation{Uri: chunk.Web.Uri, Title: chunk.Web.Title})
+			}
+		}
+	}
+	if metadata := candidate.CitationMetadata; metadata != nil {
+		for _, source := range metadata.CitationSources {
+			citations = append(citations, general.Citation{
+				StartIndex: source.StartIndex,
+				EndIndex:   source.EndIndex,
+				Uri:        stringValue(source.Uri),
+			})
+		}
+	}
+	return citations, queries
+}
+
+// generalCitationsToGemini 相同的来源合并为一个 groundingChunk
+func generalCitationsToGemini(citations []general.Citation, queries []string) *gemini.GroundingMetadata {
+	if len(citations) == 0 && len(queries) == 0 {
+		return nil
+	}
+	metadata := &gemini.GroundingMetadata{WebSearchQueries: queries}
+	chunks := map[string]int{}
+	for _, citation := range citations {
+		index, ok := chunks[citation.Uri]
+		if !ok {
+			index = len(metadata.GroundingChunks)
+			chunks[citation.Uri] = index
+			metadata.GroundingChunks = append(metadata.GroundingChunks, gemini.GroundingChunk{
+				Web: &gemini.GroundingChunkWeb{Uri: citation.Uri, Title: citation.Title},
+			})
+		}
+		if citation.EndIndex != nil {
+			metadata.GroundingSupports = append(metadata.GroundingSupports, gemini.GroundingSupport{
+				Segment:               &gemini.Segment{StartIndex: citation.StartIndex, EndIndex: citation.EndIndex, Text: citation.Text},
+				GroundingChunkIndices: []int{index},
+			})
+		}
+	}
+	return metadata
+}
+
+// openaiAnnotationsToGeneral openai 的位置按字符计算，通用格式按字节
+func openaiAnnotationsToGeneral(annotations []openai.Annotation, text string) []general.Citation {
+	var citations []general.Citation
+	for _, annotation := range annotations {
+		citation := annotation.UrlCitation
+		if annotation.Type != "url_citation" || citation == nil {
+			continue
+		}
+		start, end := charToByteIndex(text, citation.StartIndex), charToByteIndex(text, citation.EndIndex)
+		result := general.Citation{Uri: citation.Url, Title: citation.Title, StartIndex: &start, EndIndex: &end}
+		if start <= end && end <= len(text) {
+			result.Text = text[start:end]
+		}
+		citations = append(citations, result)
+	}
+	return citations
+}
+
+// generalCitationsToOpenAI 没有位置的引用对应整个回答
+func generalCitationsToOpenAI(citations []general.Citation, text string) []openai.Annotation {
+	var annotations []openai.Annotation
+	for _, citation := range citations {
+		start, end := 0, utf8.RuneCountInString(text)
+		if citation.EndIndex != nil {
+			start, end = byteToCharIndex(text, intValue(citation.StartIndex)), byteToCharIndex(text, *citation.EndIndex)
+		}
+		annotations = append(annotations, openai.Annotation{
+			Type:        "url_citation",
+			UrlCitation: &openai.UrlCitation{StartIndex: start, EndIndex: end, Url: citation.Uri, Title: citation.Title},
+		})
+	}
+	return annotations
+}
+
+// claudeCitationsToGeneral 引用挂在 text 块上，位置为该块在回答文本中的范围
+func claudeCitationsToGeneral(blocks []claude.ContentBlock) []general.Citation {
+	var citations []general.Citation
+	offset := 0
+	for _, block := range blocks {
+		if block.Type != "text" {
+			continue
+		}
+		start, end := offset, offset+len(block.Text)
+		offset = end
+		for _, citation := range block.Citations {
+			if citation.Url == "" {
+				continue
+			}
+			citations = append(citations, general.Citation{
+				StartIndex: ptr(start),
+				EndIndex:   ptr(end),
+				Uri:        citation.Url,
+				Title:      citation.Title,
+				Text:       block.Text,
+			})
+		}
+	}
+	return citations
+}
+
+// attachClaudeCitations 引用挂到范围所在的 text 块上，没有位置时挂到最后一个 text 块
+func attachClaudeCitations(blocks []claude.ContentBlock, citations []general.Citation) {
+	last := -1
+	offset := 0
+	var ranges [][2]int
+	for i, block := range blocks {
+		if block.Type == "text" {
+			last = i
+		}
+		ranges = append(ranges, [2]int{offset, offset + len(block.Text)})
+		if block.Type == "text" {
+			offset += len(block.Text)
+		}
+	}
+	for _, citation := range citations {
+		target := last
+		if citation.StartIndex != nil {
+			for i, block := range blocks {
+				if block.Type == "text" && *citation.StartIndex >= ranges[i][0] && *citation.StartIndex < ranges[i][1] {
+					target = i
+					break
+				}
+			}
+		}
+		if target < 0 {
+			continue
+		}
+		blocks[target].Citations = append(blocks[target].Citations, claudeCitation(citation))
+	}
+}
+
+func claudeCitation(citation general.Citation) claude.Citation {
+	return claude.Citation{Type: "web_search_result_location", Url: citation.Uri, Title: citation.Title, CitedText: citation.Text}
+}
+
+func charToByteIndex(text string, index int) int {
+	for i := range text {
+		if index == 0 {
+			return i
+		}
+		index--
+	}
+	return len(text)
+}
+
+func byteToCharIndex(text string, index int) int {
+	if index > len(text) {
+		index = len(text)
+	}
+	return utf8.RuneCountInString(text[:max(index, 0)])
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
@@ -0,0 +1,496 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+const (
+	claudeRoleUser      = "user"
+	claudeRoleAssistant = "assistant"
+	// claude 必须指定 max_tokens，通用请求未设置时使用
+	claudeDefaultMaxTokens = 4096
+	// 结构化输出通过强制调用该工具模拟，工具参数即为输出内容
+	claudeStructuredTool = "structured_output"
+	// schema 根节点不是对象时包装在 value 属性中
+	claudeStructuredValueTool = "structured_output_value"
+	claudeStructuredPrompt    = "Respond only by calling the " + claudeStructuredTool + " tool with the final answer."
+)
+
+func ClaudeRequestToGeneral(req *claude.Request) *general.Request {
+	result := &general.Request{
+		Stream: req.Stream,
+		Model:  req.Model,
+		Tools:  claudeToolsToGeneral(req.Tools),
+	}
+	result.ToolConfig = claudeToolChoiceToGeneral(req.ToolChoice)
+	if req.System != nil {
+		result.SystemInstruction = &general.Content{
+			Role:  general.RoleSystem,
+			Parts: claudeContentToGeneral(*req.System, nil),
+		}
+	}
+	toolNames := map[string]string{}
+	for _, message := range req.Messages {
+		content := general.Content{Role: general.RoleUser}
+		if message.Role == claudeRoleAssistant {
+			content.Role = general.RoleAssistant
+		}
+		content.Parts = claudeContentToGeneral(message.Content, toolNames)
+		result.Contents = append(result.Contents, content)
+	}
+	config := &general.GenerationConfig{
+		StopSequences: req.StopSequences,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		TopK:          req.TopK,
+	}
+	if req.MaxTokens > 0 {
+		maxTokens := req.MaxTokens
+		config.MaxOutputTokens = &maxTokens
+	}
+	if thinking := req.Thinking; thinking != nil {
+		if thinking.Type == "enabled" {
+			config.Reasoning = &general.ReasoningConfig{BudgetTokens: ptr(thinking.BudgetTokens), IncludeThoughts: ptr(true)}
+		} else if thinking.Type == "disabled" {
+			config.Reasoning = &general.ReasoningConfig{Effort: general.ReasoningEffortNone, BudgetTokens: ptr(0)}
+		}
+	}
+	if format := req.OutputFormat; format != nil && format.Type == general.ResponseFormatJsonSchema {
+		config.ResponseFormat = &general.ResponseFormat{Type: general.ResponseFormatJsonSchema, Schema: format.Schema}
+	}
+	result.GenerationConfig = emptyGenerationConfig(config)
+	return result
+}
+
+func GeneralRequestToClaude(req *general.Request) *claude.Request {
+	result := &claude.Request{
+		Model:     req.Model,
+		Stream:    req.Stream,
+		MaxTokens: claudeDefaultMaxTokens,
+		Tools:     generalToolsToClaude(req.Tools),
+	}
+	if req.SystemInstruction != nil {
+		text := partsText(req.SystemInstruction.Parts)
+		result.System = &claude.MessageContent{Text: &text}
+	}
+	for _, content := range req.Contents {
+		role := claudeRoleUser
+		if content.Role == general.RoleAssistant {
+			role = claudeRoleAssistant
+		}
+		blocks := generalContentToClaude(content, false)
+		// claude 要求 user/assistant 交替出现，相同角色合并
+		if last := len(result.Messages) - 1; last >= 0 && result.Messages[last].Role == role {
+			result.Messages[last].Content.Blocks = append(result.Messages[last].Content.Blocks, blocks...)
+			continue
+		}
+		result.Messages = append(result.Messages, claude.Message{Role: role, Content: claude.MessageContent{Blocks: blocks}})
+	}
+	if config := req.GenerationConfig; config != nil {
+		result.StopSequences = config.StopSequences
+		result.Temperature = config.Temperature
+		result.TopP = config.TopP
+		result.TopK = config.TopK
+		if config.MaxOutputTokens != nil {
+			result.MaxTokens = *config.MaxOutputTokens
+		}
+		generalReasoningToClaude(config.Reasoning, result)
+	}
+	generalToolConfigToClaude(req.ToolConfig, result)
+	if config := req.GenerationConfig; config != nil {
+		generalResponseFormatToClaude(config.ResponseFormat, result)
+	}
+	return result
+}
+
+// generalResponseFormatToClaude 使用强制工具调用模拟结构化输出
+// 开启思考时 claude 不允许强制工具调用，改为在 system 中要求调用
+func generalResponseFormatToClaude(format *general.ResponseFormat, req *claude.Request) {
+	if format == nil || format.Type == general.ResponseFormatText {
+		return
+	}
+	schema := map[string]any{"type": "object"}
+	if format.Type == general.ResponseFormatJsonSchema && format.Schema != nil {
+		schema = NormalizeSchema(constant.DialectClaude, format.Schema, false)
+	}
+	name := claudeStructuredTool
+	if !isObjectSchema(schema) {
+		name = claudeStructuredValueTool
+		schema = map[string]any{"type": "object", "properties": map[string]any{"value": schema}, "required": []string{"value"}}
+	}
+	description := format.Description
+	if description == "" {
+		description = "Return the final answer as the input of this tool."
+	}
+	req.Tools = append(req.Tools, claude.Tool{Name: name, Description: description, InputSchema: &schema})
+	if req.Thinking == nil {
+		req.ToolChoice = &claude.ToolChoice{Type: "tool", Name: name}
+		return
+	}
+	prompt := strings.ReplaceAll(claudeStructuredPrompt, claudeStructuredTool, name)
+	switch {
+	case req.System == nil:
+		req.System = &claude.MessageContent{Text: &prompt}
+	case req.System.Text != nil:
+		text := *req.System.Text + "\n\n" + prompt
+		req.System.Text = &text
+	default:
+		req.System.Blocks = append(req.System.Blocks, claude.ContentBlock{Type: "text", Text: prompt})
+	}
+}
+
+// structuredOutputParts 结构化输出工具的调用转换为文本
+func structuredOutputParts(parts []general.Part) []general.Part {
+	for i, part := range parts {
+		if text, ok := structuredOutputText(part.FunctionCall); ok {
+			parts[i] = textPart(text)
+		}
+	}
+	return parts
+}
+
+func structuredOutputText(call *general.FunctionCall) (string, bool) {
+	if call == nil {
+		return "", false
+	}
+	switch call.Name {
+	case claudeStructuredTool:
+		return marshalArguments(call.Args), true
+	case claudeStructuredValueTool:
+		data, _ := json.Marshal(call.Args["value"])
+		return string(data), true
+	}
+	return "", false
+}
+
+// generalReasoningToClaude 开启思考时 max_tokens 必须大于 budget_tokens，且不能调整 temperature、top_k
+func generalReasoningToClaude(reasoning *general.ReasoningConfig, req *claude.Request) {
+	budget, ok := reasoningBudget(reasoning)
+	if !ok {
+		if reasoning == nil || reasoning.IncludeThoughts == nil || !*reasoning.IncludeThoughts {
+			return
+		}
+		budget = -1
+	}
+	if budget == 0 {
+		return
+	}
+	if budget < 0 {
+		budget = reasoningBudgets[general.ReasoningEffortMedium]
+	}
+	budget = max(budget, claudeMinThinkingBudget)
+	req.Thinking = &claude.Thinking{Type: "enabled", BudgetTokens: budget}
+	if req.MaxTokens <= budget {
+		req.MaxTokens = budget + claudeDefaultMaxTokens
+	}
+	req.Temperature = nil
+	req.TopK = nil
+	if req.TopP != nil && *req.TopP < 0.95 {
+		req.TopP = nil
+	}
+}
+
+func claudeContentToGeneral(content claude.MessageContent, toolNames map[string]string) []general.Part {
+	if content.Text != nil {
+		return []general.Part{{Text: content.Text}}
+	}
+	var parts []general.Part
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "text":
+			text := block.Text
+			parts = append(parts, general.Part{Text: &text})
+		case "thinking":
+			parts = append(parts, thoughtPart(block.Thinking, block.Signature))
+		case "redacted_thinking":
+			parts = append(parts, thoughtPart("", block.Data))
+		case "image", "document":
+			if part, ok := claudeSourceToGeneral(block); ok {
+				parts = append(parts, part)
+			}
+		case "tool_use":
+			if toolNames != nil {
+				toolNames[block.Id] = block.Name
+			}
+			var args map[string]any
+			if block.Input != nil {
+				args = *block.Input
+			}
+			parts = append(parts, general.Part{FunctionCall: &general.FunctionCall{Id: block.Id, Name: block.Name, Args: args}})
+		case "server_tool_use", "code_execution_tool_result", "bash_code_execution_tool_result":
+			if part, ok := claudeServerToolPart(block); ok {
+				parts = append(parts, part)
+			}
+		case "tool_result":
+			var text string
+			if block.Content != nil {
+				text = partsText(claudeContentToGeneral(*block.Content, nil))
+			}
+			response := general.FunctionResponseContent{Output: &text}
+			if block.IsError != nil && *block.IsError {
+				response = general.FunctionResponseContent{Error: &text}
+			}
+			parts = append(parts, general.Part{FunctionResponse: &general.FunctionResponse{
+				Id:       block.ToolUseId,
+				Name:     toolNames[block.ToolUseId],
+				Response: response,
+			}})
+		}
+	}
+	return parts
+}
+
+// generalContentToClaude 请求中没有签名的思考内容无法通过 claude 校验，只在响应中保留
+func generalContentToClaude(content general.Content, response bool) []claude.ContentBlock {
+	// tool_result 必须位于消息开头，其次是思考内容
+	var results, thinking, blocks []claude.ContentBlock
+	for _, part := range content.Parts {
+		if part.FunctionResponse != nil {
+			block := claude.ContentBlock{
+				Type:      "tool_result",
+				ToolUseId: toolCallId(part.FunctionResponse.Id),
+				Content:   &claude.MessageContent{Text: functionResponseText(part.FunctionResponse)},
+			}
+			if part.FunctionResponse.Response.Error != nil {
+				isError := true
+				block.IsError = &isError
+			}
+			results = append(results, block)
+			continue
+		}
+		if isThought(part) {
+			if block, ok := claudeThinkingBlock(part, response); ok {
+				thinking = append(thinking, block)
+			}
+			continue
+		}
+		if part.Text != nil && *part.Text != "" {
+			blocks = append(blocks, claude.ContentBlock{Type: "text", Text: *part.Text})
+		}
+		if text, ok := codeText(part); ok {
+			blocks = append(blocks, claude.ContentBlock{Type: "text", Text: text})
+		}
+		if block, ok := generalMediaToClaude(part); ok {
+			blocks = append(blocks, block)
+		}
+		if part.FunctionCall != nil {
+			input := part.FunctionCall.Args
+			if input == nil {
+				input = map[string]any{}
+			}
+			blocks = append(blocks, claude.ContentBlock{
+				Type:  "tool_use",
+				Id:    toolCallId(part.FunctionCall.Id),
+				Name:  part.FunctionCall.Name,
+				Input: &input,
+			})
+		}
+	}
+	return append(append(results, thinking...), blocks...)
+}
+
+// claudeThinkingBlock 只有签名没有内容的思考对应 redacted_thinking
+func claudeThinkingBlock(part general.Part, keepUnsigned bool) (claude.ContentBlock, bool) {
+	signature := stringValue(part.ThoughtSignature)
+	if signature == "" && !keepUnsigned {
+		return claude.ContentBlock{}, false
+	}
+	if part.Text == nil {
+		if signature == "" {
+			return claude.ContentBlock{}, false
+		}
+		return claude.ContentBlock{Type: "redacted_thinking", Data: signature}, true
+	}
+	return claude.ContentBlock{Type: "thinking", Thinking: *part.Text, Signature: signature}, true
+}
+
+// claudeSourceToGeneral image、document 块，text 类型的文档直接作为文本
+func claudeSourceToGeneral(block claude.ContentBlock) (general.Part, bool) {
+	source := block.Source
+	if source == nil {
+		return general.Part{}, false
+	}
+	switch source.Type {
+	case "base64":
+		return general.Part{InlineData: &general.Blob{MimeType: source.MediaType, Data: source.Data}}, true
+	case "url":
+		def := defaultImageMimeType
+		if block.Type == "document" {
+			def = "application/pdf"
+		}
+		return general.Part{FileData: &general.FileData{MimeType: guessMimeType(source.Url, def), FileUri: source.Url}}, true
+	case "text":
+		text := source.Data
+		return general.Part{Text: &text}, true
+	}
+	return general.Part{}, false
+}
+
+// generalMediaToClaude claude 只支持图片与 pdf/纯文本文档
+func generalMediaToClaude(part general.Part) (claude.ContentBlock, bool) {
+	if blob := part.InlineData; blob != nil {
+		switch {
+		case isImage(blob.MimeType):
+			return claude.ContentBlock{Type: "image", Source: &claude.Source{Type: "base64", MediaType: blob.MimeType, Data: blob.Data}}, true
+		case blob.MimeType == "application/pdf":
+			return claude.ContentBlock{Type: "document", Source: &claude.Source{Type: "base64", MediaType: blob.MimeType, Data: blob.Data}}, true
+		case strings.HasPrefix(blob.MimeType, "text/"):
+			return claude.ContentBlock{Type: "document", Source: &claude.Source{
+				Type:      "text",
+				MediaType: "text/plain",
+				Data:      decodeBase64Text(blob.Data),
+			}}, true
+		}
+	}
+	if file := part.FileData; file != nil && isHttpUrl(file.FileUri) {
+		switch {
+		case isImage(file.MimeType):
+			return claude.ContentBlock{Type: "image", Source: &claude.Source{Type: "url", Url: file.FileUri}}, true
+		case file.MimeType == "application/pdf":
+			return claude.ContentBlock{Type: "document", Source: &claude.Source{Type: "url", Url: file.FileUri}}, true
+		}
+	}
+	return claude.ContentBlock{}, false
+}
+
+func claudeToolsToGeneral(tools []claude.Tool) []general.Tool {
+	var declarations []general.FunctionDeclaration
+	var builtins []general.Tool
+	for _, tool := range tools {
+		if builtin := claudeBuiltinTool(tool.Type); builtin != nil {
+			builtins = append(builtins, *builtin)
+			continue
+		}
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		declaration := general.FunctionDeclaration{Name: tool.Name, Description: tool.Description}
+		if tool.InputSchema != nil {
+			declaration.Parameters = *tool.InputSchema
+		}
+		declarations = append(declarations, declaration)
+	}
+	if len(declarations) == 0 {
+		return builtins
+	}
+	return append([]general.Tool{{FunctionDeclarations: declarations}}, builtins...)
+}
+
+func generalToolsToClaude(tools []general.Tool) []claude.Tool {
+	var result []claude.Tool
+	for _, tool := range tools {
+		for _, fd := range tool.FunctionDeclarations {
+			schema, _ := ToolSchema(constant.DialectClaude, fd.Parameters)
+			result = append(result, claude.Tool{Name: fd.Name, Description: fd.Description, InputSchema: &schema})
+		}
+	}
+	return append(result, generalBuiltinToolsToClaude(tools)...)
+}
+
+func ClaudeResponseToGeneral(resp *claude.Response) *general.Response {
+	content := general.Content{
+		Role:  general.RoleAssistant,
+		Parts: structuredOutputParts(claudeContentToGeneral(claude.MessageContent{Blocks: resp.Content}, nil)),
+	}
+	candidate := general.Candidate{Content: &content, Citations: claudeCitationsToGeneral(resp.Content)}
+	if resp.StopReason != nil {
+		candidate.FinishReason = claudeStopReasonToGeneral(*resp.StopReason)
+		// 只调用了结构化输出工具时视为正常结束
+		if candidate.FinishReason == general.FinishReasonToolCalls && !hasFunctionCall(content.Parts) {
+			candidate.FinishReason = general.FinishReasonStop
+		}
+	}
+	result := &general.Response{Id: resp.Id, Model: resp.Model, Candidates: []general.Candidate{candidate}}
+	if resp.Usage != nil {
+		result.Usage = claudeUsageToGeneral(resp.Usage)
+	}
+	return result
+}
+
+func GeneralResponseToClaude(resp *general.Response) *claude.Response {
+	result := &claude.Response{
+		Id:      resp.Id,
+		Type:    "message",
+		Role:    claudeRoleAssistant,
+		Model:   resp.Model,
+		Content: []claude.ContentBlock{},
+	}
+	if result.Id == "" {
+		result.Id = newId("msg_")
+	}
+	// claude 只有一个候选
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		if candidate.Content != nil {
+			result.Content = append(result.Content, generalContentToClaude(*candidate.Content, true)...)
+		}
+		attachClaudeCitations(result.Content, candidate.Citations)
+		stopReason := generalFinishReasonToClaude(candidate.FinishReason, hasToolUse(result.Content))
+		result.StopReason = &stopReason
+	}
+	result.Usage = generalUsageToClaude(resp.Usage)
+	return result
+}
+
+func claudeStopReasonToGeneral(reason string) string {
+	switch reason {
+	case "max_tokens", "model_context_window_exceeded":
+		return general.FinishReasonLength
+	case "tool_use":
+		return general.FinishReasonToolCalls
+	case "refusal":
+		return general.FinishReasonContentFilter
+	}
+	return general.FinishReasonStop
+}
+
+func generalFinishReasonToClaude(reason string, toolUse bool) string {
+	switch reason {
+	case general.FinishReasonLength:
+		return "max_tokens"
+	case general.FinishReasonContentFilter:
+		return "refusal"
+	case general.FinishReasonToolCalls:
+		return "tool_use"
+	}
+	if toolUse {
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+func hasToolUse(blocks []claude.ContentBlock) bool {
+	for _, block := range blocks {
+		if block.Type == "tool_use" {
+			return true
+		}
+	}
+	return false
+}
+
+// claudeUsageToGeneral claude 的 input_tokens 不包含缓存命中与写入的部分
+func claudeUsageToGeneral(usage *claude.Usage) *general.Usage {
+	promptTokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	return &general.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+		CachedTokens:     usage.CacheReadInputTokens,
+	}
+}
+
+func generalUsageToClaude(usage *general.Usage) *claude.Usage {
+	if usage == nil {
+		return &claude.Usage{}
+	}
+	return &claude.Usage{
+		InputTokens:          usage.PromptTokens - usage.CachedTokens,
+		OutputTokens:         usage.CompletionTokens,
+		CacheReadInputTokens: usage.CachedTokens,
+	}
+}
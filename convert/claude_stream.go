@@ -0,0 +1,360 @@
+package convert
+
+import (
+	"encoding/json"
+
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// claudeStreamDecoder tool_use 的参数通过 input_json_delta 分片到达，content_block_stop 时整体输出
+type claudeStreamDecoder struct {
+	id        string
+	model     string
+	usage     general.Usage
+	toolCalls *toolCallAssembler
+	// 服务端工具调用所在的块，参数与函数调用一样分片到达
+	serverTools map[int]bool
+	// 是否有结构化输出工具以外的函数调用
+	toolUse bool
+}
+
+func (d *claudeStreamDecoder) Decode(event sse.Event) ([]*general.Response, error) {
+	var streamEvent claude.StreamEvent
+	if err := json.Unmarshal([]byte(event.Data), &streamEvent); err != nil {
+		return nil, err
+	}
+	index := intValue(streamEvent.Index)
+	key := toolCallKey{index: index}
+	switch streamEvent.Type {
+	case "message_start":
+		if message := streamEvent.Message; message != nil {
+			d.id, d.model = message.Id, message.Model
+			if message.Usage != nil {
+				d.usage = *claudeUsageToGeneral(message.Usage)
+			}
+		}
+		usage := d.usage
+		return []*general.Response{{Id: d.id, Model: d.model, Usage: &usage}}, nil
+	case "content_block_start":
+		block := streamEvent.ContentBlock
+		if block == nil {
+			return nil, nil
+		}
+		switch block.Type {
+		case "tool_use", "server_tool_use":
+			var input map[string]any
+			if block.Input != nil && len(*block.Input) > 0 {
+				input = *block.Input
+			}
+			d.toolCalls.start(key, block.Id, block.Name, input)
+			if block.Type == "server_tool_use" {
+				d.serverTools[index] = true
+			}
+		case "code_execution_tool_result", "bash_code_execution_tool_result":
+			if part, ok := claudeServerToolPart(*block); ok {
+				return d.delta([]general.Part{part}, ""), nil
+			}
+		case "text":
+			if block.Text != "" {
+				return d.delta([]general.Part{textPart(block.Text)}, ""), nil
+			}
+		case "thinking":
+			if block.Thinking != "" {
+				return d.delta([]general.Part{thoughtPart(block.Thinking, "")}, ""), nil
+			}
+		case "redacted_thinking":
+			return d.delta([]general.Part{thoughtPart("", block.Data)}, ""), nil
+		}
+	case "content_block_delta":
+		delta := streamEvent.Delta
+		if delta == nil {
+			return nil, nil
+		}
+		switch delta.Type {
+		case "text_delta":
+			return d.delta([]general.Part{textPart(delta.Text)}, ""), nil
+		case "input_json_delta":
+			// 结构化输出的参数直接作为文本输出
+			if call, ok := d.toolCalls.get(key); ok && call.Name == claudeStructuredTool {
+				if delta.PartialJson == "" {
+					return nil, nil
+				}
+				return d.delta([]general.Part{textPart(delta.PartialJson)}, ""), nil
+			}
+			if _, ok := d.toolCalls.get(key); ok {
+				d.toolCalls.add(key, "", "", delta.PartialJson)
+			}
+		case "citations_delta":
+			if citation := delta.Citation; citation != nil && citation.Url != "" {
+				resps := d.delta(nil, "")
+				resps[0].Candidates[0].Citations = []general.Citation{{Uri: citation.Url, Title: citation.Title, Text: citation.CitedText}}
+				return resps, nil
+			}
+		case "thinking_delta":
+			return d.delta([]general.Part{thoughtPart(delta.Thinking, "")}, ""), nil
+		case "signature_delta":
+			return d.delta([]general.Part{thoughtPart("", delta.Signature)}, ""), nil
+		}
+	case "content_block_stop":
+		if call, ok := d.toolCalls.done(key); ok {
+			if d.serverTools[index] {
+				delete(d.serverTools, index)
+				args := call.Args
+				if part, ok := claudeServerToolPart(claude.ContentBlock{Type: "server_tool_use", Name: call.Name, Input: &args}); ok {
+					return d.delta([]general.Part{part}, ""), nil
+				}
+				return nil, nil
+			}
+			return d.toolCall(call), nil
+		}
+	case "message_delta":
+		if usage := streamEvent.Usage; usage != nil {
+			if usage.InputTokens != nil {
+				d.usage.PromptTokens = *usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+				d.usage.CachedTokens = usage.CacheReadInputTokens
+			}
+			d.usage.CompletionTokens = usage.OutputTokens
+			d.usage.TotalTokens = d.usage.PromptTokens + d.usage.CompletionTokens
+		}
+		var finishReason string
+		if streamEvent.Delta != nil && streamEvent.Delta.StopReason != nil {
+			finishReason = claudeStopReasonToGeneral(*streamEvent.Delta.StopReason)
+			if finishReason == general.FinishReasonToolCalls && !d.toolUse {
+				finishReason = general.FinishReasonStop
+			}
+		}
+		resps := d.delta(nil, finishReason)
+		usage := d.usage
+		resps[0].Usage = &usage
+		return resps, nil
+	case "error":
+		message := "upstream stream error"
+		if streamEvent.Error != nil {
+			message = streamEvent.Error.Message
+		}
+		return nil, &UpstreamError{Message: message}
+	}
+	return nil, nil
+}
+
+func (d *claudeStreamDecoder) toolCall(call *general.FunctionCall) []*general.Response {
+	if call.Name == claudeStructuredTool {
+		return nil
+	}
+	if text, ok := structuredOutputText(call); ok {
+		return d.delta([]general.Part{textPart(text)}, "")
+	}
+	d.toolUse = true
+	return d.delta([]general.Part{{FunctionCall: call}}, "")
+}
+
+// Finish 上游没有发送 content_block_stop 就结束时输出已收到的调用
+func (d *claudeStreamDecoder) Finish() []*general.Response {
+	var resps []*general.Response
+	for _, part := range d.toolCalls.flush(0) {
+		resps = append(resps, d.toolCall(part.FunctionCall)...)
+	}
+	return resps
+}
+
+func (d *claudeStreamDecoder) delta(parts []general.Part, finishReason string) []*general.Response {
+	return []*general.Response{deltaResponse(d.id, d.model, parts, finishReason)}
+}
+
+// claudeStreamEncoder 按 message_start、content_block_*、message_delta、message_stop 的顺序输出
+// 连续的文本、思考内容分别合并在同一个块中，函数调用与媒体各占一个块
+type claudeStreamEncoder struct {
+	id      string
+	model   string
+	started bool
+	index   int
+	// 当前未结束的块类型 text、thinking
+	open       string
+	toolUse    bool
+	stopReason string
+	usage      general.Usage
+}
+
+func (e *claudeStreamEncoder) Encode(resp *general.Response) []sse.Event {
+	if resp.Usage != nil {
+		e.usage = *resp.Usage
+	}
+	if e.id == "" {
+		e.id = resp.Id
+	}
+	if resp.Model != "" && !e.started {
+		e.model = resp.Model
+	}
+	var events []sse.Event
+	// claude 只有一个候选
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	candidate := resp.Candidates[0]
+	events = append(events, e.start()...)
+	if candidate.Content != nil {
+		for _, part := range candidate.Content.Parts {
+			events = append(events, e.part(part)...)
+		}
+	}
+	// 引用只能出现在 text 块中
+	for _, citation := range candidate.Citations {
+		events = append(events, e.openBlock("text")...)
+		events = append(events, e.event(claude.StreamEvent{
+			Type:  "content_block_delta",
+			Index: ptr(e.index),
+			Delta: &claude.StreamDelta{Type: "citations_delta", Citation: ptr(claudeCitation(citation))},
+		}))
+	}
+	if candidate.FinishReason != "" {
+		e.stopReason = candidate.FinishReason
+	}
+	return events
+}
+
+func (e *claudeStreamEncoder) start() []sse.Event {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	if e.id == "" {
+		e.id = newId("msg_")
+	}
+	usage := generalUsageToClaude(&e.usage)
+	usage.OutputTokens = 0
+	return []sse.Event{e.event(claude.StreamEvent{
+		Type: "message_start",
+		Message: &claude.Response{
+			Id:      e.id,
+			Type:    "message",
+			Role:    claudeRoleAssistant,
+			Model:   e.model,
+			Content: []claude.ContentBlock{},
+			Usage:   usage,
+		},
+	})}
+}
+
+func (e *claudeStreamEncoder) part(part general.Part) []sse.Event {
+	if isThought(part) {
+		return e.thought(part)
+	}
+	text := ""
+	if part.Text != nil {
+		text = *part.Text
+	} else if code, ok := codeText(part); ok {
+		text = code
+	}
+	if text != "" {
+		events := e.openBlock("text")
+		return append(events, e.event(claude.StreamEvent{
+			Type:  "content_block_delta",
+			Index: ptr(e.index),
+			Delta: &claude.StreamDelta{Type: "text_delta", Text: text},
+		}))
+	}
+	if call := part.FunctionCall; call != nil {
+		e.toolUse = true
+		events := e.closeBlock()
+		events = append(events, e.event(claude.StreamEvent{
+			Type:  "content_block_start",
+			Index: ptr(e.index),
+			ContentBlock: &claude.ContentBlock{
+				Type:  "tool_use",
+				Id:    toolCallId(call.Id),
+				Name:  call.Name,
+				Input: &map[string]any{},
+			},
+		}), e.event(claude.StreamEvent{
+			Type:  "content_block_delta",
+			Index: ptr(e.index),
+			Delta: &claude.StreamDelta{Type: "input_json_delta", PartialJson: marshalArguments(call.Args)},
+		}))
+		return append(events, e.stopBlock())
+	}
+	if block, ok := generalMediaToClaude(part); ok {
+		events := e.closeBlock()
+		events = append(events, e.event(claude.StreamEvent{Type: "content_block_start", Index: ptr(e.index), ContentBlock: &block}))
+		return append(events, e.stopBlock())
+	}
+	return nil
+}
+
+// thought 签名在思考内容之后到达，输出签名后结束 thinking 块
+func (e *claudeStreamEncoder) thought(part general.Part) []sse.Event {
+	var events []sse.Event
+	if part.Text != nil && *part.Text != "" {
+		events = append(events, e.openBlock("thinking")...)
+		events = append(events, e.event(claude.StreamEvent{
+			Type:  "content_block_delta",
+			Index: ptr(e.index),
+			Delta: &claude.StreamDelta{Type: "thinking_delta", Thinking: *part.Text},
+		}))
+	}
+	if signature := stringValue(part.ThoughtSignature); signature != "" {
+		events = append(events, e.openBlock("thinking")...)
+		events = append(events, e.event(claude.StreamEvent{
+			Type:  "content_block_delta",
+			Index: ptr(e.index),
+			Delta: &claude.StreamDelta{Type: "signature_delta", Signature: signature},
+		}))
+		events = append(events, e.closeBlock()...)
+	}
+	return events
+}
+
+// openBlock 当前块类型不同时先结束当前块
+func (e *claudeStreamEncoder) openBlock(blockType string) []sse.Event {
+	if e.open == blockType {
+		return nil
+	}
+	events := e.closeBlock()
+	e.open = blockType
+	return append(events, e.event(claude.StreamEvent{
+		Type:         "content_block_start",
+		Index:        ptr(e.index),
+		ContentBlock: &claude.ContentBlock{Type: blockType},
+	}))
+}
+
+func (e *claudeStreamEncoder) closeBlock() []sse.Event {
+	if e.open == "" {
+		return nil
+	}
+	e.open = ""
+	return []sse.Event{e.stopBlock()}
+}
+
+func (e *claudeStreamEncoder) stopBlock() sse.Event {
+	event := e.event(claude.StreamEvent{Type: "content_block_stop", Index: ptr(e.index)})
+	e.index++
+	return event
+}
+
+func (e *claudeStreamEncoder) Finish() []sse.Event {
+	events := e.start()
+	events = append(events, e.closeBlock()...)
+	stopReason := generalFinishReasonToClaude(e.stopReason, e.toolUse)
+	events = append(events, e.event(claude.StreamEvent{
+		Type:  "message_delta",
+		Delta: &claude.StreamDelta{StopReason: &stopReason},
+		Usage: e.deltaUsage(),
+	}))
+	return append(events, e.event(claude.StreamEvent{Type: "message_stop"}))
+}
+
+// deltaUsage 上游流的用量通常在最后到达，message_start 中的输入 token 为 0，这里带上实际的值
+func (e *claudeStreamEncoder) deltaUsage() *claude.DeltaUsage {
+	usage := &claude.DeltaUsage{OutputTokens: e.usage.CompletionTokens}
+	if e.usage.PromptTokens > 0 {
+		usage.InputTokens = ptr(e.usage.PromptTokens - e.usage.CachedTokens)
+		usage.CacheReadInputTokens = e.usage.CachedTokens
+	}
+	return usage
+}
+
+func (e *claudeStreamEncoder) event(streamEvent claude.StreamEvent) sse.Event {
+	return jsonEvent(streamEvent.Type, streamEvent)
+}
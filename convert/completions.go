@@ -0,0 +1,160 @@
+package convert
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+// completionsRequestError 多个 prompt、echo、suffix 在对话接口中没有对应
+func completionsRequestError(req *openai.CompletionRequest) error {
+	switch {
+	case len(req.Prompt) > 1:
+		return unsupported("multiple prompts are not supported when converting completions")
+	case req.Echo:
+		return unsupported("echo is not supported when converting completions")
+	case req.Suffix != "":
+		return unsupported("suffix is not supported when converting completions")
+	}
+	return nil
+}
+
+// CompletionsRequestToGeneral prompt 作为一条 user 消息
+func CompletionsRequestToGeneral(req *openai.CompletionRequest) *general.Request {
+	result := &general.Request{Stream: req.Stream, Model: req.Model}
+	prompt := ""
+	if len(req.Prompt) > 0 {
+		prompt = req.Prompt[0]
+	}
+	result.Contents = []general.Content{{Role: general.RoleUser, Parts: []general.Part{textPart(prompt)}}}
+	result.GenerationConfig = emptyGenerationConfig(&general.GenerationConfig{
+		StopSequences:    req.Stop,
+		MaxOutputTokens:  req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Logprobs:         req.Logprobs,
+		CandidateCount:   req.N,
+		Seed:             req.Seed,
+	})
+	return result
+}
+
+// generalCompletionsError completions 只能输入文本，没有工具与结构化输出
+func generalCompletionsError(dialect string, req *general.Request) error {
+	for _, tool := range req.Tools {
+		if len(tool.FunctionDeclarations) > 0 {
+			return unsupported("tools are not supported by the upstream %s api", dialect)
+		}
+	}
+	if config := req.GenerationConfig; config != nil && config.ResponseFormat != nil && config.ResponseFormat.Type != general.ResponseFormatText {
+		return unsupported("structured output is not supported by the upstream %s api", dialect)
+	}
+	for _, content := range req.Contents {
+		for _, part := range content.Parts {
+			if part.InlineData != nil || part.FileData != nil || part.FunctionCall != nil || part.FunctionResponse != nil {
+				return unsupported("only text input is supported by the upstream %s api", dialect)
+			}
+		}
+	}
+	return nil
+}
+
+// GeneralRequestToCompletions 对话转换为单个 prompt
+func GeneralRequestToCompletions(req *general.Request) *openai.CompletionRequest {
+	result := &openai.CompletionRequest{
+		Model:  req.Model,
+		Prompt: openai.StringOrArray{generalPromptText(req)},
+		Stream: req.Stream,
+	}
+	if req.Stream {
+		result.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if config := req.GenerationConfig; config != nil {
+		result.Stop = config.StopSequences
+		result.MaxTokens = config.MaxOutputTokens
+		result.Temperature = config.Temperature
+		result.TopP = config.TopP
+		result.PresencePenalty = config.PresencePenalty
+		result.FrequencyPenalty = config.FrequencyPenalty
+		result.Logprobs = config.Logprobs
+		result.N = config.CandidateCount
+		result.Seed = config.Seed
+	}
+	return result
+}
+
+// generalPromptText 只有一条 user 消息且没有 system 指令时直接使用文本，否则按角色拼接为对话记录，以 Assistant: 结尾引导模型回答
+func generalPromptText(req *general.Request) string {
+	if req.SystemInstruction == nil && len(req.Contents) == 1 && req.Contents[0].Role == general.RoleUser {
+		return partsText(req.Contents[0].Parts)
+	}
+	var turns []string
+	if req.SystemInstruction != nil {
+		turns = append(turns, "System: "+partsText(req.SystemInstruction.Parts))
+	}
+	for _, content := range req.Contents {
+		role := "User"
+		if content.Role == general.RoleAssistant {
+			role = "Assistant"
+		}
+		turns = append(turns, role+": "+partsText(content.Parts))
+	}
+	return strings.Join(append(turns, "Assistant:"), "\n\n")
+}
+
+func CompletionsResponseToGeneral(resp *openai.CompletionResponse) *general.Response {
+	result := &general.Response{Id: resp.Id, Model: resp.Model}
+	for _, choice := range resp.Choices {
+		candidate := general.Candidate{
+			Index:   choice.Index,
+			Content: &general.Content{Role: general.RoleAssistant, Parts: []general.Part{textPart(choice.Text)}},
+		}
+		if choice.FinishReason != nil {
+			candidate.FinishReason = openaiFinishReasonToGeneral(*choice.FinishReason)
+		}
+		result.Candidates = append(result.Candidates, candidate)
+	}
+	if resp.Usage != nil {
+		result.Usage = openaiUsageToGeneral(resp.Usage)
+	}
+	return result
+}
+
+// GeneralResponseToCompletions 只输出文本，思考内容与函数调用没有对应
+func GeneralResponseToCompletions(resp *general.Response) *openai.CompletionResponse {
+	result := &openai.CompletionResponse{
+		Id:      resp.Id,
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []openai.CompletionChoice{},
+	}
+	if !strings.HasPrefix(result.Id, "cmpl-") {
+		result.Id = newId("cmpl-")
+	}
+	for _, candidate := range resp.Candidates {
+		choice := openai.CompletionChoice{Index: candidate.Index}
+		if candidate.Content != nil {
+			choice.Text = partsText(candidate.Content.Parts)
+		}
+		finishReason := generalFinishReasonToCompletions(candidate.FinishReason)
+		choice.FinishReason = &finishReason
+		result.Choices = append(result.Choices, choice)
+	}
+	if resp.Usage != nil {
+		result.Usage = generalUsageToOpenAI(resp.Usage)
+	}
+	return result
+}
+
+// generalFinishReasonToCompletions completions 没有 tool_calls
+func generalFinishReasonToCompletions(reason string) string {
+	if reason == general.FinishReasonToolCalls {
+		return "stop"
+	}
+	return generalFinishReasonToOpenAI(reason, false)
+}
@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// completionsStreamDecoder 每个分片的 text 为增量文本
+type completionsStreamDecoder struct{}
+
+func (d *completionsStreamDecoder) Decode(event sse.Event) ([]*general.Response, error) {
+	data := strings.TrimSpace(event.Data)
+	if data == "" || data == openaiStreamDone {
+		return nil, nil
+	}
+	if err := streamError(data); err != nil {
+		return nil, err
+	}
+	var chunk openai.CompletionResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil, err
+	}
+	resp := &general.Response{Id: chunk.Id, Model: chunk.Model}
+	for _, choice := range chunk.Choices {
+		candidate := general.Candidate{Index: choice.Index}
+		var parts []general.Part
+		if choice.Text != "" {
+			parts = append(parts, textPart(choice.Text))
+		}
+		if choice.FinishReason != nil {
+			candidate.FinishReason = openaiFinishReasonToGeneral(*choice.FinishReason)
+		}
+		if len(parts) == 0 && candidate.FinishReason == "" {
+			continue
+		}
+		candidate.Content = &general.Content{Role: general.RoleAssistant, Parts: parts}
+		resp.Candidates = append(resp.Candidates, candidate)
+	}
+	if chunk.Usage != nil {
+		resp.Usage = openaiUsageToGeneral(chunk.Usage)
+	}
+	if len(resp.Candidates) == 0 && resp.Usage == nil {
+		return nil, nil
+	}
+	return []*general.Response{resp}, nil
+}
+
+func (d *completionsStreamDecoder) Finish() []*general.Response {
+	return nil
+}
+
+// completionsStreamEncoder 文本按分片输出，结束时输出 finish_reason、用量与 [DONE]
+type completionsStreamEncoder struct {
+	id      string
+	model   string
+	created int64
+	usage   *general.Usage
+}
+
+func (e *completionsStreamEncoder) Encode(resp *general.Response) []sse.Event {
+	if resp.Model != "" {
+		e.model = resp.Model
+	}
+	if resp.Usage != nil {
+		e.usage = resp.Usage
+	}
+	var events []sse.Event
+	for _, candidate := range resp.Candidates {
+		if candidate.Content != nil {
+			if text := partsText(candidate.Content.Parts); text != "" {
+				events = append(events, e.chunk(openai.CompletionChoice{Index: candidate.Index, Text: text}, nil))
+			}
+		}
+		if candidate.FinishReason != "" {
+			finishReason := generalFinishReasonToCompletions(candidate.FinishReason)
+			events = append(events, e.chunk(openai.CompletionChoice{Index: candidate.Index, FinishReason: &finishReason}, nil))
+		}
+	}
+	return events
+}
+
+func (e *completionsStreamEncoder) chunk(choice openai.CompletionChoice, usage *openai.Usage) sse.Event {
+	if e.id == "" {
+		e.id = newId("cmpl-")
+		e.created = time.Now().Unix()
+	}
+	choices := []openai.CompletionChoice{}
+	if usage == nil {
+		choices = append(choices, choice)
+	}
+	return jsonEvent("", openai.CompletionResponse{
+		Id:      e.id,
+		Object:  "text_completion",
+		Created: e.created,
+		Model:   e.model,
+		Choices: choices,
+		Usage:   usage,
+	})
+}
+
+func (e *completionsStreamEncoder) Finish() []sse.Event {
+	var events []sse.Event
+	if e.usage != nil {
+		events = append(events, e.chunk(openai.CompletionChoice{}, generalUsageToOpenAI(e.usage)))
+	}
+	return append(events, sse.Event{Data: openaiStreamDone, HasData: true})
+}
@@ -0,0 +1,101 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+func TestCompletionsRequest(t *testing.T) {
+	req, err := DecodeRequest(constant.DialectCompletions, "v1/completions", []byte(`{"model":"gpt-3.5-turbo-instruct","prompt":"say hi","max_tokens":16,"stop":"\n"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partsText(req.Contents[0].Parts) != "say hi" || *req.GenerationConfig.MaxOutputTokens != 16 || req.GenerationConfig.StopSequences[0] != "\n" {
+		t.Fatalf("prompt 转换错误: %+v", req)
+	}
+	var unsupportedErr *UnsupportedError
+	if _, err := DecodeRequest(constant.DialectCompletions, "v1/completions", []byte(`{"prompt":["a","b"]}`)); !errors.As(err, &unsupportedErr) {
+		t.Fatalf("多个 prompt 应返回不支持: %v", err)
+	}
+
+	// 多轮对话拼接为对话记录
+	chat, _ := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(`{"model":"m","stream":true,"messages":[
+		{"role":"system","content":"be brief"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`))
+	path, body, err := EncodeRequest(constant.DialectCompletions, chat)
+	if err != nil || path != "v1/completions" {
+		t.Fatalf("转换 completions 请求失败: %s %v", path, err)
+	}
+	want := `"prompt":"System: be brief\n\nUser: hi\n\nAssistant: hello\n\nUser: bye\n\nAssistant:"`
+	if !strings.Contains(string(body), want) || !strings.Contains(string(body), `"include_usage":true`) {
+		t.Fatalf("prompt 拼接错误: %s", body)
+	}
+	tools, _ := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(`{"messages":[{"role":"user","content":"hi"}],
+		"tools":[{"type":"function","function":{"name":"f"}}]}`))
+	if _, _, err := EncodeRequest(constant.DialectCompletions, tools); !errors.As(err, &unsupportedErr) {
+		t.Fatalf("completions 上游不支持工具: %v", err)
+	}
+}
+
+func TestCompletionsResponse(t *testing.T) {
+	resp, err := DecodeResponse(constant.DialectCompletions, []byte(`{"id":"cmpl-1","object":"text_completion","model":"m",
+		"choices":[{"text":"hi","index":0,"finish_reason":"length"}],"usage":{"prompt_tokens":2,"completion_tokens":1,"total_tokens":3}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partsText(resp.Candidates[0].Content.Parts) != "hi" || resp.Candidates[0].FinishReason != "length" || resp.Usage.TotalTokens != 3 {
+		t.Fatalf("completions 响应转换错误: %+v", resp)
+	}
+	body, _ := EncodeResponse(constant.DialectCompletions, resp)
+	for _, want := range []string{`"id":"cmpl-1"`, `"text":"hi"`, `"finish_reason":"length"`} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("completions 响应缺少 %s: %s", want, body)
+		}
+	}
+}
+
+func TestCompletionsStream(t *testing.T) {
+	events := []string{
+		`{"id":"chatcmpl-1","model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"he"}}]}`,
+		`{"id":"chatcmpl-1","model":"m","choices":[{"index":0,"delta":{"content":"llo"},"finish_reason":"stop"}]}`,
+		`{"id":"chatcmpl-1","model":"m","choices":[],"usage":{"prompt_tokens":2,"completion_tokens":2,"total_tokens":4}}`,
+		openaiStreamDone,
+	}
+	converter, _ := NewStreamConverter(constant.DialectOpenAI, constant.DialectCompletions, "m")
+	var out []sse.Event
+	for _, data := range events {
+		converted, err := converter.Convert(sse.Event{Data: data, HasData: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, converted...)
+	}
+	out = append(out, converter.Finish()...)
+	var texts []string
+	for _, event := range out[:len(out)-1] {
+		var chunk struct {
+			Choices []struct {
+				Text string `json:"text"`
+			} `json:"choices"`
+			Usage *struct {
+				TotalTokens int `json:"total_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, choice := range chunk.Choices {
+			texts = append(texts, choice.Text)
+		}
+		if chunk.Usage != nil && chunk.Usage.TotalTokens != 4 {
+			t.Fatalf("用量转换错误: %s", event.Data)
+		}
+	}
+	if strings.Join(texts, "") != "hello" || out[len(out)-1].Data != openaiStreamDone {
+		t.Fatalf("completions 流式转换错误: %v", out)
+	}
+}
@@ -0,0 +1,399 @@
+package convert
+
+/*
+客户端协议与通用格式之间的转换
+clientMessage -> GeneralMessage -> serverMessage
+*/
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/ollama"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+var ErrUnsupportedDialect = errors.New("unsupported dialect")
+
+// DecodeRequest 客户端请求体转换为通用请求，gemini 的模型与是否流式从路径中获取
+func DecodeRequest(dialect string, path string, body []byte) (*general.Request, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		var req gemini.Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		model, method := GeminiPath(path)
+		return GeminiRequestToGeneral(&req, model, method == "streamGenerateContent"), nil
+	case constant.DialectOpenAI:
+		var req openai.Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if err := openaiToolsError(req.Tools); err != nil {
+			return nil, err
+		}
+		if err := openaiFileError(req.Messages); err != nil {
+			return nil, err
+		}
+		return OpenAIRequestToGeneral(&req), nil
+	case constant.DialectClaude:
+		var req claude.Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if err := claudeToolsError(req.Tools); err != nil {
+			return nil, err
+		}
+		return ClaudeRequestToGeneral(&req), nil
+	case constant.DialectResponses:
+		var req openai.ResponsesRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if err := responsesToolsError(&req); err != nil {
+			return nil, err
+		}
+		return ResponsesRequestToGeneral(&req), nil
+	case constant.DialectCompletions:
+		var req openai.CompletionRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if err := completionsRequestError(&req); err != nil {
+			return nil, err
+		}
+		return CompletionsRequestToGeneral(&req), nil
+	case constant.DialectOllama:
+		var req ollama.ChatRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return OllamaChatRequestToGeneral(&req), nil
+	case constant.DialectOllamaGenerate:
+		var req ollama.GenerateRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		if err := ollamaGenerateRequestError(&req); err != nil {
+			return nil, err
+		}
+		return OllamaGenerateRequestToGeneral(&req), nil
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// GenerateEndpoint 是否为对话生成接口，只有这些接口支持协议转换
+func GenerateEndpoint(dialect string, path string) bool {
+	switch dialect {
+	case constant.DialectGemini:
+		_, method := GeminiPath(path)
+		return method == "generateContent" || method == "streamGenerateContent"
+	case constant.DialectOpenAI:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "chat/completions")
+	case constant.DialectClaude:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "v1/messages")
+	case constant.DialectResponses:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "v1/responses")
+	case constant.DialectCompletions:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "v1/completions")
+	case constant.DialectOllama:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "api/chat")
+	case constant.DialectOllamaGenerate:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "api/generate")
+	}
+	return false
+}
+
+// EncodeRequest 通用请求转换为上游请求，返回上游路径(可能带查询参数)与请求体
+func EncodeRequest(dialect string, req *general.Request) (string, []byte, error) {
+	if err := checkBuiltinTools(dialect, req.Tools); err != nil {
+		return "", nil, err
+	}
+	if err := generalMediaError(dialect, req); err != nil {
+		return "", nil, err
+	}
+	if req.PreviousResponseId != "" && dialect != constant.DialectResponses {
+		return "", nil, unsupported("previous_response_id is not supported by the upstream %s api, enable conversation on the route to keep history in the gateway", dialect)
+	}
+	var path string
+	var body any
+	switch dialect {
+	case constant.DialectGemini:
+		path = "v1beta/models/" + req.Model + ":generateContent"
+		if req.Stream {
+			path = "v1beta/models/" + req.Model + ":streamGenerateContent?alt=sse"
+		}
+		body = GeneralRequestToGemini(req)
+	case constant.DialectOpenAI:
+		path = "v1/chat/completions"
+		body = GeneralRequestToOpenAI(req)
+	case constant.DialectClaude:
+		path = "v1/messages"
+		body = GeneralRequestToClaude(req)
+	case constant.DialectResponses:
+		path = "v1/responses"
+		body = GeneralRequestToResponses(req)
+	case constant.DialectCompletions:
+		if err := generalCompletionsError(dialect, req); err != nil {
+			return "", nil, err
+		}
+		path = "v1/completions"
+		body = GeneralRequestToCompletions(req)
+	case constant.DialectOllama:
+		if err := ollamaRequestError(dialect, req); err != nil {
+			return "", nil, err
+		}
+		path = "api/chat"
+		body = GeneralRequestToOllamaChat(req)
+	case constant.DialectOllamaGenerate:
+		if err := ollamaRequestError(dialect, req); err != nil {
+			return "", nil, err
+		}
+		path = "api/generate"
+		body = GeneralRequestToOllamaGenerate(req)
+	default:
+		return "", nil, ErrUnsupportedDialect
+	}
+	data, err := json.Marshal(body)
+	return path, data, err
+}
+
+// DecodeResponse 上游非流式响应体转换为通用响应
+func DecodeResponse(dialect string, body []byte) (*general.Response, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		var resp gemini.Response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return GeminiResponseToGeneral(&resp), nil
+	case constant.DialectOpenAI:
+		var resp openai.Response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return OpenAIResponseToGeneral(&resp), nil
+	case constant.DialectClaude:
+		var resp claude.Response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return ClaudeResponseToGeneral(&resp), nil
+	case constant.DialectResponses:
+		var resp openai.ResponsesResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return ResponsesResponseToGeneral(&resp), nil
+	case constant.DialectCompletions:
+		var resp openai.CompletionResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return CompletionsResponseToGeneral(&resp), nil
+	case constant.DialectOllama:
+		var resp ollama.ChatResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return OllamaChatResponseToGeneral(&resp), nil
+	case constant.DialectOllamaGenerate:
+		var resp ollama.GenerateResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		return OllamaGenerateResponseToGeneral(&resp), nil
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// EncodeResponse 通用响应转换为客户端响应体
+func EncodeResponse(dialect string, resp *general.Response) ([]byte, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		return json.Marshal(GeneralResponseToGemini(resp))
+	case constant.DialectOpenAI:
+		return json.Marshal(GeneralResponseToOpenAI(resp))
+	case constant.DialectClaude:
+		return json.Marshal(GeneralResponseToClaude(resp))
+	case constant.DialectResponses:
+		return json.Marshal(GeneralResponseToResponses(resp))
+	case constant.DialectCompletions:
+		return json.Marshal(GeneralResponseToCompletions(resp))
+	case constant.DialectOllama:
+		return json.Marshal(GeneralResponseToOllamaChat(resp))
+	case constant.DialectOllamaGenerate:
+		return json.Marshal(GeneralResponseToOllamaGenerate(resp))
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// UpstreamError 上游返回的错误，由调用方按客户端协议重新输出
+type UpstreamError struct {
+	Message string
+}
+
+func (e *UpstreamError) Error() string {
+	return "upstream error: " + e.Message
+}
+
+// UpstreamErrorMessage 各协议的错误结构都带 error.message，ollama 的 error 为字符串，解析不出时使用原始响应体
+func UpstreamErrorMessage(body []byte) string {
+	var resp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil {
+		if message, ok := errorMessage(resp.Error); ok && message != "" {
+			return message
+		}
+	}
+	message := strings.TrimSpace(string(body))
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	return message
+}
+
+// errorMessage error 字段为带 message 的对象或字符串，不是错误时返回 false
+func errorMessage(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false
+	}
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return message, true
+	}
+	var object struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", false
+	}
+	return object.Message, true
+}
+
+func lastContent(contents []general.Content) *general.Content {
+	if len(contents) == 0 {
+		return nil
+	}
+	return &contents[len(contents)-1]
+}
+
+func isFunctionResponses(parts []general.Part) bool {
+	for _, part := range parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return len(parts) > 0
+}
+
+func hasFunctionCall(parts []general.Part) bool {
+	for _, part := range parts {
+		if part.FunctionCall != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// partsText 合并文本，思考内容不计入
+func partsText(parts []general.Part) string {
+	var texts []string
+	for _, part := range parts {
+		if isThought(part) {
+			continue
+		}
+		if part.Text != nil {
+			texts = append(texts, *part.Text)
+		}
+		if text, ok := codeText(part); ok {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func isThought(part general.Part) bool {
+	return part.Thought != nil && *part.Thought
+}
+
+func thoughtsText(parts []general.Part) string {
+	var texts []string
+	for _, part := range parts {
+		if isThought(part) && part.Text != nil {
+			texts = append(texts, *part.Text)
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+func withoutThoughts(parts []general.Part) []general.Part {
+	var result []general.Part
+	for _, part := range parts {
+		if !isThought(part) {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func functionResponseText(response *general.FunctionResponse) *string {
+	text := ""
+	if response.Response.Output != nil {
+		text = *response.Response.Output
+	} else if response.Response.Error != nil {
+		text = *response.Response.Error
+	}
+	return &text
+}
+
+// toolCallId 解码时已经按 fillToolCallIds 补全 id，仍然没有 id 时(脚本加入的调用等)生成随机 id；
+// 按函数名生成会让并行调用同一个函数的 id 重复
+func toolCallId(id string) string {
+	if id != "" {
+		return id
+	}
+	return newId("call_")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// newId 上游没有返回 id 时生成，例如 chatcmpl-xxx、msg_xxx
+func newId(prefix string) string {
+	data := make([]byte, 12)
+	_, _ = rand.Read(data)
+	return prefix + hex.EncodeToString(data)
+}
+
+func emptyGenerationConfig(config *general.GenerationConfig) *general.GenerationConfig {
+	if reflect.ValueOf(*config).IsZero() {
+		return nil
+	}
+	return config
+}
@@ -0,0 +1,612 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+func TestDecodeOpenAIRequest(t *testing.T) {
+	body := `{"model":"gpt","temperature":0,"stop":"END","messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":[{"type":"text","text":"weather?"}]},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"bj\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"}]}`
+	req, err := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.SystemInstruction == nil || *req.SystemInstruction.Parts[0].Text != "be brief" {
+		t.Fatalf("system 转换错误: %+v", req.SystemInstruction)
+	}
+	if len(req.Contents) != 3 || req.GenerationConfig.StopSequences[0] != "END" {
+		t.Fatalf("消息转换错误: %+v", req)
+	}
+	response := req.Contents[2].Parts[0].FunctionResponse
+	if response == nil || response.Name != "weather" || *response.Response.Output != "sunny" {
+		t.Fatalf("tool 消息转换错误: %+v", response)
+	}
+	back, _ := json.Marshal(GeneralRequestToOpenAI(req))
+	t.Logf("转换回 openai: %s", back)
+}
+
+func TestDecodeClaudeRequest(t *testing.T) {
+	body := `{"model":"claude","max_tokens":100,"system":"be brief","messages":[
+		{"role":"user","content":"weather?"},
+		{"role":"assistant","content":[{"type":"tool_use","id":"tu_1","name":"weather","input":{"city":"bj"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_1","content":"sunny"}]}]}`
+	req, err := DecodeRequest(constant.DialectClaude, "v1/messages", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *req.GenerationConfig.MaxOutputTokens != 100 || req.Contents[1].Parts[0].FunctionCall.Args["city"] != "bj" {
+		t.Fatalf("请求转换错误: %+v", req)
+	}
+	claudeReq := GeneralRequestToClaude(req)
+	if claudeReq.Messages[2].Content.Blocks[0].ToolUseId != "tu_1" {
+		t.Fatalf("tool_result 转换错误: %+v", claudeReq.Messages[2])
+	}
+}
+
+func TestDecodeGeminiRequest(t *testing.T) {
+	body := `{"contents":[{"role":"user","parts":[{"text":"hi"}]},{"role":"model","parts":[{"text":"hello"}]}]}`
+	req, err := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:streamGenerateContent", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Model != "gemini-2.5-flash" || !req.Stream || req.Contents[1].Role != "assistant" {
+		t.Fatalf("请求转换错误: %+v", req)
+	}
+}
+
+func TestMultimodalParts(t *testing.T) {
+	body := `{"model":"gpt","messages":[{"role":"user","content":[
+		{"type":"text","text":"describe"},
+		{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},
+		{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}},
+		{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}},
+		{"type":"file","file":{"filename":"a.pdf","file_data":"data:application/pdf;base64,JVBERi0="}}]}]}`
+	req, err := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := req.Contents[0].Parts
+	if len(parts) != 5 || parts[1].InlineData.MimeType != "image/png" || parts[2].FileData.MimeType != "image/jpeg" ||
+		parts[3].InlineData.MimeType != "audio/wav" || parts[4].InlineData.MimeType != "application/pdf" {
+		t.Fatalf("openai 多模态转换错误: %+v", parts)
+	}
+	// claude 不支持音频，EncodeRequest 拒绝，见 TestUnsupportedMedia；其余转换为 image/document 块
+	blocks := GeneralRequestToClaude(req).Messages[0].Content.Blocks
+	types := ""
+	for _, block := range blocks {
+		types += block.Type + ","
+	}
+	if types != "text,image,image,document," || blocks[2].Source.Url != "https://example.com/cat.jpg" {
+		t.Fatalf("claude 多模态转换错误: %s", types)
+	}
+	// 再转换回 openai
+	openaiParts := GeneralRequestToOpenAI(req).Messages[0].Content.Parts
+	if len(openaiParts) != 5 || openaiParts[1].ImageUrl.Url != "data:image/png;base64,iVBORw0KGgo=" ||
+		openaiParts[3].InputAudio.Format != "wav" || openaiParts[4].File.FileData != "data:application/pdf;base64,JVBERi0=" {
+		t.Fatalf("openai 多模态还原错误: %+v", openaiParts)
+	}
+}
+
+func TestConvertResponse(t *testing.T) {
+	body := `{"candidates":[{"content":{"role":"model","parts":[{"text":"calling"},{"functionCall":{"name":"weather","args":{"city":"bj"}}}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15},"modelVersion":"gemini-2.5-flash"}`
+	resp, err := DecodeResponse(constant.DialectGemini, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Candidates[0].FinishReason != "tool_calls" {
+		t.Fatalf("结束原因转换错误: %+v", resp.Candidates[0])
+	}
+	openaiResp := GeneralResponseToOpenAI(resp)
+	choice := openaiResp.Choices[0]
+	if *choice.FinishReason != "tool_calls" || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"bj"}` ||
+		openaiResp.Usage.TotalTokens != 15 {
+		t.Fatalf("openai 响应转换错误: %+v", openaiResp)
+	}
+	claudeResp := GeneralResponseToClaude(resp)
+	if *claudeResp.StopReason != "tool_use" || claudeResp.Content[1].Type != "tool_use" || claudeResp.Usage.InputTokens != 10 {
+		t.Fatalf("claude 响应转换错误: %+v", claudeResp)
+	}
+}
+
+func TestStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"c1","model":"gpt","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		`{"id":"c1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"ci"}}]}}]}`,
+		`{"id":"c1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"bj\"}"}}]}}]}`,
+		`{"id":"c1","model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"c1","model":"gpt","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`,
+		`[DONE]`,
+	}
+	converter, err := NewStreamConverter(constant.DialectOpenAI, constant.DialectClaude, "gpt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var data []string
+	for _, chunk := range chunks {
+		events, err := converter.Convert(sse.Event{Data: chunk, HasData: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range events {
+			names = append(names, event.Event)
+			data = append(data, event.Data)
+		}
+	}
+	for _, event := range converter.Finish() {
+		names = append(names, event.Event)
+		data = append(data, event.Data)
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_stop,content_block_start," +
+		"content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("claude 事件顺序错误: %v", names)
+	}
+	if !strings.Contains(data[5], `{\"city\":\"bj\"}`) || !strings.Contains(data[7], `"stop_reason":"tool_use"`) ||
+		!strings.Contains(data[7], `"output_tokens":4`) || !strings.Contains(data[7], `"input_tokens":3`) {
+		t.Fatalf("claude 事件内容错误: %v", data)
+	}
+	// 上游没有返回用量时不输出 input_tokens，不覆盖客户端已有的值
+	noUsage, _ := NewStreamConverter(constant.DialectOpenAI, constant.DialectClaude, "gpt")
+	noUsage.Convert(sse.Event{Data: chunks[1], HasData: true})
+	if finish := noUsage.Finish(); strings.Contains(finish[len(finish)-2].Data, "input_tokens") {
+		t.Fatalf("未知的输入 token 不应输出: %s", finish[len(finish)-2].Data)
+	}
+
+	_, err = converter.Convert(sse.Event{Data: `{"error":{"message":"overloaded"}}`, HasData: true})
+	if upstreamErr, ok := err.(*UpstreamError); !ok || upstreamErr.Message != "overloaded" {
+		t.Fatalf("流式错误转换错误: %v", err)
+	}
+}
+
+func TestReasoningConversion(t *testing.T) {
+	body := `{"model":"claude","max_tokens":2000,"temperature":0.5,"thinking":{"type":"enabled","budget_tokens":4000},"messages":[
+		{"role":"user","content":"hi"},
+		{"role":"assistant","content":[{"type":"thinking","thinking":"hmm","signature":"sig"},{"type":"text","text":"hello"}]},
+		{"role":"user","content":"again"}]}`
+	req, err := DecodeRequest(constant.DialectClaude, "v1/messages", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geminiReq := GeneralRequestToGemini(req)
+	thinking := geminiReq.GenerationConfig.ThinkingConfig
+	if thinking == nil || *thinking.ThinkingBudget != 4000 || !*thinking.IncludeThoughts || len(geminiReq.Contents[1].Parts) != 1 {
+		t.Fatalf("gemini 推理配置转换错误: %+v", geminiReq)
+	}
+	if effort := GeneralRequestToOpenAI(req).ReasoningEffort; effort != "medium" {
+		t.Fatalf("openai 推理强度转换错误: %s", effort)
+	}
+	// 思考签名原样回传，max_tokens 需要大于预算
+	claudeReq := GeneralRequestToClaude(req)
+	if claudeReq.Thinking.BudgetTokens != 4000 || claudeReq.MaxTokens <= 4000 || claudeReq.Temperature != nil ||
+		claudeReq.Messages[1].Content.Blocks[0].Signature != "sig" {
+		t.Fatalf("claude 推理配置转换错误: %+v", claudeReq)
+	}
+
+	openaiReq, _ := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(`{"model":"o","reasoning_effort":"low","messages":[{"role":"user","content":"hi"}]}`))
+	if budget := *GeneralRequestToGemini(openaiReq).GenerationConfig.ThinkingConfig.ThinkingBudget; budget != 1024 {
+		t.Fatalf("推理强度转换预算错误: %d", budget)
+	}
+	if claudeThinking := GeneralRequestToClaude(openaiReq).Thinking; claudeThinking.BudgetTokens != 1024 {
+		t.Fatalf("claude 推理预算错误: %+v", claudeThinking)
+	}
+
+	resp, _ := DecodeResponse(constant.DialectGemini, []byte(`{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"plan","thought":true},{"text":"answer"}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"thoughtsTokenCount":5,"totalTokenCount":10}}`))
+	openaiResp := GeneralResponseToOpenAI(resp)
+	message := openaiResp.Choices[0].Message
+	if *message.ReasoningContent != "plan" || *message.Content.Text != "answer" ||
+		openaiResp.Usage.CompletionTokens != 7 || openaiResp.Usage.CompletionTokensDetails.ReasoningTokens != 5 {
+		t.Fatalf("openai 思考内容转换错误: %+v", openaiResp)
+	}
+	claudeResp := GeneralResponseToClaude(resp)
+	if claudeResp.Content[0].Type != "thinking" || claudeResp.Content[0].Thinking != "plan" {
+		t.Fatalf("claude 思考内容转换错误: %+v", claudeResp.Content)
+	}
+}
+
+func TestReasoningStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":3,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"ok"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":9}}`,
+		`{"type":"message_stop"}`,
+	}
+	for _, to := range []string{constant.DialectOpenAI, constant.DialectGemini, constant.DialectClaude} {
+		converter, _ := NewStreamConverter(constant.DialectClaude, to, "claude")
+		var out []string
+		for _, data := range events {
+			converted, err := converter.Convert(sse.Event{Data: data, HasData: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, event := range converted {
+				out = append(out, event.Data)
+			}
+		}
+		for _, event := range converter.Finish() {
+			out = append(out, event.Data)
+		}
+		joined := strings.Join(out, "\n")
+		var want []string
+		switch to {
+		case constant.DialectOpenAI:
+			want = []string{`"reasoning_content":"hmm"`, `"content":"ok"`}
+		case constant.DialectGemini:
+			want = []string{`"text":"hmm","thought":true`, `"thoughtSignature":"sig"`, `"text":"ok"`}
+		case constant.DialectClaude:
+			want = []string{`"thinking":"hmm"`, `"signature":"sig"`, `"text":"ok"`}
+		}
+		for _, w := range want {
+			if !strings.Contains(joined, w) {
+				t.Fatalf("%s 流式思考内容缺少 %s: %s", to, w, joined)
+			}
+		}
+	}
+}
+
+func TestStructuredOutput(t *testing.T) {
+	body := `{"model":"gpt","messages":[{"role":"user","content":"list"}],"response_format":{"type":"json_schema",
+		"json_schema":{"name":"items","strict":true,"schema":{"type":"array","items":{"type":"string"}}}}}`
+	req, err := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geminiConfig := GeneralRequestToGemini(req).GenerationConfig
+	if *geminiConfig.ResponseMimeType != "application/json" || (*geminiConfig.ResponseSchema)["type"] != "array" {
+		t.Fatalf("gemini 结构化输出转换错误: %+v", geminiConfig)
+	}
+	// claude 使用强制工具调用，根节点不是对象时包装
+	claudeReq := GeneralRequestToClaude(req)
+	if claudeReq.ToolChoice.Name != claudeStructuredValueTool || claudeReq.Tools[0].Name != claudeStructuredValueTool {
+		t.Fatalf("claude 结构化输出转换错误: %+v", claudeReq)
+	}
+	resp, _ := DecodeResponse(constant.DialectClaude, []byte(`{"id":"msg_1","content":[{"type":"tool_use","id":"tu","name":"structured_output_value",
+		"input":{"value":["a","b"]}}],"stop_reason":"tool_use","usage":{"input_tokens":1,"output_tokens":1}}`))
+	if text := *resp.Candidates[0].Content.Parts[0].Text; text != `["a","b"]` || resp.Candidates[0].FinishReason != "stop" {
+		t.Fatalf("claude 结构化输出响应转换错误: %+v", resp.Candidates[0])
+	}
+
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":1,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"tu","name":"structured_output","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"a\":"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"1}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+	}
+	converter, _ := NewStreamConverter(constant.DialectClaude, constant.DialectOpenAI, "claude")
+	var out []string
+	for _, data := range events {
+		converted, _ := converter.Convert(sse.Event{Data: data, HasData: true})
+		for _, event := range converted {
+			out = append(out, event.Data)
+		}
+	}
+	joined := strings.Join(out, "\n")
+	if !strings.Contains(joined, `"content":"{\"a\":"`) || !strings.Contains(joined, `"finish_reason":"stop"`) || strings.Contains(joined, "tool_calls") {
+		t.Fatalf("claude 结构化输出流式转换错误: %s", joined)
+	}
+}
+
+func TestToolConfig(t *testing.T) {
+	tools := `"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}},
+		{"type":"function","function":{"name":"time","parameters":{"type":"object","properties":{"zone":{"type":"string"}}}}}]`
+	body := `{"model":"gpt","messages":[{"role":"user","content":"hi"}],` + tools + `,
+		"tool_choice":{"type":"function","function":{"name":"weather"}},"parallel_tool_calls":false}`
+	req, err := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geminiReq := GeneralRequestToGemini(req)
+	if calling := geminiReq.ToolConfig.FunctionCallingConfig; calling.Mode != "ANY" || calling.AllowedFunctionNames[0] != "weather" {
+		t.Fatalf("gemini toolConfig 转换错误: %+v", calling)
+	}
+	claudeReq := GeneralRequestToClaude(req)
+	if choice := claudeReq.ToolChoice; choice.Type != "tool" || choice.Name != "weather" || !*choice.DisableParallelToolUse {
+		t.Fatalf("claude tool_choice 转换错误: %+v", choice)
+	}
+
+	// 多个可选函数
+	req.ToolConfig.AllowedFunctionNames = []string{"weather", "time"}
+	data, _ := json.Marshal(GeneralRequestToOpenAI(req).ToolChoice)
+	want := `{"type":"allowed_tools","allowed_tools":{"mode":"required","tools":[{"type":"function","function":{"name":"weather"}},{"type":"function","function":{"name":"time"}}]}}`
+	if string(data) != want {
+		t.Fatalf("openai allowed_tools 转换错误: %s", data)
+	}
+	if claudeReq := GeneralRequestToClaude(req); claudeReq.ToolChoice.Type != "any" {
+		t.Fatalf("claude 多个函数应降级为 any: %+v", claudeReq.ToolChoice)
+	}
+
+	claudeBody := `{"model":"claude","max_tokens":10,"messages":[{"role":"user","content":"hi"}],
+		"tools":[{"name":"weather","input_schema":{"type":"object","properties":{"city":{"type":"string"}}}}],"tool_choice":{"type":"none"}}`
+	req, _ = DecodeRequest(constant.DialectClaude, "v1/messages", []byte(claudeBody))
+	data, _ = json.Marshal(GeneralRequestToOpenAI(req).ToolChoice)
+	if string(data) != `"none"` || GeneralRequestToGemini(req).ToolConfig.FunctionCallingConfig.Mode != "NONE" {
+		t.Fatalf("none 转换错误: %s", data)
+	}
+}
+
+func TestToolCallIds(t *testing.T) {
+	// gemini 并行调用同一个函数且都没有 id
+	body := `{"contents":[{"role":"user","parts":[{"text":"weather?"}]},
+		{"role":"model","parts":[{"functionCall":{"name":"weather","args":{"city":"bj"}}},{"functionCall":{"name":"weather","args":{"city":"sh"}}}]},
+		{"role":"user","parts":[{"functionResponse":{"name":"weather","response":{"output":"sunny"}}},{"functionResponse":{"name":"weather","response":{"output":"rain"}}}]}],
+		"toolConfig":{"functionCallingConfig":{"mode":"ANY"}}}`
+	req, err := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:generateContent", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ToolConfig.Mode != "required" {
+		t.Fatalf("gemini toolConfig 转换错误: %+v", req.ToolConfig)
+	}
+	openaiReq := GeneralRequestToOpenAI(req)
+	calls := openaiReq.Messages[1].ToolCalls
+	if len(calls) != 2 || calls[0].Id == calls[1].Id {
+		t.Fatalf("并行调用 id 错误: %+v", calls)
+	}
+	if openaiReq.Messages[2].ToolCallId != calls[0].Id || openaiReq.Messages[3].ToolCallId != calls[1].Id {
+		t.Fatalf("函数结果与调用没有对应: %+v", openaiReq.Messages[2:])
+	}
+	again, _ := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:generateContent", []byte(body))
+	if GeneralRequestToOpenAI(again).Messages[1].ToolCalls[0].Id != calls[0].Id {
+		t.Fatal("相同请求生成的 id 应该相同")
+	}
+
+	// 脚本等加入的调用没有 id，同名调用也不能重复
+	scripted := &general.Request{Contents: []general.Content{{Role: general.RoleAssistant, Parts: []general.Part{
+		{FunctionCall: &general.FunctionCall{Name: "weather"}}, {FunctionCall: &general.FunctionCall{Name: "weather"}}}}}}
+	if calls := GeneralRequestToOpenAI(scripted).Messages[0].ToolCalls; calls[0].Id == calls[1].Id || !strings.HasPrefix(calls[0].Id, "call_") {
+		t.Fatalf("没有 id 的调用应生成不同的 id: %+v", calls)
+	}
+
+	resp, _ := DecodeResponse(constant.DialectGemini, []byte(`{"candidates":[{"content":{"role":"model","parts":[
+		{"functionCall":{"name":"weather","args":{"city":"bj"}}},{"functionCall":{"name":"weather","args":{"city":"sh"}}}]},"finishReason":"STOP"}]}`))
+	parts := resp.Candidates[0].Content.Parts
+	if parts[0].FunctionCall.Id == "" || parts[0].FunctionCall.Id == parts[1].FunctionCall.Id {
+		t.Fatalf("响应调用 id 错误: %+v %+v", parts[0].FunctionCall, parts[1].FunctionCall)
+	}
+}
+
+func TestBuiltinTools(t *testing.T) {
+	body := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"tools":[{"googleSearch":{}},{"codeExecution":{}},{"urlContext":{}}]}`
+	req, err := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:generateContent", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, tool := range GeneralRequestToClaude(req).Tools {
+		types = append(types, tool.Type)
+	}
+	if strings.Join(types, ",") != "web_search_20250305,code_execution_20250825,web_fetch_20250910" {
+		t.Fatalf("claude 内置工具转换错误: %v", types)
+	}
+	var unsupported *UnsupportedError
+	if _, _, err := EncodeRequest(constant.DialectOpenAI, req); !errors.As(err, &unsupported) {
+		t.Fatalf("openai 没有代码执行工具，应拒绝: %v", err)
+	}
+	req.Tools = req.Tools[:1]
+	if GeneralRequestToOpenAI(req).WebSearchOptions == nil {
+		t.Fatal("openai web_search_options 转换错误")
+	}
+
+	claudeBody := `{"model":"c","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"bash_20250124","name":"bash"}]}`
+	if _, err := DecodeRequest(constant.DialectClaude, "v1/messages", []byte(claudeBody)); !errors.As(err, &unsupported) {
+		t.Fatalf("claude bash 工具应拒绝: %v", err)
+	}
+}
+
+func TestUnsupportedMedia(t *testing.T) {
+	var unsupported *UnsupportedError
+	for dialect, body := range map[string]string{
+		// claude 没有音频与视频
+		constant.DialectClaude: `{"contents":[{"role":"user","parts":[{"text":"hi"},{"inlineData":{"mimeType":"audio/wav","data":"UklGRg=="}}]}]}`,
+		// openai 不能通过 url 引用图片以外的文件
+		constant.DialectOpenAI: `{"contents":[{"role":"user","parts":[{"text":"hi"},{"fileData":{"mimeType":"video/mp4","fileUri":"https://example.com/a.mp4"}}]}]}`,
+	} {
+		req, err := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:generateContent", []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := EncodeRequest(dialect, req); !errors.As(err, &unsupported) {
+			t.Fatalf("%s 无法表示的媒体应拒绝: %v", dialect, err)
+		}
+	}
+	video := `{"contents":[{"role":"user","parts":[{"fileData":{"mimeType":"video/mp4","fileUri":"https://example.com/a.mp4"}}]}]}`
+	req, _ := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:generateContent", []byte(video))
+	if _, _, err := EncodeRequest(constant.DialectClaude, req); !errors.As(err, &unsupported) || !strings.Contains(err.Error(), "video/mp4") {
+		t.Fatalf("claude 视频应拒绝: %v", err)
+	}
+
+	// openai assistant 消息只能包含文本与工具调用，模型生成的图片不能静默丢弃
+	image := `{"contents":[{"role":"user","parts":[{"text":"draw"}]},{"role":"model","parts":[{"inlineData":{"mimeType":"image/png","data":"iVBORw0KGgo="}}]},{"role":"user","parts":[{"text":"again"}]}]}`
+	req, _ = DecodeRequest(constant.DialectGemini, "v1beta/models/gemini-2.5-flash:generateContent", []byte(image))
+	if _, _, err := EncodeRequest(constant.DialectOpenAI, req); !errors.As(err, &unsupported) || !strings.Contains(err.Error(), "image/png") {
+		t.Fatalf("openai assistant 图片应拒绝: %v", err)
+	}
+
+	// openai 文件 id 的类型与内容都无法得知
+	body := `{"model":"gpt","messages":[{"role":"user","content":[{"type":"file","file":{"file_id":"file-abc"}}]}]}`
+	if _, err := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(body)); !errors.As(err, &unsupported) {
+		t.Fatalf("openai file_id 应拒绝: %v", err)
+	}
+}
+
+func TestCitations(t *testing.T) {
+	// 字节位置：“北京晴” 9 字节，“，上海雨” 12 字节
+	body := `{"candidates":[{"content":{"role":"model","parts":[{"text":"北京晴，上海雨"}]},"finishReason":"STOP",
+		"groundingMetadata":{"webSearchQueries":["weather"],
+			"groundingChunks":[{"web":{"uri":"https://a.example","title":"A"}},{"web":{"uri":"https://b.example","title":"B"}}],
+			"groundingSupports":[{"segment":{"startIndex":0,"endIndex":9,"text":"北京晴"},"groundingChunkIndices":[0]},
+				{"segment":{"startIndex":9,"endIndex":21,"text":"，上海雨"},"groundingChunkIndices":[1]}]}}]}`
+	resp, err := DecodeResponse(constant.DialectGemini, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Candidates[0].Citations) != 2 || resp.Candidates[0].SearchQueries[0] != "weather" {
+		t.Fatalf("gemini 引用转换错误: %+v", resp.Candidates[0])
+	}
+	annotations := GeneralResponseToOpenAI(resp).Choices[0].Message.Annotations
+	if len(annotations) != 2 || annotations[1].UrlCitation.StartIndex != 3 || annotations[1].UrlCitation.EndIndex != 7 {
+		t.Fatalf("openai 引用位置应按字符计算: %+v", annotations[1].UrlCitation)
+	}
+	claudeResp := GeneralResponseToClaude(resp)
+	if citations := claudeResp.Content[0].Citations; len(citations) != 2 || citations[1].Url != "https://b.example" {
+		t.Fatalf("claude 引用转换错误: %+v", claudeResp.Content)
+	}
+
+	claudeBody := `{"id":"msg_1","type":"message","role":"assistant","model":"c","stop_reason":"end_turn","content":[
+		{"type":"server_tool_use","id":"srv_1","name":"code_execution","input":{"code":"print(1)"}},
+		{"type":"code_execution_tool_result","tool_use_id":"srv_1","content":{"type":"code_execution_result","stdout":"1\n","stderr":"","return_code":0}},
+		{"type":"text","text":"结果是 "},
+		{"type":"text","text":"1","citations":[{"type":"web_search_result_location","url":"https://c.example","title":"C","cited_text":"one"}]}]}`
+	resp, err = DecodeResponse(constant.DialectClaude, []byte(claudeBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geminiResp := GeneralResponseToGemini(resp)
+	parts := geminiResp.Candidates[0].Content.Parts
+	if parts[0].ExecutableCode == nil || parts[0].ExecutableCode.Code != "print(1)" || parts[1].CodeExecutionResult.Outcome != "OUTCOME_OK" {
+		t.Fatalf("claude 代码执行转换错误: %+v", parts)
+	}
+	grounding := geminiResp.Candidates[0].GroundingMetadata
+	if grounding == nil || *grounding.GroundingSupports[0].Segment.StartIndex != len("结果是 ") || grounding.GroundingChunks[0].Web.Uri != "https://c.example" {
+		t.Fatalf("claude 引用转换错误: %+v", grounding)
+	}
+}
+
+func TestGenerationOptions(t *testing.T) {
+	body := `{"model":"gpt","messages":[{"role":"user","content":"hi"}],"n":2,"seed":7,"logprobs":true,"top_logprobs":3,
+		"modalities":["text","audio"],"audio":{"voice":"verse","format":"mp3"}}`
+	req, err := DecodeRequest(constant.DialectOpenAI, "v1/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := GeneralRequestToGemini(req).GenerationConfig
+	if *config.CandidateCount != 2 || *config.Seed != 7 || !*config.ResponseLogprobs || *config.Logprobs != 3 {
+		t.Fatalf("gemini generationConfig 转换错误: %+v", config)
+	}
+	if config.ResponseModalities[1] != "AUDIO" || config.SpeechConfig.VoiceConfig.PrebuiltVoiceConfig.VoiceName != "verse" {
+		t.Fatalf("gemini 输出模态转换错误: %+v", config)
+	}
+
+	geminiBody := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],
+		"generationConfig":{"logprobs":2,"responseModalities":["TEXT","IMAGE","AUDIO"],"candidateCount":2},
+		"safetySettings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}],"cachedContent":"cachedContents/abc"}`
+	req, err = DecodeRequest(constant.DialectGemini, "v1beta/models/gemini:generateContent", []byte(geminiBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有开启 responseLogprobs 时 logprobs 不生效
+	if req.GenerationConfig.Logprobs != nil {
+		t.Fatalf("logprobs 不应生效: %v", *req.GenerationConfig.Logprobs)
+	}
+	openaiReq := GeneralRequestToOpenAI(req)
+	if *openaiReq.N != 2 || len(openaiReq.Modalities) != 2 || openaiReq.Audio.Voice != openaiDefaultVoice || openaiReq.Audio.Format != openaiDefaultAudioFormat {
+		t.Fatalf("openai 输出模态转换错误: %+v %+v", openaiReq.Modalities, openaiReq.Audio)
+	}
+}
+
+func TestPromptBlocked(t *testing.T) {
+	body := `{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH","blocked":true}]},
+		"usageMetadata":{"promptTokenCount":5,"totalTokenCount":5},"modelVersion":"gemini"}`
+	resp, err := DecodeResponse(constant.DialectGemini, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodeResponse(constant.DialectOpenAI, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var openaiResp openai.Response
+	if err := json.Unmarshal(data, &openaiResp); err != nil {
+		t.Fatal(err)
+	}
+	if len(openaiResp.Choices) != 1 || stringValue(openaiResp.Choices[0].FinishReason) != general.FinishReasonContentFilter {
+		t.Fatalf("提示词拦截转换错误: %s", data)
+	}
+}
+
+func TestGeminiExtrasLossless(t *testing.T) {
+	body := `{"contents":[{"role":"user","parts":[{"text":"hi","partMetadata":{"k":"v"}}],"futureContent":1}],
+		"generationConfig":{"temperature":0.5,"mediaResolution":"MEDIA_RESOLUTION_LOW","futureConfig":true},
+		"safetySettings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}],"cachedContent":"cachedContents/abc","futureField":{"a":[1,2]}}`
+	req, err := DecodeRequest(constant.DialectGemini, "v1beta/models/gemini:generateContent", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data, err := EncodeRequest(constant.DialectGemini, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJson(t, body, string(data))
+	// 其它协议不带 gemini 的字段
+	_, data, _ = EncodeRequest(constant.DialectOpenAI, req)
+	if strings.Contains(string(data), "future") || strings.Contains(string(data), "safetySettings") {
+		t.Fatalf("openai 请求不应包含 gemini 字段: %s", data)
+	}
+
+	body = `{"promptFeedback":{"blockReason":"SAFETY"},"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":0,"totalTokenCount":5,
+		"promptTokensDetails":[{"modality":"TEXT","tokenCount":5}]},"modelVersion":"gemini","responseId":"r1","futureResponse":"x"}`
+	resp, err := DecodeResponse(constant.DialectGemini, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = EncodeResponse(constant.DialectGemini, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJson(t, body, string(data))
+}
+
+func assertSameJson(t *testing.T, want string, got string) {
+	t.Helper()
+	var wantValue, gotValue any
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantValue, gotValue) {
+		t.Fatalf("JSON 不一致:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestMergeResponses(t *testing.T) {
+	deltas := []*general.Response{
+		deltaResponse("r", "m", []general.Part{thoughtPart("a", "")}, ""),
+		deltaResponse("", "", []general.Part{thoughtPart("b", ""), thoughtPart("", "sig")}, ""),
+		deltaResponse("", "", []general.Part{textPart("x"), textPart("y")}, ""),
+		deltaResponse("", "", []general.Part{{FunctionCall: &general.FunctionCall{Name: "f"}}}, general.FinishReasonToolCalls),
+	}
+	resp := MergeResponses(deltas)
+	parts := resp.Candidates[0].Content.Parts
+	if resp.Id != "r" || len(parts) != 3 || *parts[0].Text != "ab" || *parts[0].ThoughtSignature != "sig" || *parts[1].Text != "xy" {
+		t.Fatalf("增量合并错误: %+v", parts)
+	}
+	if resp.Candidates[0].FinishReason != general.FinishReasonToolCalls {
+		t.Fatalf("结束原因合并错误: %+v", resp.Candidates[0])
+	}
+}
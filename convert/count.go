@@ -0,0 +1,126 @@
+package convert
+
+/*
+token 计数接口的转换
+gemini countTokens、claude /v1/messages/count_tokens、responses /v1/responses/input_tokens
+openai /v1/chat/completions/count_tokens(网关提供)
+请求体与对话生成接口相同，转换为通用请求后由上游计数，上游没有计数接口时在本地估算
+*/
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+// CountTokensEndpoint 是否为 token 计数接口
+func CountTokensEndpoint(dialect string, path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	switch dialect {
+	case constant.DialectGemini:
+		_, method := GeminiPath(path)
+		return method == "countTokens"
+	case constant.DialectOpenAI:
+		return strings.HasSuffix(path, "chat/completions/count_tokens")
+	case constant.DialectClaude:
+		return strings.HasSuffix(path, "v1/messages/count_tokens")
+	case constant.DialectResponses:
+		return strings.HasSuffix(path, "responses/input_tokens")
+	}
+	return false
+}
+
+// CountTokensSupported 上游协议是否有 token 计数接口，openai 对话接口没有
+func CountTokensSupported(dialect string) bool {
+	return dialect == constant.DialectGemini || dialect == constant.DialectClaude || dialect == constant.DialectResponses
+}
+
+// DecodeCountTokensRequest gemini 的 contents 与 generateContentRequest 二选一，模型从路径中获取
+func DecodeCountTokensRequest(dialect string, path string, body []byte) (*general.Request, error) {
+	if dialect != constant.DialectGemini {
+		return DecodeRequest(dialect, path, body)
+	}
+	var req gemini.CountTokensRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	model, _ := GeminiPath(path)
+	if req.GenerateContentRequest != nil {
+		return GeminiRequestToGeneral(&req.GenerateContentRequest.Request, model, false), nil
+	}
+	return GeminiRequestToGeneral(&gemini.Request{Contents: req.Contents}, model, false), nil
+}
+
+// EncodeCountTokensRequest 返回上游计数接口的路径与请求体
+func EncodeCountTokensRequest(dialect string, req *general.Request) (string, []byte, error) {
+	if err := checkBuiltinTools(dialect, req.Tools); err != nil {
+		return "", nil, err
+	}
+	var path string
+	var body any
+	switch dialect {
+	case constant.DialectGemini:
+		path = "v1beta/models/" + req.Model + ":countTokens"
+		body = gemini.CountTokensRequest{
+			GenerateContentRequest: &gemini.GenerateContentRequest{Model: "models/" + req.Model, Request: *GeneralRequestToGemini(req)},
+		}
+	case constant.DialectClaude:
+		// 计数接口只接受与输入有关的字段
+		result := GeneralRequestToClaude(req)
+		path = "v1/messages/count_tokens"
+		body = claude.Request{
+			Model:      result.Model,
+			Messages:   result.Messages,
+			System:     result.System,
+			Tools:      result.Tools,
+			ToolChoice: result.ToolChoice,
+			Thinking:   result.Thinking,
+		}
+	case constant.DialectResponses:
+		result := GeneralRequestToResponses(req)
+		result.Stream, result.Store = false, nil
+		path = "v1/responses/input_tokens"
+		body = result
+	default:
+		return "", nil, &UnsupportedError{Message: dialect + " does not support counting tokens"}
+	}
+	data, err := json.Marshal(body)
+	return path, data, err
+}
+
+// DecodeCountTokensResponse 上游计数接口响应中的输入 token 数
+func DecodeCountTokensResponse(dialect string, body []byte) (int, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		var resp gemini.CountTokensResponse
+		err := json.Unmarshal(body, &resp)
+		return resp.TotalTokens, err
+	case constant.DialectClaude:
+		var resp claude.CountTokensResponse
+		err := json.Unmarshal(body, &resp)
+		return resp.InputTokens, err
+	case constant.DialectResponses:
+		var resp openai.InputTokensResponse
+		err := json.Unmarshal(body, &resp)
+		return resp.InputTokens, err
+	}
+	return 0, ErrUnsupportedDialect
+}
+
+// EncodeCountTokensResponse 按客户端协议输出输入 token 数
+func EncodeCountTokensResponse(dialect string, tokens int) ([]byte, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		return json.Marshal(gemini.CountTokensResponse{TotalTokens: tokens})
+	case constant.DialectClaude:
+		return json.Marshal(claude.CountTokensResponse{InputTokens: tokens})
+	case constant.DialectOpenAI, constant.DialectResponses:
+		return json.Marshal(openai.InputTokensResponse{Object: "response.input_tokens", InputTokens: tokens})
+	}
+	return nil, ErrUnsupportedDialect
+}
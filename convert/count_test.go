@@ -0,0 +1,55 @@
+package convert
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/gemini"
+)
+
+func TestCountTokensConvert(t *testing.T) {
+	path := "v1beta/models/gemini-2.5-flash:countTokens"
+	if !CountTokensEndpoint(constant.DialectGemini, path) || CountTokensEndpoint(constant.DialectOpenAI, "v1/chat/completions") ||
+		!CountTokensEndpoint(constant.DialectClaude, "v1/messages/count_tokens") {
+		t.Fatal("计数接口识别错误")
+	}
+	body := `{"generateContentRequest":{"model":"models/gemini-2.5-flash","systemInstruction":{"parts":[{"text":"be brief"}]},"contents":[{"role":"user","parts":[{"text":"hi"}]}]}}`
+	req, err := DecodeCountTokensRequest(constant.DialectGemini, path, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Model != "gemini-2.5-flash" || req.SystemInstruction == nil || len(req.Contents) != 1 {
+		t.Fatalf("gemini 计数请求解析错误: %+v", req)
+	}
+	req.Model = "claude-sonnet-4-5"
+	claudePath, data, err := EncodeCountTokensRequest(constant.DialectClaude, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claudeReq map[string]any
+	json.Unmarshal(data, &claudeReq)
+	if claudePath != "v1/messages/count_tokens" || claudeReq["max_tokens"] != nil || claudeReq["system"] == nil {
+		t.Fatalf("claude 计数请求错误: %s", data)
+	}
+	tokens, err := DecodeCountTokensResponse(constant.DialectClaude, []byte(`{"input_tokens":12}`))
+	if err != nil || tokens != 12 {
+		t.Fatalf("claude 计数响应解析错误: %d %v", tokens, err)
+	}
+	data, _ = EncodeCountTokensResponse(constant.DialectGemini, tokens)
+	var geminiResp gemini.CountTokensResponse
+	if json.Unmarshal(data, &geminiResp); geminiResp.TotalTokens != 12 {
+		t.Fatalf("gemini 计数响应错误: %s", data)
+	}
+	if _, _, err := EncodeCountTokensRequest(constant.DialectOpenAI, req); err == nil {
+		t.Fatal("openai 没有计数接口")
+	}
+	// contents 形式
+	req, _ = DecodeCountTokensRequest(constant.DialectGemini, path, []byte(`{"contents":[{"parts":[{"text":"hi"}]}]}`))
+	geminiPath, data, _ := EncodeCountTokensRequest(constant.DialectGemini, req)
+	var geminiReq gemini.CountTokensRequest
+	json.Unmarshal(data, &geminiReq)
+	if geminiPath != path || geminiReq.GenerateContentRequest.Model != "models/gemini-2.5-flash" {
+		t.Fatalf("gemini 计数请求错误: %s %s", geminiPath, data)
+	}
+}
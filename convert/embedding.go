@@ -0,0 +1,315 @@
+package convert
+
+/*
+embeddings 接口的转换
+openai /v1/embeddings <-> general.EmbeddingRequest <-> gemini embedContent、batchEmbedContents
+上游单次调用的输入条数有上限，超过时拆分为多次调用后合并
+*/
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+// 各协议单次调用的输入条数上限
+const (
+	geminiEmbeddingBatchLimit = 100
+	openaiEmbeddingBatchLimit = 2048
+)
+
+// EmbeddingEndpoint 是否为 embeddings 接口
+func EmbeddingEndpoint(dialect string, path string) bool {
+	switch dialect {
+	case constant.DialectGemini:
+		_, method := GeminiPath(path)
+		return method == "embedContent" || method == "batchEmbedContents"
+	case constant.DialectOpenAI:
+		return strings.HasSuffix(strings.TrimSuffix(path, "/"), "embeddings")
+	}
+	return false
+}
+
+// EmbeddingBatchLimit 上游协议单次调用的输入条数上限，0 表示不支持 embeddings
+func EmbeddingBatchLimit(dialect string) int {
+	switch dialect {
+	case constant.DialectGemini:
+		return geminiEmbeddingBatchLimit
+	case constant.DialectOpenAI, constant.DialectResponses:
+		return openaiEmbeddingBatchLimit
+	}
+	return 0
+}
+
+// DecodeEmbeddingRequest gemini 的模型从路径中获取，批量请求中各请求的模型以路径为准
+func DecodeEmbeddingRequest(dialect string, path string, body []byte) (*general.EmbeddingRequest, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		model, method := GeminiPath(path)
+		if method == "batchEmbedContents" {
+			var req gemini.BatchEmbedContentsRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				return nil, err
+			}
+			result := &general.EmbeddingRequest{Model: model, Batch: true}
+			for i, item := range req.Requests {
+				if i == 0 {
+					geminiEmbeddingOptions(item, result)
+				}
+				result.Inputs = append(result.Inputs, geminiEmbeddingContent(item.Content))
+			}
+			return result, nil
+		}
+		var req gemini.EmbedContentRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		result := &general.EmbeddingRequest{Model: model, Inputs: []general.Content{geminiEmbeddingContent(req.Content)}}
+		geminiEmbeddingOptions(req, result)
+		return result, nil
+	case constant.DialectOpenAI:
+		var req openai.EmbeddingRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		result := &general.EmbeddingRequest{
+			Model:          req.Model,
+			Tokens:         req.Input.Tokens,
+			Batch:          req.Input.Batch,
+			Dimensions:     req.Dimensions,
+			EncodingFormat: req.EncodingFormat,
+		}
+		for _, text := range req.Input.Texts {
+			result.Inputs = append(result.Inputs, general.Content{Role: general.RoleUser, Parts: []general.Part{textPart(text)}})
+		}
+		return result, nil
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+func geminiEmbeddingOptions(req gemini.EmbedContentRequest, result *general.EmbeddingRequest) {
+	result.TaskType = req.TaskType
+	result.Title = req.Title
+	result.Dimensions = req.OutputDimensionality
+}
+
+func geminiEmbeddingContent(content *gemini.Content) general.Content {
+	if content == nil {
+		return general.Content{Role: general.RoleUser}
+	}
+	result := geminiContentToGeneral(*content)
+	result.Role = general.RoleUser
+	return result
+}
+
+// EncodeEmbeddingRequest 返回上游路径与请求体，gemini 统一使用 batchEmbedContents
+func EncodeEmbeddingRequest(dialect string, req *general.EmbeddingRequest) (string, []byte, error) {
+	var path string
+	var body any
+	switch dialect {
+	case constant.DialectGemini:
+		if req.Tokens != nil {
+			return "", nil, &UnsupportedError{Message: "gemini embeddings do not support token array input"}
+		}
+		batch := gemini.BatchEmbedContentsRequest{Requests: []gemini.EmbedContentRequest{}}
+		for _, input := range req.Inputs {
+			content := generalContentToGemini(input)
+			content.Role = ""
+			batch.Requests = append(batch.Requests, gemini.EmbedContentRequest{
+				Model:                "models/" + req.Model,
+				Content:              &content,
+				TaskType:             req.TaskType,
+				Title:                req.Title,
+				OutputDimensionality: req.Dimensions,
+			})
+		}
+		path, body = "v1beta/models/"+req.Model+":batchEmbedContents", batch
+	case constant.DialectOpenAI, constant.DialectResponses:
+		// 向量统一按 float 获取，需要 base64 时由网关编码
+		result := openai.EmbeddingRequest{
+			Model:          req.Model,
+			Input:          openai.EmbeddingInput{Tokens: req.Tokens, Batch: true},
+			EncodingFormat: general.EncodingFormatFloat,
+			Dimensions:     req.Dimensions,
+		}
+		for _, input := range req.Inputs {
+			if len(input.Parts) == 0 || !allText(input.Parts) {
+				return "", nil, &UnsupportedError{Message: "openai embeddings only support text input"}
+			}
+			result.Input.Texts = append(result.Input.Texts, partsText(input.Parts))
+		}
+		path, body = "v1/embeddings", result
+	default:
+		return "", nil, &UnsupportedError{Message: dialect + " does not support embeddings"}
+	}
+	data, err := json.Marshal(body)
+	return path, data, err
+}
+
+func allText(parts []general.Part) bool {
+	for _, part := range parts {
+		if part.Text == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeEmbeddingResponse 上游 embeddings 响应转换为通用响应
+func DecodeEmbeddingResponse(dialect string, body []byte) (*general.EmbeddingResponse, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		// batchEmbedContents 返回 embeddings，embedContent 返回 embedding
+		var resp struct {
+			gemini.BatchEmbedContentsResponse
+			Embedding *gemini.ContentEmbedding `json:"embedding"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		embeddings := resp.Embeddings
+		if resp.Embedding != nil {
+			embeddings = append(embeddings, *resp.Embedding)
+		}
+		result := &general.EmbeddingResponse{}
+		for i, embedding := range embeddings {
+			result.Embeddings = append(result.Embeddings, general.Embedding{Index: i, Values: embedding.Values})
+		}
+		return result, nil
+	case constant.DialectOpenAI, constant.DialectResponses:
+		var resp openai.EmbeddingResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		result := &general.EmbeddingResponse{Model: resp.Model}
+		for _, data := range resp.Data {
+			values, err := decodeEmbeddingValues(data.Embedding)
+			if err != nil {
+				return nil, err
+			}
+			result.Embeddings = append(result.Embeddings, general.Embedding{Index: data.Index, Values: values})
+		}
+		if resp.Usage != nil {
+			result.Usage = &general.Usage{PromptTokens: resp.Usage.PromptTokens, TotalTokens: resp.Usage.TotalTokens}
+		}
+		return result, nil
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// EncodeEmbeddingResponse 按客户端请求的格式输出，gemini 单条请求输出 embedContent 的格式
+func EncodeEmbeddingResponse(dialect string, req *general.EmbeddingRequest, resp *general.EmbeddingResponse) ([]byte, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		if !req.Batch {
+			result := gemini.EmbedContentResponse{Embedding: &gemini.ContentEmbedding{Values: []float32{}}}
+			if len(resp.Embeddings) > 0 {
+				result.Embedding.Values = resp.Embeddings[0].Values
+			}
+			return json.Marshal(result)
+		}
+		result := gemini.BatchEmbedContentsResponse{Embeddings: []gemini.ContentEmbedding{}}
+		for _, embedding := range resp.Embeddings {
+			result.Embeddings = append(result.Embeddings, gemini.ContentEmbedding{Values: embedding.Values})
+		}
+		return json.Marshal(result)
+	case constant.DialectOpenAI:
+		result := openai.EmbeddingResponse{Object: "list", Data: []openai.Embedding{}, Model: resp.Model, Usage: &openai.EmbeddingUsage{}}
+		for _, embedding := range resp.Embeddings {
+			values, err := encodeEmbeddingValues(embedding.Values, req.EncodingFormat)
+			if err != nil {
+				return nil, err
+			}
+			result.Data = append(result.Data, openai.Embedding{Object: "embedding", Index: embedding.Index, Embedding: values})
+		}
+		if usage := resp.Usage; usage != nil {
+			result.Usage.PromptTokens, result.Usage.TotalTokens = usage.PromptTokens, usage.TotalTokens
+		}
+		return json.Marshal(result)
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// decodeEmbeddingValues embedding 为 float 数组或 float32 小端序的 base64 字符串
+func decodeEmbeddingValues(data json.RawMessage) ([]float32, error) {
+	var encoded string
+	if json.Unmarshal(data, &encoded) != nil {
+		var values []float32
+		err := json.Unmarshal(data, &values)
+		return values, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float32, len(raw)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return values, nil
+}
+
+func encodeEmbeddingValues(values []float32, format string) (json.RawMessage, error) {
+	if format != general.EncodingFormatBase64 {
+		if values == nil {
+			values = []float32{}
+		}
+		return json.Marshal(values)
+	}
+	raw := make([]byte, len(values)*4)
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(value))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(raw))
+}
+
+// SplitEmbeddingRequest 按上游单次调用的输入条数上限拆分请求，size <= 0 时不拆分
+func SplitEmbeddingRequest(req *general.EmbeddingRequest, size int) []*general.EmbeddingRequest {
+	total := max(len(req.Inputs), len(req.Tokens))
+	if size <= 0 || total <= size {
+		return []*general.EmbeddingRequest{req}
+	}
+	var result []*general.EmbeddingRequest
+	for start := 0; start < total; start += size {
+		end := min(start+size, total)
+		batch := *req
+		if req.Tokens != nil {
+			batch.Tokens = req.Tokens[start:end]
+		} else {
+			batch.Inputs = req.Inputs[start:end]
+		}
+		result = append(result, &batch)
+	}
+	return result
+}
+
+// MergeEmbeddingResponses 按拆分顺序合并响应，index 加上所在批次的偏移，用量累加
+func MergeEmbeddingResponses(resps []*general.EmbeddingResponse) *general.EmbeddingResponse {
+	result := &general.EmbeddingResponse{}
+	offset := 0
+	for _, resp := range resps {
+		if result.Model == "" {
+			result.Model = resp.Model
+		}
+		for _, embedding := range resp.Embeddings {
+			embedding.Index += offset
+			result.Embeddings = append(result.Embeddings, embedding)
+		}
+		offset += len(resp.Embeddings)
+		if usage := resp.Usage; usage != nil {
+			if result.Usage == nil {
+				result.Usage = &general.Usage{}
+			}
+			result.Usage.PromptTokens += usage.PromptTokens
+			result.Usage.TotalTokens += usage.TotalTokens
+		}
+	}
+	return result
+}
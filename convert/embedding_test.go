@@ -0,0 +1,102 @@
+package convert
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+func TestEmbeddingSplitMerge(t *testing.T) {
+	body := `{"model":"text-embedding-3-small","input":["a","bb","ccc","dddd","eeeee"],"dimensions":2,"encoding_format":"base64"}`
+	req, err := DecodeEmbeddingRequest(constant.DialectOpenAI, "v1/embeddings", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := SplitEmbeddingRequest(req, 2)
+	if len(batches) != 3 || len(batches[2].Inputs) != 1 {
+		t.Fatalf("拆分错误: %d", len(batches))
+	}
+	var resps []*general.EmbeddingResponse
+	for _, batch := range batches {
+		path, data, err := EncodeEmbeddingRequest(constant.DialectGemini, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != "v1beta/models/text-embedding-3-small:batchEmbedContents" {
+			t.Fatalf("gemini 路径错误: %s", path)
+		}
+		var geminiReq gemini.BatchEmbedContentsRequest
+		json.Unmarshal(data, &geminiReq)
+		// 按输入长度构造上游响应
+		geminiResp := gemini.BatchEmbedContentsResponse{}
+		for _, item := range geminiReq.Requests {
+			if *item.OutputDimensionality != 2 || item.Model != "models/text-embedding-3-small" {
+				t.Fatalf("gemini 请求转换错误: %s", data)
+			}
+			geminiResp.Embeddings = append(geminiResp.Embeddings, gemini.ContentEmbedding{Values: []float32{float32(len(*item.Content.Parts[0].Text)), 0.5}})
+		}
+		data, _ = json.Marshal(geminiResp)
+		resp, err := DecodeEmbeddingResponse(constant.DialectGemini, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+	}
+	data, err := EncodeEmbeddingResponse(constant.DialectOpenAI, req, MergeEmbeddingResponses(resps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := DecodeEmbeddingResponse(constant.DialectOpenAI, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Embeddings) != 5 {
+		t.Fatalf("合并数量错误: %s", data)
+	}
+	for i, embedding := range merged.Embeddings {
+		if embedding.Index != i || embedding.Values[0] != float32(i+1) || embedding.Values[1] != 0.5 {
+			t.Fatalf("合并顺序或 base64 编码错误: %+v", embedding)
+		}
+	}
+}
+
+func TestEmbeddingDialects(t *testing.T) {
+	body := `{"content":{"parts":[{"text":"hello"}]},"taskType":"RETRIEVAL_QUERY"}`
+	req, err := DecodeEmbeddingRequest(constant.DialectGemini, "v1beta/models/text-embedding-004:embedContent", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data, err := EncodeEmbeddingRequest(constant.DialectOpenAI, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"model":"text-embedding-004","input":["hello"],"encoding_format":"float"}` {
+		t.Fatalf("openai 请求转换错误: %s", data)
+	}
+	resp, _ := DecodeEmbeddingResponse(constant.DialectOpenAI, []byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"m","usage":{"prompt_tokens":1,"total_tokens":1}}`))
+	data, _ = EncodeEmbeddingResponse(constant.DialectGemini, req, resp)
+	if string(data) != `{"embedding":{"values":[0.1,0.2]}}` {
+		t.Fatalf("gemini embedContent 响应错误: %s", data)
+	}
+
+	// token 数组只能发往 openai 兼容的上游
+	req, err = DecodeEmbeddingRequest(constant.DialectOpenAI, "v1/embeddings", []byte(`{"model":"m","input":[[1,2],[3]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := EncodeEmbeddingRequest(constant.DialectGemini, req); err == nil {
+		t.Fatal("gemini 不应支持 token 数组输入")
+	}
+	_, data, _ = EncodeEmbeddingRequest(constant.DialectOpenAI, req)
+	var openaiReq openai.EmbeddingRequest
+	if json.Unmarshal(data, &openaiReq); len(openaiReq.Input.Tokens) != 2 {
+		t.Fatalf("token 数组转换错误: %s", data)
+	}
+	if _, _, err := EncodeEmbeddingRequest(constant.DialectClaude, req); err == nil {
+		t.Fatal("claude 不支持 embeddings")
+	}
+}
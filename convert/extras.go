@@ -0,0 +1,62 @@
+package convert
+
+/*
+gemini 与通用格式之间保留未建模字段
+gemini 的未建模字段以及通用格式没有对应的字段保存在通用格式同一层级的 Extras 中，转换回 gemini 时原样写回
+其它协议不读取 Extras，这些字段不会带到其它协议
+*/
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+
+	"github.com/lijcoder/aiapi/messages"
+)
+
+// mergeExtras fields 中非零值的字段序列化后加入 extras，不修改原 extras
+func mergeExtras(extras messages.Extras, fields map[string]any) messages.Extras {
+	var result messages.Extras
+	for key, value := range fields {
+		if v := reflect.ValueOf(value); !v.IsValid() || v.IsZero() {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		if result == nil {
+			result = maps.Clone(extras)
+			if result == nil {
+				result = messages.Extras{}
+			}
+		}
+		result[key] = data
+	}
+	if result == nil {
+		return extras
+	}
+	return result
+}
+
+// splitExtras extras 中与 fields 同名的字段反序列化到对应指针，返回剩余字段
+func splitExtras(extras messages.Extras, fields map[string]any) messages.Extras {
+	var result messages.Extras
+	for key, target := range fields {
+		data, ok := extras[key]
+		if !ok || json.Unmarshal(data, target) != nil {
+			continue
+		}
+		if result == nil {
+			result = maps.Clone(extras)
+		}
+		delete(result, key)
+	}
+	if result == nil {
+		return extras
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
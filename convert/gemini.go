@@ -0,0 +1,460 @@
+package convert
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+const (
+	geminiRoleModel    = "model"
+	geminiRoleUser     = "user"
+	geminiMimeTypeJson = "application/json"
+)
+
+var geminiPathPattern = regexp.MustCompile(`models/([^/:]+):(\w+)`)
+
+// GeminiPath 从请求路径中解析模型与方法，例如 v1beta/models/gemini-2.5-flash:streamGenerateContent
+func GeminiPath(path string) (model string, method string) {
+	match := geminiPathPattern.FindStringSubmatch(path)
+	if match == nil {
+		return "", ""
+	}
+	return match[1], match[2]
+}
+
+// GeminiRequestToGeneral gemini 请求中没有 model 与 stream，由请求路径决定
+func GeminiRequestToGeneral(req *gemini.Request, model string, stream bool) *general.Request {
+	result := &general.Request{
+		Stream:           stream,
+		Model:            model,
+		Tools:            geminiToolsToGeneral(req.Tools),
+		ToolConfig:       geminiToolConfigToGeneral(req.ToolConfig),
+		GenerationConfig: geminiGenerationConfigToGeneral(req.GenerationConfig),
+		Extras:           mergeExtras(req.Extras, map[string]any{"safetySettings": req.SafetySettings, "cachedContent": req.CachedContent}),
+	}
+	for _, content := range req.Contents {
+		result.Contents = append(result.Contents, geminiContentToGeneral(content))
+	}
+	fillToolCallIds(result.Contents, sequenceCallId())
+	if req.SystemInstruction != nil {
+		content := geminiContentToGeneral(*req.SystemInstruction)
+		content.Role = general.RoleSystem
+		result.SystemInstruction = &content
+	}
+	return result
+}
+
+func GeneralRequestToGemini(req *general.Request) *gemini.Request {
+	result := &gemini.Request{
+		Tools:            generalToolsToGemini(req.Tools),
+		GenerationConfig: generalGenerationConfigToGemini(req.GenerationConfig),
+	}
+	result.Extras = splitExtras(req.Extras, map[string]any{"safetySettings": &result.SafetySettings, "cachedContent": &result.CachedContent})
+	for _, content := range req.Contents {
+		// 其它协议的思考签名对 gemini 无效，历史中的思考内容不再回传
+		content.Parts = withoutThoughts(content.Parts)
+		result.Contents = append(result.Contents, generalContentToGemini(content))
+	}
+	if req.SystemInstruction != nil {
+		content := generalContentToGemini(*req.SystemInstruction)
+		content.Role = ""
+		result.SystemInstruction = &content
+	}
+	generalToolConfigToGemini(req.ToolConfig, result)
+	return result
+}
+
+func geminiContentToGeneral(content gemini.Content) general.Content {
+	result := general.Content{Role: general.RoleUser, Extras: content.Extras}
+	if content.Role == geminiRoleModel {
+		result.Role = general.RoleAssistant
+	}
+	for _, part := range content.Parts {
+		result.Parts = append(result.Parts, geminiPartToGeneral(part))
+	}
+	return result
+}
+
+func generalContentToGemini(content general.Content) gemini.Content {
+	result := gemini.Content{Role: geminiRoleUser, Extras: content.Extras}
+	if content.Role == general.RoleAssistant {
+		result.Role = geminiRoleModel
+	}
+	for _, part := range content.Parts {
+		result.Parts = append(result.Parts, generalPartToGemini(part))
+	}
+	return result
+}
+
+func geminiPartToGeneral(part gemini.Part) general.Part {
+	result := general.Part{Text: part.Text, Thought: part.Thought, ThoughtSignature: part.ThoughtSignature, Extras: part.Extras}
+	if part.InlineData != nil {
+		result.InlineData = &general.Blob{MimeType: part.InlineData.MimeType, Data: part.InlineData.Data, Extras: part.InlineData.Extras}
+	}
+	if part.FileData != nil {
+		result.FileData = &general.FileData{MimeType: part.FileData.MimeType, FileUri: part.FileData.FileUri, Extras: part.FileData.Extras}
+	}
+	if part.ExecutableCode != nil {
+		result.ExecutableCode = &general.ExecutableCode{Language: part.ExecutableCode.Language, Code: part.ExecutableCode.Code, Extras: part.ExecutableCode.Extras}
+	}
+	if part.CodeExecutionResult != nil {
+		result.CodeExecutionResult = &general.CodeExecutionResult{
+			Outcome: part.CodeExecutionResult.Outcome,
+			Output:  part.CodeExecutionResult.Output,
+			Extras:  part.CodeExecutionResult.Extras,
+		}
+	}
+	if part.FunctionCall != nil {
+		result.FunctionCall = &general.FunctionCall{
+			Id:     part.FunctionCall.Id,
+			Name:   part.FunctionCall.Name,
+			Args:   part.FunctionCall.Args,
+			Extras: part.FunctionCall.Extras,
+		}
+	}
+	if part.FunctionResponse != nil {
+		result.FunctionResponse = &general.FunctionResponse{
+			Id:   part.FunctionResponse.Id,
+			Name: part.FunctionResponse.Name,
+			Response: general.FunctionResponseContent{
+				Output: part.FunctionResponse.Response.Output,
+				Error:  part.FunctionResponse.Response.Error,
+				Extras: part.FunctionResponse.Response.Extras,
+			},
+			Extras: part.FunctionResponse.Extras,
+		}
+	}
+	return result
+}
+
+func generalPartToGemini(part general.Part) gemini.Part {
+	result := gemini.Part{Text: part.Text, Thought: part.Thought, ThoughtSignature: part.ThoughtSignature, Extras: part.Extras}
+	if part.InlineData != nil {
+		result.InlineData = &gemini.Blob{MimeType: part.InlineData.MimeType, Data: part.InlineData.Data, Extras: part.InlineData.Extras}
+	}
+	if part.FileData != nil {
+		result.FileData = &gemini.FileData{MimeType: part.FileData.MimeType, FileUri: part.FileData.FileUri, Extras: part.FileData.Extras}
+	}
+	if part.ExecutableCode != nil {
+		result.ExecutableCode = &gemini.ExecutableCode{Language: part.ExecutableCode.Language, Code: part.ExecutableCode.Code, Extras: part.ExecutableCode.Extras}
+	}
+	if part.CodeExecutionResult != nil {
+		result.CodeExecutionResult = &gemini.CodeExecutionResult{
+			Outcome: part.CodeExecutionResult.Outcome,
+			Output:  part.CodeExecutionResult.Output,
+			Extras:  part.CodeExecutionResult.Extras,
+		}
+	}
+	if part.FunctionCall != nil {
+		result.FunctionCall = &gemini.FunctionCall{
+			Id:     part.FunctionCall.Id,
+			Name:   part.FunctionCall.Name,
+			Args:   part.FunctionCall.Args,
+			Extras: part.FunctionCall.Extras,
+		}
+	}
+	if part.FunctionResponse != nil {
+		result.FunctionResponse = &gemini.FunctionResponse{
+			Id:   part.FunctionResponse.Id,
+			Name: part.FunctionResponse.Name,
+			Response: gemini.FunctionResponseContent{
+				Output: part.FunctionResponse.Response.Output,
+				Error:  part.FunctionResponse.Response.Error,
+				Extras: part.FunctionResponse.Response.Extras,
+			},
+			Extras: part.FunctionResponse.Extras,
+		}
+	}
+	return result
+}
+
+func geminiToolsToGeneral(tools []gemini.Tool) []general.Tool {
+	var result []general.Tool
+	for _, tool := range tools {
+		generalTool := general.Tool{}
+		for _, fd := range tool.FunctionDeclarations {
+			declaration := general.FunctionDeclaration{Name: fd.Name, Description: fd.Description}
+			if fd.ParametersJsonSchema != nil {
+				declaration.Parameters = general.ParametersJsonSchema(fd.ParametersJsonSchema)
+			} else if fd.Parameters != nil {
+				declaration.Parameters = *fd.Parameters
+			}
+			generalTool.FunctionDeclarations = append(generalTool.FunctionDeclarations, declaration)
+		}
+		if tool.GoogleSearch != nil {
+			generalTool.WebSearch = ptr(true)
+		}
+		if tool.CodeExecution != nil {
+			generalTool.CodeExecution = ptr(true)
+		}
+		if tool.UrlContext != nil {
+			generalTool.UrlContext = ptr(true)
+		}
+		result = append(result, generalTool)
+	}
+	return result
+}
+
+func generalToolsToGemini(tools []general.Tool) []gemini.Tool {
+	var result []gemini.Tool
+	for _, tool := range tools {
+		geminiTool := gemini.Tool{}
+		for _, fd := range tool.FunctionDeclarations {
+			declaration := gemini.FunctionDeclaration{Name: fd.Name, Description: fd.Description}
+			if parameters, _ := ToolSchema(constant.DialectGemini, fd.Parameters); parameters != nil {
+				declaration.Parameters = &parameters
+			}
+			geminiTool.FunctionDeclarations = append(geminiTool.FunctionDeclarations, declaration)
+		}
+		if len(geminiTool.FunctionDeclarations) > 0 {
+			result = append(result, geminiTool)
+		}
+	}
+	return append(result, generalBuiltinToolsToGemini(tools)...)
+}
+
+func geminiGenerationConfigToGeneral(config *gemini.GenerationConfig) *general.GenerationConfig {
+	if config == nil {
+		return nil
+	}
+	result := &general.GenerationConfig{
+		StopSequences:    config.StopSequences,
+		MaxOutputTokens:  config.MaxOutputTokens,
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		TopK:             config.TopK,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+		CandidateCount:   config.CandidateCount,
+		Seed:             config.Seed,
+		Extras:           mergeExtras(config.Extras, map[string]any{"mediaResolution": config.MediaResolution}),
+	}
+	// logprobs 只有在 responseLogprobs 开启时生效
+	if config.ResponseLogprobs != nil && *config.ResponseLogprobs {
+		logprobs := 0
+		if config.Logprobs != nil {
+			logprobs = *config.Logprobs
+		}
+		result.Logprobs = &logprobs
+	}
+	for _, modality := range config.ResponseModalities {
+		result.ResponseModalities = append(result.ResponseModalities, strings.ToLower(modality))
+	}
+	if speech := config.SpeechConfig; speech != nil {
+		result.Speech = &general.SpeechConfig{LanguageCode: speech.LanguageCode}
+		if voice := speech.VoiceConfig; voice != nil && voice.PrebuiltVoiceConfig != nil {
+			result.Speech.Voice = voice.PrebuiltVoiceConfig.VoiceName
+		}
+	}
+	if thinking := config.ThinkingConfig; thinking != nil {
+		result.Reasoning = &general.ReasoningConfig{
+			Effort:          strings.ToLower(stringValue(thinking.ThinkingLevel)),
+			BudgetTokens:    thinking.ThinkingBudget,
+			IncludeThoughts: thinking.IncludeThoughts,
+		}
+	}
+	if stringValue(config.ResponseMimeType) == geminiMimeTypeJson {
+		result.ResponseFormat = &general.ResponseFormat{Type: general.ResponseFormatJsonObject}
+		if config.ResponseJsonSchema != nil {
+			result.ResponseFormat = &general.ResponseFormat{Type: general.ResponseFormatJsonSchema, Schema: *config.ResponseJsonSchema}
+		} else if config.ResponseSchema != nil {
+			result.ResponseFormat = &general.ResponseFormat{Type: general.ResponseFormatJsonSchema, Schema: *config.ResponseSchema}
+		}
+	}
+	return result
+}
+
+func generalGenerationConfigToGemini(config *general.GenerationConfig) *gemini.GenerationConfig {
+	if config == nil {
+		return nil
+	}
+	result := &gemini.GenerationConfig{
+		StopSequences:    config.StopSequences,
+		MaxOutputTokens:  config.MaxOutputTokens,
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		TopK:             config.TopK,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+		CandidateCount:   config.CandidateCount,
+		Seed:             config.Seed,
+	}
+	result.Extras = splitExtras(config.Extras, map[string]any{"mediaResolution": &result.MediaResolution})
+	if config.Logprobs != nil {
+		result.ResponseLogprobs = ptr(true)
+		if *config.Logprobs > 0 {
+			result.Logprobs = config.Logprobs
+		}
+	}
+	for _, modality := range config.ResponseModalities {
+		result.ResponseModalities = append(result.ResponseModalities, strings.ToUpper(modality))
+	}
+	if speech := config.Speech; speech != nil {
+		result.SpeechConfig = &gemini.SpeechConfig{LanguageCode: speech.LanguageCode}
+		if speech.Voice != "" {
+			result.SpeechConfig.VoiceConfig = &gemini.VoiceConfig{PrebuiltVoiceConfig: &gemini.PrebuiltVoiceConfig{VoiceName: speech.Voice}}
+		}
+	}
+	// thinkingLevel 只有新模型支持，统一使用 thinkingBudget
+	if reasoning := config.Reasoning; reasoning != nil {
+		thinking := &gemini.ThinkingConfig{IncludeThoughts: reasoning.IncludeThoughts}
+		if budget, ok := reasoningBudget(reasoning); ok {
+			thinking.ThinkingBudget = &budget
+		}
+		if thinking.IncludeThoughts != nil || thinking.ThinkingBudget != nil {
+			result.ThinkingConfig = thinking
+		}
+	}
+	// responseSchema 所有模型都支持，schema 降级为 OpenAPI 子集
+	if format := config.ResponseFormat; format != nil && format.Type != general.ResponseFormatText {
+		result.ResponseMimeType = ptr(geminiMimeTypeJson)
+		if format.Type == general.ResponseFormatJsonSchema && format.Schema != nil {
+			schema := NormalizeSchema(constant.DialectGemini, format.Schema, false)
+			result.ResponseSchema = &schema
+		}
+	}
+	return result
+}
+
+func GeminiResponseToGeneral(resp *gemini.Response) *general.Response {
+	result := &general.Response{
+		Id:     stringValue(resp.ResponseId),
+		Model:  stringValue(resp.ModelVersion),
+		Extras: mergeExtras(resp.Extras, map[string]any{"promptFeedback": resp.PromptFeedback}),
+	}
+	for i, candidate := range resp.Candidates {
+		generalCandidate := general.Candidate{Index: i, Extras: mergeExtras(candidate.Extras, map[string]any{
+			"safetyRatings":  candidate.SafetyRatings,
+			"logprobsResult": candidate.LogprobsResult,
+			"avgLogprobs":    candidate.AvgLogprobs,
+			"tokenCount":     candidate.TokenCount,
+			"finishMessage":  candidate.FinishMessage,
+		})}
+		if candidate.Index != nil {
+			generalCandidate.Index = *candidate.Index
+		}
+		if candidate.Content != nil {
+			content := geminiContentToGeneral(*candidate.Content)
+			content.Role = general.RoleAssistant
+			fillToolCallIds([]general.Content{content}, func() string { return newId("call_") })
+			generalCandidate.Content = &content
+		}
+		if candidate.FinishReason != nil {
+			generalCandidate.FinishReason = geminiFinishReasonToGeneral(*candidate.FinishReason, generalCandidate.Content)
+		}
+		generalCandidate.Citations, generalCandidate.SearchQueries = geminiCitationsToGeneral(candidate)
+		result.Candidates = append(result.Candidates, generalCandidate)
+	}
+	// 提示词被拦截时没有候选，其它协议需要一个内容过滤的结束原因
+	if feedback := resp.PromptFeedback; feedback != nil && feedback.BlockReason != "" && len(resp.Candidates) == 0 {
+		result.Candidates = []general.Candidate{{FinishReason: general.FinishReasonContentFilter}}
+	}
+	if usage := resp.UsageMetadata; usage != nil {
+		result.Usage = &general.Usage{
+			PromptTokens:     intValue(usage.PromptTokenCount),
+			CompletionTokens: intValue(usage.CandidatesTokenCount) + intValue(usage.ThoughtsTokenCount),
+			TotalTokens:      intValue(usage.TotalTokenCount),
+			CachedTokens:     intValue(usage.CachedContentTokenCount),
+			ReasoningTokens:  intValue(usage.ThoughtsTokenCount),
+			Extras: mergeExtras(usage.Extras, map[string]any{
+				"toolUsePromptTokenCount":    usage.ToolUsePromptTokenCount,
+				"promptTokensDetails":        usage.PromptTokensDetails,
+				"cacheTokensDetails":         usage.CacheTokensDetails,
+				"candidatesTokensDetails":    usage.CandidatesTokensDetails,
+				"toolUsePromptTokensDetails": usage.ToolUsePromptTokensDetails,
+			}),
+		}
+	}
+	return result
+}
+
+func GeneralResponseToGemini(resp *general.Response) *gemini.Response {
+	result := &gemini.Response{}
+	result.Extras = splitExtras(resp.Extras, map[string]any{"promptFeedback": &result.PromptFeedback})
+	if resp.Id != "" {
+		result.ResponseId = ptr(resp.Id)
+	}
+	if resp.Model != "" {
+		result.ModelVersion = ptr(resp.Model)
+	}
+	for _, candidate := range resp.Candidates {
+		geminiCandidate := gemini.Candidate{Index: ptr(candidate.Index)}
+		geminiCandidate.Extras = splitExtras(candidate.Extras, map[string]any{
+			"safetyRatings":  &geminiCandidate.SafetyRatings,
+			"logprobsResult": &geminiCandidate.LogprobsResult,
+			"avgLogprobs":    &geminiCandidate.AvgLogprobs,
+			"tokenCount":     &geminiCandidate.TokenCount,
+			"finishMessage":  &geminiCandidate.FinishMessage,
+		})
+		if candidate.Content != nil {
+			content := generalContentToGemini(*candidate.Content)
+			content.Role = geminiRoleModel
+			geminiCandidate.Content = &content
+		}
+		if candidate.FinishReason != "" {
+			geminiCandidate.FinishReason = ptr(generalFinishReasonToGemini(candidate.FinishReason))
+		}
+		geminiCandidate.GroundingMetadata = generalCitationsToGemini(candidate.Citations, candidate.SearchQueries)
+		result.Candidates = append(result.Candidates, geminiCandidate)
+	}
+	// 提示词被拦截时转换为通用格式补充的候选不再输出
+	if feedback := result.PromptFeedback; feedback != nil && feedback.BlockReason != "" && len(result.Candidates) == 1 && result.Candidates[0].Content == nil {
+		result.Candidates = nil
+	}
+	if usage := resp.Usage; usage != nil {
+		result.UsageMetadata = &gemini.UsageMetadata{
+			PromptTokenCount:     ptr(usage.PromptTokens),
+			CandidatesTokenCount: ptr(usage.CompletionTokens - usage.ReasoningTokens),
+			TotalTokenCount:      ptr(usage.TotalTokens),
+		}
+		metadata := result.UsageMetadata
+		metadata.Extras = splitExtras(usage.Extras, map[string]any{
+			"toolUsePromptTokenCount":    &metadata.ToolUsePromptTokenCount,
+			"promptTokensDetails":        &metadata.PromptTokensDetails,
+			"cacheTokensDetails":         &metadata.CacheTokensDetails,
+			"candidatesTokensDetails":    &metadata.CandidatesTokensDetails,
+			"toolUsePromptTokensDetails": &metadata.ToolUsePromptTokensDetails,
+		})
+		if usage.CachedTokens > 0 {
+			result.UsageMetadata.CachedContentTokenCount = ptr(usage.CachedTokens)
+		}
+		if usage.ReasoningTokens > 0 {
+			result.UsageMetadata.ThoughtsTokenCount = ptr(usage.ReasoningTokens)
+		}
+	}
+	return result
+}
+
+// geminiFinishReasonToGeneral gemini 调用函数时结束原因仍为 STOP
+func geminiFinishReasonToGeneral(reason string, content *general.Content) string {
+	switch reason {
+	case "STOP":
+		if content != nil && hasFunctionCall(content.Parts) {
+			return general.FinishReasonToolCalls
+		}
+		return general.FinishReasonStop
+	case "MAX_TOKENS":
+		return general.FinishReasonLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return general.FinishReasonContentFilter
+	case "FINISH_REASON_UNSPECIFIED":
+		return ""
+	}
+	return general.FinishReasonError
+}
+
+func generalFinishReasonToGemini(reason string) string {
+	switch reason {
+	case general.FinishReasonLength:
+		return "MAX_TOKENS"
+	case general.FinishReasonContentFilter:
+		return "SAFETY"
+	case general.FinishReasonError:
+		return "OTHER"
+	}
+	return "STOP"
+}
@@ -0,0 +1,67 @@
+package convert
+
+import (
+	"encoding/json"
+
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// geminiStreamDecoder gemini 每个事件都是完整的 Response，函数调用不会拆分
+type geminiStreamDecoder struct{}
+
+func (d *geminiStreamDecoder) Decode(event sse.Event) ([]*general.Response, error) {
+	if err := streamError(event.Data); err != nil {
+		return nil, err
+	}
+	var chunk gemini.Response
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return nil, err
+	}
+	return []*general.Response{GeminiResponseToGeneral(&chunk)}, nil
+}
+
+// Finish gemini 每个事件都是完整的，没有需要补齐的内容
+func (d *geminiStreamDecoder) Finish() []*general.Response {
+	return nil
+}
+
+// geminiStreamEncoder 用量挂在下一个包含候选的事件上，最后到达的用量在结束时单独输出
+type geminiStreamEncoder struct {
+	id    string
+	model string
+	usage *general.Usage
+	// 最新的用量是否已经输出
+	usageSent bool
+}
+
+func (e *geminiStreamEncoder) Encode(resp *general.Response) []sse.Event {
+	if resp.Usage != nil {
+		e.usage, e.usageSent = resp.Usage, false
+	}
+	if resp.Id != "" {
+		e.id = resp.Id
+	}
+	if resp.Model != "" {
+		e.model = resp.Model
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	chunk := *resp
+	chunk.Usage = e.usage
+	e.usageSent = true
+	if chunk.Model == "" {
+		chunk.Model = e.model
+	}
+	return []sse.Event{jsonEvent("", GeneralResponseToGemini(&chunk))}
+}
+
+func (e *geminiStreamEncoder) Finish() []sse.Event {
+	if e.usage == nil || e.usageSent {
+		return nil
+	}
+	e.usageSent = true
+	return []sse.Event{jsonEvent("", GeneralResponseToGemini(&general.Response{Id: e.id, Model: e.model, Usage: e.usage}))}
+}
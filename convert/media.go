@@ -0,0 +1,145 @@
+package convert
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// 未能识别文件类型时使用的默认值
+const defaultImageMimeType = "image/jpeg"
+
+// parseDataUrl 解析 data:image/png;base64,xxx，非 base64 编码的 data url 不支持
+func parseDataUrl(url string) (*general.Blob, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return nil, false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return nil, false
+	}
+	mimeType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return nil, false
+	}
+	return &general.Blob{MimeType: mimeType, Data: data}, true
+}
+
+func dataUrl(blob *general.Blob) string {
+	return "data:" + blob.MimeType + ";base64," + blob.Data
+}
+
+// guessMimeType 根据文件扩展名推断类型，推断不出时使用 def
+func guessMimeType(uri string, def string) string {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		uri = uri[:i]
+	}
+	if mimeType := mime.TypeByExtension(path.Ext(uri)); mimeType != "" {
+		mimeType, _, _ = strings.Cut(mimeType, ";")
+		return mimeType
+	}
+	return def
+}
+
+// sniffImageMimeType ollama 的图片只有 base64 数据，按文件头推断类型
+func sniffImageMimeType(data string) string {
+	// 只需要解码开头的部分，长度取 4 的倍数
+	head := data[:min(len(data), 64)]
+	decoded, err := base64.StdEncoding.DecodeString(head[:len(head)/4*4])
+	if err != nil {
+		return defaultImageMimeType
+	}
+	if mimeType := http.DetectContentType(decoded); isImage(mimeType) {
+		return mimeType
+	}
+	return defaultImageMimeType
+}
+
+func fileExtension(mimeType string) string {
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func isImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+func isHttpUrl(uri string) bool {
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// audioFormat openai input_audio 只支持 wav 与 mp3
+func audioFormat(mimeType string) (string, bool) {
+	switch mimeType {
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return "wav", true
+	case "audio/mp3", "audio/mpeg":
+		return "mp3", true
+	}
+	return "", false
+}
+
+// codeText 代码执行相关的 part 在不支持的协议中以 markdown 文本表示
+func codeText(part general.Part) (string, bool) {
+	if part.ExecutableCode != nil {
+		language := strings.ToLower(part.ExecutableCode.Language)
+		if language == "language_unspecified" {
+			language = ""
+		}
+		return "```" + language + "\n" + part.ExecutableCode.Code + "\n```", true
+	}
+	if part.CodeExecutionResult != nil {
+		return "```output\n" + part.CodeExecutionResult.Output + "\n```", true
+	}
+	return "", false
+}
+
+func decodeBase64Text(data string) string {
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return ""
+	}
+	return string(decoded)
+}
+
+// generalMediaError 目标协议无法表示的图片、音视频与文件返回错误，不能静默丢弃
+// claude 只支持图片与 pdf/纯文本文档；openai 用户消息支持图片、wav/mp3 音频、文件数据与文件 id
+func generalMediaError(dialect string, req *general.Request) error {
+	for _, content := range req.Contents {
+		for _, part := range content.Parts {
+			if part.InlineData == nil && part.FileData == nil {
+				continue
+			}
+			var ok bool
+			switch dialect {
+			case constant.DialectClaude:
+				_, ok = generalMediaToClaude(part)
+			case constant.DialectOpenAI:
+				// assistant 消息只能包含文本与工具调用
+				_, ok = generalPartToOpenAI(part)
+				ok = ok && content.Role != general.RoleAssistant
+			default:
+				return nil
+			}
+			if !ok {
+				return unsupported("%s media is not supported by the upstream %s api", mediaMimeType(part), dialect)
+			}
+		}
+	}
+	return nil
+}
+
+func mediaMimeType(part general.Part) string {
+	if part.InlineData != nil {
+		return part.InlineData.MimeType
+	}
+	return part.FileData.MimeType
+}
@@ -0,0 +1,441 @@
+package convert
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/ollama"
+)
+
+const (
+	ollamaRoleSystem    = "system"
+	ollamaRoleUser      = "user"
+	ollamaRoleAssistant = "assistant"
+	ollamaRoleTool      = "tool"
+)
+
+// ollama 的 format 为 "json" 时输出任意 JSON 对象
+const ollamaFormatJson = "json"
+
+// ollamaStream stream 未设置时默认为流式
+func ollamaStream(stream *bool) bool {
+	return stream == nil || *stream
+}
+
+func OllamaChatRequestToGeneral(req *ollama.ChatRequest) *general.Request {
+	result := &general.Request{
+		Stream: ollamaStream(req.Stream),
+		Model:  req.Model,
+		Tools:  ollamaToolsToGeneral(req.Tools),
+	}
+	for _, message := range req.Messages {
+		switch message.Role {
+		case ollamaRoleSystem:
+			if result.SystemInstruction == nil {
+				result.SystemInstruction = &general.Content{Role: general.RoleSystem}
+			}
+			result.SystemInstruction.Parts = append(result.SystemInstruction.Parts, textPart(message.Content))
+		case ollamaRoleTool:
+			output := message.Content
+			part := general.Part{FunctionResponse: &general.FunctionResponse{
+				Name:     message.ToolName,
+				Response: general.FunctionResponseContent{Output: &output},
+			}}
+			// 连续的 tool 消息合并为同一轮
+			if last := lastContent(result.Contents); last != nil && last.Role == general.RoleUser && isFunctionResponses(last.Parts) {
+				last.Parts = append(last.Parts, part)
+			} else {
+				result.Contents = append(result.Contents, general.Content{Role: general.RoleUser, Parts: []general.Part{part}})
+			}
+		case ollamaRoleAssistant:
+			result.Contents = append(result.Contents, general.Content{Role: general.RoleAssistant, Parts: ollamaAssistantParts(&message)})
+		default:
+			result.Contents = append(result.Contents, general.Content{Role: general.RoleUser, Parts: ollamaUserParts(message.Content, message.Images)})
+		}
+	}
+	// ollama 的函数调用没有 id，tool 消息按函数名对应
+	fillToolCallIds(result.Contents, sequenceCallId())
+	result.GenerationConfig = ollamaOptionsToGeneral(req.Options, req.Format, req.Think)
+	return result
+}
+
+// ollamaGenerateRequestError suffix、context、template 依赖 ollama 自身的 prompt 处理，在对话接口中没有对应
+func ollamaGenerateRequestError(req *ollama.GenerateRequest) error {
+	switch {
+	case req.Suffix != "":
+		return unsupported("suffix is not supported when converting ollama generate")
+	case len(req.Context) > 0:
+		return unsupported("context is not supported when converting ollama generate")
+	case req.Template != "":
+		return unsupported("template is not supported when converting ollama generate")
+	}
+	return nil
+}
+
+// OllamaGenerateRequestToGeneral prompt 与图片作为一条 user 消息，system 作为系统指令
+func OllamaGenerateRequestToGeneral(req *ollama.GenerateRequest) *general.Request {
+	result := &general.Request{
+		Stream:   ollamaStream(req.Stream),
+		Model:    req.Model,
+		Contents: []general.Content{{Role: general.RoleUser, Parts: ollamaUserParts(req.Prompt, req.Images)}},
+	}
+	if req.System != "" {
+		result.SystemInstruction = &general.Content{Role: general.RoleSystem, Parts: []general.Part{textPart(req.System)}}
+	}
+	result.GenerationConfig = ollamaOptionsToGeneral(req.Options, req.Format, req.Think)
+	return result
+}
+
+// ollamaUserParts images 只有 base64 数据，类型按文件头推断
+func ollamaUserParts(content string, images []string) []general.Part {
+	var parts []general.Part
+	if content != "" || len(images) == 0 {
+		parts = append(parts, textPart(content))
+	}
+	for _, image := range images {
+		parts = append(parts, general.Part{InlineData: &general.Blob{MimeType: sniffImageMimeType(image), Data: image}})
+	}
+	return parts
+}
+
+// ollamaAssistantParts thinking 作为思考内容放在最前面
+func ollamaAssistantParts(message *ollama.Message) []general.Part {
+	var parts []general.Part
+	if message.Thinking != "" {
+		parts = append(parts, thoughtPart(message.Thinking, ""))
+	}
+	if message.Content != "" {
+		parts = append(parts, textPart(message.Content))
+	}
+	for _, toolCall := range message.ToolCalls {
+		parts = append(parts, general.Part{FunctionCall: &general.FunctionCall{
+			Name: toolCall.Function.Name,
+			Args: toolCall.Function.Arguments,
+		}})
+	}
+	return parts
+}
+
+// ollamaOptionsToGeneral num_predict 为负数表示不限制；num_ctx、repeat_penalty 在其它协议中没有对应
+func ollamaOptionsToGeneral(options *ollama.Options, format json.RawMessage, think json.RawMessage) *general.GenerationConfig {
+	config := &general.GenerationConfig{
+		Reasoning:      ollamaThinkToGeneral(think),
+		ResponseFormat: ollamaFormatToGeneral(format),
+	}
+	if options != nil {
+		config.StopSequences = options.Stop
+		config.Temperature = options.Temperature
+		config.TopP = options.TopP
+		config.TopK = options.TopK
+		config.PresencePenalty = options.PresencePenalty
+		config.FrequencyPenalty = options.FrequencyPenalty
+		config.Seed = options.Seed
+		if options.NumPredict != nil && *options.NumPredict >= 0 {
+			config.MaxOutputTokens = options.NumPredict
+		}
+	}
+	return emptyGenerationConfig(config)
+}
+
+// ollamaFormatToGeneral format 为 "json" 或 JSON Schema 对象
+func ollamaFormatToGeneral(format json.RawMessage) *general.ResponseFormat {
+	if len(format) == 0 {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(format, &name); err == nil {
+		if name != ollamaFormatJson {
+			return nil
+		}
+		return &general.ResponseFormat{Type: general.ResponseFormatJsonObject}
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(format, &schema); err != nil || schema == nil {
+		return nil
+	}
+	return &general.ResponseFormat{Type: general.ResponseFormatJsonSchema, Schema: schema}
+}
+
+// ollamaThinkToGeneral think 为 bool 或推理强度 low、medium、high
+func ollamaThinkToGeneral(think json.RawMessage) *general.ReasoningConfig {
+	if len(think) == 0 {
+		return nil
+	}
+	var enabled bool
+	if err := json.Unmarshal(think, &enabled); err == nil {
+		if !enabled {
+			return &general.ReasoningConfig{Effort: general.ReasoningEffortNone}
+		}
+		return &general.ReasoningConfig{IncludeThoughts: ptr(true)}
+	}
+	var effort string
+	if err := json.Unmarshal(think, &effort); err == nil && effort != "" {
+		return &general.ReasoningConfig{Effort: effort, IncludeThoughts: ptr(true)}
+	}
+	return nil
+}
+
+// ollamaRequestError ollama 的图片只能内联，没有文件引用；generate 接口没有工具
+func ollamaRequestError(dialect string, req *general.Request) error {
+	if dialect == constant.DialectOllamaGenerate {
+		for _, tool := range req.Tools {
+			if len(tool.FunctionDeclarations) > 0 {
+				return unsupported("tools are not supported by the upstream %s api", dialect)
+			}
+		}
+	}
+	for _, content := range req.Contents {
+		for _, part := range content.Parts {
+			switch {
+			case part.FileData != nil:
+				return unsupported("file references are not supported by the upstream %s api", dialect)
+			case part.InlineData != nil && !isImage(part.InlineData.MimeType):
+				return unsupported("only image media is supported by the upstream %s api", dialect)
+			case dialect == constant.DialectOllamaGenerate && (part.FunctionCall != nil || part.FunctionResponse != nil):
+				return unsupported("tool calls are not supported by the upstream %s api", dialect)
+			}
+		}
+	}
+	return nil
+}
+
+func GeneralRequestToOllamaChat(req *general.Request) *ollama.ChatRequest {
+	result := &ollama.ChatRequest{
+		Model:  req.Model,
+		Stream: ptr(req.Stream),
+	}
+	// ollama 没有 tool_choice，none 时不发送工具
+	if req.ToolConfig == nil || req.ToolConfig.Mode != general.ToolModeNone {
+		result.Tools = generalToolsToOllama(req.Tools)
+	}
+	if req.SystemInstruction != nil {
+		result.Messages = append(result.Messages, ollama.Message{Role: ollamaRoleSystem, Content: partsText(req.SystemInstruction.Parts)})
+	}
+	for _, content := range req.Contents {
+		result.Messages = append(result.Messages, generalContentToOllama(content)...)
+	}
+	generalGenerationConfigToOllama(req.GenerationConfig, &result.Options, &result.Format, &result.Think)
+	return result
+}
+
+// GeneralRequestToOllamaGenerate 对话转换为单个 prompt，系统指令单独传递
+func GeneralRequestToOllamaGenerate(req *general.Request) *ollama.GenerateRequest {
+	result := &ollama.GenerateRequest{
+		Model:  req.Model,
+		Prompt: generalPromptText(&general.Request{Contents: req.Contents}),
+		Stream: ptr(req.Stream),
+	}
+	if req.SystemInstruction != nil {
+		result.System = partsText(req.SystemInstruction.Parts)
+	}
+	for _, content := range req.Contents {
+		result.Images = append(result.Images, ollamaImages(content.Parts)...)
+	}
+	generalGenerationConfigToOllama(req.GenerationConfig, &result.Options, &result.Format, &result.Think)
+	return result
+}
+
+func generalContentToOllama(content general.Content) []ollama.Message {
+	if content.Role == general.RoleAssistant {
+		message := ollama.Message{Role: ollamaRoleAssistant, Content: partsText(content.Parts), Thinking: thoughtsText(content.Parts)}
+		for _, part := range content.Parts {
+			if part.FunctionCall != nil {
+				message.ToolCalls = append(message.ToolCalls, generalFunctionCallToOllama(part.FunctionCall))
+			}
+		}
+		return []ollama.Message{message}
+	}
+	var messages []ollama.Message
+	for _, part := range content.Parts {
+		if part.FunctionResponse != nil {
+			messages = append(messages, ollama.Message{
+				Role:     ollamaRoleTool,
+				Content:  stringValue(functionResponseText(part.FunctionResponse)),
+				ToolName: part.FunctionResponse.Name,
+			})
+		}
+	}
+	text, images := partsText(content.Parts), ollamaImages(content.Parts)
+	if text != "" || len(images) > 0 || len(messages) == 0 {
+		messages = append(messages, ollama.Message{Role: ollamaRoleUser, Content: text, Images: images})
+	}
+	return messages
+}
+
+// generalFunctionCallToOllama arguments 为对象，不能为 null
+func generalFunctionCallToOllama(call *general.FunctionCall) ollama.ToolCall {
+	args := call.Args
+	if args == nil {
+		args = map[string]any{}
+	}
+	return ollama.ToolCall{Function: ollama.ToolCallFunction{Name: call.Name, Arguments: args}}
+}
+
+func ollamaImages(parts []general.Part) []string {
+	var images []string
+	for _, part := range parts {
+		if part.InlineData != nil && isImage(part.InlineData.MimeType) {
+			images = append(images, part.InlineData.Data)
+		}
+	}
+	return images
+}
+
+// generalGenerationConfigToOllama 只有部分模型支持推理强度，思考统一使用 bool
+func generalGenerationConfigToOllama(config *general.GenerationConfig, options **ollama.Options, format *json.RawMessage, think *json.RawMessage) {
+	if config == nil {
+		return
+	}
+	*options = &ollama.Options{
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		TopK:             config.TopK,
+		NumPredict:       config.MaxOutputTokens,
+		Stop:             config.StopSequences,
+		Seed:             config.Seed,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+	}
+	if reasoning := config.Reasoning; reasoning != nil {
+		budget, ok := reasoningBudget(reasoning)
+		*think, _ = json.Marshal(!ok || budget != 0)
+	}
+	if responseFormat := config.ResponseFormat; responseFormat != nil && responseFormat.Type != general.ResponseFormatText {
+		*format, _ = json.Marshal(ollamaFormatJson)
+		if responseFormat.Type == general.ResponseFormatJsonSchema && responseFormat.Schema != nil {
+			*format, _ = json.Marshal(NormalizeSchema(constant.DialectOllama, responseFormat.Schema, false))
+		}
+	}
+}
+
+func ollamaToolsToGeneral(tools []ollama.Tool) []general.Tool {
+	var declarations []general.FunctionDeclaration
+	for _, tool := range tools {
+		declarations = append(declarations, general.FunctionDeclaration{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+	return []general.Tool{{FunctionDeclarations: declarations}}
+}
+
+func generalToolsToOllama(tools []general.Tool) []ollama.Tool {
+	var result []ollama.Tool
+	for _, tool := range tools {
+		for _, fd := range tool.FunctionDeclarations {
+			parameters, _ := ToolSchema(constant.DialectOllama, fd.Parameters)
+			result = append(result, ollama.Tool{Type: "function", Function: ollama.ToolFunction{
+				Name:        fd.Name,
+				Description: fd.Description,
+				Parameters:  parameters,
+			}})
+		}
+	}
+	return result
+}
+
+func OllamaChatResponseToGeneral(resp *ollama.ChatResponse) *general.Response {
+	var message ollama.Message
+	if resp.Message != nil {
+		message = *resp.Message
+	}
+	return ollamaResponseToGeneral(resp.Model, ollamaAssistantParts(&message), resp.DoneReason, resp.PromptEvalCount, resp.EvalCount)
+}
+
+func OllamaGenerateResponseToGeneral(resp *ollama.GenerateResponse) *general.Response {
+	message := ollama.Message{Content: resp.Response, Thinking: resp.Thinking}
+	return ollamaResponseToGeneral(resp.Model, ollamaAssistantParts(&message), resp.DoneReason, resp.PromptEvalCount, resp.EvalCount)
+}
+
+// ollamaResponseToGeneral ollama 的响应没有 id，函数调用没有 id
+func ollamaResponseToGeneral(model string, parts []general.Part, doneReason string, promptTokens int, completionTokens int) *general.Response {
+	content := general.Content{Role: general.RoleAssistant, Parts: parts}
+	fillToolCallIds([]general.Content{content}, func() string { return newId("call_") })
+	candidate := general.Candidate{Content: &content, FinishReason: ollamaDoneReasonToGeneral(doneReason, hasFunctionCall(parts))}
+	return &general.Response{
+		Model:      model,
+		Candidates: []general.Candidate{candidate},
+		Usage:      ollamaUsageToGeneral(promptTokens, completionTokens),
+	}
+}
+
+func GeneralResponseToOllamaChat(resp *general.Response) *ollama.ChatResponse {
+	result := &ollama.ChatResponse{
+		Model:     resp.Model,
+		CreatedAt: ollamaCreatedAt(),
+		Message:   &ollama.Message{Role: ollamaRoleAssistant},
+		Done:      true,
+	}
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		if candidate.Content != nil {
+			content := *candidate.Content
+			content.Role = general.RoleAssistant
+			*result.Message = generalContentToOllama(content)[0]
+		}
+		result.DoneReason = generalFinishReasonToOllama(candidate.FinishReason)
+	}
+	if resp.Usage != nil {
+		result.PromptEvalCount, result.EvalCount = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+	}
+	return result
+}
+
+// GeneralResponseToOllamaGenerate 只输出文本与思考内容
+func GeneralResponseToOllamaGenerate(resp *general.Response) *ollama.GenerateResponse {
+	result := &ollama.GenerateResponse{Model: resp.Model, CreatedAt: ollamaCreatedAt(), Done: true}
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		if candidate.Content != nil {
+			result.Response = partsText(candidate.Content.Parts)
+			result.Thinking = thoughtsText(candidate.Content.Parts)
+		}
+		result.DoneReason = generalFinishReasonToOllama(candidate.FinishReason)
+	}
+	if resp.Usage != nil {
+		result.PromptEvalCount, result.EvalCount = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+	}
+	return result
+}
+
+func ollamaCreatedAt() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// ollamaDoneReasonToGeneral ollama 调用函数时 done_reason 仍为 stop
+func ollamaDoneReasonToGeneral(reason string, toolCalls bool) string {
+	switch {
+	case reason == "length":
+		return general.FinishReasonLength
+	case toolCalls:
+		return general.FinishReasonToolCalls
+	case reason == "":
+		return ""
+	}
+	return general.FinishReasonStop
+}
+
+// generalFinishReasonToOllama ollama 只有 stop 与 length
+func generalFinishReasonToOllama(reason string) string {
+	if reason == general.FinishReasonLength {
+		return "length"
+	}
+	return "stop"
+}
+
+func ollamaUsageToGeneral(promptTokens int, completionTokens int) *general.Usage {
+	if promptTokens == 0 && completionTokens == 0 {
+		return nil
+	}
+	return &general.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
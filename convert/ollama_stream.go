@@ -0,0 +1,151 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/ollama"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// ollamaStreamDecoder 每一行为增量内容，函数调用总是完整的；done 为 true 的最后一行带上结束原因与用量
+type ollamaStreamDecoder struct {
+	// generate 接口的回答在 response 中
+	generate  bool
+	toolCalls bool
+}
+
+func (d *ollamaStreamDecoder) Decode(event sse.Event) ([]*general.Response, error) {
+	data := strings.TrimSpace(event.Data)
+	if data == "" {
+		return nil, nil
+	}
+	if err := streamError(data); err != nil {
+		return nil, err
+	}
+	var model, doneReason string
+	var message ollama.Message
+	var done bool
+	var promptTokens, completionTokens int
+	if d.generate {
+		var chunk ollama.GenerateResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+		model, doneReason, done = chunk.Model, chunk.DoneReason, chunk.Done
+		message = ollama.Message{Content: chunk.Response, Thinking: chunk.Thinking}
+		promptTokens, completionTokens = chunk.PromptEvalCount, chunk.EvalCount
+	} else {
+		var chunk ollama.ChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+		model, doneReason, done = chunk.Model, chunk.DoneReason, chunk.Done
+		if chunk.Message != nil {
+			message = *chunk.Message
+		}
+		promptTokens, completionTokens = chunk.PromptEvalCount, chunk.EvalCount
+	}
+	parts := ollamaAssistantParts(&message)
+	content := general.Content{Role: general.RoleAssistant, Parts: parts}
+	fillToolCallIds([]general.Content{content}, func() string { return newId("call_") })
+	d.toolCalls = d.toolCalls || hasFunctionCall(parts)
+	if !done {
+		if len(parts) == 0 {
+			return nil, nil
+		}
+		return []*general.Response{deltaResponse("", model, parts, "")}, nil
+	}
+	finishReason := ollamaDoneReasonToGeneral(doneReason, d.toolCalls)
+	if finishReason == "" {
+		finishReason = general.FinishReasonStop
+	}
+	resp := deltaResponse("", model, parts, finishReason)
+	resp.Usage = ollamaUsageToGeneral(promptTokens, completionTokens)
+	return []*general.Response{resp}, nil
+}
+
+func (d *ollamaStreamDecoder) Finish() []*general.Response {
+	return nil
+}
+
+// ollamaStreamEncoder 每个增量输出一行，结束原因与用量可能分开到达，在 Finish 时统一输出 done 行
+type ollamaStreamEncoder struct {
+	generate     bool
+	model        string
+	finishReason string
+	usage        *general.Usage
+}
+
+func (e *ollamaStreamEncoder) Encode(resp *general.Response) []sse.Event {
+	if resp.Model != "" {
+		e.model = resp.Model
+	}
+	if resp.Usage != nil {
+		e.usage = resp.Usage
+	}
+	var events []sse.Event
+	for _, candidate := range resp.Candidates {
+		// ollama 只有一个候选
+		if candidate.Index != 0 {
+			continue
+		}
+		if candidate.FinishReason != "" {
+			e.finishReason = candidate.FinishReason
+		}
+		if candidate.Content == nil {
+			continue
+		}
+		for _, part := range candidate.Content.Parts {
+			message := ollama.Message{Role: ollamaRoleAssistant}
+			switch {
+			case isThought(part):
+				message.Thinking = stringValue(part.Text)
+			case part.FunctionCall != nil:
+				if e.generate {
+					continue
+				}
+				message.ToolCalls = []ollama.ToolCall{generalFunctionCallToOllama(part.FunctionCall)}
+			default:
+				message.Content = partsText([]general.Part{part})
+			}
+			if message.Thinking == "" && message.Content == "" && len(message.ToolCalls) == 0 {
+				continue
+			}
+			events = append(events, e.line(message, false))
+		}
+	}
+	return events
+}
+
+func (e *ollamaStreamEncoder) line(message ollama.Message, done bool) sse.Event {
+	if !e.generate {
+		chunk := ollama.ChatResponse{Model: e.model, CreatedAt: ollamaCreatedAt(), Message: &message, Done: done}
+		if done {
+			chunk.DoneReason = generalFinishReasonToOllama(e.finishReason)
+			if e.usage != nil {
+				chunk.PromptEvalCount, chunk.EvalCount = e.usage.PromptTokens, e.usage.CompletionTokens
+			}
+		}
+		return jsonEvent("", chunk)
+	}
+	chunk := ollama.GenerateResponse{
+		Model:     e.model,
+		CreatedAt: ollamaCreatedAt(),
+		Response:  message.Content,
+		Thinking:  message.Thinking,
+		Done:      done,
+	}
+	if done {
+		chunk.DoneReason = generalFinishReasonToOllama(e.finishReason)
+		if e.usage != nil {
+			chunk.PromptEvalCount, chunk.EvalCount = e.usage.PromptTokens, e.usage.CompletionTokens
+		}
+	}
+	return jsonEvent("", chunk)
+}
+
+func (e *ollamaStreamEncoder) Finish() []sse.Event {
+	return []sse.Event{e.line(ollama.Message{Role: ollamaRoleAssistant}, true)}
+}
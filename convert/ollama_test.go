@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/ndjson"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// 1x1 png
+const ollamaTestImage = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+func TestOllamaChatRequest(t *testing.T) {
+	body := `{"model":"llama3","think":true,"format":{"type":"object"},"options":{"temperature":0.2,"num_predict":-1,"num_ctx":4096},
+		"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"what is this","images":["` + ollamaTestImage + `"]},
+		{"role":"assistant","content":"","tool_calls":[{"function":{"name":"weather","arguments":{"city":"bj"}}}]},
+		{"role":"tool","content":"sunny","tool_name":"weather"}],
+		"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object"}}}]}`
+	req, err := DecodeRequest(constant.DialectOllama, "api/chat", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.Stream || len(req.Contents) != 3 || req.SystemInstruction == nil {
+		t.Fatalf("stream 默认开启，消息转换错误: %+v", req)
+	}
+	if image := req.Contents[0].Parts[1].InlineData; image == nil || image.MimeType != "image/png" {
+		t.Fatalf("图片类型应按文件头推断: %+v", req.Contents[0].Parts)
+	}
+	call, response := req.Contents[1].Parts[0].FunctionCall, req.Contents[2].Parts[0].FunctionResponse
+	if call.Id == "" || call.Id != response.Id || call.Args["city"] != "bj" {
+		t.Fatalf("函数调用与结果应按函数名对应: %+v %+v", call, response)
+	}
+	config := req.GenerationConfig
+	if config.MaxOutputTokens != nil || !*config.Reasoning.IncludeThoughts || config.ResponseFormat.Type != "json_schema" {
+		t.Fatalf("生成配置转换错误: %+v", config)
+	}
+
+	// 转换回 ollama
+	path, data, err := EncodeRequest(constant.DialectOllama, req)
+	if err != nil || path != "api/chat" {
+		t.Fatalf("转换 ollama 请求失败: %s %v", path, err)
+	}
+	for _, want := range []string{`"images":["` + ollamaTestImage + `"]`, `"tool_calls":[{"function":{"name":"weather","arguments":{"city":"bj"}}}]`,
+		`"role":"tool","content":"sunny","tool_name":"weather"`, `"think":true`, `"stream":true`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("ollama 请求缺少 %s: %s", want, data)
+		}
+	}
+	if _, _, err := EncodeRequest(constant.DialectOllamaGenerate, req); err == nil {
+		t.Fatal("generate 接口不支持工具")
+	}
+}
+
+func TestOllamaGenerateRequest(t *testing.T) {
+	req, err := DecodeRequest(constant.DialectOllamaGenerate, "api/generate", []byte(`{"model":"llama3","prompt":"hi","system":"be brief","stream":false,"format":"json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Stream || partsText(req.SystemInstruction.Parts) != "be brief" || req.GenerationConfig.ResponseFormat.Type != "json_object" {
+		t.Fatalf("generate 请求转换错误: %+v", req)
+	}
+	_, data, err := EncodeRequest(constant.DialectOpenAI, req)
+	if err != nil || !strings.Contains(string(data), `"response_format":{"type":"json_object"}`) {
+		t.Fatalf("转换 openai 请求错误: %s %v", data, err)
+	}
+	_, data, _ = EncodeRequest(constant.DialectOllamaGenerate, req)
+	if !strings.Contains(string(data), `"prompt":"hi","system":"be brief"`) || !strings.Contains(string(data), `"format":"json"`) {
+		t.Fatalf("转换 generate 请求错误: %s", data)
+	}
+	var unsupportedErr *UnsupportedError
+	if _, err := DecodeRequest(constant.DialectOllamaGenerate, "api/generate", []byte(`{"prompt":"hi","context":[1,2]}`)); !errors.As(err, &unsupportedErr) {
+		t.Fatalf("context 应返回不支持: %v", err)
+	}
+}
+
+func TestOllamaResponse(t *testing.T) {
+	resp, err := DecodeResponse(constant.DialectOllama, []byte(`{"model":"llama3","created_at":"2024-01-01T00:00:00Z","message":{"role":"assistant",
+		"content":"","thinking":"hmm","tool_calls":[{"function":{"name":"weather","arguments":{"city":"bj"}}}]},
+		"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidate := resp.Candidates[0]
+	if candidate.FinishReason != "tool_calls" || !isThought(candidate.Content.Parts[0]) || resp.Usage.TotalTokens != 8 {
+		t.Fatalf("ollama 响应转换错误: %+v", resp)
+	}
+	body, _ := EncodeResponse(constant.DialectClaude, resp)
+	if !strings.Contains(string(body), `"stop_reason":"tool_use"`) {
+		t.Fatalf("claude 响应转换错误: %s", body)
+	}
+	body, _ = EncodeResponse(constant.DialectOllamaGenerate, resp)
+	for _, want := range []string{`"thinking":"hmm"`, `"done":true`, `"done_reason":"stop"`, `"prompt_eval_count":5`} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("generate 响应缺少 %s: %s", want, body)
+		}
+	}
+	if message := UpstreamErrorMessage([]byte(`{"error":"model not found"}`)); message != "model not found" {
+		t.Fatalf("ollama 错误信息解析错误: %s", message)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	input := `{"model":"llama3","created_at":"t","message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}
+{"model":"llama3","created_at":"t","message":{"role":"assistant","content":"he"},"done":false}
+{"model":"llama3","created_at":"t","message":{"role":"assistant","content":"llo"},"done":false}
+{"model":"llama3","created_at":"t","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":2,"eval_count":3}
+`
+	converter, _ := NewStreamConverter(constant.DialectOllama, constant.DialectOpenAI, "llama3")
+	decoder := ndjson.NewDecoder(strings.NewReader(input))
+	var data []string
+	for {
+		event, err := decoder.Next()
+		if err != nil {
+			break
+		}
+		converted, err := converter.Convert(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range converted {
+			data = append(data, e.Data)
+		}
+	}
+	for _, e := range converter.Finish() {
+		data = append(data, e.Data)
+	}
+	joined := strings.Join(data, "\n")
+	for _, want := range []string{`"reasoning_content":"hmm"`, `"content":"he"`, `"finish_reason":"length"`, `"total_tokens":5`} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("openai 流式转换缺少 %s: %s", want, joined)
+		}
+	}
+
+	// openai 的流转换为 ollama，结束原因与用量在最后一行
+	events := []string{
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[],"usage":{"prompt_tokens":2,"completion_tokens":1,"total_tokens":3}}`,
+		openaiStreamDone,
+	}
+	converter, _ = NewStreamConverter(constant.DialectOpenAI, constant.DialectOllama, "gpt")
+	var lines []string
+	for _, event := range events {
+		converted, err := converter.Convert(sse.Event{Data: event, HasData: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range converted {
+			lines = append(lines, string(ndjson.Marshal(e)))
+		}
+	}
+	for _, e := range converter.Finish() {
+		lines = append(lines, string(ndjson.Marshal(e)))
+	}
+	if len(lines) != 3 || !strings.Contains(lines[1], `"tool_calls":[{"function":{"name":"f","arguments":{}}}]`) {
+		t.Fatalf("ollama 流式转换错误: %s", lines)
+	}
+	var last struct {
+		Done            bool   `json:"done"`
+		DoneReason      string `json:"done_reason"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil || !last.Done || last.DoneReason != "stop" || last.PromptEvalCount != 2 || last.EvalCount != 1 {
+		t.Fatalf("结束行错误: %s", lines[2])
+	}
+}
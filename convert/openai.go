@@ -0,0 +1,529 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+const (
+	openaiRoleSystem    = "system"
+	openaiRoleDeveloper = "developer"
+	openaiRoleUser      = "user"
+	openaiRoleAssistant = "assistant"
+	openaiRoleTool      = "tool"
+)
+
+// 输出音频时必须指定音色与格式，其它协议没有指定时使用默认值
+const (
+	openaiDefaultVoice       = "alloy"
+	openaiDefaultAudioFormat = "wav"
+)
+
+func OpenAIRequestToGeneral(req *openai.Request) *general.Request {
+	result := &general.Request{
+		Stream: req.Stream,
+		Model:  req.Model,
+		Tools:  openaiToolsToGeneral(req.Tools),
+	}
+	result.ToolConfig = openaiToolChoiceToGeneral(req.ToolChoice, req.ParallelToolCalls)
+	if req.WebSearchOptions != nil {
+		result.Tools = append(result.Tools, general.Tool{WebSearch: ptr(true)})
+	}
+	// tool 消息只有 tool_call_id，函数名需要从之前的 assistant 消息中查找
+	toolNames := map[string]string{}
+	for _, message := range req.Messages {
+		switch message.Role {
+		case openaiRoleSystem, openaiRoleDeveloper:
+			if result.SystemInstruction == nil {
+				result.SystemInstruction = &general.Content{Role: general.RoleSystem}
+			}
+			result.SystemInstruction.Parts = append(result.SystemInstruction.Parts, openaiContentToGeneral(message.Content)...)
+		case openaiRoleTool:
+			output := openaiContentText(message.Content)
+			part := general.Part{FunctionResponse: &general.FunctionResponse{
+				Id:       message.ToolCallId,
+				Name:     toolNames[message.ToolCallId],
+				Response: general.FunctionResponseContent{Output: &output},
+			}}
+			// 连续的 tool 消息合并为同一轮
+			if last := lastContent(result.Contents); last != nil && last.Role == general.RoleUser && isFunctionResponses(last.Parts) {
+				last.Parts = append(last.Parts, part)
+			} else {
+				result.Contents = append(result.Contents, general.Content{Role: general.RoleUser, Parts: []general.Part{part}})
+			}
+		case openaiRoleAssistant:
+			content := general.Content{Role: general.RoleAssistant, Parts: openaiAssistantParts(&message)}
+			for _, toolCall := range message.ToolCalls {
+				toolNames[toolCall.Id] = toolCall.Function.Name
+				content.Parts = append(content.Parts, general.Part{FunctionCall: &general.FunctionCall{
+					Id:   toolCall.Id,
+					Name: toolCall.Function.Name,
+					Args: parseArguments(toolCall.Function.Arguments),
+				}})
+			}
+			result.Contents = append(result.Contents, content)
+		default:
+			result.Contents = append(result.Contents, general.Content{Role: general.RoleUser, Parts: openaiContentToGeneral(message.Content)})
+		}
+	}
+	config := &general.GenerationConfig{
+		StopSequences:    req.Stop,
+		MaxOutputTokens:  req.MaxCompletionTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		CandidateCount:   req.N,
+		Seed:             req.Seed,
+	}
+	for _, modality := range req.Modalities {
+		config.ResponseModalities = append(config.ResponseModalities, strings.ToLower(modality))
+	}
+	if req.Audio != nil && req.Audio.Voice != "" {
+		config.Speech = &general.SpeechConfig{Voice: req.Audio.Voice}
+	}
+	if config.MaxOutputTokens == nil {
+		config.MaxOutputTokens = req.MaxTokens
+	}
+	if req.Logprobs != nil && *req.Logprobs {
+		logprobs := 0
+		if req.TopLogprobs != nil {
+			logprobs = *req.TopLogprobs
+		}
+		config.Logprobs = &logprobs
+	}
+	if req.ReasoningEffort != "" {
+		config.Reasoning = &general.ReasoningConfig{Effort: req.ReasoningEffort}
+	}
+	if format := req.ResponseFormat; format != nil && format.Type != general.ResponseFormatText {
+		config.ResponseFormat = &general.ResponseFormat{Type: format.Type}
+		if schema := format.JsonSchema; schema != nil {
+			config.ResponseFormat.Name = schema.Name
+			config.ResponseFormat.Description = schema.Description
+			config.ResponseFormat.Schema = schema.Schema
+			config.ResponseFormat.Strict = schema.Strict
+		}
+	}
+	result.GenerationConfig = emptyGenerationConfig(config)
+	return result
+}
+
+func GeneralRequestToOpenAI(req *general.Request) *openai.Request {
+	result := &openai.Request{
+		Model:  req.Model,
+		Stream: req.Stream,
+		Tools:  generalToolsToOpenAI(req.Tools),
+	}
+	generalToolConfigToOpenAI(req.ToolConfig, result)
+	if hasWebSearch(req.Tools) {
+		result.WebSearchOptions = &openai.WebSearchOptions{}
+	}
+	if req.Stream {
+		result.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.SystemInstruction != nil {
+		text := partsText(req.SystemInstruction.Parts)
+		result.Messages = append(result.Messages, openai.Message{
+			Role:    openaiRoleSystem,
+			Content: &openai.MessageContent{Text: &text},
+		})
+	}
+	for _, content := range req.Contents {
+		result.Messages = append(result.Messages, generalContentToOpenAI(content)...)
+	}
+	if config := req.GenerationConfig; config != nil {
+		result.Stop = config.StopSequences
+		result.MaxCompletionTokens = config.MaxOutputTokens
+		result.Temperature = config.Temperature
+		result.TopP = config.TopP
+		result.PresencePenalty = config.PresencePenalty
+		result.FrequencyPenalty = config.FrequencyPenalty
+		if config.Logprobs != nil {
+			logprobs := true
+			result.Logprobs = &logprobs
+			if *config.Logprobs > 0 {
+				result.TopLogprobs = config.Logprobs
+			}
+		}
+		result.ReasoningEffort = reasoningEffort(config.Reasoning)
+		result.ResponseFormat = generalResponseFormatToOpenAI(config.ResponseFormat)
+		result.N = config.CandidateCount
+		result.Seed = config.Seed
+		generalModalitiesToOpenAI(config, result)
+	}
+	return result
+}
+
+// generalModalitiesToOpenAI openai 只支持 text、audio 输出，audio 必须带音色与格式
+func generalModalitiesToOpenAI(config *general.GenerationConfig, req *openai.Request) {
+	audio := false
+	for _, modality := range config.ResponseModalities {
+		switch modality {
+		case general.ModalityText:
+			req.Modalities = append(req.Modalities, modality)
+		case general.ModalityAudio:
+			req.Modalities = append(req.Modalities, modality)
+			audio = true
+		}
+	}
+	if !audio {
+		return
+	}
+	req.Audio = &openai.AudioOptions{Voice: openaiDefaultVoice, Format: openaiDefaultAudioFormat}
+	if config.Speech != nil && config.Speech.Voice != "" {
+		req.Audio.Voice = config.Speech.Voice
+	}
+}
+
+func generalContentToOpenAI(content general.Content) []openai.Message {
+	var messages []openai.Message
+	if content.Role == general.RoleAssistant {
+		message := openai.Message{Role: openaiRoleAssistant}
+		var texts []string
+		for _, part := range content.Parts {
+			if isThought(part) {
+				continue
+			}
+			if part.Text != nil {
+				texts = append(texts, *part.Text)
+			}
+			if text, ok := codeText(part); ok {
+				texts = append(texts, text)
+			}
+			if part.FunctionCall != nil {
+				message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+					Id:   toolCallId(part.FunctionCall.Id),
+					Type: "function",
+					Function: openai.FunctionCall{
+						Name:      part.FunctionCall.Name,
+						Arguments: marshalArguments(part.FunctionCall.Args),
+					},
+				})
+			}
+		}
+		if len(texts) > 0 || len(message.ToolCalls) == 0 {
+			text := strings.Join(texts, "")
+			message.Content = &openai.MessageContent{Text: &text}
+		}
+		return append(messages, message)
+	}
+	var parts []openai.ContentPart
+	for _, part := range content.Parts {
+		if part.FunctionResponse != nil {
+			messages = append(messages, openai.Message{
+				Role:       openaiRoleTool,
+				ToolCallId: toolCallId(part.FunctionResponse.Id),
+				Content:    &openai.MessageContent{Text: functionResponseText(part.FunctionResponse)},
+			})
+		}
+		if contentPart, ok := generalPartToOpenAI(part); ok {
+			parts = append(parts, contentPart)
+		}
+	}
+	if len(parts) > 0 {
+		message := openai.Message{Role: openaiRoleUser, Content: &openai.MessageContent{Parts: parts}}
+		if len(parts) == 1 && parts[0].Type == "text" {
+			message.Content = &openai.MessageContent{Text: &parts[0].Text}
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func openaiContentToGeneral(content *openai.MessageContent) []general.Part {
+	if content == nil {
+		return nil
+	}
+	if content.Text != nil {
+		return []general.Part{{Text: content.Text}}
+	}
+	var parts []general.Part
+	for _, part := range content.Parts {
+		switch part.Type {
+		case "text":
+			text := part.Text
+			parts = append(parts, general.Part{Text: &text})
+		case "image_url":
+			if part.ImageUrl == nil {
+				continue
+			}
+			if blob, ok := parseDataUrl(part.ImageUrl.Url); ok {
+				parts = append(parts, general.Part{InlineData: blob})
+				continue
+			}
+			parts = append(parts, general.Part{FileData: &general.FileData{
+				MimeType: guessMimeType(part.ImageUrl.Url, defaultImageMimeType),
+				FileUri:  part.ImageUrl.Url,
+			}})
+		case "input_audio":
+			if part.InputAudio == nil {
+				continue
+			}
+			parts = append(parts, general.Part{InlineData: &general.Blob{
+				MimeType: "audio/" + part.InputAudio.Format,
+				Data:     part.InputAudio.Data,
+			}})
+		case "file":
+			if part.File == nil {
+				continue
+			}
+			if blob, ok := parseDataUrl(part.File.FileData); ok {
+				parts = append(parts, general.Part{InlineData: blob})
+			}
+		}
+	}
+	return parts
+}
+
+// openaiFileError openai 上传的文件只能通过 id 引用，类型与内容都无法得知，不能转换为其它协议
+func openaiFileError(messages []openai.Message) error {
+	for _, message := range messages {
+		if message.Content == nil {
+			continue
+		}
+		for _, part := range message.Content.Parts {
+			if part.Type == "file" && part.File != nil && part.File.FileId != "" {
+				return unsupported("file_id %s can not be converted, send the file content as file_data", part.File.FileId)
+			}
+		}
+	}
+	return nil
+}
+
+// generalPartToOpenAI 用户消息中的多模态内容，openai 无法表示的内容返回 false
+func generalPartToOpenAI(part general.Part) (openai.ContentPart, bool) {
+	if isThought(part) {
+		return openai.ContentPart{}, false
+	}
+	if part.Text != nil {
+		return openai.ContentPart{Type: "text", Text: *part.Text}, true
+	}
+	if text, ok := codeText(part); ok {
+		return openai.ContentPart{Type: "text", Text: text}, true
+	}
+	if blob := part.InlineData; blob != nil {
+		if isImage(blob.MimeType) {
+			return openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: dataUrl(blob)}}, true
+		}
+		if format, ok := audioFormat(blob.MimeType); ok {
+			return openai.ContentPart{Type: "input_audio", InputAudio: &openai.InputAudio{Data: blob.Data, Format: format}}, true
+		}
+		return openai.ContentPart{Type: "file", File: &openai.File{
+			FileData: dataUrl(blob),
+			Filename: "file" + fileExtension(blob.MimeType),
+		}}, true
+	}
+	if file := part.FileData; file != nil {
+		if isImage(file.MimeType) && isHttpUrl(file.FileUri) {
+			return openai.ContentPart{Type: "image_url", ImageUrl: &openai.ImageUrl{Url: file.FileUri}}, true
+		}
+		if !isHttpUrl(file.FileUri) {
+			return openai.ContentPart{Type: "file", File: &openai.File{FileId: file.FileUri}}, true
+		}
+	}
+	return openai.ContentPart{}, false
+}
+
+// generalResponseFormatToOpenAI json_schema 必须有名称，strict 模式下 schema 需要满足 openai 的限制
+func generalResponseFormatToOpenAI(format *general.ResponseFormat) *openai.ResponseFormat {
+	if format == nil {
+		return nil
+	}
+	if format.Type != general.ResponseFormatJsonSchema || format.Schema == nil {
+		return &openai.ResponseFormat{Type: format.Type}
+	}
+	strict := format.Strict != nil && *format.Strict
+	name := format.Name
+	if name == "" {
+		name = "response"
+	}
+	return &openai.ResponseFormat{Type: format.Type, JsonSchema: &openai.JsonSchema{
+		Name:        name,
+		Description: format.Description,
+		Schema:      NormalizeSchema(constant.DialectOpenAI, format.Schema, strict),
+		Strict:      format.Strict,
+	}}
+}
+
+// openaiAssistantParts reasoning_content 作为思考内容放在最前面
+func openaiAssistantParts(message *openai.Message) []general.Part {
+	parts := openaiContentToGeneral(message.Content)
+	if message.ReasoningContent != nil && *message.ReasoningContent != "" {
+		parts = append([]general.Part{thoughtPart(*message.ReasoningContent, "")}, parts...)
+	}
+	return parts
+}
+
+func openaiContentText(content *openai.MessageContent) string {
+	return partsText(openaiContentToGeneral(content))
+}
+
+func openaiToolsToGeneral(tools []openai.Tool) []general.Tool {
+	var declarations []general.FunctionDeclaration
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		declaration := general.FunctionDeclaration{Name: tool.Function.Name, Description: tool.Function.Description}
+		if tool.Function.Parameters != nil {
+			declaration.Parameters = *tool.Function.Parameters
+		}
+		declarations = append(declarations, declaration)
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+	return []general.Tool{{FunctionDeclarations: declarations}}
+}
+
+func generalToolsToOpenAI(tools []general.Tool) []openai.Tool {
+	var result []openai.Tool
+	for _, tool := range tools {
+		for _, fd := range tool.FunctionDeclarations {
+			function := &openai.FunctionDefinition{Name: fd.Name, Description: fd.Description}
+			parameters, _ := ToolSchema(constant.DialectOpenAI, fd.Parameters)
+			function.Parameters = &parameters
+			result = append(result, openai.Tool{Type: "function", Function: function})
+		}
+	}
+	return result
+}
+
+func parseArguments(arguments string) map[string]any {
+	args := map[string]any{}
+	if arguments != "" {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+	return args
+}
+
+func marshalArguments(args map[string]any) string {
+	if args == nil {
+		return "{}"
+	}
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+func OpenAIResponseToGeneral(resp *openai.Response) *general.Response {
+	result := &general.Response{Id: resp.Id, Model: resp.Model}
+	for _, choice := range resp.Choices {
+		candidate := general.Candidate{Index: choice.Index}
+		if choice.Message != nil {
+			content := general.Content{Role: general.RoleAssistant, Parts: openaiAssistantParts(choice.Message)}
+			for _, toolCall := range choice.Message.ToolCalls {
+				content.Parts = append(content.Parts, general.Part{FunctionCall: &general.FunctionCall{
+					Id:   toolCall.Id,
+					Name: toolCall.Function.Name,
+					Args: parseArguments(toolCall.Function.Arguments),
+				}})
+			}
+			candidate.Content = &content
+			candidate.Citations = openaiAnnotationsToGeneral(choice.Message.Annotations, openaiContentText(choice.Message.Content))
+		}
+		if choice.FinishReason != nil {
+			candidate.FinishReason = openaiFinishReasonToGeneral(*choice.FinishReason)
+		}
+		result.Candidates = append(result.Candidates, candidate)
+	}
+	if resp.Usage != nil {
+		result.Usage = openaiUsageToGeneral(resp.Usage)
+	}
+	return result
+}
+
+func GeneralResponseToOpenAI(resp *general.Response) *openai.Response {
+	result := &openai.Response{
+		Id:      resp.Id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []openai.Choice{},
+	}
+	if result.Id == "" {
+		result.Id = newId("chatcmpl-")
+	}
+	for _, candidate := range resp.Candidates {
+		message := openai.Message{Role: openaiRoleAssistant, Content: &openai.MessageContent{Text: ptr("")}}
+		if candidate.Content != nil {
+			if messages := generalContentToOpenAI(general.Content{Role: general.RoleAssistant, Parts: candidate.Content.Parts}); len(messages) > 0 {
+				message = messages[0]
+			}
+			if thoughts := thoughtsText(candidate.Content.Parts); thoughts != "" {
+				message.ReasoningContent = &thoughts
+			}
+		}
+		message.Annotations = generalCitationsToOpenAI(candidate.Citations, openaiContentText(message.Content))
+		finishReason := generalFinishReasonToOpenAI(candidate.FinishReason, len(message.ToolCalls) > 0)
+		result.Choices = append(result.Choices, openai.Choice{Index: candidate.Index, Message: &message, FinishReason: &finishReason})
+	}
+	if resp.Usage != nil {
+		result.Usage = generalUsageToOpenAI(resp.Usage)
+	}
+	return result
+}
+
+func openaiFinishReasonToGeneral(reason string) string {
+	switch reason {
+	case "length":
+		return general.FinishReasonLength
+	case "tool_calls", "function_call":
+		return general.FinishReasonToolCalls
+	case "content_filter":
+		return general.FinishReasonContentFilter
+	}
+	return general.FinishReasonStop
+}
+
+func generalFinishReasonToOpenAI(reason string, toolCalls bool) string {
+	switch reason {
+	case general.FinishReasonLength:
+		return "length"
+	case general.FinishReasonContentFilter:
+		return "content_filter"
+	case general.FinishReasonToolCalls:
+		return "tool_calls"
+	}
+	if toolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func openaiUsageToGeneral(usage *openai.Usage) *general.Usage {
+	result := &general.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if usage.PromptTokensDetails != nil {
+		result.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		result.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return result
+}
+
+func generalUsageToOpenAI(usage *general.Usage) *openai.Usage {
+	result := &openai.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if result.TotalTokens == 0 {
+		result.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.CachedTokens > 0 {
+		result.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: usage.CachedTokens}
+	}
+	if usage.ReasoningTokens > 0 {
+		result.CompletionTokensDetails = &openai.CompletionTokensDetails{ReasoningTokens: usage.ReasoningTokens}
+	}
+	return result
+}
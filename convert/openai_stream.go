@@ -0,0 +1,205 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+const openaiStreamDone = "[DONE]"
+
+// openaiStreamDecoder 函数参数按 index 分片到达，收到 finish_reason 后整体输出
+// 部分兼容服务会交错输出多个调用的分片，不能在下一个 index 出现时提前结束前一个调用
+type openaiStreamDecoder struct {
+	id        string
+	model     string
+	toolCalls *toolCallAssembler
+	// 已收到的回答文本，引用位置按字符计算，需要转换为字节位置
+	text strings.Builder
+}
+
+func (d *openaiStreamDecoder) Decode(event sse.Event) ([]*general.Response, error) {
+	data := strings.TrimSpace(event.Data)
+	if data == "" || data == openaiStreamDone {
+		return nil, nil
+	}
+	if err := streamError(data); err != nil {
+		return nil, err
+	}
+	var chunk openai.Response
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil, err
+	}
+	d.id, d.model = chunk.Id, chunk.Model
+	resp := &general.Response{Id: chunk.Id, Model: chunk.Model}
+	for _, choice := range chunk.Choices {
+		var parts []general.Part
+		if delta := choice.Delta; delta != nil {
+			if delta.ReasoningContent != nil && *delta.ReasoningContent != "" {
+				parts = append(parts, thoughtPart(*delta.ReasoningContent, ""))
+			}
+			if delta.Content != nil && delta.Content.Text != nil && *delta.Content.Text != "" {
+				parts = append(parts, textPart(*delta.Content.Text))
+				d.text.WriteString(*delta.Content.Text)
+			}
+			for i, toolCall := range delta.ToolCalls {
+				index := i
+				if toolCall.Index != nil {
+					index = *toolCall.Index
+				}
+				key := toolCallKey{choice: choice.Index, index: index}
+				d.toolCalls.add(key, toolCall.Id, toolCall.Function.Name, toolCall.Function.Arguments)
+			}
+		}
+		candidate := general.Candidate{Index: choice.Index}
+		if choice.Delta != nil {
+			candidate.Citations = openaiAnnotationsToGeneral(choice.Delta.Annotations, d.text.String())
+		}
+		if choice.FinishReason != nil {
+			parts = append(parts, d.toolCalls.flush(choice.Index)...)
+			candidate.FinishReason = openaiFinishReasonToGeneral(*choice.FinishReason)
+		}
+		if len(parts) == 0 && candidate.FinishReason == "" && len(candidate.Citations) == 0 {
+			continue
+		}
+		candidate.Content = &general.Content{Role: general.RoleAssistant, Parts: parts}
+		resp.Candidates = append(resp.Candidates, candidate)
+	}
+	if chunk.Usage != nil {
+		resp.Usage = openaiUsageToGeneral(chunk.Usage)
+	}
+	if len(resp.Candidates) == 0 && resp.Usage == nil {
+		return nil, nil
+	}
+	return []*general.Response{resp}, nil
+}
+
+// Finish 上游没有发送 finish_reason 就结束时输出已收到的调用
+func (d *openaiStreamDecoder) Finish() []*general.Response {
+	resp := &general.Response{Id: d.id, Model: d.model}
+	for _, choice := range d.toolCalls.choices() {
+		resp.Candidates = append(resp.Candidates, general.Candidate{
+			Index:   choice,
+			Content: &general.Content{Role: general.RoleAssistant, Parts: d.toolCalls.flush(choice)},
+		})
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	return []*general.Response{resp}
+}
+
+// openaiStreamEncoder 首个事件携带 role，结束时输出 finish_reason、用量与 [DONE]
+type openaiStreamEncoder struct {
+	id        string
+	model     string
+	created   int64
+	started   bool
+	toolIndex int
+	usage     *general.Usage
+	// 已输出的回答文本，用于计算引用的字符位置
+	text strings.Builder
+}
+
+func (e *openaiStreamEncoder) Encode(resp *general.Response) []sse.Event {
+	if e.id == "" {
+		e.id = resp.Id
+		if e.id == "" {
+			e.id = newId("chatcmpl-")
+		}
+		e.created = time.Now().Unix()
+	}
+	if resp.Model != "" {
+		e.model = resp.Model
+	}
+	if resp.Usage != nil {
+		e.usage = resp.Usage
+	}
+	var events []sse.Event
+	for _, candidate := range resp.Candidates {
+		if !e.started {
+			e.started = true
+			events = append(events, e.chunk(candidate.Index, &openai.Message{
+				Role:    openaiRoleAssistant,
+				Content: &openai.MessageContent{Text: ptr("")},
+			}, nil))
+		}
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				for _, delta := range e.partDeltas(part) {
+					if delta.Content != nil {
+						e.text.WriteString(stringValue(delta.Content.Text))
+					}
+					events = append(events, e.chunk(candidate.Index, delta, nil))
+				}
+			}
+		}
+		if annotations := generalCitationsToOpenAI(candidate.Citations, e.text.String()); len(annotations) > 0 {
+			events = append(events, e.chunk(candidate.Index, &openai.Message{Annotations: annotations}, nil))
+		}
+		if candidate.FinishReason != "" {
+			finishReason := generalFinishReasonToOpenAI(candidate.FinishReason, e.toolIndex > 0)
+			events = append(events, e.chunk(candidate.Index, &openai.Message{}, &finishReason))
+		}
+	}
+	return events
+}
+
+// partDeltas 函数调用与 openai 一致分为两个事件：首个事件携带 id、name 与空参数，第二个事件携带完整参数
+func (e *openaiStreamEncoder) partDeltas(part general.Part) []*openai.Message {
+	if isThought(part) {
+		if part.Text == nil || *part.Text == "" {
+			return nil
+		}
+		return []*openai.Message{{ReasoningContent: part.Text}}
+	}
+	if part.Text != nil && *part.Text != "" {
+		return []*openai.Message{{Content: &openai.MessageContent{Text: part.Text}}}
+	}
+	if text, ok := codeText(part); ok {
+		return []*openai.Message{{Content: &openai.MessageContent{Text: &text}}}
+	}
+	if call := part.FunctionCall; call != nil {
+		index := e.toolIndex
+		e.toolIndex++
+		return []*openai.Message{{ToolCalls: []openai.ToolCall{{
+			Index:    &index,
+			Id:       toolCallId(call.Id),
+			Type:     "function",
+			Function: openai.FunctionCall{Name: call.Name},
+		}}}, {ToolCalls: []openai.ToolCall{{
+			Index:    &index,
+			Function: openai.FunctionCall{Arguments: marshalArguments(call.Args)},
+		}}}}
+	}
+	return nil
+}
+
+func (e *openaiStreamEncoder) chunk(index int, delta *openai.Message, finishReason *string) sse.Event {
+	return jsonEvent("", openai.Response{
+		Id:      e.id,
+		Object:  "chat.completion.chunk",
+		Created: e.created,
+		Model:   e.model,
+		Choices: []openai.Choice{{Index: index, Delta: delta, FinishReason: finishReason}},
+	})
+}
+
+func (e *openaiStreamEncoder) Finish() []sse.Event {
+	var events []sse.Event
+	if e.usage != nil {
+		events = append(events, jsonEvent("", openai.Response{
+			Id:      e.id,
+			Object:  "chat.completion.chunk",
+			Created: e.created,
+			Model:   e.model,
+			Choices: []openai.Choice{},
+			Usage:   generalUsageToOpenAI(e.usage),
+		}))
+	}
+	return append(events, sse.Event{Data: openaiStreamDone, HasData: true})
+}
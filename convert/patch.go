@@ -0,0 +1,236 @@
+package convert
+
+/*
+协议相同时把规则对请求、响应的修改应用到原始的请求体、响应体
+经过通用格式后重新编码会丢失通用格式没有的字段(openai logit_bias、system_fingerprint，claude cache_control 等)，
+这里用未修改的与修改后的内容各编码一次，只把两者的差异写回原始内容，其它内容按字节保留
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// 编码结果与客户端请求中含义相同的字段名，按 normalizeKey 之后的名称
+var patchKeyAliases = map[string]string{
+	// openai 编码时使用 max_completion_tokens，客户端可能使用 max_tokens
+	"maxcompletiontokens": "maxtokens",
+}
+
+// PatchRequest modified 为修改后的请求按 dialect 编码的结果；原始请求无法解析或编码时返回 modified
+func PatchRequest(dialect string, path string, raw []byte, modified []byte) []byte {
+	original, err := DecodeRequest(dialect, path, raw)
+	if err != nil {
+		return modified
+	}
+	_, base, err := EncodeRequest(dialect, original)
+	if err != nil {
+		return modified
+	}
+	return patchJSON(raw, base, modified)
+}
+
+// 响应编码时生成的时间字段每次都不同，不属于规则的修改，按 normalizeKey 之后的名称
+var responseVolatileKeys = []string{"created", "createdat"}
+
+// PatchResponse modified 为修改后的响应按 dialect 编码的结果；原始响应无法解析或编码时返回 modified
+func PatchResponse(dialect string, raw []byte, modified []byte) []byte {
+	original, err := DecodeResponse(dialect, raw)
+	if err != nil {
+		return modified
+	}
+	base, err := EncodeResponse(dialect, original)
+	if err != nil {
+		return modified
+	}
+	return patchJSON(raw, base, withFields(modified, base, responseVolatileKeys))
+}
+
+// withFields data 顶层的 keys 字段使用 from 中的值
+func withFields(data, from []byte, keys []string) []byte {
+	fields, ok1 := parseObject(data)
+	fromFields, ok2 := parseObject(from)
+	if !ok1 || !ok2 {
+		return data
+	}
+	values := fieldMap(fromFields)
+	for i, field := range fields {
+		key := normalizeKey(field.key)
+		if value, ok := values[key]; ok && slices.Contains(keys, key) {
+			fields[i].value = value
+		}
+	}
+	return writeObject(fields)
+}
+
+// patchJSON base 到 mod 的差异应用到 raw，raw 与 base 结构不一致的部分使用 mod
+func patchJSON(raw, base, mod json.RawMessage) json.RawMessage {
+	if bytes.Equal(base, mod) {
+		return raw
+	}
+	if rawFields, ok := parseObject(raw); ok {
+		baseFields, ok1 := parseObject(base)
+		modFields, ok2 := parseObject(mod)
+		if ok1 && ok2 {
+			return patchObject(rawFields, baseFields, modFields)
+		}
+	}
+	var rawItems, baseItems, modItems []json.RawMessage
+	if isArray(raw) && isArray(base) && isArray(mod) &&
+		json.Unmarshal(raw, &rawItems) == nil && json.Unmarshal(base, &baseItems) == nil && json.Unmarshal(mod, &modItems) == nil &&
+		len(rawItems) == len(baseItems) {
+		return patchArray(rawItems, baseItems, modItems)
+	}
+	return mod
+}
+
+// patchObject 原始请求中编码结果没有的字段保留，删除的字段去掉，新增的字段追加到最后
+func patchObject(raw, base, mod []jsonField) json.RawMessage {
+	baseValues, modValues := fieldMap(base), fieldMap(mod)
+	used := map[string]bool{}
+	var result []jsonField
+	for _, field := range raw {
+		key := normalizeKey(field.key)
+		if alias := aliasOf(key, baseValues, modValues); alias != "" {
+			key = alias
+		}
+		modValue, inMod := modValues[key]
+		baseValue, inBase := baseValues[key]
+		switch {
+		case inMod && inBase:
+			result = append(result, jsonField{field.key, patchJSON(field.value, baseValue, modValue)})
+		case inMod:
+			result = append(result, jsonField{field.key, modValue})
+		case inBase:
+			// 规则删除的字段
+			continue
+		default:
+			result = append(result, field)
+		}
+		used[key] = true
+	}
+	for _, field := range mod {
+		key := normalizeKey(field.key)
+		if used[key] {
+			continue
+		}
+		// 编码结果中有但原始请求中没有的字段，只有被修改时才写入
+		if baseValue, ok := baseValues[key]; ok && bytes.Equal(baseValue, field.value) {
+			continue
+		}
+		result = append(result, field)
+	}
+	return writeObject(result)
+}
+
+func writeObject(fields []jsonField) json.RawMessage {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(field.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// patchArray 长度不变时逐项修改；长度变化时(加入历史对话、删除消息)按顺序找到未修改的项使用原始内容
+func patchArray(raw, base, mod []json.RawMessage) json.RawMessage {
+	result := make([][]byte, 0, len(mod))
+	if len(base) == len(mod) {
+		for i := range mod {
+			result = append(result, patchJSON(raw[i], base[i], mod[i]))
+		}
+	} else {
+		next := 0
+		for _, item := range mod {
+			found := -1
+			for i := next; i < len(base); i++ {
+				if bytes.Equal(base[i], item) {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				result = append(result, item)
+				continue
+			}
+			result = append(result, raw[found])
+			next = found + 1
+		}
+	}
+	return append(append(json.RawMessage("["), bytes.Join(result, []byte(","))...), ']')
+}
+
+type jsonField struct {
+	key   string
+	value json.RawMessage
+}
+
+// parseObject 按原始顺序解析对象的字段，值保留原始字节
+func parseObject(data []byte) ([]jsonField, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+	var fields []jsonField
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, false
+		}
+		fields = append(fields, jsonField{key, value})
+	}
+	return fields, true
+}
+
+func fieldMap(fields []jsonField) map[string]json.RawMessage {
+	values := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		values[normalizeKey(field.key)] = field.value
+	}
+	return values
+}
+
+// normalizeKey gemini 同时接受 snake_case 与 camelCase，encoding/json 匹配字段名时忽略大小写
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", ""))
+}
+
+// aliasOf 原始请求的字段 key 在编码结果中使用另一个名称时返回该名称，否则返回空
+func aliasOf(key string, base, mod map[string]json.RawMessage) string {
+	if _, ok := base[key]; ok {
+		return ""
+	}
+	if _, ok := mod[key]; ok {
+		return ""
+	}
+	for encoded, alias := range patchKeyAliases {
+		if alias != key {
+			continue
+		}
+		_, inBase := base[encoded]
+		_, inMod := mod[encoded]
+		if inBase || inMod {
+			return encoded
+		}
+	}
+	return ""
+}
+
+func isArray(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '['
+}
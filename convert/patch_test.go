@@ -0,0 +1,46 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+)
+
+func TestPatchJSON(t *testing.T) {
+	raw := `{"messages":[{"role":"user","name":"a","content":"hi"},{"role":"user","name":"b","content":"bye"}],"x":1}`
+	base := `{"messages":[{"role":"user","content":"hi"},{"role":"user","content":"bye"}]}`
+	for mod, want := range map[string]string{
+		// 加入历史对话，原有消息保留未建模字段
+		`{"messages":[{"role":"user","content":"old"},{"role":"user","content":"hi"},{"role":"user","content":"bye"}]}`: `{"messages":[{"role":"user","content":"old"},{"role":"user","name":"a","content":"hi"},{"role":"user","name":"b","content":"bye"}],"x":1}`,
+		// 脱敏修改消息内容
+		`{"messages":[{"role":"user","content":"hi"},{"role":"user","content":"[REDACTED]"}]}`: `{"messages":[{"role":"user","name":"a","content":"hi"},{"role":"user","name":"b","content":"[REDACTED]"}],"x":1}`,
+		// 删除消息
+		`{"messages":[{"role":"user","content":"bye"}]}`: `{"messages":[{"role":"user","name":"b","content":"bye"}],"x":1}`,
+		// 删除与新增字段
+		`{"temperature":0}`: `{"x":1,"temperature":0}`,
+	} {
+		if got := string(patchJSON([]byte(raw), []byte(base), []byte(mod))); got != want {
+			t.Fatalf("修改结果错误:\n%s\n%s", got, want)
+		}
+	}
+}
+
+func TestPatchResponse(t *testing.T) {
+	raw := `{"model":"llama3","created_at":"2024-01-01T00:00:00Z","message":{"role":"assistant","content":"hi"},"done":true,"done_reason":"stop","total_duration":5}`
+	resp, err := DecodeResponse(constant.DialectOllama, []byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "bye"
+	resp.Candidates[0].Content.Parts[0].Text = &text
+	modified, err := EncodeResponse(constant.DialectOllama, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 编码时生成的 created_at 不算修改，上游的时间与未建模字段保留
+	want := strings.Replace(raw, `"content":"hi"`, `"content":"bye"`, 1)
+	if got := string(PatchResponse(constant.DialectOllama, []byte(raw), modified)); got != want {
+		t.Fatalf("修改结果错误:\n%s\n%s", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package convert
+
+import (
+	"strings"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// 推理强度与 token 预算的对应关系，只用于只支持其中一种配置方式的协议之间转换
+var reasoningBudgets = map[string]int{
+	general.ReasoningEffortNone:    0,
+	general.ReasoningEffortMinimal: 512,
+	general.ReasoningEffortLow:     1024,
+	general.ReasoningEffortMedium:  8192,
+	general.ReasoningEffortHigh:    24576,
+}
+
+// claude 开启思考时 budget_tokens 的最小值
+const claudeMinThinkingBudget = 1024
+
+// reasoningBudget 返回推理 token 预算，-1 表示由模型决定，未配置时返回 false
+func reasoningBudget(config *general.ReasoningConfig) (int, bool) {
+	if config == nil {
+		return 0, false
+	}
+	if config.BudgetTokens != nil {
+		return *config.BudgetTokens, true
+	}
+	budget, ok := reasoningBudgets[strings.ToLower(config.Effort)]
+	return budget, ok
+}
+
+// reasoningEffort 返回推理强度，只配置了预算时按预算推断
+func reasoningEffort(config *general.ReasoningConfig) string {
+	if config == nil {
+		return ""
+	}
+	if config.Effort != "" {
+		return strings.ToLower(config.Effort)
+	}
+	if config.BudgetTokens == nil || *config.BudgetTokens < 0 {
+		return ""
+	}
+	switch budget := *config.BudgetTokens; {
+	case budget == 0:
+		return general.ReasoningEffortMinimal
+	case budget <= reasoningBudgets[general.ReasoningEffortLow]:
+		return general.ReasoningEffortLow
+	case budget <= reasoningBudgets[general.ReasoningEffortMedium]:
+		return general.ReasoningEffortMedium
+	}
+	return general.ReasoningEffortHigh
+}
+
+func thoughtPart(text string, signature string) general.Part {
+	part := general.Part{Thought: ptr(true)}
+	if text != "" {
+		part.Text = &text
+	}
+	if signature != "" {
+		part.ThoughtSignature = &signature
+	}
+	return part
+}
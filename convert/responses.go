@@ -0,0 +1,678 @@
+package convert
+
+/*
+OpenAI Responses API 与通用格式之间的转换
+input 中连续的 reasoning、assistant message、function_call 属于同一轮 assistant 回复，连续的 function_call_output 属于同一轮 user 消息
+*/
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+// Responses API 的 item 类型
+const (
+	responsesItemMessage         = "message"
+	responsesItemFunctionCall    = "function_call"
+	responsesItemFunctionOutput  = "function_call_output"
+	responsesItemReasoning       = "reasoning"
+	responsesItemWebSearch       = "web_search_call"
+	responsesItemCodeInterpreter = "code_interpreter_call"
+	responsesItemReference       = "item_reference"
+)
+
+// responsesToolsError function、联网搜索、代码执行以外的工具在其它协议中没有对应
+func responsesToolsError(req *openai.ResponsesRequest) error {
+	for _, tool := range req.Tools {
+		switch tool.Type {
+		case "function", "web_search", "web_search_preview", "code_interpreter":
+		default:
+			return unsupported("tool type %s has no equivalent in the upstream dialect", tool.Type)
+		}
+	}
+	for _, item := range req.Input.Items {
+		if item.Type == responsesItemReference {
+			return unsupported("input item_reference %s cannot be resolved for the upstream dialect", item.Id)
+		}
+	}
+	return nil
+}
+
+func ResponsesRequestToGeneral(req *openai.ResponsesRequest) *general.Request {
+	result := &general.Request{
+		Stream:             req.Stream,
+		Model:              req.Model,
+		PreviousResponseId: req.PreviousResponseId,
+		Store:              req.Store,
+	}
+	if req.Instructions != "" {
+		result.SystemInstruction = &general.Content{Role: general.RoleSystem, Parts: []general.Part{textPart(req.Instructions)}}
+	}
+	if req.Input.Text != nil {
+		result.Contents = append(result.Contents, general.Content{Role: general.RoleUser, Parts: []general.Part{textPart(*req.Input.Text)}})
+	}
+	// function_call_output 只有 call_id，函数名需要从之前的 function_call 中查找
+	toolNames := map[string]string{}
+	for _, item := range req.Input.Items {
+		switch item.Type {
+		case responsesItemFunctionCall:
+			toolNames[item.CallId] = item.Name
+			appendResponsesPart(result, general.RoleAssistant, general.Part{FunctionCall: &general.FunctionCall{
+				Id:   item.CallId,
+				Name: item.Name,
+				Args: parseArguments(stringValue(item.Arguments)),
+			}})
+		case responsesItemFunctionOutput:
+			output := ""
+			if item.Output != nil {
+				output = partsText(responsesContentToGeneral(item.Output))
+			}
+			appendResponsesPart(result, general.RoleUser, general.Part{FunctionResponse: &general.FunctionResponse{
+				Id:       item.CallId,
+				Name:     toolNames[item.CallId],
+				Response: general.FunctionResponseContent{Output: &output},
+			}})
+		case responsesItemReasoning:
+			for _, part := range responsesReasoningToGeneral(item) {
+				appendResponsesPart(result, general.RoleAssistant, part)
+			}
+		case responsesItemCodeInterpreter:
+			for _, part := range responsesCodeToGeneral(item) {
+				appendResponsesPart(result, general.RoleAssistant, part)
+			}
+		case "", responsesItemMessage:
+			parts := responsesContentToGeneral(item.Content)
+			switch item.Role {
+			case openaiRoleSystem, openaiRoleDeveloper:
+				if result.SystemInstruction == nil {
+					result.SystemInstruction = &general.Content{Role: general.RoleSystem}
+				}
+				result.SystemInstruction.Parts = append(result.SystemInstruction.Parts, parts...)
+			case openaiRoleAssistant:
+				for _, part := range parts {
+					appendResponsesPart(result, general.RoleAssistant, part)
+				}
+			default:
+				result.Contents = append(result.Contents, general.Content{Role: general.RoleUser, Parts: parts})
+			}
+		}
+	}
+	result.Tools = responsesToolsToGeneral(req.Tools)
+	result.ToolConfig = responsesToolChoiceToGeneral(req.ToolChoice, req.ParallelToolCalls)
+	config := &general.GenerationConfig{
+		MaxOutputTokens: req.MaxOutputTokens,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+	}
+	if reasoning := req.Reasoning; reasoning != nil && (reasoning.Effort != "" || reasoning.Summary != "") {
+		config.Reasoning = &general.ReasoningConfig{Effort: reasoning.Effort}
+		if reasoning.Summary != "" {
+			config.Reasoning.IncludeThoughts = ptr(true)
+		}
+	}
+	if req.Text != nil {
+		if format := req.Text.Format; format != nil && format.Type != general.ResponseFormatText {
+			config.ResponseFormat = &general.ResponseFormat{
+				Type:        format.Type,
+				Name:        format.Name,
+				Description: format.Description,
+				Schema:      format.Schema,
+				Strict:      format.Strict,
+			}
+		}
+	}
+	result.GenerationConfig = emptyGenerationConfig(config)
+	return result
+}
+
+// appendResponsesPart 与上一条消息角色相同时合并为同一轮，user 的函数结果不与普通消息合并
+func appendResponsesPart(req *general.Request, role string, part general.Part) {
+	last := lastContent(req.Contents)
+	if last != nil && last.Role == role && (role == general.RoleAssistant || isFunctionResponses(last.Parts)) {
+		last.Parts = append(last.Parts, part)
+		return
+	}
+	req.Contents = append(req.Contents, general.Content{Role: role, Parts: []general.Part{part}})
+}
+
+func responsesContentToGeneral(content *openai.ResponseContent) []general.Part {
+	if content == nil {
+		return nil
+	}
+	if content.Text != nil {
+		return []general.Part{textPart(*content.Text)}
+	}
+	var parts []general.Part
+	for _, part := range content.Parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			parts = append(parts, textPart(stringValue(part.Text)))
+		case "refusal":
+			parts = append(parts, textPart(part.Refusal))
+		case "input_image":
+			if blob, ok := parseDataUrl(part.ImageUrl); ok {
+				parts = append(parts, general.Part{InlineData: blob})
+			} else if part.ImageUrl != "" {
+				parts = append(parts, general.Part{FileData: &general.FileData{
+					MimeType: guessMimeType(part.ImageUrl, defaultImageMimeType),
+					FileUri:  part.ImageUrl,
+				}})
+			} else if part.FileId != "" {
+				parts = append(parts, general.Part{FileData: &general.FileData{MimeType: defaultImageMimeType, FileUri: part.FileId}})
+			}
+		case "input_file":
+			if blob, ok := parseDataUrl(part.FileData); ok {
+				parts = append(parts, general.Part{InlineData: blob})
+			} else if uri := part.FileUrl + part.FileId; uri != "" {
+				parts = append(parts, general.Part{FileData: &general.FileData{
+					MimeType: guessMimeType(part.Filename+uri, "application/pdf"),
+					FileUri:  uri,
+				}})
+			}
+		}
+	}
+	return parts
+}
+
+// responsesReasoningToGeneral 摘要作为思考内容，encrypted_content 作为签名
+func responsesReasoningToGeneral(item openai.ResponseItem) []general.Part {
+	var texts []string
+	for _, summary := range item.Summary {
+		texts = append(texts, summary.Text)
+	}
+	if len(texts) == 0 && item.EncryptedContent == "" {
+		return nil
+	}
+	return []general.Part{thoughtPart(strings.Join(texts, "\n\n"), item.EncryptedContent)}
+}
+
+// responsesCodeToGeneral 代码执行的调用与日志输出转换为通用的代码块
+func responsesCodeToGeneral(item openai.ResponseItem) []general.Part {
+	var parts []general.Part
+	if item.Code != nil {
+		parts = append(parts, general.Part{ExecutableCode: &general.ExecutableCode{Language: "PYTHON", Code: *item.Code}})
+	}
+	var logs []string
+	for _, output := range item.Outputs {
+		if output.Type == "logs" {
+			logs = append(logs, output.Logs)
+		}
+	}
+	if len(logs) > 0 {
+		outcome := "OUTCOME_OK"
+		if item.Status == "failed" {
+			outcome = "OUTCOME_FAILED"
+		}
+		parts = append(parts, general.Part{CodeExecutionResult: &general.CodeExecutionResult{Outcome: outcome, Output: strings.Join(logs, "")}})
+	}
+	return parts
+}
+
+func responsesToolsToGeneral(tools []openai.ResponseTool) []general.Tool {
+	var result []general.Tool
+	var declarations []general.FunctionDeclaration
+	for _, tool := range tools {
+		switch tool.Type {
+		case "function":
+			declaration := general.FunctionDeclaration{Name: tool.Name, Description: tool.Description}
+			if tool.Parameters != nil {
+				declaration.Parameters = *tool.Parameters
+			}
+			declarations = append(declarations, declaration)
+		case "web_search", "web_search_preview":
+			result = append(result, general.Tool{WebSearch: ptr(true)})
+		case "code_interpreter":
+			result = append(result, general.Tool{CodeExecution: ptr(true)})
+		}
+	}
+	if len(declarations) > 0 {
+		result = append([]general.Tool{{FunctionDeclarations: declarations}}, result...)
+	}
+	return result
+}
+
+// responsesToolChoiceToGeneral 指定内置工具时按 required 处理
+func responsesToolChoiceToGeneral(choice *openai.ResponseToolChoice, parallel *bool) *general.ToolConfig {
+	if choice == nil && parallel == nil {
+		return nil
+	}
+	config := &general.ToolConfig{ParallelToolCalls: parallel}
+	switch {
+	case choice == nil:
+	case choice.Mode != "":
+		config.Mode = choice.Mode
+	case choice.Type == "function":
+		config.Mode = general.ToolModeRequired
+		config.AllowedFunctionNames = []string{choice.Name}
+	case choice.Type == "allowed_tools":
+		config.Mode = choice.AllowedMode
+		for _, tool := range choice.Tools {
+			if tool.Type == "function" {
+				config.AllowedFunctionNames = append(config.AllowedFunctionNames, tool.Name)
+			}
+		}
+	default:
+		config.Mode = general.ToolModeRequired
+	}
+	return config
+}
+
+func GeneralRequestToResponses(req *general.Request) *openai.ResponsesRequest {
+	result := &openai.ResponsesRequest{
+		Model:              req.Model,
+		Stream:             req.Stream,
+		PreviousResponseId: req.PreviousResponseId,
+		Store:              req.Store,
+		Tools:              generalToolsToResponses(req.Tools),
+		Input:              openai.ResponseInput{Items: []openai.ResponseItem{}},
+	}
+	generalToolConfigToResponses(req.ToolConfig, result)
+	if req.SystemInstruction != nil {
+		result.Instructions = partsText(req.SystemInstruction.Parts)
+	}
+	for _, content := range req.Contents {
+		result.Input.Items = append(result.Input.Items, generalContentToResponses(content)...)
+	}
+	if config := req.GenerationConfig; config != nil {
+		result.MaxOutputTokens = config.MaxOutputTokens
+		result.Temperature = config.Temperature
+		result.TopP = config.TopP
+		if effort := reasoningEffort(config.Reasoning); effort != "" {
+			result.Reasoning = &openai.ResponseReasoning{Effort: effort}
+		}
+		if config.Reasoning != nil && isTrue(config.Reasoning.IncludeThoughts) {
+			if result.Reasoning == nil {
+				result.Reasoning = &openai.ResponseReasoning{}
+			}
+			result.Reasoning.Summary = "auto"
+		}
+		if format := generalResponseFormatToOpenAI(config.ResponseFormat); format != nil {
+			textFormat := &openai.ResponseTextFormat{Type: format.Type}
+			if schema := format.JsonSchema; schema != nil {
+				textFormat.Name, textFormat.Description = schema.Name, schema.Description
+				textFormat.Schema, textFormat.Strict = schema.Schema, schema.Strict
+			}
+			result.Text = &openai.ResponseText{Format: textFormat}
+		}
+	}
+	return result
+}
+
+// generalContentToResponses 思考内容的签名只对产生它的服务有效，不传给上游
+func generalContentToResponses(content general.Content) []openai.ResponseItem {
+	var items []openai.ResponseItem
+	if content.Role == general.RoleAssistant {
+		var texts []string
+		flush := func() {
+			if len(texts) == 0 {
+				return
+			}
+			items = append(items, openai.ResponseItem{
+				Type:    responsesItemMessage,
+				Role:    openaiRoleAssistant,
+				Content: &openai.ResponseContent{Parts: []openai.ResponseContentPart{{Type: "output_text", Text: ptr(strings.Join(texts, ""))}}},
+			})
+			texts = nil
+		}
+		for _, part := range content.Parts {
+			if isThought(part) {
+				continue
+			}
+			if part.Text != nil {
+				texts = append(texts, *part.Text)
+			} else if text, ok := codeText(part); ok {
+				texts = append(texts, text)
+			}
+			if call := part.FunctionCall; call != nil {
+				flush()
+				items = append(items, openai.ResponseItem{
+					Type:      responsesItemFunctionCall,
+					CallId:    toolCallId(call.Id),
+					Name:      call.Name,
+					Arguments: ptr(marshalArguments(call.Args)),
+				})
+			}
+		}
+		flush()
+		return items
+	}
+	var parts []openai.ResponseContentPart
+	for _, part := range content.Parts {
+		if response := part.FunctionResponse; response != nil {
+			items = append(items, openai.ResponseItem{
+				Type:   responsesItemFunctionOutput,
+				CallId: toolCallId(response.Id),
+				Output: &openai.ResponseContent{Text: functionResponseText(response)},
+			})
+		}
+		if contentPart, ok := generalPartToResponses(part); ok {
+			parts = append(parts, contentPart)
+		}
+	}
+	if len(parts) > 0 {
+		items = append(items, openai.ResponseItem{
+			Type:    responsesItemMessage,
+			Role:    openaiRoleUser,
+			Content: &openai.ResponseContent{Parts: parts},
+		})
+	}
+	return items
+}
+
+// generalPartToResponses 用户消息中的多模态内容，无法表示的内容返回 false
+func generalPartToResponses(part general.Part) (openai.ResponseContentPart, bool) {
+	if isThought(part) {
+		return openai.ResponseContentPart{}, false
+	}
+	if part.Text != nil {
+		return openai.ResponseContentPart{Type: "input_text", Text: part.Text}, true
+	}
+	if text, ok := codeText(part); ok {
+		return openai.ResponseContentPart{Type: "input_text", Text: &text}, true
+	}
+	if blob := part.InlineData; blob != nil {
+		if isImage(blob.MimeType) {
+			return openai.ResponseContentPart{Type: "input_image", ImageUrl: dataUrl(blob), Detail: "auto"}, true
+		}
+		return openai.ResponseContentPart{Type: "input_file", FileData: dataUrl(blob), Filename: "file" + fileExtension(blob.MimeType)}, true
+	}
+	if file := part.FileData; file != nil {
+		switch {
+		case isImage(file.MimeType) && isHttpUrl(file.FileUri):
+			return openai.ResponseContentPart{Type: "input_image", ImageUrl: file.FileUri, Detail: "auto"}, true
+		case isHttpUrl(file.FileUri):
+			return openai.ResponseContentPart{Type: "input_file", FileUrl: file.FileUri}, true
+		case isImage(file.MimeType):
+			return openai.ResponseContentPart{Type: "input_image", FileId: file.FileUri, Detail: "auto"}, true
+		}
+		return openai.ResponseContentPart{Type: "input_file", FileId: file.FileUri}, true
+	}
+	return openai.ResponseContentPart{}, false
+}
+
+func generalToolsToResponses(tools []general.Tool) []openai.ResponseTool {
+	var result []openai.ResponseTool
+	for _, tool := range tools {
+		for _, fd := range tool.FunctionDeclarations {
+			parameters, _ := ToolSchema(constant.DialectOpenAI, fd.Parameters)
+			result = append(result, openai.ResponseTool{Type: "function", Name: fd.Name, Description: fd.Description, Parameters: &parameters})
+		}
+		if isTrue(tool.WebSearch) {
+			result = append(result, openai.ResponseTool{Type: "web_search"})
+		}
+		if isTrue(tool.CodeExecution) {
+			result = append(result, openai.ResponseTool{Type: "code_interpreter", Container: []byte(`{"type":"auto"}`)})
+		}
+	}
+	return result
+}
+
+// generalToolConfigToResponses 与 chat completions 相同，指定单个函数使用 function，多个函数使用 allowed_tools
+func generalToolConfigToResponses(config *general.ToolConfig, req *openai.ResponsesRequest) {
+	if config == nil || len(req.Tools) == 0 {
+		return
+	}
+	req.ParallelToolCalls = config.ParallelToolCalls
+	names := config.AllowedFunctionNames
+	switch {
+	case config.Mode == "":
+	case len(names) == 0 || config.Mode == general.ToolModeNone:
+		req.ToolChoice = &openai.ResponseToolChoice{Mode: config.Mode}
+	case len(names) == 1 && config.Mode == general.ToolModeRequired:
+		req.ToolChoice = &openai.ResponseToolChoice{Type: "function", Name: names[0]}
+	default:
+		choice := &openai.ResponseToolChoice{Type: "allowed_tools", AllowedMode: config.Mode}
+		for _, name := range names {
+			choice.Tools = append(choice.Tools, openai.ResponseTool{Type: "function", Name: name})
+		}
+		req.ToolChoice = choice
+	}
+}
+
+func ResponsesResponseToGeneral(resp *openai.ResponsesResponse) *general.Response {
+	result := &general.Response{Id: resp.Id, Model: resp.Model}
+	content := &general.Content{Role: general.RoleAssistant}
+	candidate := general.Candidate{Content: content}
+	// 引用位置相对于所在 content part，需要加上之前文本的长度
+	var text strings.Builder
+	toolCalls := false
+	for _, item := range resp.Output {
+		switch item.Type {
+		case responsesItemMessage:
+			if item.Content == nil {
+				continue
+			}
+			if item.Content.Text != nil {
+				content.Parts = append(content.Parts, textPart(*item.Content.Text))
+				text.WriteString(*item.Content.Text)
+				continue
+			}
+			for _, part := range item.Content.Parts {
+				value := stringValue(part.Text)
+				if part.Type == "refusal" {
+					value = part.Refusal
+				}
+				offset := text.Len()
+				content.Parts = append(content.Parts, textPart(value))
+				text.WriteString(value)
+				candidate.Citations = append(candidate.Citations, responsesAnnotationsToGeneral(part.Annotations, value, offset)...)
+			}
+		case responsesItemFunctionCall:
+			toolCalls = true
+			content.Parts = append(content.Parts, general.Part{FunctionCall: &general.FunctionCall{
+				Id:   item.CallId,
+				Name: item.Name,
+				Args: parseArguments(stringValue(item.Arguments)),
+			}})
+		case responsesItemReasoning:
+			content.Parts = append(content.Parts, responsesReasoningToGeneral(item)...)
+		case responsesItemCodeInterpreter:
+			content.Parts = append(content.Parts, responsesCodeToGeneral(item)...)
+		case responsesItemWebSearch:
+			if item.Action != nil && item.Action.Query != "" {
+				candidate.SearchQueries = append(candidate.SearchQueries, item.Action.Query)
+			}
+		}
+	}
+	candidate.FinishReason = responsesFinishReasonToGeneral(resp.Status, resp.IncompleteDetails, toolCalls)
+	result.Candidates = []general.Candidate{candidate}
+	if resp.Usage != nil {
+		result.Usage = responsesUsageToGeneral(resp.Usage)
+	}
+	return result
+}
+
+// responsesAnnotationsToGeneral 字符位置转换为整个回答文本中的字节位置
+func responsesAnnotationsToGeneral(annotations []openai.ResponseAnnotation, text string, offset int) []general.Citation {
+	var citations []general.Citation
+	for _, annotation := range annotations {
+		if annotation.Type != "url_citation" {
+			continue
+		}
+		start, end := charToByteIndex(text, annotation.StartIndex), charToByteIndex(text, annotation.EndIndex)
+		result := general.Citation{Uri: annotation.Url, Title: annotation.Title}
+		if start <= end && end <= len(text) {
+			result.Text = text[start:end]
+		}
+		start, end = start+offset, end+offset
+		result.StartIndex, result.EndIndex = &start, &end
+		citations = append(citations, result)
+	}
+	return citations
+}
+
+func responsesFinishReasonToGeneral(status string, details *openai.ResponseIncompleteDetails, toolCalls bool) string {
+	switch {
+	case status == "failed":
+		return general.FinishReasonError
+	case status == "incomplete" && details != nil && details.Reason == "content_filter":
+		return general.FinishReasonContentFilter
+	case status == "incomplete":
+		return general.FinishReasonLength
+	case toolCalls:
+		return general.FinishReasonToolCalls
+	}
+	return general.FinishReasonStop
+}
+
+// generalFinishReasonToResponses 返回 status 与 incomplete_details
+func generalFinishReasonToResponses(reason string) (string, *openai.ResponseIncompleteDetails) {
+	switch reason {
+	case general.FinishReasonLength:
+		return "incomplete", &openai.ResponseIncompleteDetails{Reason: "max_output_tokens"}
+	case general.FinishReasonContentFilter:
+		return "incomplete", &openai.ResponseIncompleteDetails{Reason: "content_filter"}
+	case general.FinishReasonError:
+		return "failed", nil
+	}
+	return "completed", nil
+}
+
+// GeneralResponseToResponses 只输出第一个候选，Responses API 没有多候选
+func GeneralResponseToResponses(resp *general.Response) *openai.ResponsesResponse {
+	result := &openai.ResponsesResponse{
+		Id:        resp.Id,
+		Object:    "response",
+		CreatedAt: time.Now().Unix(),
+		Status:    "completed",
+		Model:     resp.Model,
+		Output:    []openai.ResponseItem{},
+	}
+	if !strings.HasPrefix(result.Id, "resp_") {
+		result.Id = newId("resp_")
+	}
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		if candidate.Content != nil {
+			result.Output = generalPartsToResponsesOutput(candidate.Content.Parts, candidate.Citations)
+		}
+		result.Status, result.IncompleteDetails = generalFinishReasonToResponses(candidate.FinishReason)
+	}
+	if resp.Usage != nil {
+		result.Usage = generalUsageToResponses(resp.Usage)
+	}
+	return result
+}
+
+// generalPartsToResponsesOutput 连续的文本合并为一个 message，思考内容、函数调用、代码执行各自为一个 item
+func generalPartsToResponsesOutput(parts []general.Part, citations []general.Citation) []openai.ResponseItem {
+	var items []openai.ResponseItem
+	var text strings.Builder
+	var messageText []string
+	flush := func() {
+		if len(messageText) == 0 {
+			return
+		}
+		value := strings.Join(messageText, "")
+		items = append(items, responsesMessageItem(newId("msg_"), value, generalCitationsToResponses(citations, text.String(), value)))
+		text.WriteString(value)
+		messageText = nil
+	}
+	for _, part := range parts {
+		switch {
+		case isThought(part):
+			flush()
+			item := openai.ResponseItem{Type: responsesItemReasoning, Id: newId("rs_"), EncryptedContent: stringValue(part.ThoughtSignature)}
+			if part.Text != nil && *part.Text != "" {
+				item.Summary = []openai.ResponseSummary{{Type: "summary_text", Text: *part.Text}}
+			}
+			items = append(items, item)
+		case part.Text != nil:
+			messageText = append(messageText, *part.Text)
+		case part.FunctionCall != nil:
+			flush()
+			call := part.FunctionCall
+			items = append(items, openai.ResponseItem{
+				Type:      responsesItemFunctionCall,
+				Id:        newId("fc_"),
+				Status:    "completed",
+				CallId:    toolCallId(call.Id),
+				Name:      call.Name,
+				Arguments: ptr(marshalArguments(call.Args)),
+			})
+		case part.ExecutableCode != nil:
+			flush()
+			items = append(items, openai.ResponseItem{
+				Type:    responsesItemCodeInterpreter,
+				Id:      newId("ci_"),
+				Status:  "completed",
+				Code:    &part.ExecutableCode.Code,
+				Outputs: []openai.ResponseCodeOutput{},
+			})
+		case part.CodeExecutionResult != nil:
+			// 结果挂在之前的代码执行上
+			output := openai.ResponseCodeOutput{Type: "logs", Logs: part.CodeExecutionResult.Output}
+			if last := len(items) - 1; last >= 0 && items[last].Type == responsesItemCodeInterpreter && len(messageText) == 0 {
+				items[last].Outputs = append(items[last].Outputs, output)
+				if part.CodeExecutionResult.Outcome == "OUTCOME_FAILED" {
+					items[last].Status = "failed"
+				}
+				continue
+			}
+			messageText = append(messageText, "```output\n"+output.Logs+"\n```")
+		}
+	}
+	flush()
+	return items
+}
+
+func responsesMessageItem(id string, text string, annotations []openai.ResponseAnnotation) openai.ResponseItem {
+	return openai.ResponseItem{
+		Type:    responsesItemMessage,
+		Id:      id,
+		Status:  "completed",
+		Role:    openaiRoleAssistant,
+		Content: &openai.ResponseContent{Parts: []openai.ResponseContentPart{{Type: "output_text", Text: &text, Annotations: annotations}}},
+	}
+}
+
+// generalCitationsToResponses 只保留落在当前 message 文本中的引用，没有位置的引用对应整个文本
+// before 为之前 message 的文本，引用位置按整个回答计算
+func generalCitationsToResponses(citations []general.Citation, before string, text string) []openai.ResponseAnnotation {
+	var annotations []openai.ResponseAnnotation
+	for _, citation := range citations {
+		start, end := 0, len(text)
+		if citation.EndIndex != nil {
+			start, end = intValue(citation.StartIndex)-len(before), *citation.EndIndex-len(before)
+			if start < 0 || end > len(text) || start > end {
+				continue
+			}
+		}
+		annotations = append(annotations, openai.ResponseAnnotation{
+			Type:       "url_citation",
+			StartIndex: byteToCharIndex(text, start),
+			EndIndex:   byteToCharIndex(text, end),
+			Url:        citation.Uri,
+			Title:      citation.Title,
+		})
+	}
+	return annotations
+}
+
+func responsesUsageToGeneral(usage *openai.ResponsesUsage) *general.Usage {
+	return &general.Usage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.TotalTokens,
+		CachedTokens:     usage.InputTokensDetails.CachedTokens,
+		ReasoningTokens:  usage.OutputTokensDetails.ReasoningTokens,
+	}
+}
+
+func generalUsageToResponses(usage *general.Usage) *openai.ResponsesUsage {
+	result := &openai.ResponsesUsage{
+		InputTokens:         usage.PromptTokens,
+		InputTokensDetails:  openai.ResponsesInputTokensDetails{CachedTokens: usage.CachedTokens},
+		OutputTokens:        usage.CompletionTokens,
+		OutputTokensDetails: openai.ResponsesOutputTokensDetails{ReasoningTokens: usage.ReasoningTokens},
+		TotalTokens:         usage.TotalTokens,
+	}
+	if result.TotalTokens == 0 {
+		result.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return result
+}
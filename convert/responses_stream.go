@@ -0,0 +1,435 @@
+package convert
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// responsesStreamDecoder 文本与思考内容按 delta 输出，函数调用在 output_item.done 时整体输出
+type responsesStreamDecoder struct {
+	id    string
+	model string
+	// 已收到的回答文本与当前 content part 的起始位置，引用位置相对于 content part
+	text       strings.Builder
+	partOffset int
+	toolCalls  bool
+}
+
+func (d *responsesStreamDecoder) Decode(event sse.Event) ([]*general.Response, error) {
+	data := strings.TrimSpace(event.Data)
+	if data == "" {
+		return nil, nil
+	}
+	var streamEvent openai.ResponseStreamEvent
+	if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
+		return nil, err
+	}
+	switch streamEvent.Type {
+	case "response.created", "response.in_progress":
+		if resp := streamEvent.Response; resp != nil {
+			d.id, d.model = resp.Id, resp.Model
+		}
+	case "response.content_part.added":
+		d.partOffset = d.text.Len()
+	case "response.output_text.delta", "response.refusal.delta":
+		if streamEvent.Delta == "" {
+			return nil, nil
+		}
+		d.text.WriteString(streamEvent.Delta)
+		return d.delta([]general.Part{textPart(streamEvent.Delta)}, ""), nil
+	case "response.output_text.annotation.added":
+		if streamEvent.Annotation == nil {
+			return nil, nil
+		}
+		text := d.text.String()
+		citations := responsesAnnotationsToGeneral([]openai.ResponseAnnotation{*streamEvent.Annotation}, text[d.partOffset:], d.partOffset)
+		if len(citations) == 0 {
+			return nil, nil
+		}
+		resps := d.delta(nil, "")
+		resps[0].Candidates[0].Citations = citations
+		return resps, nil
+	case "response.reasoning_summary_part.added":
+		// 多段摘要之间与非流式一样以空行分隔
+		if intValue(streamEvent.SummaryIndex) > 0 {
+			return d.delta([]general.Part{thoughtPart("\n\n", "")}, ""), nil
+		}
+	case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+		if streamEvent.Delta == "" {
+			return nil, nil
+		}
+		return d.delta([]general.Part{thoughtPart(streamEvent.Delta, "")}, ""), nil
+	case "response.output_item.done":
+		return d.itemDone(streamEvent.Item), nil
+	case "response.completed", "response.incomplete", "response.failed":
+		resp := streamEvent.Response
+		if resp == nil {
+			return nil, nil
+		}
+		if resp.Status == "failed" {
+			message := "upstream response failed"
+			if resp.Error != nil {
+				message = resp.Error.Message
+			}
+			return nil, &UpstreamError{Message: message}
+		}
+		resps := d.delta(nil, responsesFinishReasonToGeneral(resp.Status, resp.IncompleteDetails, d.toolCalls))
+		if resp.Usage != nil {
+			resps[0].Usage = responsesUsageToGeneral(resp.Usage)
+		}
+		return resps, nil
+	case "error":
+		message := streamEvent.Message
+		if message == "" {
+			message = "upstream stream error"
+		}
+		return nil, &UpstreamError{Message: message}
+	}
+	return nil, nil
+}
+
+// itemDone 函数调用、推理的签名、代码执行与搜索词在 item 完成时输出
+func (d *responsesStreamDecoder) itemDone(item *openai.ResponseItem) []*general.Response {
+	if item == nil {
+		return nil
+	}
+	switch item.Type {
+	case responsesItemFunctionCall:
+		d.toolCalls = true
+		return d.delta([]general.Part{{FunctionCall: &general.FunctionCall{
+			Id:   item.CallId,
+			Name: item.Name,
+			Args: parseArguments(stringValue(item.Arguments)),
+		}}}, "")
+	case responsesItemReasoning:
+		if item.EncryptedContent != "" {
+			return d.delta([]general.Part{thoughtPart("", item.EncryptedContent)}, "")
+		}
+	case responsesItemCodeInterpreter:
+		if parts := responsesCodeToGeneral(*item); len(parts) > 0 {
+			return d.delta(parts, "")
+		}
+	case responsesItemWebSearch:
+		if item.Action != nil && item.Action.Query != "" {
+			resps := d.delta(nil, "")
+			resps[0].Candidates[0].SearchQueries = []string{item.Action.Query}
+			return resps
+		}
+	}
+	return nil
+}
+
+func (d *responsesStreamDecoder) Finish() []*general.Response {
+	return nil
+}
+
+func (d *responsesStreamDecoder) delta(parts []general.Part, finishReason string) []*general.Response {
+	return []*general.Response{deltaResponse(d.id, d.model, parts, finishReason)}
+}
+
+// responsesStreamEncoder 按 response.created、output_item、content_part、response.completed 的顺序输出
+// 连续的文本、思考内容分别合并在同一个 item 中，函数调用与代码执行各占一个 item
+type responsesStreamEncoder struct {
+	id        string
+	model     string
+	createdAt int64
+	sequence  int
+	started   bool
+	// 当前未结束的 item 及其文本，open: message、reasoning、code
+	open     string
+	item     openai.ResponseItem
+	itemText strings.Builder
+	// 已结束的 item 与其中的回答文本
+	output       []openai.ResponseItem
+	text         strings.Builder
+	finishReason string
+	usage        *general.Usage
+}
+
+func (e *responsesStreamEncoder) Encode(resp *general.Response) []sse.Event {
+	if resp.Usage != nil {
+		e.usage = resp.Usage
+	}
+	if e.id == "" && strings.HasPrefix(resp.Id, "resp_") {
+		e.id = resp.Id
+	}
+	if resp.Model != "" && !e.started {
+		e.model = resp.Model
+	}
+	// Responses API 只有一个候选
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	candidate := resp.Candidates[0]
+	events := e.start()
+	if candidate.Content != nil {
+		for _, part := range candidate.Content.Parts {
+			events = append(events, e.part(part)...)
+		}
+	}
+	for _, citation := range candidate.Citations {
+		events = append(events, e.openItem("message")...)
+		annotations := generalCitationsToResponses([]general.Citation{citation}, e.text.String(), e.itemText.String())
+		for _, annotation := range annotations {
+			e.item.Content.Parts[0].Annotations = append(e.item.Content.Parts[0].Annotations, annotation)
+			events = append(events, e.event(openai.ResponseStreamEvent{
+				Type:            "response.output_text.annotation.added",
+				OutputIndex:     ptr(len(e.output)),
+				ContentIndex:    ptr(0),
+				ItemId:          e.item.Id,
+				AnnotationIndex: ptr(len(e.item.Content.Parts[0].Annotations) - 1),
+				Annotation:      &annotation,
+			}))
+		}
+	}
+	if candidate.FinishReason != "" {
+		e.finishReason = candidate.FinishReason
+	}
+	return events
+}
+
+func (e *responsesStreamEncoder) start() []sse.Event {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	if e.id == "" {
+		e.id = newId("resp_")
+	}
+	e.createdAt = time.Now().Unix()
+	return []sse.Event{
+		e.event(openai.ResponseStreamEvent{Type: "response.created", Response: e.response("in_progress", nil)}),
+		e.event(openai.ResponseStreamEvent{Type: "response.in_progress", Response: e.response("in_progress", nil)}),
+	}
+}
+
+func (e *responsesStreamEncoder) part(part general.Part) []sse.Event {
+	if isThought(part) {
+		return e.thought(part)
+	}
+	if part.Text != nil && *part.Text != "" {
+		events := e.openItem("message")
+		e.itemText.WriteString(*part.Text)
+		return append(events, e.event(openai.ResponseStreamEvent{
+			Type:         "response.output_text.delta",
+			OutputIndex:  ptr(len(e.output)),
+			ContentIndex: ptr(0),
+			ItemId:       e.item.Id,
+			Delta:        *part.Text,
+		}))
+	}
+	if call := part.FunctionCall; call != nil {
+		events := e.closeItem()
+		arguments := marshalArguments(call.Args)
+		item := openai.ResponseItem{
+			Type:      responsesItemFunctionCall,
+			Id:        newId("fc_"),
+			Status:    "in_progress",
+			CallId:    toolCallId(call.Id),
+			Name:      call.Name,
+			Arguments: ptr(""),
+		}
+		index := len(e.output)
+		events = append(events, e.event(openai.ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: &index, Item: &item}))
+		events = append(events, e.event(openai.ResponseStreamEvent{
+			Type:        "response.function_call_arguments.delta",
+			OutputIndex: &index,
+			ItemId:      item.Id,
+			Delta:       arguments,
+		}), e.event(openai.ResponseStreamEvent{
+			Type:        "response.function_call_arguments.done",
+			OutputIndex: &index,
+			ItemId:      item.Id,
+			Arguments:   &arguments,
+		}))
+		done := item
+		done.Status, done.Arguments = "completed", &arguments
+		e.output = append(e.output, done)
+		return append(events, e.event(openai.ResponseStreamEvent{Type: "response.output_item.done", OutputIndex: &index, Item: &done}))
+	}
+	if code := part.ExecutableCode; code != nil {
+		events := e.openItem("code")
+		e.item.Code = &code.Code
+		return events
+	}
+	if result := part.CodeExecutionResult; result != nil {
+		if e.open != "code" {
+			text := "```output\n" + result.Output + "\n```"
+			return e.part(textPart(text))
+		}
+		e.item.Outputs = append(e.item.Outputs, openai.ResponseCodeOutput{Type: "logs", Logs: result.Output})
+		if result.Outcome == "OUTCOME_FAILED" {
+			e.item.Status = "failed"
+		}
+		return e.closeItem()
+	}
+	return nil
+}
+
+// thought 思考内容作为推理摘要输出，签名在思考内容之后到达，作为 encrypted_content 后结束 reasoning
+func (e *responsesStreamEncoder) thought(part general.Part) []sse.Event {
+	var events []sse.Event
+	if part.Text != nil && *part.Text != "" {
+		events = append(events, e.openItem("reasoning")...)
+		if e.item.Summary == nil {
+			e.item.Summary = []openai.ResponseSummary{}
+			events = append(events, e.event(openai.ResponseStreamEvent{
+				Type:         "response.reasoning_summary_part.added",
+				OutputIndex:  ptr(len(e.output)),
+				SummaryIndex: ptr(0),
+				ItemId:       e.item.Id,
+				Part:         &openai.ResponseContentPart{Type: "summary_text", Text: ptr("")},
+			}))
+		}
+		e.itemText.WriteString(*part.Text)
+		events = append(events, e.event(openai.ResponseStreamEvent{
+			Type:         "response.reasoning_summary_text.delta",
+			OutputIndex:  ptr(len(e.output)),
+			SummaryIndex: ptr(0),
+			ItemId:       e.item.Id,
+			Delta:        *part.Text,
+		}))
+	}
+	if signature := stringValue(part.ThoughtSignature); signature != "" {
+		events = append(events, e.openItem("reasoning")...)
+		e.item.EncryptedContent = signature
+		events = append(events, e.closeItem()...)
+	}
+	return events
+}
+
+// openItem 当前 item 类型不同时先结束当前 item
+func (e *responsesStreamEncoder) openItem(itemType string) []sse.Event {
+	if e.open == itemType {
+		return nil
+	}
+	events := e.closeItem()
+	e.open = itemType
+	e.itemText.Reset()
+	index := len(e.output)
+	switch itemType {
+	case "message":
+		e.item = openai.ResponseItem{
+			Type:    responsesItemMessage,
+			Id:      newId("msg_"),
+			Status:  "in_progress",
+			Role:    openaiRoleAssistant,
+			Content: &openai.ResponseContent{Parts: []openai.ResponseContentPart{}},
+		}
+		added := e.item
+		events = append(events, e.event(openai.ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: &index, Item: &added}))
+		e.item.Content = &openai.ResponseContent{Parts: []openai.ResponseContentPart{{Type: "output_text", Text: ptr("")}}}
+		return append(events, e.event(openai.ResponseStreamEvent{
+			Type:         "response.content_part.added",
+			OutputIndex:  &index,
+			ContentIndex: ptr(0),
+			ItemId:       e.item.Id,
+			Part:         &openai.ResponseContentPart{Type: "output_text", Text: ptr("")},
+		}))
+	case "reasoning":
+		e.item = openai.ResponseItem{Type: responsesItemReasoning, Id: newId("rs_")}
+	case "code":
+		e.item = openai.ResponseItem{Type: responsesItemCodeInterpreter, Id: newId("ci_"), Status: "in_progress", Outputs: []openai.ResponseCodeOutput{}}
+	}
+	added := e.item
+	return append(events, e.event(openai.ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: &index, Item: &added}))
+}
+
+func (e *responsesStreamEncoder) closeItem() []sse.Event {
+	if e.open == "" {
+		return nil
+	}
+	var events []sse.Event
+	index := len(e.output)
+	text := e.itemText.String()
+	switch e.open {
+	case "message":
+		part := e.item.Content.Parts[0]
+		part.Text = &text
+		e.item.Content.Parts[0] = part
+		events = append(events, e.event(openai.ResponseStreamEvent{
+			Type:         "response.output_text.done",
+			OutputIndex:  &index,
+			ContentIndex: ptr(0),
+			ItemId:       e.item.Id,
+			Text:         &text,
+		}), e.event(openai.ResponseStreamEvent{
+			Type:         "response.content_part.done",
+			OutputIndex:  &index,
+			ContentIndex: ptr(0),
+			ItemId:       e.item.Id,
+			Part:         &part,
+		}))
+		e.text.WriteString(text)
+	case "reasoning":
+		if e.item.Summary != nil {
+			summary := openai.ResponseSummary{Type: "summary_text", Text: text}
+			e.item.Summary = []openai.ResponseSummary{summary}
+			events = append(events, e.event(openai.ResponseStreamEvent{
+				Type:         "response.reasoning_summary_text.done",
+				OutputIndex:  &index,
+				SummaryIndex: ptr(0),
+				ItemId:       e.item.Id,
+				Text:         &text,
+			}), e.event(openai.ResponseStreamEvent{
+				Type:         "response.reasoning_summary_part.done",
+				OutputIndex:  &index,
+				SummaryIndex: ptr(0),
+				ItemId:       e.item.Id,
+				Part:         &openai.ResponseContentPart{Type: "summary_text", Text: &text},
+			}))
+		}
+	}
+	if e.item.Status == "in_progress" {
+		e.item.Status = "completed"
+	}
+	done := e.item
+	e.output = append(e.output, done)
+	e.open = ""
+	return append(events, e.event(openai.ResponseStreamEvent{Type: "response.output_item.done", OutputIndex: &index, Item: &done}))
+}
+
+func (e *responsesStreamEncoder) Finish() []sse.Event {
+	events := e.start()
+	events = append(events, e.closeItem()...)
+	status, details := generalFinishReasonToResponses(e.finishReason)
+	eventType := "response.completed"
+	switch status {
+	case "incomplete":
+		eventType = "response.incomplete"
+	case "failed":
+		eventType = "response.failed"
+	}
+	resp := e.response(status, details)
+	resp.Output = e.output
+	if resp.Output == nil {
+		resp.Output = []openai.ResponseItem{}
+	}
+	if e.usage != nil {
+		resp.Usage = generalUsageToResponses(e.usage)
+	}
+	return append(events, e.event(openai.ResponseStreamEvent{Type: eventType, Response: resp}))
+}
+
+func (e *responsesStreamEncoder) response(status string, details *openai.ResponseIncompleteDetails) *openai.ResponsesResponse {
+	return &openai.ResponsesResponse{
+		Id:                e.id,
+		Object:            "response",
+		CreatedAt:         e.createdAt,
+		Status:            status,
+		Model:             e.model,
+		Output:            []openai.ResponseItem{},
+		IncompleteDetails: details,
+	}
+}
+
+func (e *responsesStreamEncoder) event(streamEvent openai.ResponseStreamEvent) sse.Event {
+	streamEvent.SequenceNumber = e.sequence
+	e.sequence++
+	return jsonEvent(streamEvent.Type, streamEvent)
+}
@@ -0,0 +1,164 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+func TestResponsesRequest(t *testing.T) {
+	body := `{"model":"gpt-4o","instructions":"be brief","reasoning":{"effort":"low","summary":"auto"},"input":[
+		{"role":"developer","content":"use tools"},
+		{"role":"user","content":[{"type":"input_text","text":"weather?"}]},
+		{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"plan"}],"encrypted_content":"enc"},
+		{"type":"function_call","id":"fc_1","call_id":"call_1","name":"weather","arguments":"{\"city\":\"bj\"}"},
+		{"type":"function_call_output","call_id":"call_1","output":"sunny"}],
+		"tools":[{"type":"function","name":"weather","parameters":{"type":"object"}}],"tool_choice":"required",
+		"text":{"format":{"type":"json_schema","name":"w","schema":{"type":"object"}}}}`
+	req, err := DecodeRequest(constant.DialectResponses, "v1/responses", []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.SystemInstruction.Parts) != 2 || len(req.Contents) != 3 {
+		t.Fatalf("input 转换错误: %+v", req)
+	}
+	assistant := req.Contents[1].Parts
+	if len(assistant) != 2 || !isThought(assistant[0]) || *assistant[0].ThoughtSignature != "enc" || assistant[1].FunctionCall.Id != "call_1" {
+		t.Fatalf("推理与函数调用应合并为同一轮: %+v", assistant)
+	}
+	if response := req.Contents[2].Parts[0].FunctionResponse; response.Name != "weather" || *response.Response.Output != "sunny" {
+		t.Fatalf("函数结果转换错误: %+v", response)
+	}
+	config := req.GenerationConfig
+	if config.Reasoning.Effort != "low" || !*config.Reasoning.IncludeThoughts || config.ResponseFormat.Name != "w" {
+		t.Fatalf("生成配置转换错误: %+v", config)
+	}
+	claudeReq := GeneralRequestToClaude(req)
+	if claudeReq.Messages[1].Content.Blocks[0].Signature != "enc" || claudeReq.Messages[2].Content.Blocks[0].ToolUseId != "call_1" {
+		t.Fatalf("claude 转换错误: %+v", claudeReq)
+	}
+
+	// 通用请求转换回 responses，思考内容不回传
+	back, _ := json.Marshal(GeneralRequestToResponses(req))
+	for _, want := range []string{`"instructions":"be brief\nuse tools"`, `"type":"function_call","call_id":"call_1"`,
+		`"type":"function_call_output","call_id":"call_1","output":"sunny"`, `"tool_choice":"required"`} {
+		if !strings.Contains(string(back), want) {
+			t.Fatalf("转换回 responses 缺少 %s: %s", want, back)
+		}
+	}
+	if strings.Contains(string(back), "reasoning\",") {
+		t.Fatalf("思考内容不应回传: %s", back)
+	}
+
+	req.PreviousResponseId = "resp_1"
+	var unsupported *UnsupportedError
+	if _, _, err := EncodeRequest(constant.DialectGemini, req); !errors.As(err, &unsupported) {
+		t.Fatalf("previous_response_id 只能发送给 responses 上游: %v", err)
+	}
+	if _, data, err := EncodeRequest(constant.DialectResponses, req); err != nil || !strings.Contains(string(data), `"previous_response_id":"resp_1"`) {
+		t.Fatalf("previous_response_id 应原样发送: %s %v", data, err)
+	}
+}
+
+func TestResponsesResponse(t *testing.T) {
+	body := `{"id":"resp_1","object":"response","created_at":1,"status":"completed","model":"gpt-4o","output":[
+		{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"plan"}]},
+		{"type":"web_search_call","id":"ws_1","status":"completed","action":{"type":"search","query":"bj weather"}},
+		{"type":"message","id":"msg_1","role":"assistant","content":[{"type":"output_text","text":"北京 sunny","annotations":[
+			{"type":"url_citation","start_index":3,"end_index":8,"url":"https://w","title":"W"}]}]}],
+		"usage":{"input_tokens":3,"output_tokens":7,"output_tokens_details":{"reasoning_tokens":5},"total_tokens":10}}`
+	resp, err := DecodeResponse(constant.DialectResponses, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidate := resp.Candidates[0]
+	if len(candidate.Content.Parts) != 2 || !isThought(candidate.Content.Parts[0]) || candidate.SearchQueries[0] != "bj weather" {
+		t.Fatalf("output 转换错误: %+v", candidate)
+	}
+	if citation := candidate.Citations[0]; citation.Text != "sunny" || *citation.StartIndex != 7 {
+		t.Fatalf("引用位置应转换为字节位置: %+v", citation)
+	}
+	if resp.Usage.ReasoningTokens != 5 || candidate.FinishReason != "stop" {
+		t.Fatalf("用量与结束原因转换错误: %+v", resp)
+	}
+	openaiResp := GeneralResponseToOpenAI(resp)
+	if *openaiResp.Choices[0].Message.ReasoningContent != "plan" {
+		t.Fatalf("openai 思考内容转换错误: %+v", openaiResp.Choices[0].Message)
+	}
+
+	gemini, _ := DecodeResponse(constant.DialectGemini, []byte(`{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"plan","thought":true,"thoughtSignature":"sig"},{"text":"call"},{"functionCall":{"name":"weather","args":{"city":"bj"}}}]},
+		"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5}}`))
+	result := GeneralResponseToResponses(gemini)
+	if len(result.Output) != 3 || result.Output[0].EncryptedContent != "sig" || result.Output[2].Name != "weather" {
+		t.Fatalf("responses output 转换错误: %+v", result.Output)
+	}
+	if result.Status != "incomplete" || result.IncompleteDetails.Reason != "max_output_tokens" || result.Usage.TotalTokens != 5 {
+		t.Fatalf("responses 状态转换错误: %+v", result)
+	}
+}
+
+func TestResponsesReasoningStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":3,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"ok"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":9}}`,
+		`{"type":"message_stop"}`,
+	}
+	converter, _ := NewStreamConverter(constant.DialectClaude, constant.DialectResponses, "claude")
+	var out []sse.Event
+	for _, data := range events {
+		converted, err := converter.Convert(sse.Event{Data: data, HasData: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, converted...)
+	}
+	out = append(out, converter.Finish()...)
+	var types []string
+	for _, event := range out {
+		types = append(types, event.Event)
+	}
+	want := "response.created response.in_progress response.output_item.added response.reasoning_summary_part.added " +
+		"response.reasoning_summary_text.delta response.reasoning_summary_text.done response.reasoning_summary_part.done " +
+		"response.output_item.done response.output_item.added response.content_part.added response.output_text.delta " +
+		"response.output_text.done response.content_part.done response.output_item.done response.incomplete"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("事件顺序错误:\n%s", got)
+	}
+	if last := out[len(out)-1].Data; !strings.Contains(last, `"encrypted_content":"sig"`) || !strings.Contains(last, `"output_tokens":9`) {
+		t.Fatalf("结束事件缺少签名或用量: %s", last)
+	}
+
+	// responses 的推理流转换回 claude
+	converter, _ = NewStreamConverter(constant.DialectResponses, constant.DialectClaude, "gpt")
+	var data []string
+	for _, event := range out {
+		converted, err := converter.Convert(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range converted {
+			data = append(data, e.Data)
+		}
+	}
+	for _, e := range converter.Finish() {
+		data = append(data, e.Data)
+	}
+	joined := strings.Join(data, "\n")
+	for _, w := range []string{`"thinking":"hmm"`, `"signature":"sig"`, `"text":"ok"`, `"stop_reason":"max_tokens"`} {
+		if !strings.Contains(joined, w) {
+			t.Fatalf("claude 流式转换缺少 %s: %s", w, joined)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+)
+
+// gemini responseSchema 只支持 OpenAPI 3.0 schema 的子集
+var geminiSchemaKeywords = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true, "enum": true,
+	"maxItems": true, "minItems": true, "properties": true, "required": true, "minProperties": true,
+	"maxProperties": true, "minLength": true, "maxLength": true, "pattern": true, "example": true,
+	"anyOf": true, "propertyOrdering": true, "default": true, "items": true, "minimum": true, "maximum": true,
+}
+
+// openai strict 模式不支持的关键字
+var openaiStrictDropKeywords = map[string]bool{
+	"default": true, "examples": true, "example": true, "minLength": true, "maxLength": true,
+	"minProperties": true, "maxProperties": true, "propertyOrdering": true, "nullable": true,
+}
+
+// 其它协议都不认识的 gemini/OpenAPI 扩展
+var openapiOnlyKeywords = map[string]bool{
+	"propertyOrdering": true, "nullable": true, "example": true,
+}
+
+// 子 schema 所在的关键字
+var schemaMapKeywords = []string{"properties", "$defs", "definitions", "patternProperties"}
+var schemaListKeywords = []string{"anyOf", "oneOf", "allOf", "prefixItems"}
+var schemaKeywords = []string{"items", "additionalProperties", "not"}
+
+// NormalizeSchema 按上游协议降级 JSON Schema，返回新的 schema，不修改入参
+// strict 为 openai strict 模式：所有对象禁止额外属性，所有属性必填，可选属性改为可空
+func NormalizeSchema(dialect string, schema map[string]any, strict bool) map[string]any {
+	result, _ := normalizeSchema(dialect, schema, strict)
+	return result
+}
+
+func normalizeSchema(dialect string, schema map[string]any, strict bool) (map[string]any, []string) {
+	if schema == nil {
+		return nil, nil
+	}
+	n := &schemaNormalizer{strict: dialect == constant.DialectOpenAI && strict}
+	var result map[string]any
+	if dialect == constant.DialectGemini {
+		// gemini 不支持 $ref 与 allOf，先展开
+		result = n.gemini(n.inline(schema, schemaDefs(schema), nil, ""), "")
+	} else {
+		result = n.json(schema, "")
+	}
+	sort.Strings(n.warnings)
+	return result, n.warnings
+}
+
+// schemaNormalizer 转换过程中丢弃或改写的内容记录为告警
+type schemaNormalizer struct {
+	strict   bool
+	warnings []string
+}
+
+func (n *schemaNormalizer) warn(path string, format string, args ...any) {
+	if path == "" {
+		path = "root"
+	}
+	warning := path + ": " + fmt.Sprintf(format, args...)
+	if !slices.Contains(n.warnings, warning) {
+		n.warnings = append(n.warnings, warning)
+	}
+}
+
+// inline 展开本地 $ref 并合并 allOf，递归引用替换为不带约束的 object
+func (n *schemaNormalizer) inline(schema map[string]any, defs map[string]map[string]any, refs []string, path string) map[string]any {
+	result := map[string]any{}
+	if ref, ok := schema["$ref"].(string); ok {
+		name, found := refName(ref)
+		def, defined := defs[name]
+		switch {
+		case !found || !defined:
+			n.warn(path, "unresolved $ref %s dropped", ref)
+		case slices.Contains(refs, name):
+			n.warn(path, "recursive $ref %s replaced with object", ref)
+			result["type"] = "object"
+		default:
+			for k, v := range n.inline(def, defs, append(refs, name), path) {
+				result[k] = v
+			}
+		}
+	}
+	for key, value := range schema {
+		switch key {
+		case "$ref", "$defs", "definitions":
+		case "allOf":
+			for _, item := range schemaList(value) {
+				mergeSchema(result, n.inline(item, defs, refs, path))
+			}
+		default:
+			result[key] = n.inlineChildren(key, value, defs, refs, path)
+		}
+	}
+	return result
+}
+
+func (n *schemaNormalizer) inlineChildren(key string, value any, defs map[string]map[string]any, refs []string, path string) any {
+	if slices.Contains(schemaMapKeywords, key) {
+		children := map[string]any{}
+		for name, child := range schemaMap(value) {
+			children[name] = n.inline(child, defs, refs, childPath(path, key, name))
+		}
+		return children
+	}
+	if slices.Contains(schemaListKeywords, key) {
+		var children []any
+		for i, child := range schemaList(value) {
+			children = append(children, n.inline(child, defs, refs, childPath(path, key, strconv.Itoa(i))))
+		}
+		return children
+	}
+	if child, ok := value.(map[string]any); ok && slices.Contains(schemaKeywords, key) {
+		return n.inline(child, defs, refs, childPath(path, key, ""))
+	}
+	return value
+}
+
+// gemini type 数组与 null 转换为 nullable，const 转换为 enum，去掉不支持的关键字
+func (n *schemaNormalizer) gemini(schema map[string]any, path string) map[string]any {
+	result := map[string]any{}
+	for key, value := range schema {
+		switch key {
+		case "const":
+			result["enum"] = []any{value}
+		case "type":
+			types, nullable := schemaTypes(value)
+			if nullable {
+				result["nullable"] = true
+			}
+			if len(types) == 1 {
+				result["type"] = types[0]
+			} else if len(types) > 1 {
+				var anyOf []any
+				for _, t := range types {
+					anyOf = append(anyOf, map[string]any{"type": t})
+				}
+				result["anyOf"] = anyOf
+			}
+		case "oneOf", "anyOf":
+			var anyOf []any
+			for i, item := range schemaList(value) {
+				if types, _ := schemaTypes(item["type"]); len(item) == 1 && len(types) == 0 {
+					result["nullable"] = true
+					continue
+				}
+				anyOf = append(anyOf, n.gemini(item, childPath(path, key, strconv.Itoa(i))))
+			}
+			if len(anyOf) == 1 {
+				for k, v := range anyOf[0].(map[string]any) {
+					result[k] = v
+				}
+			} else if len(anyOf) > 1 {
+				result["anyOf"] = anyOf
+			}
+		case "properties":
+			properties := map[string]any{}
+			for name, property := range schemaMap(value) {
+				properties[name] = n.gemini(property, childPath(path, key, name))
+			}
+			result[key] = properties
+		case "items":
+			if items, ok := value.(map[string]any); ok {
+				result[key] = n.gemini(items, childPath(path, key, ""))
+			}
+		case "enum":
+			// gemini 的 enum 只支持字符串
+			if enum, ok := stringEnum(value); ok {
+				result[key] = enum
+			} else {
+				n.warn(path, "non-string enum dropped")
+			}
+		case "examples":
+			if examples, ok := value.([]any); ok && len(examples) > 0 {
+				result["example"] = examples[0]
+			}
+		case "$schema", "$id", "$comment":
+		default:
+			if geminiSchemaKeywords[key] {
+				result[key] = value
+			} else {
+				n.warn(path, "unsupported keyword %s dropped", key)
+			}
+		}
+	}
+	return result
+}
+
+// json nullable 转换为 type 数组，type 统一小写
+func (n *schemaNormalizer) json(schema map[string]any, path string) map[string]any {
+	strict := n.strict
+	result := map[string]any{}
+	for key, value := range schema {
+		if openapiOnlyKeywords[key] || (strict && openaiStrictDropKeywords[key]) {
+			continue
+		}
+		switch key {
+		case "type":
+			types, nullable := schemaTypes(value)
+			result[key] = typeValue(types, nullable)
+		default:
+			result[key] = n.jsonChildren(key, value, path)
+		}
+	}
+	if nullable, _ := schema["nullable"].(bool); nullable {
+		result = nullableSchema(result)
+	}
+	if example, ok := schema["example"]; ok && !strict {
+		result["examples"] = []any{example}
+	}
+	if strict && isObjectSchema(result) {
+		strictObject(result)
+	}
+	return result
+}
+
+func (n *schemaNormalizer) jsonChildren(key string, value any, path string) any {
+	if slices.Contains(schemaMapKeywords, key) {
+		children := map[string]any{}
+		for name, child := range schemaMap(value) {
+			children[name] = n.json(child, childPath(path, key, name))
+		}
+		return children
+	}
+	if slices.Contains(schemaListKeywords, key) {
+		var children []any
+		for i, child := range schemaList(value) {
+			children = append(children, n.json(child, childPath(path, key, strconv.Itoa(i))))
+		}
+		return children
+	}
+	if child, ok := value.(map[string]any); ok && slices.Contains(schemaKeywords, key) {
+		return n.json(child, childPath(path, key, ""))
+	}
+	return value
+}
+
+// strictObject openai strict 要求 additionalProperties 为 false 且所有属性必填
+func strictObject(schema map[string]any) {
+	schema["additionalProperties"] = false
+	properties := schemaMap(schema["properties"])
+	required := map[string]bool{}
+	for _, name := range stringList(schema["required"]) {
+		required[name] = true
+	}
+	var names []string
+	for name, property := range properties {
+		names = append(names, name)
+		if !required[name] {
+			properties[name] = nullableSchema(property)
+		}
+	}
+	sort.Strings(names)
+	if properties != nil {
+		schema["properties"] = toAnyMap(properties)
+	}
+	schema["required"] = names
+}
+
+// nullableSchema 在 type 中加入 null，没有 type 时使用 anyOf
+func nullableSchema(schema map[string]any) map[string]any {
+	if value, ok := schema["type"]; ok {
+		types, _ := schemaTypes(value)
+		schema["type"] = typeValue(types, true)
+		if enum, ok := schema["enum"].([]any); ok {
+			schema["enum"] = append(enum, nil)
+		}
+		return schema
+	}
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+// schemaTypes 返回小写的非 null 类型与是否可空
+func schemaTypes(value any) ([]string, bool) {
+	var types []string
+	nullable := false
+	add := func(v any) {
+		t, ok := v.(string)
+		if !ok {
+			return
+		}
+		t = strings.ToLower(t)
+		if t == "null" {
+			nullable = true
+			return
+		}
+		types = append(types, t)
+	}
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			add(item)
+		}
+	case []string:
+		for _, item := range v {
+			add(item)
+		}
+	default:
+		add(v)
+	}
+	return types, nullable
+}
+
+func typeValue(types []string, nullable bool) any {
+	if nullable {
+		types = append(types, "null")
+	}
+	if len(types) == 1 {
+		return types[0]
+	}
+	result := make([]any, 0, len(types))
+	for _, t := range types {
+		result = append(result, t)
+	}
+	return result
+}
+
+func isObjectSchema(schema map[string]any) bool {
+	types, _ := schemaTypes(schema["type"])
+	for _, t := range types {
+		if t == "object" {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaMap(value any) map[string]map[string]any {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	result := map[string]map[string]any{}
+	for k, v := range m {
+		if child, ok := v.(map[string]any); ok {
+			result[k] = child
+		}
+	}
+	return result
+}
+
+func schemaList(value any) []map[string]any {
+	list, ok := value.([]any)
+	if !ok {
+		return nil
+	}
+	var result []map[string]any
+	for _, v := range list {
+		if child, ok := v.(map[string]any); ok {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+func toAnyMap(m map[string]map[string]any) map[string]any {
+	result := map[string]any{}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+func stringList(value any) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []any:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func stringEnum(value any) ([]any, bool) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, false
+	}
+	for _, item := range list {
+		if _, ok := item.(string); !ok {
+			return nil, false
+		}
+	}
+	return list, true
+}
+
+// schemaDefs 根 schema 中 $defs 与 definitions 的定义
+func schemaDefs(schema map[string]any) map[string]map[string]any {
+	defs := map[string]map[string]any{}
+	for _, key := range []string{"definitions", "$defs"} {
+		for name, def := range schemaMap(schema[key]) {
+			defs[name] = def
+		}
+	}
+	return defs
+}
+
+// refName 只支持本地引用 #/$defs/x 与 #/definitions/x
+func refName(ref string) (string, bool) {
+	for _, prefix := range []string{"#/$defs/", "#/definitions/"} {
+		if name, ok := strings.CutPrefix(ref, prefix); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// mergeSchema 合并 allOf 子 schema：properties 与 required 取并集，其它关键字先出现的优先
+func mergeSchema(dst map[string]any, src map[string]any) {
+	for key, value := range src {
+		switch key {
+		case "properties":
+			properties, _ := dst[key].(map[string]any)
+			if properties == nil {
+				properties = map[string]any{}
+			}
+			for name, property := range schemaMap(value) {
+				properties[name] = property
+			}
+			dst[key] = properties
+		case "required":
+			required := stringList(dst[key])
+			for _, name := range stringList(value) {
+				if !slices.Contains(required, name) {
+					required = append(required, name)
+				}
+			}
+			dst[key] = required
+		default:
+			if _, ok := dst[key]; !ok {
+				dst[key] = value
+			}
+		}
+	}
+}
+
+// childPath 告警中子 schema 的位置，例如 properties.user.items
+func childPath(path string, key string, name string) string {
+	if path != "" {
+		key = path + "." + key
+	}
+	if name != "" {
+		key += "." + name
+	}
+	return key
+}
@@ -0,0 +1,120 @@
+package convert
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+func TestNormalizeSchema(t *testing.T) {
+	var schema map[string]any
+	_ = json.Unmarshal([]byte(`{"type":"object","$schema":"x","additionalProperties":false,
+		"properties":{
+			"name":{"type":["string","null"],"minLength":1},
+			"kind":{"const":"a"},
+			"count":{"type":"integer","enum":[1,2]},
+			"tags":{"type":"array","items":{"anyOf":[{"type":"string"},{"type":"null"}]}}},
+		"required":["name"]}`), &schema)
+
+	gemini := NormalizeSchema(constant.DialectGemini, schema, false)
+	properties := gemini["properties"].(map[string]any)
+	name := properties["name"].(map[string]any)
+	if _, ok := gemini["$schema"]; ok || gemini["additionalProperties"] != nil {
+		t.Fatalf("gemini 不支持的关键字未去掉: %v", gemini)
+	}
+	if name["type"] != "string" || name["nullable"] != true || name["minLength"] == nil {
+		t.Fatalf("gemini nullable 转换错误: %v", name)
+	}
+	if kind := properties["kind"].(map[string]any); len(kind["enum"].([]any)) != 1 {
+		t.Fatalf("gemini const 转换错误: %v", kind)
+	}
+	if count := properties["count"].(map[string]any); count["enum"] != nil {
+		t.Fatalf("gemini 非字符串 enum 未去掉: %v", count)
+	}
+	if items := properties["tags"].(map[string]any)["items"].(map[string]any); items["type"] != "string" || items["nullable"] != true {
+		t.Fatalf("gemini anyOf null 转换错误: %v", items)
+	}
+
+	// gemini 风格的 schema 转换为 openai strict
+	var openapi map[string]any
+	_ = json.Unmarshal([]byte(`{"type":"OBJECT","properties":{"a":{"type":"STRING","nullable":true},"b":{"type":"NUMBER","minLength":1}},
+		"required":["a"],"propertyOrdering":["a","b"]}`), &openapi)
+	strict := NormalizeSchema(constant.DialectOpenAI, openapi, true)
+	data, _ := json.Marshal(strict)
+	want := `{"additionalProperties":false,"properties":{"a":{"type":["string","null"]},"b":{"type":["number","null"]}},"required":["a","b"],"type":"object"}`
+	if string(data) != want {
+		t.Fatalf("openai strict 转换错误: %s", data)
+	}
+	if schema["properties"].(map[string]any)["name"].(map[string]any)["type"] == "string" {
+		t.Fatal("不应修改入参")
+	}
+}
+
+func TestToolSchema(t *testing.T) {
+	var schema map[string]any
+	_ = json.Unmarshal([]byte(`{"type":"object","additionalProperties":false,
+		"$defs":{
+			"unit":{"type":"string","enum":["c","f"]},
+			"node":{"type":"object","properties":{"child":{"$ref":"#/$defs/node"}}}},
+		"properties":{
+			"unit":{"$ref":"#/$defs/unit","description":"温度单位"},
+			"tree":{"$ref":"#/$defs/node"},
+			"level":{"type":"integer","enum":[1,2]},
+			"place":{"allOf":[{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]},
+				{"properties":{"country":{"type":"string"}},"required":["country"]}]},
+			"remote":{"$ref":"https://example.com/schema"}},
+		"required":["unit"]}`), &schema)
+
+	gemini, warnings := ToolSchema(constant.DialectGemini, schema)
+	data, _ := json.Marshal(gemini)
+	if strings.Contains(string(data), "$ref") || strings.Contains(string(data), "$defs") || gemini["additionalProperties"] != nil {
+		t.Fatalf("gemini $ref 未展开: %s", data)
+	}
+	properties := gemini["properties"].(map[string]any)
+	if unit := properties["unit"].(map[string]any); unit["type"] != "string" || unit["description"] != "温度单位" || len(unit["enum"].([]any)) != 2 {
+		t.Fatalf("gemini $ref 展开错误: %v", unit)
+	}
+	child := properties["tree"].(map[string]any)["properties"].(map[string]any)["child"].(map[string]any)
+	if child["type"] != "object" || child["properties"] != nil {
+		t.Fatalf("gemini 递归引用转换错误: %v", child)
+	}
+	if place := properties["place"].(map[string]any); len(place["properties"].(map[string]any)) != 2 || len(place["required"].([]string)) != 2 {
+		t.Fatalf("gemini allOf 合并错误: %v", place)
+	}
+	want := []string{
+		"root: unsupported keyword additionalProperties dropped",
+		"properties.level: non-string enum dropped",
+		"properties.tree.properties.child: recursive $ref #/$defs/node replaced with object",
+		"properties.remote: unresolved $ref https://example.com/schema dropped",
+	}
+	for _, w := range want {
+		if !slices.Contains(warnings, w) {
+			t.Fatalf("缺少告警 %q: %v", w, warnings)
+		}
+	}
+
+	// openai 与 claude 支持完整的 JSON Schema，保留 $ref 与 additionalProperties
+	openai, warnings := ToolSchema(constant.DialectOpenAI, schema)
+	if openai["additionalProperties"] != false || openai["$defs"] == nil || len(warnings) != 0 {
+		t.Fatalf("openai 转换错误: %v %v", openai, warnings)
+	}
+
+	// 没有参数
+	if claude, _ := ToolSchema(constant.DialectClaude, nil); claude["type"] != "object" {
+		t.Fatalf("claude 空参数转换错误: %v", claude)
+	}
+	if gemini, _ := ToolSchema(constant.DialectGemini, map[string]any{"type": "object"}); gemini != nil {
+		t.Fatalf("gemini 空参数应省略: %v", gemini)
+	}
+
+	req := &general.Request{Tools: []general.Tool{{FunctionDeclarations: []general.FunctionDeclaration{
+		{Name: "weather", Parameters: schema},
+	}}}}
+	if warnings := ToolWarnings(constant.DialectGemini, req); len(warnings) != 4 || !strings.HasPrefix(warnings[0], "weather: ") {
+		t.Fatalf("工具告警错误: %v", warnings)
+	}
+}
@@ -0,0 +1,239 @@
+package convert
+
+import (
+	"encoding/json"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/ndjson"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// StreamDecoder 上游 SSE 事件(NDJSON 的每一行)转换为通用增量响应，事件之间的状态由实现自行保存
+type StreamDecoder interface {
+	Decode(event sse.Event) ([]*general.Response, error)
+	// Finish 上游流结束时输出尚未完成的函数调用
+	Finish() []*general.Response
+}
+
+// StreamEncoder 通用增量响应转换为客户端 SSE 事件
+// 增量响应中的 part 只包含本次新增的内容，函数调用总是完整的
+type StreamEncoder interface {
+	Encode(resp *general.Response) []sse.Event
+	// Finish 上游流结束时补齐客户端协议要求的结束事件
+	Finish() []sse.Event
+}
+
+func NewStreamDecoder(dialect string) (StreamDecoder, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		return &geminiStreamDecoder{}, nil
+	case constant.DialectOpenAI:
+		return &openaiStreamDecoder{toolCalls: newToolCallAssembler()}, nil
+	case constant.DialectClaude:
+		return &claudeStreamDecoder{toolCalls: newToolCallAssembler(), serverTools: map[int]bool{}}, nil
+	case constant.DialectResponses:
+		return &responsesStreamDecoder{}, nil
+	case constant.DialectCompletions:
+		return &completionsStreamDecoder{}, nil
+	case constant.DialectOllama, constant.DialectOllamaGenerate:
+		return &ollamaStreamDecoder{generate: dialect == constant.DialectOllamaGenerate}, nil
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// NewStreamEncoder model 为上游响应中没有模型名时使用的默认值
+func NewStreamEncoder(dialect string, model string) (StreamEncoder, error) {
+	switch dialect {
+	case constant.DialectGemini:
+		return &geminiStreamEncoder{model: model}, nil
+	case constant.DialectOpenAI:
+		return &openaiStreamEncoder{model: model}, nil
+	case constant.DialectClaude:
+		return &claudeStreamEncoder{model: model}, nil
+	case constant.DialectResponses:
+		return &responsesStreamEncoder{model: model}, nil
+	case constant.DialectCompletions:
+		return &completionsStreamEncoder{model: model}, nil
+	case constant.DialectOllama, constant.DialectOllamaGenerate:
+		return &ollamaStreamEncoder{generate: dialect == constant.DialectOllamaGenerate, model: model}, nil
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// StreamContentType 客户端协议的流式响应类型，ollama 为 NDJSON，其它协议为 SSE
+func StreamContentType(dialect string) string {
+	if dialect == constant.DialectOllama || dialect == constant.DialectOllamaGenerate {
+		return ndjson.ContentType
+	}
+	return sse.ContentType
+}
+
+// StreamConverter 上游协议的流式事件转换为客户端协议的流式事件，协议相同时事件原样输出
+type StreamConverter struct {
+	decoder  StreamDecoder
+	encoder  StreamEncoder
+	onDelta  []func(delta *general.Response)
+	onFinish []func() []*general.Response
+}
+
+// OnDelta 解码后、编码前回调每个增量响应，回调中可以修改响应，按注册顺序调用；事件原样输出时不回调
+func (c *StreamConverter) OnDelta(fn func(delta *general.Response)) {
+	c.onDelta = append(c.onDelta, fn)
+}
+
+// OnFinish 上游流结束时回调，返回的增量响应在结束事件之前编码输出，同样经过 OnDelta 回调；事件原样输出时不回调
+func (c *StreamConverter) OnFinish(fn func() []*general.Response) {
+	c.onFinish = append(c.onFinish, fn)
+}
+
+func NewStreamConverter(from string, to string, model string) (*StreamConverter, error) {
+	if from == to {
+		if _, err := NewStreamDecoder(from); err != nil {
+			return nil, err
+		}
+		return &StreamConverter{}, nil
+	}
+	return NewStreamTranscoder(from, to, model)
+}
+
+// NewStreamTranscoder 协议相同时也解码为通用格式再编码，用于需要通过 OnDelta 修改响应的场景
+func NewStreamTranscoder(from string, to string, model string) (*StreamConverter, error) {
+	decoder, err := NewStreamDecoder(from)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := NewStreamEncoder(to, model)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamConverter{decoder: decoder, encoder: encoder}, nil
+}
+
+func (c *StreamConverter) Convert(event sse.Event) ([]sse.Event, error) {
+	if c.decoder == nil {
+		return []sse.Event{event}, nil
+	}
+	if event.IsComment() {
+		return nil, nil
+	}
+	deltas, err := c.decoder.Decode(event)
+	if err != nil {
+		return nil, err
+	}
+	var events []sse.Event
+	for _, delta := range deltas {
+		events = append(events, c.encode(delta)...)
+	}
+	return events, nil
+}
+
+func (c *StreamConverter) Finish() []sse.Event {
+	if c.decoder == nil {
+		return nil
+	}
+	var events []sse.Event
+	for _, delta := range c.decoder.Finish() {
+		events = append(events, c.encode(delta)...)
+	}
+	for _, fn := range c.onFinish {
+		for _, delta := range fn() {
+			events = append(events, c.encode(delta)...)
+		}
+	}
+	return append(events, c.encoder.Finish()...)
+}
+
+func (c *StreamConverter) encode(delta *general.Response) []sse.Event {
+	for _, fn := range c.onDelta {
+		fn(delta)
+	}
+	return c.encoder.Encode(delta)
+}
+
+// MergeResponses 流式的增量响应合并为完整响应，只合并第一个候选
+// 连续的文本、思考内容合并为一个 part，签名附加到所属的思考内容上
+func MergeResponses(deltas []*general.Response) *general.Response {
+	result := &general.Response{}
+	candidate := general.Candidate{Content: &general.Content{Role: general.RoleAssistant}}
+	for _, delta := range deltas {
+		if result.Id == "" {
+			result.Id = delta.Id
+		}
+		if result.Model == "" {
+			result.Model = delta.Model
+		}
+		if delta.Usage != nil {
+			result.Usage = delta.Usage
+		}
+		if len(delta.Candidates) == 0 {
+			continue
+		}
+		current := delta.Candidates[0]
+		if current.Content != nil {
+			for _, part := range current.Content.Parts {
+				candidate.Content.Parts = mergePart(candidate.Content.Parts, part)
+			}
+		}
+		candidate.Citations = append(candidate.Citations, current.Citations...)
+		candidate.SearchQueries = append(candidate.SearchQueries, current.SearchQueries...)
+		if current.FinishReason != "" {
+			candidate.FinishReason = current.FinishReason
+		}
+	}
+	result.Candidates = []general.Candidate{candidate}
+	return result
+}
+
+func mergePart(parts []general.Part, part general.Part) []general.Part {
+	last := len(parts) - 1
+	if last < 0 || !textOnly(part) || !textOnly(parts[last]) || isThought(part) != isThought(parts[last]) || parts[last].ThoughtSignature != nil {
+		return append(parts, part)
+	}
+	if part.Text != nil {
+		text := stringValue(parts[last].Text) + *part.Text
+		parts[last].Text = &text
+	}
+	parts[last].ThoughtSignature = part.ThoughtSignature
+	return parts
+}
+
+// textOnly 只有文本与签名的 part，思考签名可能单独到达
+func textOnly(part general.Part) bool {
+	return part.InlineData == nil && part.FileData == nil && part.FunctionCall == nil && part.FunctionResponse == nil &&
+		part.ExecutableCode == nil && part.CodeExecutionResult == nil
+}
+
+func jsonEvent(name string, v any) sse.Event {
+	data, _ := json.Marshal(v)
+	return sse.Event{Event: name, Data: string(data), HasData: true}
+}
+
+// streamError 流式中途出现的错误事件
+func streamError(data string) error {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return nil
+	}
+	if message, ok := errorMessage(payload.Error); ok {
+		return &UpstreamError{Message: message}
+	}
+	return nil
+}
+
+func textPart(text string) general.Part {
+	return general.Part{Text: &text}
+}
+
+func deltaResponse(id string, model string, parts []general.Part, finishReason string) *general.Response {
+	return &general.Response{
+		Id:    id,
+		Model: model,
+		Candidates: []general.Candidate{{
+			Content:      &general.Content{Role: general.RoleAssistant, Parts: parts},
+			FinishReason: finishReason,
+		}},
+	}
+}
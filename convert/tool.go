@@ -0,0 +1,213 @@
+package convert
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+// ToolSchema 工具参数的 JSON Schema 转换为上游协议接受的子集，返回新的 schema 与转换告警
+// 各协议都要求参数根节点为 object；gemini 没有属性的对象不能声明，返回 nil 表示不带参数
+func ToolSchema(dialect string, schema map[string]any) (map[string]any, []string) {
+	result, warnings := normalizeSchema(dialect, schema, false)
+	if result == nil {
+		result = map[string]any{}
+	}
+	if _, ok := result["type"]; !ok {
+		result["type"] = "object"
+	} else if !isObjectSchema(result) {
+		warnings = append(warnings, "root: parameters type must be object")
+	}
+	if dialect == constant.DialectGemini && len(schemaMap(result["properties"])) == 0 {
+		return nil, warnings
+	}
+	return result, warnings
+}
+
+// ToolWarnings 请求中所有工具转换为上游协议时的告警，每条带上工具名
+func ToolWarnings(dialect string, req *general.Request) []string {
+	var warnings []string
+	for _, tool := range req.Tools {
+		for _, fd := range tool.FunctionDeclarations {
+			_, toolWarnings := ToolSchema(dialect, fd.Parameters)
+			for _, warning := range toolWarnings {
+				warnings = append(warnings, fd.Name+": "+warning)
+			}
+		}
+	}
+	return warnings
+}
+
+func openaiToolChoiceToGeneral(choice *openai.ToolChoice, parallel *bool) *general.ToolConfig {
+	if choice == nil && parallel == nil {
+		return nil
+	}
+	config := &general.ToolConfig{ParallelToolCalls: parallel}
+	switch {
+	case choice == nil:
+	case choice.Mode != "":
+		config.Mode = choice.Mode
+	case choice.Function != nil:
+		config.Mode = general.ToolModeRequired
+		config.AllowedFunctionNames = []string{choice.Function.Name}
+	case choice.AllowedTools != nil:
+		config.Mode = choice.AllowedTools.Mode
+		for _, tool := range choice.AllowedTools.Tools {
+			if tool.Function != nil {
+				config.AllowedFunctionNames = append(config.AllowedFunctionNames, tool.Function.Name)
+			}
+		}
+	}
+	return config
+}
+
+// generalToolConfigToOpenAI 指定单个函数使用 function，多个函数使用 allowed_tools；没有工具时 openai 不允许设置
+func generalToolConfigToOpenAI(config *general.ToolConfig, req *openai.Request) {
+	if config == nil || len(req.Tools) == 0 {
+		return
+	}
+	req.ParallelToolCalls = config.ParallelToolCalls
+	names := config.AllowedFunctionNames
+	switch {
+	case config.Mode == "":
+	case len(names) == 0 || config.Mode == general.ToolModeNone:
+		req.ToolChoice = &openai.ToolChoice{Mode: config.Mode}
+	case len(names) == 1 && config.Mode == general.ToolModeRequired:
+		req.ToolChoice = &openai.ToolChoice{Type: "function", Function: &openai.ToolChoiceFunction{Name: names[0]}}
+	default:
+		allowed := &openai.AllowedTools{Mode: config.Mode}
+		for _, name := range names {
+			allowed.Tools = append(allowed.Tools, openai.Tool{Type: "function", Function: &openai.FunctionDefinition{Name: name}})
+		}
+		req.ToolChoice = &openai.ToolChoice{Type: "allowed_tools", AllowedTools: allowed}
+	}
+}
+
+// gemini VALIDATED 与 AUTO 一样由模型决定是否调用，只是额外校验参数
+var geminiToolModes = map[string]string{
+	"AUTO":      general.ToolModeAuto,
+	"VALIDATED": general.ToolModeAuto,
+	"ANY":       general.ToolModeRequired,
+	"NONE":      general.ToolModeNone,
+}
+
+func geminiToolConfigToGeneral(config *gemini.ToolConfig) *general.ToolConfig {
+	if config == nil || config.FunctionCallingConfig == nil {
+		return nil
+	}
+	return &general.ToolConfig{
+		Mode:                 geminiToolModes[strings.ToUpper(config.FunctionCallingConfig.Mode)],
+		AllowedFunctionNames: config.FunctionCallingConfig.AllowedFunctionNames,
+	}
+}
+
+// generalToolConfigToGemini gemini 只有 ANY 能限制函数，并行调用不可配置
+func generalToolConfigToGemini(config *general.ToolConfig, req *gemini.Request) {
+	if config == nil || config.Mode == "" || len(req.Tools) == 0 {
+		return
+	}
+	calling := &gemini.FunctionCallingConfig{}
+	switch config.Mode {
+	case general.ToolModeNone:
+		calling.Mode = "NONE"
+	case general.ToolModeRequired:
+		calling.Mode = "ANY"
+		calling.AllowedFunctionNames = config.AllowedFunctionNames
+	default:
+		calling.Mode = "AUTO"
+	}
+	req.ToolConfig = &gemini.ToolConfig{FunctionCallingConfig: calling}
+}
+
+func claudeToolChoiceToGeneral(choice *claude.ToolChoice) *general.ToolConfig {
+	if choice == nil {
+		return nil
+	}
+	config := &general.ToolConfig{}
+	switch choice.Type {
+	case "auto":
+		config.Mode = general.ToolModeAuto
+	case "none":
+		config.Mode = general.ToolModeNone
+	case "any":
+		config.Mode = general.ToolModeRequired
+	case "tool":
+		config.Mode = general.ToolModeRequired
+		config.AllowedFunctionNames = []string{choice.Name}
+	}
+	if choice.DisableParallelToolUse != nil {
+		config.ParallelToolCalls = ptr(!*choice.DisableParallelToolUse)
+	}
+	return config
+}
+
+// generalToolConfigToClaude 多个可选函数无法限制，降级为 any；开启思考时 claude 不允许强制调用工具
+func generalToolConfigToClaude(config *general.ToolConfig, req *claude.Request) {
+	if config == nil || len(req.Tools) == 0 {
+		return
+	}
+	choice := &claude.ToolChoice{}
+	switch config.Mode {
+	case general.ToolModeNone:
+		choice.Type = "none"
+	case general.ToolModeRequired:
+		choice.Type = "any"
+		if len(config.AllowedFunctionNames) == 1 {
+			choice.Type = "tool"
+			choice.Name = config.AllowedFunctionNames[0]
+		}
+	case general.ToolModeAuto:
+		choice.Type = "auto"
+	}
+	if req.Thinking != nil && (choice.Type == "any" || choice.Type == "tool") {
+		choice.Type, choice.Name = "auto", ""
+	}
+	if config.ParallelToolCalls != nil && !*config.ParallelToolCalls && choice.Type != "none" {
+		if choice.Type == "" {
+			choice.Type = "auto"
+		}
+		choice.DisableParallelToolUse = ptr(true)
+	}
+	if choice.Type != "" {
+		req.ToolChoice = choice
+	}
+}
+
+// fillToolCallIds gemini 的函数调用经常没有 id，按出现顺序生成；
+// 没有 id 的函数结果对应到同名且最早未返回结果的调用，多个并行调用也能一一对应
+func fillToolCallIds(contents []general.Content, newCallId func() string) {
+	pending := map[string][]string{}
+	for i := range contents {
+		for j := range contents[i].Parts {
+			part := &contents[i].Parts[j]
+			if call := part.FunctionCall; call != nil {
+				if call.Id == "" {
+					call.Id = newCallId()
+				}
+				pending[call.Name] = append(pending[call.Name], call.Id)
+			}
+			if response := part.FunctionResponse; response != nil {
+				ids := pending[response.Name]
+				if response.Id == "" && len(ids) > 0 {
+					response.Id = ids[0]
+				}
+				pending[response.Name] = slices.DeleteFunc(ids, func(id string) bool { return id == response.Id })
+			}
+		}
+	}
+}
+
+// sequenceCallId 请求中按顺序生成 id，相同请求转换结果不变，缓存才能命中
+func sequenceCallId() func() string {
+	n := 0
+	return func() string {
+		n++
+		return "call_" + strconv.Itoa(n)
+	}
+}
@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// toolCallAssembler 拼接流式函数调用的参数分片，调用完整后再交给编码器重新分片
+// openai 以 choice 与 tool_calls.index 区分调用，claude 以内容块 index 区分；gemini 每个事件中的调用都是完整的，不需要拼接
+type toolCallAssembler struct {
+	calls map[toolCallKey]*pendingToolCall
+}
+
+type toolCallKey struct {
+	choice int
+	index  int
+}
+
+type pendingToolCall struct {
+	call      *general.FunctionCall
+	arguments strings.Builder
+	// 分片开始前已知的完整参数，claude content_block_start 的 input
+	args map[string]any
+}
+
+func newToolCallAssembler() *toolCallAssembler {
+	return &toolCallAssembler{calls: map[toolCallKey]*pendingToolCall{}}
+}
+
+// add 追加一个分片，id 与 name 只在首个分片中出现，后续分片为空
+func (a *toolCallAssembler) add(key toolCallKey, id string, name string, fragment string) {
+	pending := a.pending(key)
+	if id != "" {
+		pending.call.Id = id
+	}
+	if name != "" {
+		pending.call.Name = name
+	}
+	pending.arguments.WriteString(fragment)
+}
+
+// start 开始一个调用，args 为已经完整的参数，没有参数分片时使用
+func (a *toolCallAssembler) start(key toolCallKey, id string, name string, args map[string]any) {
+	a.add(key, id, name, "")
+	a.calls[key].args = args
+}
+
+func (a *toolCallAssembler) pending(key toolCallKey) *pendingToolCall {
+	pending, ok := a.calls[key]
+	if !ok {
+		pending = &pendingToolCall{call: &general.FunctionCall{}}
+		a.calls[key] = pending
+	}
+	return pending
+}
+
+// get 返回未完成的调用，参数尚未解析
+func (a *toolCallAssembler) get(key toolCallKey) (*general.FunctionCall, bool) {
+	pending, ok := a.calls[key]
+	if !ok {
+		return nil, false
+	}
+	return pending.call, true
+}
+
+// done 调用结束，解析参数后返回
+func (a *toolCallAssembler) done(key toolCallKey) (*general.FunctionCall, bool) {
+	pending, ok := a.calls[key]
+	if !ok {
+		return nil, false
+	}
+	delete(a.calls, key)
+	call := pending.call
+	if pending.arguments.Len() > 0 || pending.args == nil {
+		call.Args = parseArguments(pending.arguments.String())
+	} else {
+		call.Args = pending.args
+	}
+	return call, true
+}
+
+// flush 结束某个 choice 的所有调用，按 index 顺序输出
+func (a *toolCallAssembler) flush(choice int) []general.Part {
+	var indexes []int
+	for key := range a.calls {
+		if key.choice == choice {
+			indexes = append(indexes, key.index)
+		}
+	}
+	sort.Ints(indexes)
+	var parts []general.Part
+	for _, index := range indexes {
+		call, _ := a.done(toolCallKey{choice: choice, index: index})
+		parts = append(parts, general.Part{FunctionCall: call})
+	}
+	return parts
+}
+
+// choices 还有未完成调用的 choice
+func (a *toolCallAssembler) choices() []int {
+	var choices []int
+	for key := range a.calls {
+		if !slices.Contains(choices, key.choice) {
+			choices = append(choices, key.choice)
+		}
+	}
+	sort.Ints(choices)
+	return choices
+}
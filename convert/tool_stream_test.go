@@ -0,0 +1,90 @@
+package convert
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// go test ./convert -run TestToolCallStreamGolden -update 重新生成期望结果
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// 网关生成的随机 id 按出现顺序替换为序号，比较 id 之间是否相同而不是具体的值；时间戳不参与比较
+var goldenRandom = regexp.MustCompile(`(chatcmpl-|msg_|call_|resp_|fc_)[0-9a-f]{24}|"(created|created_at)":\d+`)
+
+// TestToolCallStreamGolden 每个协议的上游流包含文本与两个并行的函数调用，转换为其它协议后与期望结果比较
+func TestToolCallStreamGolden(t *testing.T) {
+	dialects := []string{constant.DialectOpenAI, constant.DialectClaude, constant.DialectGemini, constant.DialectResponses}
+	for _, from := range dialects {
+		for _, to := range dialects {
+			if from == to {
+				continue
+			}
+			t.Run(from+"_to_"+to, func(t *testing.T) {
+				input, err := os.Open("resources/stream/" + from + ".sse")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer input.Close()
+				converter, err := NewStreamConverter(from, to, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				var out bytes.Buffer
+				decoder := sse.NewDecoder(input)
+				for {
+					event, err := decoder.Next()
+					if err != nil {
+						break
+					}
+					events, err := converter.Convert(event)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, e := range events {
+						out.Write(sse.Marshal(e))
+					}
+				}
+				for _, e := range converter.Finish() {
+					out.Write(sse.Marshal(e))
+				}
+				got := goldenIds(out.Bytes())
+				golden := "resources/stream/" + from + "_to_" + to + ".sse"
+				if *updateGolden {
+					if err := os.WriteFile(golden, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("%s 转换结果与 %s 不一致:\n%s", from+"->"+to, golden, got)
+				}
+			})
+		}
+	}
+}
+
+// goldenIds 同一个随机 id 替换为相同的序号，不同的 id 序号不同，调用与结果的对应关系、并行调用的 id 不重复同样会被比较
+func goldenIds(data []byte) []byte {
+	ids := map[string]string{}
+	return goldenRandom.ReplaceAllFunc(data, func(match []byte) []byte {
+		if bytes.HasPrefix(match, []byte(`"created`)) {
+			return append(match[:bytes.IndexByte(match, ':')+1], '0')
+		}
+		id, ok := ids[string(match)]
+		if !ok {
+			id = string(goldenRandom.FindSubmatch(match)[1]) + "#" + strconv.Itoa(len(ids)+1)
+			ids[string(match)] = id
+		}
+		return []byte(id)
+	})
+}
@@ -2,14 +2,16 @@ package framework
 
 import (
 	"errors"
-	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/lijcoder/aiapi/apierror"
 	"github.com/lijcoder/aiapi/constant"
 	"github.com/lijcoder/aiapi/messages/gemini"
 	"github.com/lijcoder/aiapi/proxy"
+	"github.com/lijcoder/aiapi/script"
 )
 
 type EchoProxyDirectResponseWrite struct {
@@ -47,6 +49,8 @@ func EchoInit(e *echo.Echo) {
 	apiTest(e, "/test")
 	apiManager(e, "/manager")
 	apiProxy(e, "/proxy")
+	apiModels(e, "")
+	apiModels(e, "/proxy/route")
 	apiProxyDebug(e, "/proxy/debug/:traceid")
 }
 
@@ -56,7 +60,21 @@ func apiTest(e *echo.Echo, group string) {
 }
 
 func apiManager(e *echo.Echo, group string) {
-	// managerGroup := e.Group("/manager")
+	managerGroup := e.Group(group, managerAuth)
+	managerGroup.GET("/scripts", GeneralHandler(listScripts))
+	managerGroup.GET("/scripts/:name", GeneralHandler(getScript))
+	managerGroup.PUT("/scripts/:name", GeneralHandler(putScript))
+	managerGroup.DELETE("/scripts/:name", GeneralHandler(deleteScript))
+}
+
+// managerAuth 管理接口可以修改脚本，只允许管理员 key 调用
+func managerAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !proxy.AdminKey(c.Request().Header, c.QueryParams()) {
+			return c.JSON(http.StatusUnauthorized, constant.BuildHttpResponseFail("admin gateway key required"))
+		}
+		return next(c)
+	}
 }
 
 func apiProxy(e *echo.Echo, group string) {
@@ -65,6 +83,13 @@ func apiProxy(e *echo.Echo, group string) {
 	proxyGroup.Any("/direct/:type/*", proxyDirect)
 }
 
+// apiModels 所有路由的模型列表，openai、claude 使用 /v1/models，gemini 使用 /v1beta/models
+func apiModels(e *echo.Echo, group string) {
+	modelsGroup := e.Group(group)
+	modelsGroup.GET("/v1/models", listModels)
+	modelsGroup.GET("/v1beta/models", listModels)
+}
+
 func apiProxyDebug(e *echo.Echo, group string) {
 	proxyGroup := e.Group(group)
 	proxyGroup.Any("/direct/:type/*", proxyDirectDebug)
@@ -98,6 +123,41 @@ func debugMessage(c echo.Context) error {
 }
 
 // manager set
+func listScripts(c echo.Context) ([]script.Script, *constant.HttpCustomError) {
+	return proxy.Scripts().List(), nil
+}
+
+func getScript(c echo.Context) (script.Script, *constant.HttpCustomError) {
+	s, ok := proxy.Scripts().Get(c.Param("name"))
+	if !ok {
+		return s, &constant.HttpCustomError{Msg: "script not found: " + c.Param("name")}
+	}
+	return s, nil
+}
+
+// putScript 请求体为脚本配置，名称以路径为准，编译失败时返回错误信息
+func putScript(c echo.Context) (script.Script, *constant.HttpCustomError) {
+	var s script.Script
+	if err := c.Bind(&s); err != nil {
+		return s, &constant.HttpCustomError{Msg: "invalid script: " + err.Error(), Err: err}
+	}
+	s.Name = c.Param("name")
+	if err := proxy.Scripts().Put(s); err != nil {
+		return s, &constant.HttpCustomError{Msg: err.Error(), Err: err}
+	}
+	return s, nil
+}
+
+func deleteScript(c echo.Context) (bool, *constant.HttpCustomError) {
+	ok, err := proxy.Scripts().Delete(c.Param("name"))
+	if err != nil {
+		return false, &constant.HttpCustomError{Msg: err.Error(), Err: err}
+	}
+	if !ok {
+		return false, &constant.HttpCustomError{Msg: "script not found: " + c.Param("name")}
+	}
+	return true, nil
+}
 
 // proxy set
 func proxyDirectDebug(c echo.Context) error {
@@ -109,22 +169,65 @@ func proxyDirect(c echo.Context) error {
 }
 
 func proxyDirectProcess(c echo.Context, debug bool) error {
-	bodyBytes, err := io.ReadAll(c.Request().Body)
-	if err != nil {
-		return err
-	}
 	pdr := &proxy.ProxyDirectRequest{
-		Debug:       debug,
-		TraceId:     c.Param("traceid"),
-		Url:         c.Request().URL,
-		Type:        c.Param("type"),
-		Path:        c.Param("*"),
-		Method:      c.Request().Method,
-		Headers:     c.Request().Header,
-		QueryParams: c.QueryParams(),
-		Body:        bodyBytes,
+		Context:       c.Request().Context(),
+		Debug:         debug,
+		TraceId:       c.Param("traceid"),
+		Url:           c.Request().URL,
+		Type:          c.Param("type"),
+		Path:          c.Param("*"),
+		Method:        c.Request().Method,
+		Headers:       c.Request().Header,
+		QueryParams:   c.QueryParams(),
+		BodyReader:    c.Request().Body,
+		ContentLength: c.Request().ContentLength,
+		ReadDeadline:  http.NewResponseController(c.Response()).SetReadDeadline,
 	}
 	pdw := EchoProxyDirectResponseWrite{E: c}
 	p := proxy.ProxyDirect{Request: pdr, Response: &pdw}
-	return p.Direct()
+	start := time.Now()
+	var err error
+	if directErr := p.Direct(); directErr != nil {
+		err = proxyError(c, p.Dialect(), directErr)
+	}
+	accessLog(c, &p, start)
+	return err
+}
+
+// accessLog 每个代理请求一条，错误响应写出之后记录
+func accessLog(c echo.Context, p *proxy.ProxyDirect, start time.Time) {
+	attrs := []any{
+		"type", p.Request.Type,
+		"method", p.Request.Method,
+		"path", p.Request.Path,
+		"status", c.Response().Status,
+		"duration", time.Since(start).Milliseconds(),
+	}
+	if rules := p.GuardrailRules(); len(rules) > 0 {
+		attrs = append(attrs, "guardrails", rules)
+	}
+	if verdict := p.InjectionVerdict(); verdict != nil && verdict.Flagged {
+		attrs = append(attrs, "injectionScore", verdict.Score, "injectionSignals", verdict.Signals)
+	}
+	slog.Info("proxy access.", attrs...)
+}
+
+func listModels(c echo.Context) error {
+	request := c.Request()
+	body, err := proxy.ListModels(request.Context(), request.URL.Path, request.Header, c.QueryParams())
+	if err != nil {
+		return proxyError(c, proxy.ModelsDialect(request.URL.Path, request.Header), err)
+	}
+	return c.JSONBlob(http.StatusOK, body)
+}
+
+// proxyError 按客户端协议返回错误，响应已经写出时错误事件由 proxy 负责发送
+func proxyError(c echo.Context, dialect string, err error) error {
+	apiErr := apierror.From(err)
+	slog.Error("proxy process error.", "api", c.Path(), "code", apiErr.Code, "errStack", err)
+	if c.Response().Committed || apiErr.Code == apierror.CodeClientClosed {
+		return nil
+	}
+	apiErr.Header(c.Response().Header())
+	return c.JSONBlob(apiErr.Status, apiErr.JSON(dialect))
 }
@@ -0,0 +1,31 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lijcoder/aiapi/proxy"
+)
+
+func TestManagerAuth(t *testing.T) {
+	e := echo.New()
+	EchoInit(e)
+	for name, header := range map[string]string{"missing": "", "unknown": "Bearer sk-unknown"} {
+		req := httptest.NewRequest(http.MethodPut, "/manager/scripts/evil", strings.NewReader(`{"source":"function onRequest(req) { return req }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: 没有管理员 key 应返回 401: %d %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	if _, ok := proxy.Scripts().Get("evil"); ok {
+		t.Fatal("被拒绝的请求不应修改脚本")
+	}
+}
@@ -2,7 +2,10 @@ module github.com/lijcoder/aiapi
 
 go 1.25.4
 
-require github.com/labstack/echo/v4 v4.13.4
+require (
+	github.com/labstack/echo/v4 v4.13.4
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+)
 
 require (
 	github.com/labstack/gommon v0.4.2 // indirect
@@ -0,0 +1,106 @@
+package guardrail
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// detector 正则匹配后由 valid 校验，digits 为 true 时匹配结果前后不能紧邻数字、字母
+type detector struct {
+	pattern *regexp.Regexp
+	valid   func(value string) bool
+	digits  bool
+}
+
+var builtinDetectors = map[string]detector{
+	"email": {pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+	// 中国大陆手机号、带国家码的国际号码、北美格式号码
+	"phone": {
+		pattern: regexp.MustCompile(`(?:\+?86[- ]?)?1[3-9]\d{9}|\+\d{1,3}[- ]?\(?\d{1,4}\)?(?:[- ]?\d{2,4}){2,4}|\(?\d{3}\)?[- .]\d{3}[- .]\d{4}`),
+		digits:  true,
+	},
+	// 中国居民身份证号(校验位)、美国 SSN
+	"id": {
+		pattern: regexp.MustCompile(`\d{17}[\dXx]|\d{3}-\d{2}-\d{4}`),
+		valid: func(value string) bool {
+			return len(value) != 18 || residentIdValid(value)
+		},
+		digits: true,
+	},
+	// 13-19 位卡号，允许空格、- 分隔，Luhn 校验
+	"card": {
+		pattern: regexp.MustCompile(`\d(?:[ -]?\d){12,18}`),
+		valid:   luhnValid,
+		digits:  true,
+	},
+}
+
+// wordsDetector 长词优先匹配
+func wordsDetector(words []string) detector {
+	sorted := slices.Clone(words)
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+	quoted := make([]string, 0, len(sorted))
+	for _, word := range sorted {
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	return detector{pattern: regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)}
+}
+
+func (d detector) find(text string) [][]int {
+	var result [][]int
+	for _, loc := range d.pattern.FindAllStringIndex(text, -1) {
+		if d.digits && (alnumBefore(text, loc[0]) || alnumAfter(text, loc[1])) {
+			continue
+		}
+		if d.valid != nil && !d.valid(text[loc[0]:loc[1]]) {
+			continue
+		}
+		result = append(result, loc)
+	}
+	return result
+}
+
+func alnumBefore(text string, i int) bool {
+	r, size := utf8.DecodeLastRuneInString(text[:i])
+	return size > 0 && r < utf8.RuneSelf && (unicode.IsDigit(r) || unicode.IsLetter(r))
+}
+
+func alnumAfter(text string, i int) bool {
+	r, size := utf8.DecodeRuneInString(text[i:])
+	return size > 0 && r < utf8.RuneSelf && (unicode.IsDigit(r) || unicode.IsLetter(r))
+}
+
+func luhnValid(value string) bool {
+	sum, double := 0, false
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// residentIdValid GB 11643 校验位
+func residentIdValid(value string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, weight := range weights {
+		sum += int(value[i]-'0') * weight
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(value[17:])[0]
+}
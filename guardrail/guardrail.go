@@ -0,0 +1,215 @@
+package guardrail
+
+/*
+内容安全规则，作用于通用格式(general.Request、general.Response)中的文本
+检查范围: 系统提示词、消息文本、函数调用参数与函数结果中的字符串
+命中后的处理:
+  redact    替换为 [REDACTED_<NAME>]
+  block     拒绝请求
+  tokenize  替换为 [[<NAME>_<n>]]，模型输出中出现的 token 还原为原始内容
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lijcoder/aiapi/transform"
+)
+
+// 命中后的处理
+const (
+	ActionRedact   = "redact"
+	ActionBlock    = "block"
+	ActionTokenize = "tokenize"
+)
+
+// Policy 匹配条件与改写规则相同，多个策略同时匹配时规则按配置顺序合并
+type Policy struct {
+	Name  string          `json:"name"`
+	Match transform.Match `json:"match"`
+	Rules []Rule          `json:"rules"`
+	// 同时检查模型输出，输出中命中 tokenize 规则时按 redact 处理；还原 token 不需要开启
+	Response bool `json:"response"`
+}
+
+// Rule detector、pattern、words 三选一
+type Rule struct {
+	// 名称只能包含字母、数字、下划线，为空时使用 detector
+	Name string `json:"name"`
+	// 内置检测器 email、phone、id、card
+	Detector string `json:"detector"`
+	// 自定义正则表达式(RE2)
+	Pattern string `json:"pattern"`
+	// 词典，大小写不敏感
+	Words  []string `json:"words"`
+	Action string   `json:"action"`
+	// redact 的替换文本，为空时为 [REDACTED_<NAME>]
+	Replacement string `json:"replacement"`
+}
+
+type rule struct {
+	name        string
+	action      string
+	replacement string
+	detector    detector
+}
+
+type policy struct {
+	Policy
+	rules []*rule
+}
+
+// Set 所有策略，配置文件加载时编译
+type Set struct {
+	policies []policy
+}
+
+// Guard 一次请求生效的规则
+type Guard struct {
+	rules    []*rule
+	response bool
+}
+
+// BlockedError 命中 block 规则
+type BlockedError struct {
+	Rule     string
+	Response bool
+}
+
+func (e *BlockedError) Error() string {
+	if e.Response {
+		return "response blocked by guardrail rule " + e.Rule
+	}
+	return "request blocked by guardrail rule " + e.Rule
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+
+// New 检查并编译配置
+func New(policies []Policy) (*Set, error) {
+	set := &Set{}
+	for i, p := range policies {
+		name := p.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		compiled := policy{Policy: p}
+		for _, r := range p.Rules {
+			rule, err := compile(r)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", name, err)
+			}
+			compiled.rules = append(compiled.rules, rule)
+		}
+		set.policies = append(set.policies, compiled)
+	}
+	return set, nil
+}
+
+func compile(r Rule) (*rule, error) {
+	name := r.Name
+	if name == "" {
+		name = r.Detector
+	}
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("rule %q: name must match %s", name, namePattern)
+	}
+	switch r.Action {
+	case ActionRedact, ActionBlock, ActionTokenize:
+	default:
+		return nil, fmt.Errorf("rule %s: unknown action %s", name, r.Action)
+	}
+	compiled := &rule{name: name, action: r.Action, replacement: r.Replacement}
+	if compiled.replacement == "" {
+		compiled.replacement = "[REDACTED_" + strings.ToUpper(name) + "]"
+	}
+	configured := 0
+	if r.Detector != "" {
+		configured++
+		detector, ok := builtinDetectors[r.Detector]
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown detector %s", name, r.Detector)
+		}
+		compiled.detector = detector
+	}
+	if r.Pattern != "" {
+		configured++
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		compiled.detector = detector{pattern: pattern}
+	}
+	if len(r.Words) > 0 {
+		configured++
+		compiled.detector = wordsDetector(r.Words)
+	}
+	if configured != 1 {
+		return nil, fmt.Errorf("rule %s: exactly one of detector, pattern, words is required", name)
+	}
+	return compiled, nil
+}
+
+// Possible 是否存在可能生效的策略，不考虑模型条件，用于请求体解析之前的判断
+func (s *Set) Possible(scope transform.Scope) bool {
+	if s == nil {
+		return false
+	}
+	return slices.ContainsFunc(s.policies, func(p policy) bool {
+		match := p.Match
+		match.Models = nil
+		return match.Matches(scope)
+	})
+}
+
+// Select 合并满足匹配条件的策略，没有策略生效时返回 nil
+func (s *Set) Select(scope transform.Scope) *Guard {
+	if s == nil {
+		return nil
+	}
+	var guard *Guard
+	for _, p := range s.policies {
+		if !p.Match.Matches(scope) {
+			continue
+		}
+		if guard == nil {
+			guard = &Guard{}
+		}
+		guard.rules = append(guard.rules, p.rules...)
+		guard.response = guard.response || p.Response
+	}
+	return guard
+}
+
+// match 文本中命中规则的位置
+type match struct {
+	rule       *rule
+	start, end int
+}
+
+// find 按位置排序，重叠时保留开始位置靠前、更长、配置在前的结果
+func (g *Guard) find(text string) []match {
+	var matches []match
+	for _, rule := range g.rules {
+		for _, loc := range rule.detector.find(text) {
+			matches = append(matches, match{rule: rule, start: loc[0], end: loc[1]})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.start != b.start {
+			return a.start - b.start
+		}
+		return b.end - a.end
+	})
+	var result []match
+	for _, m := range matches {
+		if len(result) > 0 && m.start < result[len(result)-1].end {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/transform"
+)
+
+func testGuard(t *testing.T, config string) *Guard {
+	var policies []Policy
+	if err := json.Unmarshal([]byte(config), &policies); err != nil {
+		t.Fatal(err)
+	}
+	set, err := New(policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard := set.Select(transform.Scope{Route: "gem", Key: "team-a"})
+	if guard == nil {
+		t.Fatal("策略应匹配")
+	}
+	return guard
+}
+
+func TestDetectors(t *testing.T) {
+	for detector, cases := range map[string]map[string]bool{
+		"email": {"mail me at a.b+c@example.co.uk now": true, "not an @ address": false},
+		"phone": {"call 13800138000": true, "call +1 415-555-0100": true, "(415) 555-0100": true, "order 123456789012345": false},
+		"id":    {"id 11010519491231002X": true, "id 110105194912310021": false, "ssn 123-45-6789": true},
+		"card":  {"card 4111 1111 1111 1111": true, "card 4111111111111112": false},
+	} {
+		d := builtinDetectors[detector]
+		for text, want := range cases {
+			if got := len(d.find(text)) > 0; got != want {
+				t.Fatalf("%s 检测 %q 结果应为 %v", detector, text, want)
+			}
+		}
+	}
+}
+
+func TestCheckRequest(t *testing.T) {
+	guard := testGuard(t, `[
+		{"name":"pii","match":{"keys":["team-*"]},"rules":[
+			{"detector":"email","action":"tokenize"},
+			{"detector":"phone","action":"redact"},
+			{"name":"project","words":["Project Falcon"],"action":"redact","replacement":"<project>"}]},
+		{"name":"card","match":{"routes":["gem"]},"rules":[{"detector":"card","action":"block"}]}]`)
+	session := guard.NewSession()
+	text := "mail bob@example.com or bob@example.com, phone 13800138000, about project falcon"
+	output := "secret"
+	req := &general.Request{
+		SystemInstruction: &general.Content{Parts: []general.Part{{Text: &text}}},
+		Contents: []general.Content{{Role: "user", Parts: []general.Part{
+			{FunctionCall: &general.FunctionCall{Name: "send", Args: map[string]any{"to": []any{"alice@example.com"}}}},
+			{FunctionResponse: &general.FunctionResponse{Name: "send", Response: general.FunctionResponseContent{Output: &output}}},
+		}}},
+	}
+	changed, err := session.CheckRequest(req)
+	if err != nil || !changed {
+		t.Fatalf("请求应被修改: %v", err)
+	}
+	want := "mail [[EMAIL_1]] or [[EMAIL_1]], phone [REDACTED_PHONE], about <project>"
+	if got := *req.SystemInstruction.Parts[0].Text; got != want || text == got {
+		t.Fatalf("请求处理错误: %s", got)
+	}
+	if to := req.Contents[0].Parts[0].FunctionCall.Args["to"].([]any)[0]; to != "[[EMAIL_2]]" {
+		t.Fatalf("函数参数处理错误: %v", to)
+	}
+	if fired := strings.Join(session.Fired(), ","); fired != "email,phone,project" {
+		t.Fatalf("命中规则记录错误: %s", fired)
+	}
+
+	// token 在响应中还原
+	answer := "sent to [[EMAIL_2]] and [[EMAIL_9]]"
+	resp := &general.Response{Candidates: []general.Candidate{{Content: &general.Content{Parts: []general.Part{{Text: &answer}}}}}}
+	if err := session.CheckResponse(resp); err != nil || !session.Responding() {
+		t.Fatal(err)
+	}
+	if got := *resp.Candidates[0].Content.Parts[0].Text; got != "sent to alice@example.com and [[EMAIL_9]]" {
+		t.Fatalf("token 还原错误: %s", got)
+	}
+
+	card := "pay with 4111-1111-1111-1111"
+	_, err = guard.NewSession().CheckRequest(&general.Request{Contents: []general.Content{{Parts: []general.Part{{Text: &card}}}}})
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) || blocked.Rule != "card" {
+		t.Fatalf("卡号应拒绝请求: %v", err)
+	}
+}
+
+func TestCheckDelta(t *testing.T) {
+	guard := testGuard(t, `[{"response":true,"rules":[{"detector":"email","action":"tokenize"},{"detector":"phone","action":"redact"}]}]`)
+	session := guard.NewSession()
+	text := "contact carol@example.com"
+	if _, err := session.CheckRequest(&general.Request{Contents: []general.Content{{Parts: []general.Part{{Text: &text}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	// token 与手机号跨增量
+	chunks := []string{"I wrote to [[EM", "AIL_1]] as asked. ", strings.Repeat("x", 70), " call 1380013", "8000 later", " done"}
+	var out []string
+	for i, chunk := range chunks {
+		delta := &general.Response{Candidates: []general.Candidate{{Content: &general.Content{Parts: []general.Part{{Text: &chunk}}}}}}
+		if i == len(chunks)-1 {
+			delta.Candidates[0].FinishReason = "stop"
+		}
+		if err := session.CheckDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range delta.Candidates[0].Content.Parts {
+			out = append(out, *part.Text)
+		}
+	}
+	want := "I wrote to carol@example.com as asked. " + strings.Repeat("x", 70) + " call [REDACTED_PHONE] later done"
+	if got := strings.Join(out, ""); got != want {
+		t.Fatalf("流式处理错误:\n%s\n%s", got, want)
+	}
+
+	// 没有结束原因时由 Finish 输出缓冲的内容
+	session = guard.NewSession()
+	chunk := "tail 13800138000"
+	delta := &general.Response{Candidates: []general.Candidate{{Content: &general.Content{Parts: []general.Part{{Text: &chunk}}}}}}
+	if err := session.CheckDelta(delta); err != nil || len(delta.Candidates[0].Content.Parts) != 0 {
+		t.Fatalf("短文本应缓冲: %v", err)
+	}
+	last, err := session.Finish()
+	if err != nil || *last.Candidates[0].Content.Parts[0].Text != "tail [REDACTED_PHONE]" {
+		t.Fatalf("结束时输出缓冲错误: %+v %v", last, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, rule := range []Rule{
+		{Detector: "ssn", Action: ActionRedact},
+		{Detector: "email", Action: "mask"},
+		{Name: "x", Pattern: "(", Action: ActionRedact},
+		{Name: "x", Detector: "email", Words: []string{"a"}, Action: ActionRedact},
+		{Name: "bad name", Words: []string{"a"}, Action: ActionRedact},
+	} {
+		if _, err := New([]Policy{{Rules: []Rule{rule}}}); err == nil {
+			t.Fatalf("配置错误应校验失败: %+v", rule)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package guardrail
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// 流式输出保留的尾部长度(字节)，跨增量的内容与 token 不超过该长度时可以完整检查
+const holdBack = 64
+
+var tokenPattern = regexp.MustCompile(`\[\[[A-Z0-9_]+_\d+\]\]`)
+
+// Session 一次请求的处理状态，记录 tokenize 的原始内容与命中的规则，不能并发使用
+type Session struct {
+	guard *Guard
+	// token -> 原始内容，原始内容 -> token
+	tokens map[string]string
+	values map[string]string
+	counts map[string]int
+	fired  []string
+	// 请求内容被脱敏或替换为 token
+	modified bool
+	// 流式输出尚未输出的文本
+	pending  map[streamKey]string
+	finished bool
+}
+
+// streamKey 每个候选的回答与思考内容分别缓冲
+type streamKey struct {
+	index   int
+	thought bool
+}
+
+func (g *Guard) NewSession() *Session {
+	return &Session{
+		guard:   g,
+		tokens:  map[string]string{},
+		values:  map[string]string{},
+		counts:  map[string]int{},
+		pending: map[streamKey]string{},
+	}
+}
+
+// Fired 按首次命中顺序返回命中的规则名称
+func (s *Session) Fired() []string {
+	return s.fired
+}
+
+// Responding 是否需要处理响应: 检查模型输出或还原 token
+func (s *Session) Responding() bool {
+	return s.guard.response || len(s.tokens) > 0
+}
+
+// Modified 请求内容是否被脱敏或替换为 token
+func (s *Session) Modified() bool {
+	return s.modified
+}
+
+// CheckRequest 返回请求是否被修改，命中 block 规则时返回 *BlockedError
+func (s *Session) CheckRequest(req *general.Request) (bool, error) {
+	changed := false
+	check := func(text string) (string, error) {
+		out, err := s.scan(text, false)
+		changed = changed || out != text
+		s.modified = s.modified || out != text
+		return out, err
+	}
+	if req.SystemInstruction != nil {
+		if err := walkParts(req.SystemInstruction.Parts, check); err != nil {
+			return changed, err
+		}
+	}
+	for _, content := range req.Contents {
+		if err := walkParts(content.Parts, check); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// CheckResponse 非流式响应检查模型输出并还原 token
+func (s *Session) CheckResponse(resp *general.Response) error {
+	for _, candidate := range resp.Candidates {
+		if candidate.Content == nil {
+			continue
+		}
+		if err := walkParts(candidate.Content.Parts, s.output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckDelta 流式增量的文本先缓冲，保留尾部 holdBack 字节，跨增量的内容完整后再检查输出
+// 遇到非文本内容或结束原因时输出该候选缓冲的全部文本
+func (s *Session) CheckDelta(delta *general.Response) error {
+	if s.finished {
+		return nil
+	}
+	for i := range delta.Candidates {
+		candidate := &delta.Candidates[i]
+		if candidate.Content != nil {
+			var parts []general.Part
+			for _, part := range candidate.Content.Parts {
+				if textPart(part) {
+					out, err := s.stream(streamKey{candidate.Index, thoughtPart(part)}, *part.Text, false)
+					if err != nil {
+						return err
+					}
+					if out == "" && part.ThoughtSignature == nil {
+						continue
+					}
+					part.Text = &out
+					parts = append(parts, part)
+					continue
+				}
+				flushed, err := s.flush(candidate.Index)
+				if err != nil {
+					return err
+				}
+				restored := []general.Part{part}
+				if err := walkParts(restored, s.output); err != nil {
+					return err
+				}
+				parts = append(append(parts, flushed...), restored...)
+			}
+			candidate.Content.Parts = parts
+		}
+		if candidate.FinishReason != "" {
+			flushed, err := s.flush(candidate.Index)
+			if err != nil {
+				return err
+			}
+			if len(flushed) > 0 && candidate.Content == nil {
+				candidate.Content = &general.Content{Role: general.RoleAssistant}
+			}
+			if len(flushed) > 0 {
+				candidate.Content.Parts = append(candidate.Content.Parts, flushed...)
+			}
+		}
+	}
+	return nil
+}
+
+// Finish 上游流结束时输出所有缓冲的文本，没有缓冲时返回 nil；之后的增量不再处理
+func (s *Session) Finish() (*general.Response, error) {
+	s.finished = true
+	var indexes []int
+	for key, text := range s.pending {
+		if text != "" && !slices.Contains(indexes, key.index) {
+			indexes = append(indexes, key.index)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+	slices.Sort(indexes)
+	resp := &general.Response{}
+	for _, index := range indexes {
+		parts, err := s.flush(index)
+		if err != nil {
+			return nil, err
+		}
+		resp.Candidates = append(resp.Candidates, general.Candidate{Index: index, Content: &general.Content{Role: general.RoleAssistant, Parts: parts}})
+	}
+	return resp, nil
+}
+
+// stream 返回可以输出的文本，flush 时输出全部
+func (s *Session) stream(key streamKey, text string, flush bool) (string, error) {
+	buffer := s.pending[key] + text
+	cut := len(buffer)
+	if !flush {
+		cut = len(buffer) - holdBack
+		if cut <= 0 {
+			s.pending[key] = buffer
+			return "", nil
+		}
+		for cut > 0 && !utf8.RuneStart(buffer[cut]) {
+			cut--
+		}
+		// 不能从命中内容或 token 的中间截断
+		var locs [][]int
+		if s.guard.response {
+			for _, m := range s.guard.find(buffer) {
+				locs = append(locs, []int{m.start, m.end})
+			}
+		}
+		if len(s.tokens) > 0 {
+			locs = append(locs, tokenPattern.FindAllStringIndex(buffer, -1)...)
+		}
+		for _, loc := range locs {
+			if loc[0] < cut && cut < loc[1] {
+				cut = loc[0]
+			}
+		}
+	}
+	s.pending[key] = buffer[cut:]
+	return s.output(buffer[:cut])
+}
+
+// flush 输出候选缓冲的全部文本，思考内容在前
+func (s *Session) flush(index int) ([]general.Part, error) {
+	var parts []general.Part
+	for _, thought := range []bool{true, false} {
+		key := streamKey{index, thought}
+		if s.pending[key] == "" {
+			continue
+		}
+		out, err := s.stream(key, "", true)
+		if err != nil {
+			return nil, err
+		}
+		part := general.Part{Text: &out}
+		if thought {
+			part.Thought = &thought
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// output 模型输出先检查再还原 token，token 本身不会命中规则
+func (s *Session) output(text string) (string, error) {
+	if s.guard.response {
+		var err error
+		if text, err = s.scan(text, true); err != nil {
+			return "", err
+		}
+	}
+	if len(s.tokens) == 0 {
+		return text, nil
+	}
+	return tokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		if value, ok := s.tokens[token]; ok {
+			return value
+		}
+		return token
+	}), nil
+}
+
+// scan 处理命中的内容，output 为 true 时 tokenize 按 redact 处理
+func (s *Session) scan(text string, output bool) (string, error) {
+	matches := s.guard.find(text)
+	if len(matches) == 0 {
+		return text, nil
+	}
+	var builder strings.Builder
+	last := 0
+	for _, m := range matches {
+		s.fire(m.rule.name)
+		var replacement string
+		switch {
+		case m.rule.action == ActionBlock:
+			return "", &BlockedError{Rule: m.rule.name, Response: output}
+		case m.rule.action == ActionTokenize && !output:
+			replacement = s.token(m.rule, text[m.start:m.end])
+		default:
+			replacement = m.rule.replacement
+		}
+		builder.WriteString(text[last:m.start])
+		builder.WriteString(replacement)
+		last = m.end
+	}
+	builder.WriteString(text[last:])
+	return builder.String(), nil
+}
+
+// token 相同的内容使用相同的 token
+func (s *Session) token(rule *rule, value string) string {
+	key := rule.name + "\x00" + value
+	if token, ok := s.values[key]; ok {
+		return token
+	}
+	s.counts[rule.name]++
+	token := "[[" + strings.ToUpper(rule.name) + "_" + strconv.Itoa(s.counts[rule.name]) + "]]"
+	s.values[key] = token
+	s.tokens[token] = value
+	return token
+}
+
+func (s *Session) fire(name string) {
+	if !slices.Contains(s.fired, name) {
+		s.fired = append(s.fired, name)
+	}
+}
+
+func textPart(part general.Part) bool {
+	return part.Text != nil && part.InlineData == nil && part.FileData == nil && part.FunctionCall == nil &&
+		part.FunctionResponse == nil && part.ExecutableCode == nil && part.CodeExecutionResult == nil
+}
+
+func thoughtPart(part general.Part) bool {
+	return part.Thought != nil && *part.Thought
+}
+
+// walkParts 处理文本、函数调用参数与函数结果中的字符串，替换时不修改原来的字符串与 map
+func walkParts(parts []general.Part, fn func(string) (string, error)) error {
+	for i := range parts {
+		part := &parts[i]
+		if part.Text != nil {
+			out, err := fn(*part.Text)
+			if err != nil {
+				return err
+			}
+			part.Text = &out
+		}
+		if call := part.FunctionCall; call != nil && call.Args != nil {
+			args, err := walkValue(call.Args, fn)
+			if err != nil {
+				return err
+			}
+			copied := *call
+			copied.Args = args.(map[string]any)
+			part.FunctionCall = &copied
+		}
+		if response := part.FunctionResponse; response != nil {
+			copied := *response
+			for _, field := range []**string{&copied.Response.Output, &copied.Response.Error} {
+				if *field == nil {
+					continue
+				}
+				out, err := fn(**field)
+				if err != nil {
+					return err
+				}
+				*field = &out
+			}
+			part.FunctionResponse = &copied
+		}
+	}
+	return nil
+}
+
+func walkValue(value any, fn func(string) (string, error)) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, elem := range v {
+			out, err := walkValue(elem, fn)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = out
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(v))
+		for i, elem := range v {
+			out, err := walkValue(elem, fn)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = out
+		}
+		return result, nil
+	}
+	return value, nil
+}
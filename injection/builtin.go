@@ -0,0 +1,45 @@
+package injection
+
+// builtinRules 常见的提示词注入、越狱话术
+var builtinRules = []Rule{
+	{
+		Name:    "ignore_instructions",
+		Pattern: `(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(previous|prior|above|earlier|all|any|your)\b.{0,30}\b(instructions?|prompts?|rules|directions|guidelines)\b`,
+		Weight:  0.8,
+	},
+	{
+		Name:    "reveal_prompt",
+		Pattern: `(?i)\b(reveal|show|print|repeat|output|leak|tell me)\b.{0,40}\b(system prompt|initial (prompt|instructions)|hidden (prompt|instructions))`,
+		Weight:  0.7,
+	},
+	{
+		Name:    "persona_override",
+		Pattern: `(?i)\byou are (now|no longer)\b|\bact as (an? )?(unfiltered|unrestricted|jailbroken)\b|\bpretend (you are|to be)\b.{0,40}\b(no|without) (rules|restrictions|limits)\b`,
+		Weight:  0.5,
+	},
+	{
+		Name:    "jailbreak_persona",
+		Pattern: `\bDAN\b|(?i:\bdo anything now\b|\bdeveloper mode\b|\bjailbreak(ed|ing)?\b|\bgod mode\b)`,
+		Weight:  0.6,
+	},
+	{
+		Name:    "disable_safety",
+		Pattern: `(?i)\b(without|no|bypass|disable|remove|ignore)\b.{0,20}\b(restrictions|filters?|safety|guardrails|censorship|content polic(y|ies))\b`,
+		Weight:  0.5,
+	},
+	{
+		Name:    "chat_markup",
+		Pattern: `<\|im_start\|>|<\|system\|>|\[/?INST\]|<<SYS>>|(?im:^\s*#{2,}\s*(system|instructions?)\s*:?\s*$)`,
+		Weight:  0.6,
+	},
+	{
+		Name:    "ignore_instructions_zh",
+		Pattern: `(忽略|无视|忘记|忘掉)(之前|以上|上面|前面|先前|所有)?的?(所有)?(指令|指示|提示|规则|设定)`,
+		Weight:  0.8,
+	},
+	{
+		Name:    "reveal_prompt_zh",
+		Pattern: `(输出|显示|告诉我|重复|泄露).{0,10}(系统提示|系统指令|初始指令|提示词)`,
+		Weight:  0.7,
+	},
+}
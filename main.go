@@ -10,10 +10,12 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/lijcoder/aiapi/constant"
 	"github.com/lijcoder/aiapi/framework"
+	"github.com/lijcoder/aiapi/proxy"
 )
 
 func main() {
 	constant.ParseAgrs()
+	proxy.Init()
 	slog.SetLogLoggerLevel(slog.LevelInfo)
 	e := echo.New()
 	framework.EchoInit(e)
@@ -23,9 +25,8 @@ func main() {
 	registerRuntime()
 	e.Logger.Fatal(e.StartServer(&http.Server{
 		Addr:              constant.Address(),
-		ReadTimeout:       time.Second * 5,
 		ReadHeaderTimeout: time.Second * 2,
-		WriteTimeout:      time.Second * 90,
+		// 不设置 ReadTimeout、WriteTimeout，请求体上传与响应由代理按路由控制整体超时与流空闲超时
 	}))
 }
 
@@ -0,0 +1,247 @@
+package claude
+
+/*
+Claude AI API
+https://docs.claude.com/en/api/messages
+*/
+
+import "encoding/json"
+
+/* request params */
+type Request struct {
+	Model         string          `json:"model,omitempty"`
+	Messages      []Message       `json:"messages,omitempty"`
+	System        *MessageContent `json:"system,omitempty"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Temperature   *float32        `json:"temperature,omitempty"`
+	TopP          *float32        `json:"top_p,omitempty"`
+	TopK          *int            `json:"top_k,omitempty"`
+	Tools         []Tool          `json:"tools,omitempty"`
+	Metadata      map[string]any  `json:"metadata,omitempty"`
+	Thinking      *Thinking       `json:"thinking,omitempty"`
+	ToolChoice    *ToolChoice     `json:"tool_choice,omitempty"`
+	OutputFormat  *OutputFormat   `json:"output_format,omitempty"`
+}
+
+// ToolChoice type: auto、any、tool、none
+type ToolChoice struct {
+	Type                   string `json:"type,omitempty"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse *bool  `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// OutputFormat 结构化输出，type: json_schema
+type OutputFormat struct {
+	Type   string         `json:"type,omitempty"`
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// Thinking type: enabled、disabled，enabled 时 budget_tokens 至少 1024 且小于 max_tokens
+type Thinking struct {
+	Type         string `json:"type,omitempty"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// Message role: user、assistant
+type Message struct {
+	Role    string         `json:"role,omitempty"`
+	Content MessageContent `json:"content"`
+}
+
+// MessageContent content 可以是字符串或 content block 数组
+type MessageContent struct {
+	Text   *string
+	Blocks []ContentBlock
+}
+
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if c.Blocks != nil {
+		return json.Marshal(c.Blocks)
+	}
+	if c.Text != nil {
+		return json.Marshal(*c.Text)
+	}
+	return []byte("[]"), nil
+}
+
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		c.Text = &text
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	// 服务端工具出错时 content 为单个对象
+	if len(data) > 0 && data[0] == '{' {
+		var block ContentBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return err
+		}
+		c.Blocks = []ContentBlock{block}
+		return nil
+	}
+	return json.Unmarshal(data, &c.Blocks)
+}
+
+// ContentBlock type: text、image、document、thinking、redacted_thinking、tool_use、tool_result
+// 服务端工具：server_tool_use、web_search_tool_result、web_fetch_tool_result、code_execution_tool_result 等
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// text 块引用的搜索结果
+	Citations []Citation `json:"citations,omitempty"`
+	// thinking、redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+	// image、document
+	Source *Source `json:"source,omitempty"`
+	Title  string  `json:"title,omitempty"`
+	// tool_use
+	Id    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input *map[string]any `json:"input,omitempty"`
+	// tool_result
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	Content   *MessageContent `json:"content,omitempty"`
+	IsError   *bool           `json:"is_error,omitempty"`
+	// web_search_result
+	Url string `json:"url,omitempty"`
+	// code_execution_result、bash_code_execution_result
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	ReturnCode *int   `json:"return_code,omitempty"`
+}
+
+// Citation type: web_search_result_location、char_location 等
+type Citation struct {
+	Type           string `json:"type"`
+	Url            string `json:"url,omitempty"`
+	Title          string `json:"title,omitempty"`
+	CitedText      string `json:"cited_text,omitempty"`
+	EncryptedIndex string `json:"encrypted_index,omitempty"`
+}
+
+// MarshalJSON text、thinking 块即使为空也要输出对应字段，流式 content_block_start 依赖它
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	type alias ContentBlock
+	switch b.Type {
+	case "text":
+		return json.Marshal(struct {
+			alias
+			Text string `json:"text"`
+		}{alias(b), b.Text})
+	case "thinking":
+		return json.Marshal(struct {
+			alias
+			Thinking  string `json:"thinking"`
+			Signature string `json:"signature"`
+		}{alias(b), b.Thinking, b.Signature})
+	}
+	return json.Marshal(alias(b))
+}
+
+// Source type: base64、url、text
+type Source struct {
+	Type      string `json:"type,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+// Tool type 为空或 custom 时为自定义函数，其它为 web_search_20250305 等内置工具
+type Tool struct {
+	Type        string          `json:"type,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	InputSchema *map[string]any `json:"input_schema,omitempty"`
+	MaxUses     *int            `json:"max_uses,omitempty"`
+}
+
+/* response params */
+type Response struct {
+	Id           string         `json:"id,omitempty"`
+	Type         string         `json:"type,omitempty"`
+	Role         string         `json:"role,omitempty"`
+	Model        string         `json:"model,omitempty"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        *Usage         `json:"usage,omitempty"`
+}
+
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// StreamEvent type: message_start、content_block_start、content_block_delta、content_block_stop、
+// message_delta、message_stop、ping、error
+type StreamEvent struct {
+	Type         string        `json:"type"`
+	Message      *Response     `json:"message,omitempty"`
+	Index        *int          `json:"index,omitempty"`
+	ContentBlock *ContentBlock `json:"content_block,omitempty"`
+	Delta        *StreamDelta  `json:"delta,omitempty"`
+	Usage        *DeltaUsage   `json:"usage,omitempty"`
+	Error        *Error        `json:"error,omitempty"`
+}
+
+// DeltaUsage message_delta 中的累计用量，客户端用其中的 input_tokens 覆盖 message_start 的值，未知时不输出
+type DeltaUsage struct {
+	InputTokens              *int `json:"input_tokens,omitempty"`
+	OutputTokens             int  `json:"output_tokens"`
+	CacheCreationInputTokens int  `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int  `json:"cache_read_input_tokens,omitempty"`
+}
+
+// StreamDelta type: text_delta、input_json_delta、thinking_delta、signature_delta
+type StreamDelta struct {
+	Type         string  `json:"type,omitempty"`
+	Text         string  `json:"text,omitempty"`
+	PartialJson  string  `json:"partial_json,omitempty"`
+	Thinking     string  `json:"thinking,omitempty"`
+	Signature    string  `json:"signature,omitempty"`
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+	// citations_delta
+	Citation *Citation `json:"citation,omitempty"`
+}
+
+type Error struct {
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+/* models */
+
+// Model type: model
+type Model struct {
+	Type        string `json:"type"`
+	Id          string `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+type ModelList struct {
+	Data    []Model `json:"data"`
+	HasMore bool    `json:"has_more"`
+	FirstId *string `json:"first_id"`
+	LastId  *string `json:"last_id"`
+}
+
+/* count_tokens */
+
+// CountTokensResponse /v1/messages/count_tokens 的响应，请求体与 Request 相同但不带 max_tokens
+type CountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
@@ -0,0 +1,121 @@
+package messages
+
+/*
+消息结构体未建模字段的保留
+各协议不断增加新字段，结构体中没有的字段反序列化时保存在 Extras 中，序列化时原样输出
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extras 未建模的字段，值为原始 JSON
+type Extras map[string]json.RawMessage
+
+// knownFields 结构体类型 -> 小写的 JSON 字段名，encoding/json 匹配字段名时忽略大小写
+var knownFields sync.Map
+
+// MarshalExtras v 为去掉 MarshalJSON 方法的别名类型，结构体中已有的字段优先
+func MarshalExtras(v any, extras Extras) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extras) == 0 {
+		return data, err
+	}
+	known := fieldsOf(reflect.TypeOf(v))
+	keys := make([]string, 0, len(extras))
+	for key := range extras {
+		if !known[strings.ToLower(key)] {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return data, nil
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for i, key := range keys {
+		if i > 0 || len(data) > 2 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(extras[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalExtras v 为去掉 UnmarshalJSON 方法的别名类型指针，结构体中没有的字段写入 extras
+func UnmarshalExtras(data []byte, v any, extras *Extras) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	*extras = nil
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	known := fieldsOf(reflect.TypeOf(v))
+	for key, value := range fields {
+		if known[strings.ToLower(key)] {
+			continue
+		}
+		if *extras == nil {
+			*extras = Extras{}
+		}
+		(*extras)[key] = value
+	}
+	return nil
+}
+
+func fieldsOf(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if fields, ok := knownFields.Load(t); ok {
+		return fields.(map[string]bool)
+	}
+	fields := map[string]bool{}
+	collectFields(t, fields)
+	knownFields.Store(t, fields)
+	return fields
+}
+
+// collectFields 没有 json 标签的匿名结构体字段展开到外层
+func collectFields(t reflect.Type, fields map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" && field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectFields(embedded, fields)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+}
@@ -0,0 +1,61 @@
+package messages
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type extrasMessage struct {
+	Name   string         `json:"name,omitempty"`
+	Inner  *extrasMessage `json:"inner,omitempty"`
+	Extras Extras         `json:"-"`
+}
+
+func (m extrasMessage) MarshalJSON() ([]byte, error) {
+	type alias extrasMessage
+	return MarshalExtras(alias(m), m.Extras)
+}
+
+func (m *extrasMessage) UnmarshalJSON(data []byte) error {
+	type alias extrasMessage
+	return UnmarshalExtras(data, (*alias)(m), &m.Extras)
+}
+
+func TestExtrasRoundTrip(t *testing.T) {
+	body := `{"name":"a","inner":{"name":"b","z":null,"deep":{"x":1}},"b":[1,2],"a":"s"}`
+	var message extrasMessage
+	if err := json.Unmarshal([]byte(body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Extras) != 2 || len(message.Inner.Extras) != 2 {
+		t.Fatalf("未建模字段解析错误: %v %v", message.Extras, message.Inner.Extras)
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 已建模字段在前，未建模字段按名称排序
+	want := `{"name":"a","inner":{"name":"b","deep":{"x":1},"z":null},"a":"s","b":[1,2]}`
+	if string(data) != want {
+		t.Fatalf("序列化结果错误: %s", data)
+	}
+}
+
+func TestExtrasKnownField(t *testing.T) {
+	// encoding/json 匹配字段名忽略大小写，NAME 不是未建模字段
+	var message extrasMessage
+	if err := json.Unmarshal([]byte(`{"NAME":"a"}`), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Name != "a" || message.Extras != nil {
+		t.Fatalf("大小写不同的字段解析错误: %+v", message)
+	}
+	// 与已建模字段同名的 extras 不输出
+	message.Extras = Extras{"name": json.RawMessage(`"b"`)}
+	if data, _ := json.Marshal(message); string(data) != `{"name":"a"}` {
+		t.Fatalf("同名字段应以结构体为准: %s", data)
+	}
+	if data, _ := json.Marshal(extrasMessage{Extras: Extras{"x": json.RawMessage(`1`)}}); string(data) != `{"x":1}` {
+		t.Fatalf("空结构体序列化错误: %s", data)
+	}
+}
@@ -0,0 +1,130 @@
+package gemini
+
+/*
+generateContent 以外的接口
+https://ai.google.dev/api/tokens
+https://ai.google.dev/api/embeddings
+https://ai.google.dev/api/models
+*/
+
+import (
+	"encoding/json"
+	"maps"
+
+	"github.com/lijcoder/aiapi/messages"
+)
+
+/* countTokens */
+
+// CountTokensRequest contents 与 generateContentRequest 二选一，后者可以带上系统提示词与工具一起计算
+type CountTokensRequest struct {
+	Contents               []Content               `json:"contents,omitempty"`
+	GenerateContentRequest *GenerateContentRequest `json:"generateContentRequest,omitempty"`
+	Extras                 messages.Extras         `json:"-"`
+}
+
+// GenerateContentRequest 带模型名的 generateContent 请求，model 格式为 models/{model}
+type GenerateContentRequest struct {
+	Model string `json:"model,omitempty"`
+	Request
+}
+
+// MarshalJSON 嵌入的 Request 的 MarshalJSON 会被提升，model 作为 Request 的未建模字段一起输出
+func (g GenerateContentRequest) MarshalJSON() ([]byte, error) {
+	req := g.Request
+	if g.Model != "" {
+		model, err := json.Marshal(g.Model)
+		if err != nil {
+			return nil, err
+		}
+		req.Extras = maps.Clone(req.Extras)
+		if req.Extras == nil {
+			req.Extras = messages.Extras{}
+		}
+		req.Extras["model"] = model
+	}
+	return json.Marshal(req)
+}
+
+func (g *GenerateContentRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &g.Request); err != nil {
+		return err
+	}
+	g.Model = ""
+	model, ok := g.Request.Extras["model"]
+	if !ok {
+		return nil
+	}
+	delete(g.Request.Extras, "model")
+	if len(g.Request.Extras) == 0 {
+		g.Request.Extras = nil
+	}
+	return json.Unmarshal(model, &g.Model)
+}
+
+type CountTokensResponse struct {
+	TotalTokens             int                  `json:"totalTokens"`
+	CachedContentTokenCount *int                 `json:"cachedContentTokenCount,omitempty"`
+	PromptTokensDetails     []ModalityTokenCount `json:"promptTokensDetails,omitempty"`
+	CacheTokensDetails      []ModalityTokenCount `json:"cacheTokensDetails,omitempty"`
+	Extras                  messages.Extras      `json:"-"`
+}
+
+/* embedContent、batchEmbedContents */
+
+// EmbedContentRequest taskType: RETRIEVAL_QUERY、RETRIEVAL_DOCUMENT、SEMANTIC_SIMILARITY、CLASSIFICATION、CLUSTERING 等
+// title 只能与 RETRIEVAL_DOCUMENT 一起使用；批量请求中每个请求都要带 model
+type EmbedContentRequest struct {
+	Model                string          `json:"model,omitempty"`
+	Content              *Content        `json:"content,omitempty"`
+	TaskType             string          `json:"taskType,omitempty"`
+	Title                string          `json:"title,omitempty"`
+	OutputDimensionality *int            `json:"outputDimensionality,omitempty"`
+	Extras               messages.Extras `json:"-"`
+}
+
+type EmbedContentResponse struct {
+	Embedding *ContentEmbedding `json:"embedding,omitempty"`
+	Extras    messages.Extras   `json:"-"`
+}
+
+type BatchEmbedContentsRequest struct {
+	Requests []EmbedContentRequest `json:"requests,omitempty"`
+	Extras   messages.Extras       `json:"-"`
+}
+
+type BatchEmbedContentsResponse struct {
+	Embeddings []ContentEmbedding `json:"embeddings"`
+	Extras     messages.Extras    `json:"-"`
+}
+
+type ContentEmbedding struct {
+	Values []float32       `json:"values"`
+	Extras messages.Extras `json:"-"`
+}
+
+/* models */
+
+// Model name 格式为 models/{model}
+type Model struct {
+	Name                       string          `json:"name"`
+	BaseModelId                string          `json:"baseModelId,omitempty"`
+	Version                    string          `json:"version,omitempty"`
+	DisplayName                string          `json:"displayName,omitempty"`
+	Description                string          `json:"description,omitempty"`
+	InputTokenLimit            int             `json:"inputTokenLimit,omitempty"`
+	OutputTokenLimit           int             `json:"outputTokenLimit,omitempty"`
+	SupportedGenerationMethods []string        `json:"supportedGenerationMethods,omitempty"`
+	Thinking                   bool            `json:"thinking,omitempty"`
+	Temperature                *float32        `json:"temperature,omitempty"`
+	MaxTemperature             *float32        `json:"maxTemperature,omitempty"`
+	TopP                       *float32        `json:"topP,omitempty"`
+	TopK                       *int            `json:"topK,omitempty"`
+	Extras                     messages.Extras `json:"-"`
+}
+
+type ListModelsResponse struct {
+	Models        []Model         `json:"models"`
+	NextPageToken string          `json:"nextPageToken,omitempty"`
+	Extras        messages.Extras `json:"-"`
+}
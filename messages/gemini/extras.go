@@ -0,0 +1,485 @@
+package gemini
+
+import "github.com/lijcoder/aiapi/messages"
+
+// 以下方法保留未建模字段，见 messages.Extras
+
+func (g GeminiContext) MarshalJSON() ([]byte, error) {
+	type alias GeminiContext
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GeminiContext) UnmarshalJSON(data []byte) error {
+	type alias GeminiContext
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (r Request) MarshalJSON() ([]byte, error) {
+	type alias Request
+	return messages.MarshalExtras(alias(r), r.Extras)
+}
+
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type alias Request
+	return messages.UnmarshalExtras(data, (*alias)(r), &r.Extras)
+}
+
+func (s SafetySetting) MarshalJSON() ([]byte, error) {
+	type alias SafetySetting
+	return messages.MarshalExtras(alias(s), s.Extras)
+}
+
+func (s *SafetySetting) UnmarshalJSON(data []byte) error {
+	type alias SafetySetting
+	return messages.UnmarshalExtras(data, (*alias)(s), &s.Extras)
+}
+
+func (t ToolConfig) MarshalJSON() ([]byte, error) {
+	type alias ToolConfig
+	return messages.MarshalExtras(alias(t), t.Extras)
+}
+
+func (t *ToolConfig) UnmarshalJSON(data []byte) error {
+	type alias ToolConfig
+	return messages.UnmarshalExtras(data, (*alias)(t), &t.Extras)
+}
+
+func (f FunctionCallingConfig) MarshalJSON() ([]byte, error) {
+	type alias FunctionCallingConfig
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionCallingConfig) UnmarshalJSON(data []byte) error {
+	type alias FunctionCallingConfig
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (c Content) MarshalJSON() ([]byte, error) {
+	type alias Content
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	type alias Content
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (p Part) MarshalJSON() ([]byte, error) {
+	type alias Part
+	return messages.MarshalExtras(alias(p), p.Extras)
+}
+
+func (p *Part) UnmarshalJSON(data []byte) error {
+	type alias Part
+	return messages.UnmarshalExtras(data, (*alias)(p), &p.Extras)
+}
+
+func (b Blob) MarshalJSON() ([]byte, error) {
+	type alias Blob
+	return messages.MarshalExtras(alias(b), b.Extras)
+}
+
+func (b *Blob) UnmarshalJSON(data []byte) error {
+	type alias Blob
+	return messages.UnmarshalExtras(data, (*alias)(b), &b.Extras)
+}
+
+func (f FileData) MarshalJSON() ([]byte, error) {
+	type alias FileData
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FileData) UnmarshalJSON(data []byte) error {
+	type alias FileData
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (e ExecutableCode) MarshalJSON() ([]byte, error) {
+	type alias ExecutableCode
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *ExecutableCode) UnmarshalJSON(data []byte) error {
+	type alias ExecutableCode
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
+
+func (c CodeExecutionResult) MarshalJSON() ([]byte, error) {
+	type alias CodeExecutionResult
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *CodeExecutionResult) UnmarshalJSON(data []byte) error {
+	type alias CodeExecutionResult
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (f FunctionCall) MarshalJSON() ([]byte, error) {
+	type alias FunctionCall
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionCall) UnmarshalJSON(data []byte) error {
+	type alias FunctionCall
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (f FunctionResponse) MarshalJSON() ([]byte, error) {
+	type alias FunctionResponse
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionResponse) UnmarshalJSON(data []byte) error {
+	type alias FunctionResponse
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (f FunctionResponseContent) MarshalJSON() ([]byte, error) {
+	type alias FunctionResponseContent
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionResponseContent) UnmarshalJSON(data []byte) error {
+	type alias FunctionResponseContent
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (t Tool) MarshalJSON() ([]byte, error) {
+	type alias Tool
+	return messages.MarshalExtras(alias(t), t.Extras)
+}
+
+func (t *Tool) UnmarshalJSON(data []byte) error {
+	type alias Tool
+	return messages.UnmarshalExtras(data, (*alias)(t), &t.Extras)
+}
+
+func (f FunctionDeclaration) MarshalJSON() ([]byte, error) {
+	type alias FunctionDeclaration
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionDeclaration) UnmarshalJSON(data []byte) error {
+	type alias FunctionDeclaration
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (g GenerationConfig) MarshalJSON() ([]byte, error) {
+	type alias GenerationConfig
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GenerationConfig) UnmarshalJSON(data []byte) error {
+	type alias GenerationConfig
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (s SpeechConfig) MarshalJSON() ([]byte, error) {
+	type alias SpeechConfig
+	return messages.MarshalExtras(alias(s), s.Extras)
+}
+
+func (s *SpeechConfig) UnmarshalJSON(data []byte) error {
+	type alias SpeechConfig
+	return messages.UnmarshalExtras(data, (*alias)(s), &s.Extras)
+}
+
+func (v VoiceConfig) MarshalJSON() ([]byte, error) {
+	type alias VoiceConfig
+	return messages.MarshalExtras(alias(v), v.Extras)
+}
+
+func (v *VoiceConfig) UnmarshalJSON(data []byte) error {
+	type alias VoiceConfig
+	return messages.UnmarshalExtras(data, (*alias)(v), &v.Extras)
+}
+
+func (p PrebuiltVoiceConfig) MarshalJSON() ([]byte, error) {
+	type alias PrebuiltVoiceConfig
+	return messages.MarshalExtras(alias(p), p.Extras)
+}
+
+func (p *PrebuiltVoiceConfig) UnmarshalJSON(data []byte) error {
+	type alias PrebuiltVoiceConfig
+	return messages.UnmarshalExtras(data, (*alias)(p), &p.Extras)
+}
+
+func (m MultiSpeakerVoiceConfig) MarshalJSON() ([]byte, error) {
+	type alias MultiSpeakerVoiceConfig
+	return messages.MarshalExtras(alias(m), m.Extras)
+}
+
+func (m *MultiSpeakerVoiceConfig) UnmarshalJSON(data []byte) error {
+	type alias MultiSpeakerVoiceConfig
+	return messages.UnmarshalExtras(data, (*alias)(m), &m.Extras)
+}
+
+func (s SpeakerVoiceConfig) MarshalJSON() ([]byte, error) {
+	type alias SpeakerVoiceConfig
+	return messages.MarshalExtras(alias(s), s.Extras)
+}
+
+func (s *SpeakerVoiceConfig) UnmarshalJSON(data []byte) error {
+	type alias SpeakerVoiceConfig
+	return messages.UnmarshalExtras(data, (*alias)(s), &s.Extras)
+}
+
+func (t ThinkingConfig) MarshalJSON() ([]byte, error) {
+	type alias ThinkingConfig
+	return messages.MarshalExtras(alias(t), t.Extras)
+}
+
+func (t *ThinkingConfig) UnmarshalJSON(data []byte) error {
+	type alias ThinkingConfig
+	return messages.UnmarshalExtras(data, (*alias)(t), &t.Extras)
+}
+
+func (r Response) MarshalJSON() ([]byte, error) {
+	type alias Response
+	return messages.MarshalExtras(alias(r), r.Extras)
+}
+
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type alias Response
+	return messages.UnmarshalExtras(data, (*alias)(r), &r.Extras)
+}
+
+func (u UsageMetadata) MarshalJSON() ([]byte, error) {
+	type alias UsageMetadata
+	return messages.MarshalExtras(alias(u), u.Extras)
+}
+
+func (u *UsageMetadata) UnmarshalJSON(data []byte) error {
+	type alias UsageMetadata
+	return messages.UnmarshalExtras(data, (*alias)(u), &u.Extras)
+}
+
+func (m ModalityTokenCount) MarshalJSON() ([]byte, error) {
+	type alias ModalityTokenCount
+	return messages.MarshalExtras(alias(m), m.Extras)
+}
+
+func (m *ModalityTokenCount) UnmarshalJSON(data []byte) error {
+	type alias ModalityTokenCount
+	return messages.UnmarshalExtras(data, (*alias)(m), &m.Extras)
+}
+
+func (c Candidate) MarshalJSON() ([]byte, error) {
+	type alias Candidate
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *Candidate) UnmarshalJSON(data []byte) error {
+	type alias Candidate
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (p PromptFeedback) MarshalJSON() ([]byte, error) {
+	type alias PromptFeedback
+	return messages.MarshalExtras(alias(p), p.Extras)
+}
+
+func (p *PromptFeedback) UnmarshalJSON(data []byte) error {
+	type alias PromptFeedback
+	return messages.UnmarshalExtras(data, (*alias)(p), &p.Extras)
+}
+
+func (s SafetyRating) MarshalJSON() ([]byte, error) {
+	type alias SafetyRating
+	return messages.MarshalExtras(alias(s), s.Extras)
+}
+
+func (s *SafetyRating) UnmarshalJSON(data []byte) error {
+	type alias SafetyRating
+	return messages.UnmarshalExtras(data, (*alias)(s), &s.Extras)
+}
+
+func (l LogprobsResult) MarshalJSON() ([]byte, error) {
+	type alias LogprobsResult
+	return messages.MarshalExtras(alias(l), l.Extras)
+}
+
+func (l *LogprobsResult) UnmarshalJSON(data []byte) error {
+	type alias LogprobsResult
+	return messages.UnmarshalExtras(data, (*alias)(l), &l.Extras)
+}
+
+func (t TopCandidates) MarshalJSON() ([]byte, error) {
+	type alias TopCandidates
+	return messages.MarshalExtras(alias(t), t.Extras)
+}
+
+func (t *TopCandidates) UnmarshalJSON(data []byte) error {
+	type alias TopCandidates
+	return messages.UnmarshalExtras(data, (*alias)(t), &t.Extras)
+}
+
+func (l LogprobCandidate) MarshalJSON() ([]byte, error) {
+	type alias LogprobCandidate
+	return messages.MarshalExtras(alias(l), l.Extras)
+}
+
+func (l *LogprobCandidate) UnmarshalJSON(data []byte) error {
+	type alias LogprobCandidate
+	return messages.UnmarshalExtras(data, (*alias)(l), &l.Extras)
+}
+
+func (c CitationMetadata) MarshalJSON() ([]byte, error) {
+	type alias CitationMetadata
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *CitationMetadata) UnmarshalJSON(data []byte) error {
+	type alias CitationMetadata
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (g GroundingMetadata) MarshalJSON() ([]byte, error) {
+	type alias GroundingMetadata
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GroundingMetadata) UnmarshalJSON(data []byte) error {
+	type alias GroundingMetadata
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (g GroundingChunk) MarshalJSON() ([]byte, error) {
+	type alias GroundingChunk
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GroundingChunk) UnmarshalJSON(data []byte) error {
+	type alias GroundingChunk
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (g GroundingChunkWeb) MarshalJSON() ([]byte, error) {
+	type alias GroundingChunkWeb
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GroundingChunkWeb) UnmarshalJSON(data []byte) error {
+	type alias GroundingChunkWeb
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (g GroundingSupport) MarshalJSON() ([]byte, error) {
+	type alias GroundingSupport
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GroundingSupport) UnmarshalJSON(data []byte) error {
+	type alias GroundingSupport
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (s Segment) MarshalJSON() ([]byte, error) {
+	type alias Segment
+	return messages.MarshalExtras(alias(s), s.Extras)
+}
+
+func (s *Segment) UnmarshalJSON(data []byte) error {
+	type alias Segment
+	return messages.UnmarshalExtras(data, (*alias)(s), &s.Extras)
+}
+
+func (c CitationSource) MarshalJSON() ([]byte, error) {
+	type alias CitationSource
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *CitationSource) UnmarshalJSON(data []byte) error {
+	type alias CitationSource
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (c CountTokensRequest) MarshalJSON() ([]byte, error) {
+	type alias CountTokensRequest
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *CountTokensRequest) UnmarshalJSON(data []byte) error {
+	type alias CountTokensRequest
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (c CountTokensResponse) MarshalJSON() ([]byte, error) {
+	type alias CountTokensResponse
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *CountTokensResponse) UnmarshalJSON(data []byte) error {
+	type alias CountTokensResponse
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (e EmbedContentRequest) MarshalJSON() ([]byte, error) {
+	type alias EmbedContentRequest
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *EmbedContentRequest) UnmarshalJSON(data []byte) error {
+	type alias EmbedContentRequest
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
+
+func (e EmbedContentResponse) MarshalJSON() ([]byte, error) {
+	type alias EmbedContentResponse
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *EmbedContentResponse) UnmarshalJSON(data []byte) error {
+	type alias EmbedContentResponse
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
+
+func (b BatchEmbedContentsRequest) MarshalJSON() ([]byte, error) {
+	type alias BatchEmbedContentsRequest
+	return messages.MarshalExtras(alias(b), b.Extras)
+}
+
+func (b *BatchEmbedContentsRequest) UnmarshalJSON(data []byte) error {
+	type alias BatchEmbedContentsRequest
+	return messages.UnmarshalExtras(data, (*alias)(b), &b.Extras)
+}
+
+func (b BatchEmbedContentsResponse) MarshalJSON() ([]byte, error) {
+	type alias BatchEmbedContentsResponse
+	return messages.MarshalExtras(alias(b), b.Extras)
+}
+
+func (b *BatchEmbedContentsResponse) UnmarshalJSON(data []byte) error {
+	type alias BatchEmbedContentsResponse
+	return messages.UnmarshalExtras(data, (*alias)(b), &b.Extras)
+}
+
+func (c ContentEmbedding) MarshalJSON() ([]byte, error) {
+	type alias ContentEmbedding
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *ContentEmbedding) UnmarshalJSON(data []byte) error {
+	type alias ContentEmbedding
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (m Model) MarshalJSON() ([]byte, error) {
+	type alias Model
+	return messages.MarshalExtras(alias(m), m.Extras)
+}
+
+func (m *Model) UnmarshalJSON(data []byte) error {
+	type alias Model
+	return messages.UnmarshalExtras(data, (*alias)(m), &m.Extras)
+}
+
+func (l ListModelsResponse) MarshalJSON() ([]byte, error) {
+	type alias ListModelsResponse
+	return messages.MarshalExtras(alias(l), l.Extras)
+}
+
+func (l *ListModelsResponse) UnmarshalJSON(data []byte) error {
+	type alias ListModelsResponse
+	return messages.UnmarshalExtras(data, (*alias)(l), &l.Extras)
+}
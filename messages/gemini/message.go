@@ -5,67 +5,137 @@ Gemini AI API
 https://ai.google.dev/api/generate-content#v1beta.Candidate
 */
 
+import "github.com/lijcoder/aiapi/messages"
+
 type GeminiContext struct {
-	Stream          bool       `json:"stream,omitempty"`
-	Model           string     `json:"model,omitempty"`
-	Request         *Request   `json:"request,omitempty"`
-	Response        *Response  `json:"response,omitempty"`
-	StreamResponses []Response `json:"streamResponses,omitempty"`
+	Stream          bool            `json:"stream,omitempty"`
+	Model           string          `json:"model,omitempty"`
+	Request         *Request        `json:"request,omitempty"`
+	Response        *Response       `json:"response,omitempty"`
+	StreamResponses []Response      `json:"streamResponses,omitempty"`
+	Extras          messages.Extras `json:"-"`
 }
 
 /* request param */
 type Request struct {
 	Contents          []Content         `json:"contents,omitempty"`
 	Tools             []Tool            `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig       `json:"toolConfig,omitempty"`
 	SystemInstruction *Content          `json:"systemInstruction,omitempty"`
 	GenerationConfig  *GenerationConfig `json:"generationConfig,omitempty"`
+	SafetySettings    []SafetySetting   `json:"safetySettings,omitempty"`
+	// 上下文缓存名称 cachedContents/{id}
+	CachedContent string          `json:"cachedContent,omitempty"`
+	Extras        messages.Extras `json:"-"`
+}
+
+// SafetySetting category: HARM_CATEGORY_HARASSMENT 等，threshold: BLOCK_NONE、BLOCK_ONLY_HIGH、OFF 等
+type SafetySetting struct {
+	Category  string `json:"category,omitempty"`
+	Threshold string `json:"threshold,omitempty"`
+	// method: SEVERITY、PROBABILITY，只有 vertex 支持
+	Method string          `json:"method,omitempty"`
+	Extras messages.Extras `json:"-"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+	Extras                messages.Extras        `json:"-"`
+}
+
+// FunctionCallingConfig mode: AUTO、ANY、NONE、VALIDATED，allowedFunctionNames 只能与 ANY、VALIDATED 一起使用
+type FunctionCallingConfig struct {
+	Mode                 string          `json:"mode,omitempty"`
+	AllowedFunctionNames []string        `json:"allowedFunctionNames,omitempty"`
+	Extras               messages.Extras `json:"-"`
 }
 
 type Content struct {
-	Role  string `json:"role,omitempty"`
-	Parts []Part `json:"parts,omitempty"`
+	Role   string          `json:"role,omitempty"`
+	Parts  []Part          `json:"parts,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type Part struct {
-	Text             *string           `json:"text,omitempty"`
-	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
-	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	Text                *string              `json:"text,omitempty"`
+	InlineData          *Blob                `json:"inlineData,omitempty"`
+	FileData            *FileData            `json:"fileData,omitempty"`
+	FunctionCall        *FunctionCall        `json:"functionCall,omitempty"`
+	FunctionResponse    *FunctionResponse    `json:"functionResponse,omitempty"`
+	ExecutableCode      *ExecutableCode      `json:"executableCode,omitempty"`
+	CodeExecutionResult *CodeExecutionResult `json:"codeExecutionResult,omitempty"`
+	// 思考内容与签名，多轮对话时需要原样回传
+	Thought          *bool           `json:"thought,omitempty"`
+	ThoughtSignature *string         `json:"thoughtSignature,omitempty"`
+	Extras           messages.Extras `json:"-"`
+}
+
+// Blob 内联二进制数据，data 为 base64
+type Blob struct {
+	MimeType string          `json:"mimeType,omitempty"`
+	Data     string          `json:"data,omitempty"`
+	Extras   messages.Extras `json:"-"`
+}
+
+// FileData 文件引用
+type FileData struct {
+	MimeType string          `json:"mimeType,omitempty"`
+	FileUri  string          `json:"fileUri,omitempty"`
+	Extras   messages.Extras `json:"-"`
+}
+
+type ExecutableCode struct {
+	Language string          `json:"language,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Extras   messages.Extras `json:"-"`
+}
+
+// CodeExecutionResult outcome: OUTCOME_OK、OUTCOME_FAILED、OUTCOME_DEADLINE_EXCEEDED
+type CodeExecutionResult struct {
+	Outcome string          `json:"outcome,omitempty"`
+	Output  string          `json:"output,omitempty"`
+	Extras  messages.Extras `json:"-"`
 }
 
 type FunctionCall struct {
-	Id   string         `json:"id,omitempty"`
-	Name string         `json:"name,omitempty"`
-	Args map[string]any `json:"args,omitempty"`
+	Id     string          `json:"id,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Args   map[string]any  `json:"args,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type FunctionResponse struct {
 	Id       string                  `json:"id,omitempty"`
 	Name     string                  `json:"name,omitempty"`
 	Response FunctionResponseContent `json:"response,omitempty"`
+	Extras   messages.Extras         `json:"-"`
 }
 
 type FunctionResponseContent struct {
-	Output *string `json:"output,omitempty"`
-	Error  *string `json:"error,omitempty"`
+	Output *string         `json:"output,omitempty"`
+	Error  *string         `json:"error,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type Tool struct {
 	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
 	GoogleSearch         *map[string]any       `json:"googleSearch,omitempty"`
+	CodeExecution        *map[string]any       `json:"codeExecution,omitempty"`
+	UrlContext           *map[string]any       `json:"urlContext,omitempty"`
+	Extras               messages.Extras       `json:"-"`
 }
 
 type FunctionDeclaration struct {
-	Name                 string                `json:"name,omitempty"`
-	Description          string                `json:"description,omitempty"`
-	Parameters           *map[string]any       `json:"parameters,omitempty"`
-	ParametersJsonSchema *ParametersJsonSchema `json:"parametersJsonSchema,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// OpenAPI 3.0 schema 子集
+	Parameters *map[string]any `json:"parameters,omitempty"`
+	// JSON Schema，与 parameters 二选一
+	ParametersJsonSchema ParametersJsonSchema `json:"parametersJsonSchema,omitempty"`
+	Extras               messages.Extras      `json:"-"`
 }
 
-type ParametersJsonSchema struct {
-	Type       string         `json:"type,omitempty"`
-	Properties map[string]any `json:"properties,omitempty"`
-	Required   []string       `json:"required,omitempty"`
-}
+type ParametersJsonSchema map[string]any
 
 type GenerationConfig struct {
 	StopSequences    []string        `json:"stopSequences,omitempty"`
@@ -77,21 +147,68 @@ type GenerationConfig struct {
 	FrequencyPenalty *float32        `json:"frequencyPenalty,omitempty"`
 	Logprobs         *int            `json:"logprobs,omitempty"`
 	ThinkingConfig   *ThinkingConfig `json:"thinkingConfig,omitempty"`
+	// 结构化输出 application/json、text/x.enum
+	ResponseMimeType *string `json:"responseMimeType,omitempty"`
+	// OpenAPI schema 子集
+	ResponseSchema *map[string]any `json:"responseSchema,omitempty"`
+	// JSON Schema，与 responseSchema 二选一
+	ResponseJsonSchema *map[string]any `json:"responseJsonSchema,omitempty"`
+	// 输出模态 TEXT、IMAGE、AUDIO
+	ResponseModalities []string      `json:"responseModalities,omitempty"`
+	SpeechConfig       *SpeechConfig `json:"speechConfig,omitempty"`
+	CandidateCount     *int          `json:"candidateCount,omitempty"`
+	Seed               *int          `json:"seed,omitempty"`
+	// 返回 token 的对数概率，logprobs 为每个位置返回的候选数
+	ResponseLogprobs *bool `json:"responseLogprobs,omitempty"`
+	// mediaResolution: MEDIA_RESOLUTION_LOW、MEDIA_RESOLUTION_MEDIUM、MEDIA_RESOLUTION_HIGH
+	MediaResolution string          `json:"mediaResolution,omitempty"`
+	Extras          messages.Extras `json:"-"`
+}
+
+type SpeechConfig struct {
+	VoiceConfig             *VoiceConfig             `json:"voiceConfig,omitempty"`
+	MultiSpeakerVoiceConfig *MultiSpeakerVoiceConfig `json:"multiSpeakerVoiceConfig,omitempty"`
+	LanguageCode            string                   `json:"languageCode,omitempty"`
+	Extras                  messages.Extras          `json:"-"`
+}
+
+type VoiceConfig struct {
+	PrebuiltVoiceConfig *PrebuiltVoiceConfig `json:"prebuiltVoiceConfig,omitempty"`
+	Extras              messages.Extras      `json:"-"`
+}
+
+type PrebuiltVoiceConfig struct {
+	VoiceName string          `json:"voiceName,omitempty"`
+	Extras    messages.Extras `json:"-"`
+}
+
+type MultiSpeakerVoiceConfig struct {
+	SpeakerVoiceConfigs []SpeakerVoiceConfig `json:"speakerVoiceConfigs,omitempty"`
+	Extras              messages.Extras      `json:"-"`
+}
+
+type SpeakerVoiceConfig struct {
+	Speaker     string          `json:"speaker,omitempty"`
+	VoiceConfig *VoiceConfig    `json:"voiceConfig,omitempty"`
+	Extras      messages.Extras `json:"-"`
 }
 
 type ThinkingConfig struct {
-	IncludeThoughts *bool   `json:"includeThoughts,omitempty"`
-	ThinkingBudget  *int    `json:"thinkingBudget,omitempty"`
-	ThinkingLevel   *string `json:"thinkingLevel,omitempty"`
+	IncludeThoughts *bool           `json:"includeThoughts,omitempty"`
+	ThinkingBudget  *int            `json:"thinkingBudget,omitempty"`
+	ThinkingLevel   *string         `json:"thinkingLevel,omitempty"`
+	Extras          messages.Extras `json:"-"`
 }
 
 /* response params */
 
 type Response struct {
-	Candidates    []Candidate    `json:"candidates,omitempty"`
-	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
-	ResponseId    *string        `json:"responseId,omitempty"`
-	ModelVersion  *string        `json:"modelVersion,omitempty"`
+	Candidates     []Candidate     `json:"candidates,omitempty"`
+	PromptFeedback *PromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata  `json:"usageMetadata,omitempty"`
+	ResponseId     *string         `json:"responseId,omitempty"`
+	ModelVersion   *string         `json:"modelVersion,omitempty"`
+	Extras         messages.Extras `json:"-"`
 }
 
 type UsageMetadata struct {
@@ -105,30 +222,109 @@ type UsageMetadata struct {
 	CacheTokensDetails         []ModalityTokenCount `json:"cacheTokensDetails,omitempty"`
 	CandidatesTokensDetails    []ModalityTokenCount `json:"candidatesTokensDetails,omitempty"`
 	ToolUsePromptTokensDetails []ModalityTokenCount `json:"toolUsePromptTokensDetails,omitempty"`
+	Extras                     messages.Extras      `json:"-"`
 }
 
 type ModalityTokenCount struct {
-	Modality   *string `json:"modality,omitempty"`
-	TokenCount *int    `json:"tokenCount,omitempty"`
+	Modality   *string         `json:"modality,omitempty"`
+	TokenCount *int            `json:"tokenCount,omitempty"`
+	Extras     messages.Extras `json:"-"`
 }
 
 type Candidate struct {
 	Content          *Content          `json:"content,omitempty"`
 	FinishReason     *string           `json:"finishReason,omitempty"`
 	CitationMetadata *CitationMetadata `json:"citationMetadata,omitempty"`
-	TokenCount       *int              `json:"tokenCount,omitempty"`
-	Index            *int              `json:"index,omitempty"`
-	FinishMessage    *string           `json:"finishMessage,omitempty"`
-	AvgLogprobs      *float32          `json:"avgLogprobs,omitempty"`
+	// googleSearch 等工具的搜索结果与回答片段的对应关系
+	GroundingMetadata *GroundingMetadata `json:"groundingMetadata,omitempty"`
+	TokenCount        *int               `json:"tokenCount,omitempty"`
+	Index             *int               `json:"index,omitempty"`
+	FinishMessage     *string            `json:"finishMessage,omitempty"`
+	AvgLogprobs       *float32           `json:"avgLogprobs,omitempty"`
+	SafetyRatings     []SafetyRating     `json:"safetyRatings,omitempty"`
+	LogprobsResult    *LogprobsResult    `json:"logprobsResult,omitempty"`
+	Extras            messages.Extras    `json:"-"`
+}
+
+// PromptFeedback blockReason 不为空时提示词被拦截，没有候选
+// blockReason: SAFETY、OTHER、BLOCKLIST、PROHIBITED_CONTENT、IMAGE_SAFETY
+type PromptFeedback struct {
+	BlockReason   string          `json:"blockReason,omitempty"`
+	SafetyRatings []SafetyRating  `json:"safetyRatings,omitempty"`
+	Extras        messages.Extras `json:"-"`
+}
+
+// SafetyRating probability: NEGLIGIBLE、LOW、MEDIUM、HIGH
+type SafetyRating struct {
+	Category    string          `json:"category,omitempty"`
+	Probability string          `json:"probability,omitempty"`
+	Blocked     bool            `json:"blocked,omitempty"`
+	Extras      messages.Extras `json:"-"`
+}
+
+type LogprobsResult struct {
+	TopCandidates    []TopCandidates    `json:"topCandidates,omitempty"`
+	ChosenCandidates []LogprobCandidate `json:"chosenCandidates,omitempty"`
+	Extras           messages.Extras    `json:"-"`
+}
+
+type TopCandidates struct {
+	Candidates []LogprobCandidate `json:"candidates,omitempty"`
+	Extras     messages.Extras    `json:"-"`
+}
+
+type LogprobCandidate struct {
+	Token          string          `json:"token,omitempty"`
+	TokenId        *int            `json:"tokenId,omitempty"`
+	LogProbability *float32        `json:"logProbability,omitempty"`
+	Extras         messages.Extras `json:"-"`
 }
 
 type CitationMetadata struct {
 	CitationSources []CitationSource `json:"citationSources,omitempty"`
+	Extras          messages.Extras  `json:"-"`
+}
+
+type GroundingMetadata struct {
+	WebSearchQueries  []string           `json:"webSearchQueries,omitempty"`
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports,omitempty"`
+	SearchEntryPoint  *map[string]any    `json:"searchEntryPoint,omitempty"`
+	Extras            messages.Extras    `json:"-"`
+}
+
+type GroundingChunk struct {
+	Web    *GroundingChunkWeb `json:"web,omitempty"`
+	Extras messages.Extras    `json:"-"`
+}
+
+type GroundingChunkWeb struct {
+	Uri    string          `json:"uri,omitempty"`
+	Title  string          `json:"title,omitempty"`
+	Extras messages.Extras `json:"-"`
+}
+
+// GroundingSupport 回答片段由哪些 groundingChunks 支持
+type GroundingSupport struct {
+	Segment               *Segment        `json:"segment,omitempty"`
+	GroundingChunkIndices []int           `json:"groundingChunkIndices,omitempty"`
+	ConfidenceScores      []float32       `json:"confidenceScores,omitempty"`
+	Extras                messages.Extras `json:"-"`
+}
+
+// Segment startIndex、endIndex 为字节位置
+type Segment struct {
+	PartIndex  *int            `json:"partIndex,omitempty"`
+	StartIndex *int            `json:"startIndex,omitempty"`
+	EndIndex   *int            `json:"endIndex,omitempty"`
+	Text       string          `json:"text,omitempty"`
+	Extras     messages.Extras `json:"-"`
 }
 
 type CitationSource struct {
-	StartIndex *int    `json:"startIndex,omitempty"`
-	EndIndex   *int    `json:"endIndex,omitempty"`
-	Uri        *string `json:"uri,omitempty"`
-	License    *string `json:"license,omitempty"`
+	StartIndex *int            `json:"startIndex,omitempty"`
+	EndIndex   *int            `json:"endIndex,omitempty"`
+	Uri        *string         `json:"uri,omitempty"`
+	License    *string         `json:"license,omitempty"`
+	Extras     messages.Extras `json:"-"`
 }
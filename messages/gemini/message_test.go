@@ -8,8 +8,8 @@ import (
 
 func TestJsonParametersJsonSchema(t *testing.T) {
 	paramsSchema := ParametersJsonSchema{
-		Type: "object",
-		Properties: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
 			"name": map[string]any{
 				"type": "string",
 			},
@@ -17,7 +17,7 @@ func TestJsonParametersJsonSchema(t *testing.T) {
 				"type": "integer",
 			},
 		},
-		Required: []string{"name"},
+		"required": []string{"name"},
 	}
 	// JSON 序列化
 	jsonData, err := json.Marshal(paramsSchema)
@@ -118,3 +118,52 @@ func TestJsonResponseSerializeDeserialize(t *testing.T) {
 
 	t.Log("序列化完成，已写入 gemini_resp_de.json")
 }
+
+func TestJsonApiModels(t *testing.T) {
+	body := `{"requests":[{"model":"models/text-embedding-004","content":{"parts":[{"text":"hello"}]},"taskType":"RETRIEVAL_DOCUMENT","title":"doc","outputDimensionality":256}]}`
+	var batch BatchEmbedContentsRequest
+	if err := json.Unmarshal([]byte(body), &batch); err != nil {
+		t.Fatalf("JSON 反序列化失败: %v", err)
+	}
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatalf("JSON 序列化失败: %v", err)
+	}
+	if string(jsonData) != body {
+		t.Fatalf("batchEmbedContents 序列化结果不一致: %s", jsonData)
+	}
+
+	body = `{"generateContentRequest":{"model":"models/gemini-2.5-flash","contents":[{"role":"user","parts":[{"text":"hi"}]}],"cachedContent":"cachedContents/abc"}}`
+	var count CountTokensRequest
+	if err := json.Unmarshal([]byte(body), &count); err != nil {
+		t.Fatalf("JSON 反序列化失败: %v", err)
+	}
+	if count.GenerateContentRequest.Model != "models/gemini-2.5-flash" || count.GenerateContentRequest.CachedContent != "cachedContents/abc" {
+		t.Fatalf("countTokens 反序列化错误: %+v", count.GenerateContentRequest)
+	}
+
+	body = `{"models":[{"name":"models/gemini-2.5-flash","inputTokenLimit":1048576,"supportedGenerationMethods":["generateContent","countTokens"]}],"nextPageToken":"next"}`
+	var models ListModelsResponse
+	if err := json.Unmarshal([]byte(body), &models); err != nil {
+		t.Fatalf("JSON 反序列化失败: %v", err)
+	}
+	if jsonData, _ := json.Marshal(models); string(jsonData) != body {
+		t.Fatalf("models.list 序列化结果不一致: %s", jsonData)
+	}
+}
+
+func TestJsonUnknownFields(t *testing.T) {
+	body := `{"contents":[{"parts":[{"text":"hi","videoMetadata":{"fps":1}}],"role":"user"}],"futureField":{"a":1}}`
+	var request Request
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		t.Fatalf("JSON 反序列化失败: %v", err)
+	}
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("JSON 序列化失败: %v", err)
+	}
+	want := `{"contents":[{"role":"user","parts":[{"text":"hi","videoMetadata":{"fps":1}}]}],"futureField":{"a":1}}`
+	if string(jsonData) != want {
+		t.Fatalf("未建模字段丢失: %s", jsonData)
+	}
+}
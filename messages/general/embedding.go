@@ -0,0 +1,44 @@
+package general
+
+import "github.com/lijcoder/aiapi/messages"
+
+/*
+通用 embeddings 请求与响应
+*/
+
+// EmbeddingRequest 每个输入是一个 Content，openai 的 token 数组输入只能发往 openai 兼容的上游
+type EmbeddingRequest struct {
+	Model  string    `json:"model,omitempty"`
+	Inputs []Content `json:"inputs,omitempty"`
+	Tokens [][]int   `json:"tokens,omitempty"`
+	// 客户端是否按列表请求，决定 gemini 输出 embedContent 还是 batchEmbedContents 的格式
+	Batch bool `json:"batch,omitempty"`
+	// 任务类型 RETRIEVAL_QUERY、RETRIEVAL_DOCUMENT 等，只有 gemini 支持
+	TaskType string `json:"taskType,omitempty"`
+	Title    string `json:"title,omitempty"`
+	// 输出维度
+	Dimensions *int `json:"dimensions,omitempty"`
+	// 客户端要求的向量编码 float、base64，只有 openai 支持
+	EncodingFormat string          `json:"encodingFormat,omitempty"`
+	Extras         messages.Extras `json:"-"`
+}
+
+type EmbeddingResponse struct {
+	Model      string          `json:"model,omitempty"`
+	Embeddings []Embedding     `json:"embeddings,omitempty"`
+	Usage      *Usage          `json:"usage,omitempty"`
+	Extras     messages.Extras `json:"-"`
+}
+
+// Embedding index 为对应输入在请求中的位置
+type Embedding struct {
+	Index  int             `json:"index"`
+	Values []float32       `json:"values"`
+	Extras messages.Extras `json:"-"`
+}
+
+// 向量编码
+const (
+	EncodingFormatFloat  = "float"
+	EncodingFormatBase64 = "base64"
+)
@@ -0,0 +1,245 @@
+package general
+
+import "github.com/lijcoder/aiapi/messages"
+
+// 以下方法保留未建模字段，见 messages.Extras
+
+func (r Request) MarshalJSON() ([]byte, error) {
+	type alias Request
+	return messages.MarshalExtras(alias(r), r.Extras)
+}
+
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type alias Request
+	return messages.UnmarshalExtras(data, (*alias)(r), &r.Extras)
+}
+
+func (c Content) MarshalJSON() ([]byte, error) {
+	type alias Content
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	type alias Content
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (p Part) MarshalJSON() ([]byte, error) {
+	type alias Part
+	return messages.MarshalExtras(alias(p), p.Extras)
+}
+
+func (p *Part) UnmarshalJSON(data []byte) error {
+	type alias Part
+	return messages.UnmarshalExtras(data, (*alias)(p), &p.Extras)
+}
+
+func (b Blob) MarshalJSON() ([]byte, error) {
+	type alias Blob
+	return messages.MarshalExtras(alias(b), b.Extras)
+}
+
+func (b *Blob) UnmarshalJSON(data []byte) error {
+	type alias Blob
+	return messages.UnmarshalExtras(data, (*alias)(b), &b.Extras)
+}
+
+func (f FileData) MarshalJSON() ([]byte, error) {
+	type alias FileData
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FileData) UnmarshalJSON(data []byte) error {
+	type alias FileData
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (e ExecutableCode) MarshalJSON() ([]byte, error) {
+	type alias ExecutableCode
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *ExecutableCode) UnmarshalJSON(data []byte) error {
+	type alias ExecutableCode
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
+
+func (c CodeExecutionResult) MarshalJSON() ([]byte, error) {
+	type alias CodeExecutionResult
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *CodeExecutionResult) UnmarshalJSON(data []byte) error {
+	type alias CodeExecutionResult
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (f FunctionCall) MarshalJSON() ([]byte, error) {
+	type alias FunctionCall
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionCall) UnmarshalJSON(data []byte) error {
+	type alias FunctionCall
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (f FunctionResponse) MarshalJSON() ([]byte, error) {
+	type alias FunctionResponse
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionResponse) UnmarshalJSON(data []byte) error {
+	type alias FunctionResponse
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (f FunctionResponseContent) MarshalJSON() ([]byte, error) {
+	type alias FunctionResponseContent
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionResponseContent) UnmarshalJSON(data []byte) error {
+	type alias FunctionResponseContent
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (t Tool) MarshalJSON() ([]byte, error) {
+	type alias Tool
+	return messages.MarshalExtras(alias(t), t.Extras)
+}
+
+func (t *Tool) UnmarshalJSON(data []byte) error {
+	type alias Tool
+	return messages.UnmarshalExtras(data, (*alias)(t), &t.Extras)
+}
+
+func (f FunctionDeclaration) MarshalJSON() ([]byte, error) {
+	type alias FunctionDeclaration
+	return messages.MarshalExtras(alias(f), f.Extras)
+}
+
+func (f *FunctionDeclaration) UnmarshalJSON(data []byte) error {
+	type alias FunctionDeclaration
+	return messages.UnmarshalExtras(data, (*alias)(f), &f.Extras)
+}
+
+func (t ToolConfig) MarshalJSON() ([]byte, error) {
+	type alias ToolConfig
+	return messages.MarshalExtras(alias(t), t.Extras)
+}
+
+func (t *ToolConfig) UnmarshalJSON(data []byte) error {
+	type alias ToolConfig
+	return messages.UnmarshalExtras(data, (*alias)(t), &t.Extras)
+}
+
+func (g GenerationConfig) MarshalJSON() ([]byte, error) {
+	type alias GenerationConfig
+	return messages.MarshalExtras(alias(g), g.Extras)
+}
+
+func (g *GenerationConfig) UnmarshalJSON(data []byte) error {
+	type alias GenerationConfig
+	return messages.UnmarshalExtras(data, (*alias)(g), &g.Extras)
+}
+
+func (s SpeechConfig) MarshalJSON() ([]byte, error) {
+	type alias SpeechConfig
+	return messages.MarshalExtras(alias(s), s.Extras)
+}
+
+func (s *SpeechConfig) UnmarshalJSON(data []byte) error {
+	type alias SpeechConfig
+	return messages.UnmarshalExtras(data, (*alias)(s), &s.Extras)
+}
+
+func (r ResponseFormat) MarshalJSON() ([]byte, error) {
+	type alias ResponseFormat
+	return messages.MarshalExtras(alias(r), r.Extras)
+}
+
+func (r *ResponseFormat) UnmarshalJSON(data []byte) error {
+	type alias ResponseFormat
+	return messages.UnmarshalExtras(data, (*alias)(r), &r.Extras)
+}
+
+func (r ReasoningConfig) MarshalJSON() ([]byte, error) {
+	type alias ReasoningConfig
+	return messages.MarshalExtras(alias(r), r.Extras)
+}
+
+func (r *ReasoningConfig) UnmarshalJSON(data []byte) error {
+	type alias ReasoningConfig
+	return messages.UnmarshalExtras(data, (*alias)(r), &r.Extras)
+}
+
+func (r Response) MarshalJSON() ([]byte, error) {
+	type alias Response
+	return messages.MarshalExtras(alias(r), r.Extras)
+}
+
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type alias Response
+	return messages.UnmarshalExtras(data, (*alias)(r), &r.Extras)
+}
+
+func (c Candidate) MarshalJSON() ([]byte, error) {
+	type alias Candidate
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *Candidate) UnmarshalJSON(data []byte) error {
+	type alias Candidate
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (c Citation) MarshalJSON() ([]byte, error) {
+	type alias Citation
+	return messages.MarshalExtras(alias(c), c.Extras)
+}
+
+func (c *Citation) UnmarshalJSON(data []byte) error {
+	type alias Citation
+	return messages.UnmarshalExtras(data, (*alias)(c), &c.Extras)
+}
+
+func (u Usage) MarshalJSON() ([]byte, error) {
+	type alias Usage
+	return messages.MarshalExtras(alias(u), u.Extras)
+}
+
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	type alias Usage
+	return messages.UnmarshalExtras(data, (*alias)(u), &u.Extras)
+}
+
+func (e EmbeddingRequest) MarshalJSON() ([]byte, error) {
+	type alias EmbeddingRequest
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *EmbeddingRequest) UnmarshalJSON(data []byte) error {
+	type alias EmbeddingRequest
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
+
+func (e EmbeddingResponse) MarshalJSON() ([]byte, error) {
+	type alias EmbeddingResponse
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *EmbeddingResponse) UnmarshalJSON(data []byte) error {
+	type alias EmbeddingResponse
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
+
+func (e Embedding) MarshalJSON() ([]byte, error) {
+	type alias Embedding
+	return messages.MarshalExtras(alias(e), e.Extras)
+}
+
+func (e *Embedding) UnmarshalJSON(data []byte) error {
+	type alias Embedding
+	return messages.UnmarshalExtras(data, (*alias)(e), &e.Extras)
+}
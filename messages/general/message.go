@@ -5,61 +5,132 @@ general message api
 role type: system、assistant、user
 */
 
+import "github.com/lijcoder/aiapi/messages"
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
 /* request params */
 type Request struct {
 	Stream            bool              `json:"stream,omitempty"`
 	Model             string            `json:"model,omitempty"`
 	Contents          []Content         `json:"contents,omitempty"`
 	Tools             []Tool            `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig       `json:"toolConfig,omitempty"`
 	SystemInstruction *Content          `json:"systemInstruction,omitempty"`
 	GenerationConfig  *GenerationConfig `json:"generationConfig,omitempty"`
+	// Responses API 引用的上一轮响应，上游同样使用 Responses API 时直接传递，否则由网关保存的对话补齐历史
+	PreviousResponseId string `json:"previousResponseId,omitempty"`
+	// 是否保存本轮对话供之后引用，为空时保存
+	Store  *bool           `json:"store,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type Content struct {
-	Role  string `json:"role,omitempty"`
-	Parts []Part `json:"parts,omitempty"`
+	Role   string          `json:"role,omitempty"`
+	Parts  []Part          `json:"parts,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type Part struct {
-	Text             *string           `json:"text,omitempty"`
-	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
-	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	Text                *string              `json:"text,omitempty"`
+	InlineData          *Blob                `json:"inlineData,omitempty"`
+	FileData            *FileData            `json:"fileData,omitempty"`
+	FunctionCall        *FunctionCall        `json:"functionCall,omitempty"`
+	FunctionResponse    *FunctionResponse    `json:"functionResponse,omitempty"`
+	ExecutableCode      *ExecutableCode      `json:"executableCode,omitempty"`
+	CodeExecutionResult *CodeExecutionResult `json:"codeExecutionResult,omitempty"`
+	// 思考内容与签名，多轮对话时需要原样回传
+	Thought          *bool           `json:"thought,omitempty"`
+	ThoughtSignature *string         `json:"thoughtSignature,omitempty"`
+	Extras           messages.Extras `json:"-"`
+}
+
+// Blob 内联二进制数据，data 为 base64
+type Blob struct {
+	MimeType string          `json:"mimeType,omitempty"`
+	Data     string          `json:"data,omitempty"`
+	Extras   messages.Extras `json:"-"`
+}
+
+// FileData 文件引用
+type FileData struct {
+	MimeType string          `json:"mimeType,omitempty"`
+	FileUri  string          `json:"fileUri,omitempty"`
+	Extras   messages.Extras `json:"-"`
+}
+
+type ExecutableCode struct {
+	Language string          `json:"language,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Extras   messages.Extras `json:"-"`
+}
+
+// CodeExecutionResult outcome: OUTCOME_OK、OUTCOME_FAILED、OUTCOME_DEADLINE_EXCEEDED
+type CodeExecutionResult struct {
+	Outcome string          `json:"outcome,omitempty"`
+	Output  string          `json:"output,omitempty"`
+	Extras  messages.Extras `json:"-"`
 }
 
 type FunctionCall struct {
-	Id   string         `json:"id,omitempty"`
-	Name string         `json:"name,omitempty"`
-	Args map[string]any `json:"args,omitempty"`
+	Id     string          `json:"id,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Args   map[string]any  `json:"args,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type FunctionResponse struct {
 	Id       string                  `json:"id,omitempty"`
 	Name     string                  `json:"name,omitempty"`
 	Response FunctionResponseContent `json:"response,omitempty"`
+	Extras   messages.Extras         `json:"-"`
 }
 
 type FunctionResponseContent struct {
-	Output *string `json:"output,omitempty"`
-	Error  *string `json:"error,omitempty"`
+	Output *string         `json:"output,omitempty"`
+	Error  *string         `json:"error,omitempty"`
+	Extras messages.Extras `json:"-"`
 }
 
 type Tool struct {
 	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
-	WebSearch            *bool                 `json:"webSearch,omitempty"`
+	// 内置工具，由模型服务执行
+	WebSearch     *bool           `json:"webSearch,omitempty"`
+	CodeExecution *bool           `json:"codeExecution,omitempty"`
+	UrlContext    *bool           `json:"urlContext,omitempty"`
+	Extras        messages.Extras `json:"-"`
 }
 
 type FunctionDeclaration struct {
-	Name        string                `json:"name,omitempty"`
-	Description string                `json:"description,omitempty"`
-	Parameters  *ParametersJsonSchema `json:"parameters,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Parameters  ParametersJsonSchema `json:"parameters,omitempty"`
+	Extras      messages.Extras      `json:"-"`
 }
 
-type ParametersJsonSchema struct {
-	Type       string         `json:"type,omitempty"`
-	Properties map[string]any `json:"properties,omitempty"`
-	Required   []string       `json:"required,omitempty"`
+// 工具调用模式
+const (
+	ToolModeAuto     = "auto"
+	ToolModeNone     = "none"
+	ToolModeRequired = "required"
+)
+
+// ToolConfig mode 为空时使用协议默认值；AllowedFunctionNames 限制 required 时可调用的函数
+type ToolConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	// 是否允许一轮返回多个函数调用，gemini 不支持配置
+	ParallelToolCalls *bool           `json:"parallelToolCalls,omitempty"`
+	Extras            messages.Extras `json:"-"`
 }
 
+// ParametersJsonSchema 完整的 JSON Schema，按上游协议转换时再降级
+type ParametersJsonSchema map[string]any
+
 type GenerationConfig struct {
 	StopSequences    []string `json:"stopSequences,omitempty"`
 	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
@@ -69,6 +140,115 @@ type GenerationConfig struct {
 	PresencePenalty  *float32 `json:"presencePenalty,omitempty"`
 	FrequencyPenalty *float32 `json:"frequencyPenalty,omitempty"`
 	Logprobs         *int     `json:"logprobs,omitempty"`
+	// 推理配置
+	Reasoning *ReasoningConfig `json:"reasoning,omitempty"`
+	// 结构化输出
+	ResponseFormat *ResponseFormat `json:"responseFormat,omitempty"`
+	// 候选数量
+	CandidateCount *int `json:"candidateCount,omitempty"`
+	Seed           *int `json:"seed,omitempty"`
+	// 输出模态 text、image、audio
+	ResponseModalities []string        `json:"responseModalities,omitempty"`
+	Speech             *SpeechConfig   `json:"speech,omitempty"`
+	Extras             messages.Extras `json:"-"`
 }
 
+// SpeechConfig 语音输出配置
+type SpeechConfig struct {
+	Voice        string          `json:"voice,omitempty"`
+	LanguageCode string          `json:"languageCode,omitempty"`
+	Extras       messages.Extras `json:"-"`
+}
+
+// 输出模态
+const (
+	ModalityText  = "text"
+	ModalityImage = "image"
+	ModalityAudio = "audio"
+)
+
+// ResponseFormat type: text、json_object、json_schema
+type ResponseFormat struct {
+	Type        string         `json:"type,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	// 是否严格按 schema 输出
+	Strict *bool           `json:"strict,omitempty"`
+	Extras messages.Extras `json:"-"`
+}
+
+// 结构化输出类型
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJsonObject = "json_object"
+	ResponseFormatJsonSchema = "json_schema"
+)
+
+// ReasoningConfig effort 与 budgetTokens 同时设置时优先使用 budgetTokens
+type ReasoningConfig struct {
+	// 推理强度 none、minimal、low、medium、high
+	Effort string `json:"effort,omitempty"`
+	// 推理 token 预算，0 关闭推理，-1 由模型决定
+	BudgetTokens *int `json:"budgetTokens,omitempty"`
+	// 是否在响应中返回思考内容
+	IncludeThoughts *bool           `json:"includeThoughts,omitempty"`
+	Extras          messages.Extras `json:"-"`
+}
+
+// 推理强度
+const (
+	ReasoningEffortNone    = "none"
+	ReasoningEffortMinimal = "minimal"
+	ReasoningEffortLow     = "low"
+	ReasoningEffortMedium  = "medium"
+	ReasoningEffortHigh    = "high"
+)
+
 /* response params */
+type Response struct {
+	Id         string          `json:"id,omitempty"`
+	Model      string          `json:"model,omitempty"`
+	Candidates []Candidate     `json:"candidates,omitempty"`
+	Usage      *Usage          `json:"usage,omitempty"`
+	Extras     messages.Extras `json:"-"`
+}
+
+type Candidate struct {
+	Index        int      `json:"index,omitempty"`
+	Content      *Content `json:"content,omitempty"`
+	FinishReason string   `json:"finishReason,omitempty"`
+	// 联网搜索等内置工具返回的引用来源与搜索词
+	Citations     []Citation      `json:"citations,omitempty"`
+	SearchQueries []string        `json:"searchQueries,omitempty"`
+	Extras        messages.Extras `json:"-"`
+}
+
+// Citation StartIndex、EndIndex 为引用在回答文本中的字节位置，未知时为空；Text 为被引用的回答片段
+type Citation struct {
+	StartIndex *int            `json:"startIndex,omitempty"`
+	EndIndex   *int            `json:"endIndex,omitempty"`
+	Uri        string          `json:"uri,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Text       string          `json:"text,omitempty"`
+	Extras     messages.Extras `json:"-"`
+}
+
+// 结束原因
+const (
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonToolCalls     = "tool_calls"
+	FinishReasonContentFilter = "content_filter"
+	FinishReasonError         = "error"
+)
+
+type Usage struct {
+	PromptTokens     int `json:"promptTokens,omitempty"`
+	CompletionTokens int `json:"completionTokens,omitempty"`
+	TotalTokens      int `json:"totalTokens,omitempty"`
+	CachedTokens     int `json:"cachedTokens,omitempty"`
+	// 推理消耗的 token，已包含在 completionTokens 中
+	ReasoningTokens int             `json:"reasoningTokens,omitempty"`
+	Extras          messages.Extras `json:"-"`
+}
@@ -0,0 +1,129 @@
+package ollama
+
+/*
+Ollama API
+https://github.com/ollama/ollama/blob/main/docs/api.md
+stream 默认为 true，流式响应为 NDJSON，最后一行 done 为 true 并带上用量
+*/
+
+import "encoding/json"
+
+/* request params */
+
+// ChatRequest /api/chat
+type ChatRequest struct {
+	Model    string    `json:"model,omitempty"`
+	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	// json 或 JSON Schema
+	Format    json.RawMessage `json:"format,omitempty"`
+	Options   *Options        `json:"options,omitempty"`
+	Stream    *bool           `json:"stream,omitempty"`
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+	// 是否输出思考内容，部分模型支持 low、medium、high
+	Think json.RawMessage `json:"think,omitempty"`
+}
+
+// GenerateRequest /api/generate，context 为上一轮返回的 token 序列
+type GenerateRequest struct {
+	Model     string          `json:"model,omitempty"`
+	Prompt    string          `json:"prompt"`
+	Suffix    string          `json:"suffix,omitempty"`
+	Images    []string        `json:"images,omitempty"`
+	System    string          `json:"system,omitempty"`
+	Template  string          `json:"template,omitempty"`
+	Context   []int           `json:"context,omitempty"`
+	Raw       bool            `json:"raw,omitempty"`
+	Format    json.RawMessage `json:"format,omitempty"`
+	Options   *Options        `json:"options,omitempty"`
+	Stream    *bool           `json:"stream,omitempty"`
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+	Think     json.RawMessage `json:"think,omitempty"`
+}
+
+// Message role: system、user、assistant、tool，images 为不带 data url 前缀的 base64
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// tool 消息对应的函数名
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction arguments 为对象而不是字符串
+type ToolCallFunction struct {
+	Index     *int           `json:"index,omitempty"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// Tool type: function
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// Options 模型参数，num_predict 为最大输出 token 数，-1 不限制
+type Options struct {
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`
+	NumPredict       *int     `json:"num_predict,omitempty"`
+	NumCtx           *int     `json:"num_ctx,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+	RepeatPenalty    *float32 `json:"repeat_penalty,omitempty"`
+}
+
+/* response params */
+
+// ChatResponse 流式的每一行结构相同，done 为 true 时带上结束原因与用量，时长单位为纳秒
+type ChatResponse struct {
+	Model              string   `json:"model"`
+	CreatedAt          string   `json:"created_at"`
+	Message            *Message `json:"message,omitempty"`
+	Done               bool     `json:"done"`
+	DoneReason         string   `json:"done_reason,omitempty"`
+	TotalDuration      int64    `json:"total_duration,omitempty"`
+	LoadDuration       int64    `json:"load_duration,omitempty"`
+	PromptEvalCount    int      `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64    `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int      `json:"eval_count,omitempty"`
+	EvalDuration       int64    `json:"eval_duration,omitempty"`
+}
+
+// GenerateResponse 与 ChatResponse 相同，回答在 response 中
+type GenerateResponse struct {
+	Model              string `json:"model"`
+	CreatedAt          string `json:"created_at"`
+	Response           string `json:"response"`
+	Thinking           string `json:"thinking,omitempty"`
+	Done               bool   `json:"done"`
+	DoneReason         string `json:"done_reason,omitempty"`
+	Context            []int  `json:"context,omitempty"`
+	TotalDuration      int64  `json:"total_duration,omitempty"`
+	LoadDuration       int64  `json:"load_duration,omitempty"`
+	PromptEvalCount    int    `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int    `json:"eval_count,omitempty"`
+	EvalDuration       int64  `json:"eval_duration,omitempty"`
+}
+
+// ErrorResponse 请求错误与流式中途的错误
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
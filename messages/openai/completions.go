@@ -0,0 +1,47 @@
+package openai
+
+/*
+OpenAI 旧版文本补全接口
+https://platform.openai.com/docs/api-reference/completions
+*/
+
+// CompletionRequest prompt 为字符串或字符串数组，数组的每一项单独生成
+type CompletionRequest struct {
+	Model            string             `json:"model,omitempty"`
+	Prompt           StringOrArray      `json:"prompt,omitempty"`
+	Suffix           string             `json:"suffix,omitempty"`
+	MaxTokens        *int               `json:"max_tokens,omitempty"`
+	Temperature      *float32           `json:"temperature,omitempty"`
+	TopP             *float32           `json:"top_p,omitempty"`
+	N                *int               `json:"n,omitempty"`
+	BestOf           *int               `json:"best_of,omitempty"`
+	Stream           bool               `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions     `json:"stream_options,omitempty"`
+	Logprobs         *int               `json:"logprobs,omitempty"`
+	Echo             bool               `json:"echo,omitempty"`
+	Stop             StringOrArray      `json:"stop,omitempty"`
+	PresencePenalty  *float32           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32           `json:"frequency_penalty,omitempty"`
+	LogitBias        map[string]float32 `json:"logit_bias,omitempty"`
+	Seed             *int               `json:"seed,omitempty"`
+	User             string             `json:"user,omitempty"`
+}
+
+// CompletionResponse object: text_completion，流式的每个分片结构相同
+type CompletionResponse struct {
+	Id                string             `json:"id,omitempty"`
+	Object            string             `json:"object,omitempty"`
+	Created           int64              `json:"created,omitempty"`
+	Model             string             `json:"model,omitempty"`
+	Choices           []CompletionChoice `json:"choices"`
+	Usage             *Usage             `json:"usage,omitempty"`
+	SystemFingerprint string             `json:"system_fingerprint,omitempty"`
+}
+
+// CompletionChoice finish_reason: stop、length、content_filter
+type CompletionChoice struct {
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+/*
+OpenAI embeddings API
+https://platform.openai.com/docs/api-reference/embeddings
+*/
+
+// EmbeddingRequest encoding_format: float、base64
+type EmbeddingRequest struct {
+	Model          string         `json:"model,omitempty"`
+	Input          EmbeddingInput `json:"input"`
+	EncodingFormat string         `json:"encoding_format,omitempty"`
+	Dimensions     *int           `json:"dimensions,omitempty"`
+	User           string         `json:"user,omitempty"`
+}
+
+// EmbeddingInput input 可以是字符串、字符串数组、token 数组或 token 数组的数组，Texts 与 Tokens 只有一个有值
+type EmbeddingInput struct {
+	Texts  []string
+	Tokens [][]int
+	// 输入是否为列表
+	Batch bool
+}
+
+func (e EmbeddingInput) MarshalJSON() ([]byte, error) {
+	if e.Tokens != nil {
+		if len(e.Tokens) == 1 && !e.Batch {
+			return json.Marshal(e.Tokens[0])
+		}
+		return json.Marshal(e.Tokens)
+	}
+	if len(e.Texts) == 1 && !e.Batch {
+		return json.Marshal(e.Texts[0])
+	}
+	if e.Texts == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e.Texts)
+}
+
+func (e *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	*e = EmbeddingInput{}
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		e.Texts = []string{text}
+		return nil
+	}
+	var texts []string
+	if json.Unmarshal(data, &texts) == nil {
+		e.Texts, e.Batch = texts, true
+		return nil
+	}
+	var tokens []int
+	if json.Unmarshal(data, &tokens) == nil {
+		e.Tokens = [][]int{tokens}
+		return nil
+	}
+	var batch [][]int
+	if json.Unmarshal(data, &batch) == nil {
+		e.Tokens, e.Batch = batch, true
+		return nil
+	}
+	return errors.New("input must be a string, an array of strings or an array of token arrays")
+}
+
+// EmbeddingResponse object: list
+type EmbeddingResponse struct {
+	Object string          `json:"object,omitempty"`
+	Data   []Embedding     `json:"data"`
+	Model  string          `json:"model,omitempty"`
+	Usage  *EmbeddingUsage `json:"usage,omitempty"`
+}
+
+// Embedding encoding_format 为 base64 时 embedding 为 float32 小端序的 base64 字符串
+type Embedding struct {
+	Object    string          `json:"object,omitempty"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"`
+}
+
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
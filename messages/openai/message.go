@@ -5,12 +5,307 @@ OpenAI AI API
 https://platform.openai.com/docs/api-reference/chat/create
 */
 
+import "encoding/json"
+
 /* request params */
 type Request struct {
-	Model    string `json:"model,omitempty"`
-	Messages []any  `json:"messages,omitempty"`
+	Model               string         `json:"model,omitempty"`
+	Messages            []Message      `json:"messages,omitempty"`
+	Stream              bool           `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions `json:"stream_options,omitempty"`
+	Tools               []Tool         `json:"tools,omitempty"`
+	ToolChoice          *ToolChoice    `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool          `json:"parallel_tool_calls,omitempty"`
+	MaxTokens           *int           `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int           `json:"max_completion_tokens,omitempty"`
+	Temperature         *float32       `json:"temperature,omitempty"`
+	TopP                *float32       `json:"top_p,omitempty"`
+	Stop                StringOrArray  `json:"stop,omitempty"`
+	PresencePenalty     *float32       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float32       `json:"frequency_penalty,omitempty"`
+	Logprobs            *bool          `json:"logprobs,omitempty"`
+	TopLogprobs         *int           `json:"top_logprobs,omitempty"`
+	N                   *int           `json:"n,omitempty"`
+	Seed                *int           `json:"seed,omitempty"`
+	User                string         `json:"user,omitempty"`
+	// 推理强度 none、minimal、low、medium、high
+	ReasoningEffort string          `json:"reasoning_effort,omitempty"`
+	ResponseFormat  *ResponseFormat `json:"response_format,omitempty"`
+	// 联网搜索，只有 search 系列模型支持
+	WebSearchOptions *WebSearchOptions `json:"web_search_options,omitempty"`
+	// 输出模态 text、audio，audio 需要同时设置 audio 参数
+	Modalities []string      `json:"modalities,omitempty"`
+	Audio      *AudioOptions `json:"audio,omitempty"`
+}
+
+// AudioOptions format: wav、mp3、flac、opus、pcm16
+type AudioOptions struct {
+	Voice  string `json:"voice,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// WebSearchOptions search_context_size: low、medium、high
+type WebSearchOptions struct {
+	SearchContextSize string          `json:"search_context_size,omitempty"`
+	UserLocation      *map[string]any `json:"user_location,omitempty"`
+}
+
+// ResponseFormat type: text、json_object、json_schema
+type ResponseFormat struct {
+	Type       string      `json:"type,omitempty"`
+	JsonSchema *JsonSchema `json:"json_schema,omitempty"`
+}
+
+type JsonSchema struct {
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// Message role: system、developer、user、assistant、tool
+type Message struct {
+	Role       string          `json:"role,omitempty"`
+	Content    *MessageContent `json:"content,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallId string          `json:"tool_call_id,omitempty"`
+	// 兼容 deepseek、vllm 等返回思考内容的服务
+	ReasoningContent *string `json:"reasoning_content,omitempty"`
+	// 联网搜索的引用，只出现在响应中
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Annotation type: url_citation
+type Annotation struct {
+	Type        string       `json:"type"`
+	UrlCitation *UrlCitation `json:"url_citation,omitempty"`
+}
+
+// UrlCitation start_index、end_index 为字符位置
+type UrlCitation struct {
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+	Url        string `json:"url"`
+	Title      string `json:"title"`
+}
+
+// MessageContent content 可以是字符串或 content part 数组
+type MessageContent struct {
+	Text  *string
+	Parts []ContentPart
+}
+
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	if c.Text != nil {
+		return json.Marshal(*c.Text)
+	}
+	return []byte("null"), nil
+}
+
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		c.Text = &text
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &c.Parts)
+}
+
+// ContentPart type: text、image_url、input_audio、file
+type ContentPart struct {
+	Type       string      `json:"type,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	ImageUrl   *ImageUrl   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *File       `json:"file,omitempty"`
+}
+
+// ImageUrl url 可以是 http 地址或 data:image/png;base64,... 形式
+type ImageUrl struct {
+	Url    string `json:"url,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// InputAudio format: wav、mp3
+type InputAudio struct {
+	Data   string `json:"data,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// File file_data 为 data url
+type File struct {
+	FileData string `json:"file_data,omitempty"`
+	FileId   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	Id       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type Tool struct {
+	Type     string              `json:"type,omitempty"`
+	Function *FunctionDefinition `json:"function,omitempty"`
+}
+
+type FunctionDefinition struct {
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  *map[string]any `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// ToolChoice 字符串 none、auto、required，或对象
+// {"type":"function","function":{"name":"x"}}、{"type":"allowed_tools","allowed_tools":{"mode":"auto","tools":[...]}}
+type ToolChoice struct {
+	Mode         string              `json:"-"`
+	Type         string              `json:"type,omitempty"`
+	Function     *ToolChoiceFunction `json:"function,omitempty"`
+	AllowedTools *AllowedTools       `json:"allowed_tools,omitempty"`
+}
+
+type ToolChoiceFunction struct {
+	Name string `json:"name"`
+}
+
+// AllowedTools mode: auto、required
+type AllowedTools struct {
+	Mode  string `json:"mode,omitempty"`
+	Tools []Tool `json:"tools,omitempty"`
+}
+
+type toolChoiceObject ToolChoice
+
+func (c ToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Mode != "" {
+		return json.Marshal(c.Mode)
+	}
+	return json.Marshal(toolChoiceObject(c))
+}
+
+func (c *ToolChoice) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &c.Mode)
+	}
+	return json.Unmarshal(data, (*toolChoiceObject)(c))
+}
+
+// StringOrArray stop 等字段可以是字符串或字符串数组
+type StringOrArray []string
+
+func (s StringOrArray) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]string(s))
+}
+
+func (s *StringOrArray) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		*s = StringOrArray{str}
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(s))
 }
 
 /* response params */
+
+// Response object: chat.completion、chat.completion.chunk
 type Response struct {
+	Id                string   `json:"id,omitempty"`
+	Object            string   `json:"object,omitempty"`
+	Created           int64    `json:"created,omitempty"`
+	Model             string   `json:"model,omitempty"`
+	Choices           []Choice `json:"choices"`
+	Usage             *Usage   `json:"usage,omitempty"`
+	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+}
+
+// Choice 非流式使用 message，流式使用 delta
+type Choice struct {
+	Index        int      `json:"index"`
+	Message      *Message `json:"message,omitempty"`
+	Delta        *Message `json:"delta,omitempty"`
+	FinishReason *string  `json:"finish_reason"`
+}
+
+type Usage struct {
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
+
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// ErrorResponse 错误响应，流式中也可能出现
+type ErrorResponse struct {
+	Error *Error `json:"error,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Code    any    `json:"code,omitempty"`
+}
+
+/* models */
+
+// Model object: model
+type Model struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelList object: list
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+/* count_tokens */
+
+// InputTokensResponse 网关提供的 /v1/chat/completions/count_tokens 的响应，格式与 /v1/responses/input_tokens 一致
+// object: response.input_tokens
+type InputTokensResponse struct {
+	Object      string `json:"object"`
+	InputTokens int    `json:"input_tokens"`
 }
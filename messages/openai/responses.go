@@ -0,0 +1,318 @@
+package openai
+
+import "encoding/json"
+
+/*
+OpenAI Responses API
+https://platform.openai.com/docs/api-reference/responses
+输入与输出都由 item 组成：message、function_call、function_call_output、reasoning 以及内置工具的调用
+*/
+
+/* request params */
+
+// ResponsesRequest input 可以是字符串或 item 数组，previous_response_id 引用上一轮的响应继续对话
+type ResponsesRequest struct {
+	Model              string              `json:"model,omitempty"`
+	Input              ResponseInput       `json:"input,omitzero"`
+	Instructions       string              `json:"instructions,omitempty"`
+	PreviousResponseId string              `json:"previous_response_id,omitempty"`
+	Tools              []ResponseTool      `json:"tools,omitempty"`
+	ToolChoice         *ResponseToolChoice `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	MaxOutputTokens    *int                `json:"max_output_tokens,omitempty"`
+	Temperature        *float32            `json:"temperature,omitempty"`
+	TopP               *float32            `json:"top_p,omitempty"`
+	Reasoning          *ResponseReasoning  `json:"reasoning,omitempty"`
+	Text               *ResponseText       `json:"text,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	// 是否在服务端保存响应，保存后才能被 previous_response_id 引用
+	Store    *bool             `json:"store,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	User     string            `json:"user,omitempty"`
+	// 额外返回的内容，如 reasoning.encrypted_content
+	Include    []string `json:"include,omitempty"`
+	Truncation string   `json:"truncation,omitempty"`
+}
+
+// ResponseInput 字符串输入等同于一条 user 消息，Text 与 Items 只有一个有值
+type ResponseInput struct {
+	Text  *string
+	Items []ResponseItem
+}
+
+func (r ResponseInput) IsZero() bool {
+	return r.Text == nil && r.Items == nil
+}
+
+func (r ResponseInput) MarshalJSON() ([]byte, error) {
+	if r.Text != nil {
+		return json.Marshal(*r.Text)
+	}
+	if r.Items == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.Items)
+}
+
+func (r *ResponseInput) UnmarshalJSON(data []byte) error {
+	*r = ResponseInput{}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &r.Text)
+	}
+	return json.Unmarshal(data, &r.Items)
+}
+
+// ResponseItem 输入与输出共用的 item，type 为空且有 role 时为 message
+// type: message、function_call、function_call_output、reasoning、web_search_call、code_interpreter_call、item_reference
+type ResponseItem struct {
+	Type   string `json:"type,omitempty"`
+	Id     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+	// message，role: user、assistant、system、developer
+	Role    string           `json:"role,omitempty"`
+	Content *ResponseContent `json:"content,omitempty"`
+	// function_call、function_call_output
+	CallId    string           `json:"call_id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Arguments *string          `json:"arguments,omitempty"`
+	Output    *ResponseContent `json:"output,omitempty"`
+	// reasoning，encrypted_content 在多轮对话中原样回传
+	Summary          []ResponseSummary `json:"summary,omitempty"`
+	EncryptedContent string            `json:"encrypted_content,omitempty"`
+	// web_search_call
+	Action *ResponseSearchAction `json:"action,omitempty"`
+	// code_interpreter_call
+	Code        *string              `json:"code,omitempty"`
+	ContainerId string               `json:"container_id,omitempty"`
+	Outputs     []ResponseCodeOutput `json:"outputs,omitempty"`
+}
+
+type responseItem ResponseItem
+
+// MarshalJSON reasoning 的 summary 为必填字段，没有摘要时输出空数组
+func (r ResponseItem) MarshalJSON() ([]byte, error) {
+	if r.Type != "reasoning" || r.Summary != nil {
+		return json.Marshal(responseItem(r))
+	}
+	return json.Marshal(struct {
+		responseItem
+		Summary []ResponseSummary `json:"summary"`
+	}{responseItem: responseItem(r), Summary: []ResponseSummary{}})
+}
+
+// ResponseContent 内容可以是字符串或 content part 数组，Text 与 Parts 只有一个有值
+type ResponseContent struct {
+	Text  *string
+	Parts []ResponseContentPart
+}
+
+func (c ResponseContent) MarshalJSON() ([]byte, error) {
+	if c.Text != nil {
+		return json.Marshal(*c.Text)
+	}
+	if c.Parts == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(c.Parts)
+}
+
+func (c *ResponseContent) UnmarshalJSON(data []byte) error {
+	*c = ResponseContent{}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &c.Text)
+	}
+	return json.Unmarshal(data, &c.Parts)
+}
+
+// ResponseContentPart type: input_text、input_image、input_file、output_text、refusal
+// input_image 的 image_url 为 http 地址或 data url，detail: low、high、auto
+type ResponseContentPart struct {
+	Type        string               `json:"type"`
+	Text        *string              `json:"text,omitempty"`
+	Annotations []ResponseAnnotation `json:"annotations,omitempty"`
+	Refusal     string               `json:"refusal,omitempty"`
+	ImageUrl    string               `json:"image_url,omitempty"`
+	Detail      string               `json:"detail,omitempty"`
+	FileId      string               `json:"file_id,omitempty"`
+	FileData    string               `json:"file_data,omitempty"`
+	FileUrl     string               `json:"file_url,omitempty"`
+	Filename    string               `json:"filename,omitempty"`
+}
+
+type responseContentPart ResponseContentPart
+
+// MarshalJSON output_text 的 text 与 annotations 为必填字段
+func (p ResponseContentPart) MarshalJSON() ([]byte, error) {
+	if p.Type != "output_text" {
+		return json.Marshal(responseContentPart(p))
+	}
+	text := ""
+	if p.Text != nil {
+		text = *p.Text
+	}
+	annotations := p.Annotations
+	if annotations == nil {
+		annotations = []ResponseAnnotation{}
+	}
+	return json.Marshal(struct {
+		responseContentPart
+		Text        string               `json:"text"`
+		Annotations []ResponseAnnotation `json:"annotations"`
+	}{responseContentPart: responseContentPart(p), Text: text, Annotations: annotations})
+}
+
+// ResponseAnnotation type: url_citation，位置按字符计算，相对于所在 content part 的文本
+type ResponseAnnotation struct {
+	Type       string `json:"type"`
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+	Url        string `json:"url,omitempty"`
+	Title      string `json:"title,omitempty"`
+}
+
+// ResponseSummary 推理摘要，type: summary_text
+type ResponseSummary struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ResponseSearchAction type: search、open_page、find
+type ResponseSearchAction struct {
+	Type  string `json:"type,omitempty"`
+	Query string `json:"query,omitempty"`
+	Url   string `json:"url,omitempty"`
+}
+
+// ResponseCodeOutput type: logs、image
+type ResponseCodeOutput struct {
+	Type string `json:"type"`
+	Logs string `json:"logs,omitempty"`
+	Url  string `json:"url,omitempty"`
+}
+
+// ResponseTool type: function、web_search、web_search_preview、code_interpreter、file_search 等
+// function 的定义与 chat completions 不同，name、parameters 直接放在 tool 中
+type ResponseTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  *map[string]any `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+	// code_interpreter 的运行容器，{"type":"auto"} 或容器 id
+	Container         json.RawMessage `json:"container,omitempty"`
+	SearchContextSize string          `json:"search_context_size,omitempty"`
+}
+
+// ResponseToolChoice 字符串 none、auto、required，或对象
+// {"type":"function","name":"x"}、{"type":"allowed_tools","mode":"auto","tools":[...]}、{"type":"web_search"}
+type ResponseToolChoice struct {
+	Mode  string         `json:"-"`
+	Type  string         `json:"type,omitempty"`
+	Name  string         `json:"name,omitempty"`
+	Tools []ResponseTool `json:"tools,omitempty"`
+	// allowed_tools 的 mode 与字符串形式的 Mode 区分
+	AllowedMode string `json:"mode,omitempty"`
+}
+
+type responseToolChoice ResponseToolChoice
+
+func (c ResponseToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Mode != "" {
+		return json.Marshal(c.Mode)
+	}
+	return json.Marshal(responseToolChoice(c))
+}
+
+func (c *ResponseToolChoice) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &c.Mode)
+	}
+	return json.Unmarshal(data, (*responseToolChoice)(c))
+}
+
+// ResponseReasoning effort: none、minimal、low、medium、high，summary: auto、concise、detailed
+type ResponseReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResponseText 输出格式，verbosity: low、medium、high
+type ResponseText struct {
+	Format    *ResponseTextFormat `json:"format,omitempty"`
+	Verbosity string              `json:"verbosity,omitempty"`
+}
+
+// ResponseTextFormat type: text、json_object、json_schema，json_schema 的字段与 type 同级
+type ResponseTextFormat struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+/* response params */
+
+// ResponsesResponse object: response，status: completed、incomplete、in_progress、failed
+type ResponsesResponse struct {
+	Id                 string                     `json:"id"`
+	Object             string                     `json:"object"`
+	CreatedAt          int64                      `json:"created_at"`
+	Status             string                     `json:"status"`
+	Model              string                     `json:"model"`
+	Output             []ResponseItem             `json:"output"`
+	PreviousResponseId *string                    `json:"previous_response_id"`
+	IncompleteDetails  *ResponseIncompleteDetails `json:"incomplete_details"`
+	Error              *ResponseError             `json:"error"`
+	Usage              *ResponsesUsage            `json:"usage,omitempty"`
+}
+
+// ResponseIncompleteDetails reason: max_output_tokens、content_filter
+type ResponseIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResponsesUsage struct {
+	InputTokens         int                          `json:"input_tokens"`
+	InputTokensDetails  ResponsesInputTokensDetails  `json:"input_tokens_details"`
+	OutputTokens        int                          `json:"output_tokens"`
+	OutputTokensDetails ResponsesOutputTokensDetails `json:"output_tokens_details"`
+	TotalTokens         int                          `json:"total_tokens"`
+}
+
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// ResponseStreamEvent 流式的语义事件，SSE 的 event 与 type 相同
+// response.created、response.in_progress、response.completed、response.incomplete、response.failed 携带 response
+// response.output_item.added/done 携带 item，response.content_part.added/done 携带 part
+// response.output_text.delta、response.reasoning_summary_text.delta、response.function_call_arguments.delta 携带 delta
+type ResponseStreamEvent struct {
+	Type            string               `json:"type"`
+	SequenceNumber  int                  `json:"sequence_number"`
+	Response        *ResponsesResponse   `json:"response,omitempty"`
+	OutputIndex     *int                 `json:"output_index,omitempty"`
+	ContentIndex    *int                 `json:"content_index,omitempty"`
+	SummaryIndex    *int                 `json:"summary_index,omitempty"`
+	AnnotationIndex *int                 `json:"annotation_index,omitempty"`
+	ItemId          string               `json:"item_id,omitempty"`
+	Item            *ResponseItem        `json:"item,omitempty"`
+	Part            *ResponseContentPart `json:"part,omitempty"`
+	Delta           string               `json:"delta,omitempty"`
+	Text            *string              `json:"text,omitempty"`
+	Arguments       *string              `json:"arguments,omitempty"`
+	Annotation      *ResponseAnnotation  `json:"annotation,omitempty"`
+	// error 事件
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
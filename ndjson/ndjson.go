@@ -0,0 +1,54 @@
+package ndjson
+
+/*
+NDJSON(每行一个 JSON) 流式编解码，ollama 的流式响应使用该格式
+https://github.com/ndjson/ndjson-spec
+每一行对应一个 sse.Event 的 data，与 SSE 共用同一套流式转换
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/lijcoder/aiapi/sse"
+)
+
+const ContentType = "application/x-ndjson"
+
+// Decoder 流式 NDJSON 解析，跳过空行；最后一行没有换行时在 EOF 时仍然下发
+type Decoder struct {
+	r *bufio.Reader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next 返回下一行作为事件的 data，流结束返回 io.EOF
+func (d *Decoder) Next() (sse.Event, error) {
+	for {
+		line, err := d.r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return sse.Event{Data: line, HasData: true}, nil
+		}
+		if err != nil {
+			return sse.Event{}, err
+		}
+	}
+}
+
+// Marshal 事件的 data 输出为一行，data 中的换行会破坏分行，替换为空格(JSON 字符串内的换行已转义)
+// 只有注释的事件(心跳)没有对应格式，返回 nil
+func Marshal(event sse.Event) []byte {
+	if !event.HasData && event.Data == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	data := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(event.Data)
+	buf.WriteString(data)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,38 @@
+package ndjson
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/lijcoder/aiapi/sse"
+)
+
+func TestDecoder(t *testing.T) {
+	input := "{\"a\":1}\r\n\n{\"b\":2}\n{\"c\":3}"
+	decoder := NewDecoder(iotest.OneByteReader(strings.NewReader(input)))
+	var data []string
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, event.Data)
+	}
+	if strings.Join(data, ",") != `{"a":1},{"b":2},{"c":3}` {
+		t.Fatalf("解析结果错误: %v", data)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	if got := string(Marshal(sse.Event{Data: "{\"a\":\n1}", HasData: true})); got != "{\"a\": 1}\n" {
+		t.Fatalf("序列化错误: %q", got)
+	}
+	if Marshal(sse.Event{Comments: []string{"keep-alive"}}) != nil {
+		t.Fatal("心跳不应输出")
+	}
+}
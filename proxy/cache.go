@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lijcoder/aiapi/cache"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/ndjson"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// 缓存响应头取值
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheBypass = "bypass"
+)
+
+type CacheConfig struct {
+	Enable bool `json:"enable"`
+	// 存储方式 memory、disk，默认 memory
+	Store string `json:"store"`
+	// disk 存储目录，默认 ~/.aiapi/cache/{type}
+	Dir string `json:"dir"`
+	// 过期时间(秒)，0 不过期
+	Ttl        int `json:"ttl"`
+	MaxEntries int `json:"maxEntries"`
+	// 缓存总大小上限(MB)，0 不限制
+	MaxSize int `json:"maxSize"`
+	// 是否缓存带 tools 的请求
+	IncludeTools bool `json:"includeTools"`
+	// 是否缓存非确定性请求，默认只缓存 temperature 为 0 的请求
+	NonDeterministic bool `json:"nonDeterministic"`
+}
+
+var cacheStores sync.Map
+
+// 不需要缓存的响应头
+var cacheSkipHeaders = map[string]bool{
+	"Date":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+	"Set-Cookie":        true,
+}
+
+func getCacheStore(modelType string, config *CacheConfig) (cache.Store, error) {
+	if store, ok := cacheStores.Load(modelType); ok {
+		return store.(cache.Store), nil
+	}
+	dir := config.Dir
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".aiapi", "cache", modelType)
+	}
+	store, err := cache.New(cache.Config{
+		Store:      config.Store,
+		Dir:        dir,
+		Ttl:        time.Duration(config.Ttl) * time.Second,
+		MaxEntries: config.MaxEntries,
+		MaxBytes:   int64(config.MaxSize) * 1024 * 1024,
+	})
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := cacheStores.LoadOrStore(modelType, store)
+	return actual.(cache.Store), nil
+}
+
+func (p *ProxyDirect) cacheEnabled() bool {
+	return p.modelConfig.Cache != nil && p.modelConfig.Cache.Enable
+}
+
+// cacheLookup 先查精确缓存，再查语义缓存，命中时直接返回缓存的响应；只缓存对话生成接口
+func (p *ProxyDirect) cacheLookup(upstreamPath string) (bool, error) {
+	if !p.cacheEnabled() && !p.semanticCacheEnabled() {
+		return false, nil
+	}
+	if !convert.GenerateEndpoint(p.Dialect(), p.Request.Path) {
+		return false, nil
+	}
+	switch strings.ToLower(p.Request.Headers.Get(constant.HeaderCache)) {
+	case cacheBypass, "no-cache", "no-store":
+		p.cacheHeader(cacheBypass)
+		return false, nil
+	}
+	// 脱敏、tokenize 之后不同调用方的请求可能相同([[EMAIL_1]])，响应中还原的却是各自的原始内容，不能共享
+	if p.guardrail != nil && p.guardrail.Modified() {
+		p.cacheHeader(cacheBypass)
+		return false, nil
+	}
+	req := p.cacheRequest()
+	if req == nil {
+		p.cacheHeader(cacheBypass)
+		return false, nil
+	}
+	if hit, err := p.exactCacheLookup(req, upstreamPath); hit {
+		return true, err
+	}
+	return p.semanticCacheLookup(req)
+}
+
+// cacheRequest 判断能否缓存以及语义匹配使用的请求，经过通用格式时为执行规则之后的请求
+func (p *ProxyDirect) cacheRequest() *general.Request {
+	if p.conversion != nil {
+		return p.conversion.request
+	}
+	req, err := convert.DecodeRequest(p.Dialect(), p.Request.Path, p.Request.Body)
+	if err != nil {
+		return nil
+	}
+	return req
+}
+
+func (p *ProxyDirect) cacheHeader(value string) {
+	if p.cacheEnabled() {
+		p.Response.Header().Set(constant.HeaderCache, value)
+	}
+	if p.semanticCacheEnabled() {
+		p.Response.Header().Set(constant.HeaderSemanticCache, value)
+	}
+}
+
+func (p *ProxyDirect) exactCacheLookup(req *general.Request, upstreamPath string) (bool, error) {
+	if !p.cacheEnabled() {
+		return false, nil
+	}
+	config := p.modelConfig.Cache
+	if !cacheable(req, config.IncludeTools, config.NonDeterministic) {
+		p.Response.Header().Set(constant.HeaderCache, cacheBypass)
+		return false, nil
+	}
+	store, err := getCacheStore(p.modelConfig.Type, config)
+	if err != nil {
+		slog.Warn("cache store init fail.", "type", p.modelConfig.Type, "errStack", err)
+		return false, nil
+	}
+	key := p.exactCacheKey(req, upstreamPath)
+	if entry, ok := store.Get(key); ok {
+		p.proxyTraceLog("ResponseCache", cacheHit)
+		p.Response.Header().Set(constant.HeaderCache, cacheHit)
+		return true, p.cacheReplay(entry)
+	}
+	p.Response.Header().Set(constant.HeaderCache, cacheMiss)
+	p.cacheStore = store
+	p.cacheKey = key
+	p.cacheEntry = &cache.Entry{}
+	return false, nil
+}
+
+// exactCacheKey 按客户端请求体计算，通用格式没有的字段不同时不会命中；请求体先规范化，空白与字段顺序不影响命中
+// 同时包含协议、路由、网关 key(规则可能按 key 生效)、模型、客户端路径与查询参数、上游路径与请求体
+func (p *ProxyDirect) exactCacheKey(req *general.Request, upstreamPath string) string {
+	query := url.Values{}
+	for name, values := range p.Request.QueryParams {
+		// 凭证不参与计算
+		if name != "key" {
+			query[name] = values
+		}
+	}
+	upstreamBody := p.Request.Body
+	if p.conversion != nil {
+		upstreamBody = p.conversion.body
+	}
+	return cache.Key(p.Dialect(), p.modelConfig.Type, p.transformScope("").Key, req.Model, p.Request.Path, query.Encode(),
+		canonicalJSON(p.Request.Body), upstreamPath, canonicalJSON(upstreamBody))
+}
+
+// canonicalJSON 字段按名称排序、去掉空白，数字保持原样；无法解析时返回原始内容
+func canonicalJSON(data []byte) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return data
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return data
+	}
+	return canonical
+}
+
+// cacheable 默认只缓存确定性、无 tools 的请求
+func cacheable(req *general.Request, includeTools bool, nonDeterministic bool) bool {
+	if len(req.Tools) > 0 && !includeTools {
+		return false
+	}
+	if nonDeterministic {
+		return true
+	}
+	generationConfig := req.GenerationConfig
+	if generationConfig == nil {
+		return false
+	}
+	if generationConfig.Temperature != nil && *generationConfig.Temperature == 0 {
+		return true
+	}
+	return generationConfig.TopK != nil && *generationConfig.TopK == 1
+}
+
+// cacheReplay 流式响应按缓存的事件重新生成 SSE(NDJSON)
+func (p *ProxyDirect) cacheReplay(entry *cache.Entry) error {
+	for k, vs := range entry.Header {
+		for _, v := range vs {
+			p.Response.Header().Add(k, v)
+		}
+	}
+	p.Response.WriteStatusCode(entry.StatusCode)
+	if entry.Events == nil {
+		_, err := p.Response.Write(entry.Body)
+		return err
+	}
+	p.streamNdjson = strings.Contains(entry.Header.Get("Content-Type"), ndjson.ContentType)
+	for _, event := range entry.Events {
+		if _, err := p.Response.Write(p.marshalEvent(event)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheRecordHeader 只缓存成功的响应
+func (p *ProxyDirect) cacheRecordHeader() {
+	if p.cacheEntry == nil {
+		return
+	}
+	if p.proxyResponse.StatusCode != http.StatusOK {
+		p.cacheEntry = nil
+		return
+	}
+	p.cacheEntry.StatusCode = p.proxyResponse.StatusCode
+	p.cacheEntry.Header = http.Header{}
+	for k, vs := range p.proxyResponse.Headers {
+		if !cacheSkipHeaders[http.CanonicalHeaderKey(k)] {
+			p.cacheEntry.Header[k] = vs
+		}
+	}
+}
+
+func (p *ProxyDirect) cacheRecordEvent(event sse.Event) {
+	if p.cacheEntry == nil || event.IsComment() {
+		return
+	}
+	p.cacheEntry.Events = append(p.cacheEntry.Events, event)
+}
+
+// cacheSave 完整读取上游响应后写入缓存
+func (p *ProxyDirect) cacheSave(body []byte) {
+	if p.cacheEntry == nil {
+		return
+	}
+	p.cacheEntry.Body = body
+	if p.semanticIndex != nil {
+		p.semanticIndex.Add(p.semanticScope, p.semanticVector, p.cacheEntry)
+	}
+	if p.cacheStore != nil {
+		p.cacheStore.Set(p.cacheKey, p.cacheEntry)
+	}
+	p.cacheEntry = nil
+}
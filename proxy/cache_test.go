@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/guardrail"
+)
+
+// testCacheDirect 缓存路由的一次请求
+func testCacheDirect(t *testing.T, route string, path string, body string) (*bufferResponseWrite, error) {
+	p, writer := testProxy(route, path, strings.NewReader(body), int64(len(body)))
+	err := p.Direct()
+	return writer, err
+}
+
+func TestCacheKey(t *testing.T) {
+	server, calls := testUpstream(t, "application/json", `{"id":"1","choices":[]}`)
+	testRoutes(t, ProxyDirectModelConfig{Type: "cache-key", Domain: server.URL, Cache: &CacheConfig{Enable: true}})
+
+	body := `{"model":"m","temperature":0,"messages":[{"role":"user","content":"hi"}],"logit_bias":{"1":1}}`
+	for i, want := range []string{"miss", "hit"} {
+		writer, err := testCacheDirect(t, "cache-key", "v1/chat/completions", body)
+		if err != nil || writer.header.Get(constant.HeaderCache) != want {
+			t.Fatalf("第 %d 次请求应为 %s: %v %q", i+1, want, err, writer.header.Get(constant.HeaderCache))
+		}
+	}
+	// 空白与字段顺序不同的相同请求命中同一个缓存
+	reordered := `{ "messages": [ {"content":"hi", "role":"user"} ], "logit_bias": {"1":1}, "temperature": 0, "model": "m" }`
+	if writer, err := testCacheDirect(t, "cache-key", "v1/chat/completions", reordered); err != nil || writer.header.Get(constant.HeaderCache) != "hit" {
+		t.Fatalf("格式不同的相同请求应命中: %v %q", err, writer.header.Get(constant.HeaderCache))
+	}
+	// 通用格式没有的字段不同时不命中
+	other := strings.Replace(body, `{"1":1}`, `{"1":-1}`, 1)
+	if writer, _ := testCacheDirect(t, "cache-key", "v1/chat/completions", other); writer.header.Get(constant.HeaderCache) != "miss" {
+		t.Fatalf("logit_bias 不同不应命中: %q", writer.header.Get(constant.HeaderCache))
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("上游请求次数错误: %d", calls.Load())
+	}
+
+	// 只缓存对话生成接口
+	for range 2 {
+		if writer, _ := testCacheDirect(t, "cache-key", "v1/moderations", `{"model":"m","input":"hi"}`); writer.header.Get(constant.HeaderCache) != "" {
+			t.Fatalf("非生成接口不应缓存: %q", writer.header.Get(constant.HeaderCache))
+		}
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("非生成接口应每次请求上游: %d", calls.Load())
+	}
+}
+
+func TestCacheAfterGuardrail(t *testing.T) {
+	server, calls := testUpstream(t, "application/json", `{"id":"1","choices":[]}`)
+	testRoutes(t, ProxyDirectModelConfig{Type: "cache-guard", Domain: server.URL, Cache: &CacheConfig{Enable: true}})
+	body := `{"model":"m","temperature":0,"messages":[{"role":"user","content":"secret plan"}]}`
+	if writer, err := testCacheDirect(t, "cache-guard", "v1/chat/completions", body); err != nil || writer.header.Get(constant.HeaderCache) != "miss" {
+		t.Fatalf("第一次请求应写入缓存: %v", err)
+	}
+
+	// 规则生效之后，已缓存的响应同样不能返回
+	set, err := guardrail.New([]guardrail.Policy{{Rules: []guardrail.Rule{{Name: "secret", Words: []string{"secret"}, Action: "block"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := guardrails
+	guardrails = set
+	t.Cleanup(func() { guardrails = saved })
+	writer, err := testCacheDirect(t, "cache-guard", "v1/chat/completions", body)
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeGuardrailBlocked || apiErr.Status != http.StatusBadRequest {
+		t.Fatalf("命中拦截规则应返回 400: %v", err)
+	}
+	if writer.header.Get(constant.HeaderCache) == "hit" || calls.Load() != 1 {
+		t.Fatalf("被拒绝的请求不应返回缓存: %q %d", writer.header.Get(constant.HeaderCache), calls.Load())
+	}
+}
+
+func TestCacheSkippedWhenTokenized(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"1","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"mail [[EMAIL_1]]"},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(server.Close)
+	testRoutes(t, ProxyDirectModelConfig{Type: "cache-token", Domain: server.URL,
+		Cache: &CacheConfig{Enable: true}, SemanticCache: &SemanticCacheConfig{Enable: true}})
+	testGuardrails(t, `[{"rules":[{"detector":"email","action":"tokenize"}]}]`)
+
+	// 两个调用方 tokenize 之后的请求相同，各自的响应还原为各自的邮箱
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		body := `{"model":"m","temperature":0,"messages":[{"role":"user","content":"write to ` + email + `"}]}`
+		writer, err := testCacheDirect(t, "cache-token", "v1/chat/completions", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if writer.header.Get(constant.HeaderCache) != cacheBypass || !strings.Contains(writer.body.String(), email) {
+			t.Fatalf("tokenize 之后的请求不应使用缓存: %q %s", writer.header.Get(constant.HeaderCache), writer.body.String())
+		}
+	}
+	if len(received) != 2 || received[0] != received[1] {
+		t.Fatalf("两次请求都应发送到上游: %q", received)
+	}
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/cache"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/conversation"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// ConversationConfig 服务端保存对话历史，只对转换到无状态上游的对话生成请求生效
+type ConversationConfig struct {
+	Enable bool `json:"enable"`
+	// 存储方式 memory、disk，默认 memory
+	Store string `json:"store"`
+	// disk 存储目录，默认 ~/.aiapi/conversation/{type}
+	Dir string `json:"dir"`
+	// 保存时间(秒)，0 使用启动参数默认值，负数不过期
+	Ttl        int `json:"ttl"`
+	MaxEntries int `json:"maxEntries"`
+	// 总大小上限(MB)，0 不限制
+	MaxSize int `json:"maxSize"`
+}
+
+var conversationStores sync.Map
+
+func getConversationStore(modelType string, config *ConversationConfig) (*conversation.Store, error) {
+	if store, ok := conversationStores.Load(modelType); ok {
+		return store.(*conversation.Store), nil
+	}
+	dir := config.Dir
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".aiapi", "conversation", modelType)
+	}
+	store, err := conversation.New(cache.Config{
+		Store:      config.Store,
+		Dir:        dir,
+		Ttl:        routeSeconds(config.Ttl, constant.CONVERSATION_TTL),
+		MaxEntries: config.MaxEntries,
+		MaxBytes:   int64(config.MaxSize) * 1024 * 1024,
+	})
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := conversationStores.LoadOrStore(modelType, store)
+	return actual.(*conversation.Store), nil
+}
+
+// conversationRecord 本轮请求的完整历史，响应完成后加上回答一起保存
+type conversationRecord struct {
+	store    *conversation.Store
+	owner    string
+	id       string
+	model    string
+	contents []general.Content
+	// 流式响应的增量，结束时合并
+	deltas []*general.Response
+}
+
+// conversationEnabled 上游使用 Responses API 时由上游保存对话，协议相同时直接转发，不保存对话
+func (p *ProxyDirect) conversationEnabled() bool {
+	config := p.modelConfig.Conversation
+	return config != nil && config.Enable && p.UpstreamDialect() != constant.DialectResponses && !p.conversion.same()
+}
+
+// conversationLoad 引用之前的响应时在本轮输入之前补齐历史，并记录本轮对话
+// 非 Responses API 的客户端通过请求头引用
+func (p *ProxyDirect) conversationLoad(req *general.Request) error {
+	if id := p.Request.Headers.Get(constant.HeaderPreviousResponseId); id != "" && req.PreviousResponseId == "" {
+		req.PreviousResponseId = id
+	}
+	if !p.conversationEnabled() {
+		return nil
+	}
+	store, err := getConversationStore(p.Request.Type, p.modelConfig.Conversation)
+	if err != nil {
+		slog.Warn("conversation store init fail.", "type", p.Request.Type, "errStack", err)
+		if req.PreviousResponseId != "" {
+			return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "conversation store unavailable")
+		}
+		return nil
+	}
+	owner := conversationOwner(p.Request.Headers, p.Request.QueryParams)
+	if req.PreviousResponseId != "" {
+		previous, ok := store.Get(owner, req.PreviousResponseId)
+		if !ok {
+			return apierror.New(apierror.CodePreviousResponseNotFound, http.StatusBadRequest, false,
+				"previous response not found: "+req.PreviousResponseId)
+		}
+		p.proxyTraceLog("ConversationHistory", len(previous.Contents))
+		req.Contents = append(previous.Contents, req.Contents...)
+		req.PreviousResponseId = ""
+	}
+	if req.Store != nil && !*req.Store {
+		return nil
+	}
+	p.conversation = &conversationRecord{
+		store:    store,
+		owner:    owner,
+		id:       conversation.NewId(),
+		model:    req.Model,
+		contents: slices.Clone(req.Contents),
+	}
+	return nil
+}
+
+// conversationOwner 按调用方的凭证隔离对话，只保存凭证的摘要
+func conversationOwner(headers http.Header, queryParams map[string][]string) string {
+	for _, credential := range requestCredentials(headers, queryParams) {
+		if credential != "" {
+			return cache.Key(credential)
+		}
+	}
+	return ""
+}
+
+// conversationResponse 响应 id 通过响应头返回，Responses API 的客户端同时替换响应体中的 id
+func (p *ProxyDirect) conversationResponse(resp *general.Response) {
+	if p.conversation == nil {
+		return
+	}
+	p.Response.Header().Set(constant.HeaderResponseId, p.conversation.id)
+	if p.conversion.client == constant.DialectResponses {
+		resp.Id = p.conversation.id
+	}
+}
+
+// conversationStream 记录流式响应的增量，结束后由 conversationStreamSave 保存
+func (p *ProxyDirect) conversationStream(stream *convert.StreamConverter) {
+	if p.conversation == nil {
+		return
+	}
+	p.Response.Header().Set(constant.HeaderResponseId, p.conversation.id)
+	stream.OnDelta(func(delta *general.Response) {
+		p.conversationResponse(delta)
+		p.conversation.deltas = append(p.conversation.deltas, delta)
+	})
+}
+
+func (p *ProxyDirect) conversationStreamSave() {
+	if p.conversation == nil {
+		return
+	}
+	p.conversationSave(convert.MergeResponses(p.conversation.deltas))
+}
+
+func (p *ProxyDirect) conversationSave(resp *general.Response) {
+	record := p.conversation
+	if record == nil {
+		return
+	}
+	contents := record.contents
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		answer := *resp.Candidates[0].Content
+		answer.Role = general.RoleAssistant
+		contents = append(contents, answer)
+	}
+	record.store.Save(record.owner, record.id, &conversation.Conversation{Model: record.model, Contents: contents})
+	p.proxyTraceLog("ConversationSave", record.id)
+	p.conversation = nil
+}
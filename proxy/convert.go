@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/script"
+	"github.com/lijcoder/aiapi/sse"
+	"github.com/lijcoder/aiapi/transform"
+)
+
+// conversion 客户端协议与上游协议不同，或者有改写规则、脚本、内容安全规则生效时，请求与响应经过通用格式转换
+type conversion struct {
+	client   string
+	upstream string
+	// 客户端请求的模型，上游响应中没有模型名时使用
+	model  string
+	stream *convert.StreamConverter
+	// 本次请求生效的响应改写规则
+	responseRules []transform.Rule
+	// 本次请求生效的响应脚本与传给脚本的请求信息
+	responseScripts []*script.Hook
+	scriptMeta      script.Meta
+	// 流式响应被脚本或内容安全规则拒绝，之后的事件不再输出
+	streamErr error
+	// 执行规则之后的请求与发送给上游的请求体，用于缓存
+	request *general.Request
+	body    []byte
+}
+
+// same 协议相同，只是为了执行改写规则、脚本或内容安全规则
+func (c *conversion) same() bool {
+	return c.client == c.upstream
+}
+
+// converting 只转换对话生成接口，其它接口仍然直接转发；协议相同时只有可能匹配改写规则、脚本、内容安全规则或注入检测才经过通用格式
+func (p *ProxyDirect) converting() bool {
+	client, upstream := p.Dialect(), p.UpstreamDialect()
+	if client == "" || upstream == "" || !convert.GenerateEndpoint(client, p.Request.Path) {
+		return false
+	}
+	return client != upstream || p.transformPossible() || p.scriptPossible() || p.guardrailPossible() || p.injectionPossible()
+}
+
+// convertRequest 返回上游路径与转换后的请求体，协议相同且没有规则生效时原样返回，conversion 为空
+func (p *ProxyDirect) convertRequest() (string, io.ReadCloser, int64, error) {
+	client, upstream := p.Dialect(), p.UpstreamDialect()
+	req, err := convert.DecodeRequest(client, p.Request.Path, p.Request.Body)
+	if err != nil && client == upstream && (p.guardrailPossible() || p.injectionPossible()) {
+		// 无法解析的请求不能绕过内容安全规则与注入检测
+		return "", nil, 0, convertRequestError(err, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "invalid "+client+" request body"))
+	}
+	if err != nil && client == upstream {
+		// 协议相同时解析失败不影响转发，改写规则不生效
+		slog.Warn("decode request for transform fail.", "type", p.Request.Type, "errStack", err)
+		return p.passRequest()
+	}
+	if err != nil {
+		return "", nil, 0, convertRequestError(err, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "invalid "+client+" request body"))
+	}
+	p.conversion = &conversion{client: client, upstream: upstream, model: req.Model}
+	if err := p.conversationLoad(req); err != nil {
+		return "", nil, 0, err
+	}
+	// 脚本看到的是客户端请求的模型名，可以改变路由，之后按实际路由做模型映射
+	scripted, err := p.scriptRequest(req)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	// 模型映射只在协议转换时生效，之后执行的改写规则可以再修改模型名
+	if !p.conversion.same() {
+		req.Model = upstreamModel(p.modelConfig, req.Model)
+	}
+	transformed, err := p.transformRequest(req)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	guarded, err := p.guardrailRequest(req)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	// 注入检测不修改请求，协议相同时仍然可以原样转发
+	if err := p.injectionScan(req); err != nil {
+		return "", nil, 0, err
+	}
+	if !transformed && !scripted && !guarded && p.conversion.same() {
+		p.conversion = nil
+		return p.passRequest()
+	}
+	path, body, err := convert.EncodeRequest(p.conversion.upstream, req)
+	if err != nil {
+		return "", nil, 0, convertRequestError(err, apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert request fail"))
+	}
+	if p.conversion.same() {
+		// 协议相同时只把修改写回原始请求体，通用格式没有的字段原样转发
+		body = convert.PatchRequest(client, p.Request.Path, p.Request.Body, body)
+	}
+	p.conversion.request, p.conversion.body = req, body
+	if warnings := convert.ToolWarnings(p.conversion.upstream, req); len(warnings) > 0 {
+		p.proxyTraceLog("ConvertWarnings", warnings)
+		p.Response.Header().Set(constant.HeaderConversionWarnings, strings.Join(warnings, "; "))
+	}
+	p.proxyTraceLog("ConvertRequestPath", path)
+	p.proxyTraceLog("ConvertRequestBody", body)
+	return path, io.NopCloser(bytes.NewReader(body)), int64(len(body)), nil
+}
+
+func (p *ProxyDirect) passRequest() (string, io.ReadCloser, int64, error) {
+	return p.Request.Path, io.NopCloser(bytes.NewReader(p.Request.Body)), int64(len(p.Request.Body)), nil
+}
+
+// convertRequestError 上游协议没有对应功能时返回 400 并说明原因，其它错误返回 fallback
+func convertRequestError(err error, fallback *apierror.Error) error {
+	var unsupported *convert.UnsupportedError
+	if errors.As(err, &unsupported) {
+		return apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, unsupported.Message)
+	}
+	return fallback
+}
+
+// upstreamModel 按路由的模型映射替换模型名，* 匹配所有模型
+func upstreamModel(modelConfig ProxyDirectModelConfig, model string) string {
+	if mapped, ok := modelConfig.Models[model]; ok {
+		return mapped
+	}
+	if mapped, ok := modelConfig.Models["*"]; ok {
+		return mapped
+	}
+	return model
+}
+
+// convertResponseHeader 上游错误按客户端协议返回；非流式响应在写响应头之前完成转换，转换失败时仍可返回错误
+func (p *ProxyDirect) convertResponseHeader() error {
+	resp := p.proxyResponse
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		p.proxyTraceLog("ResponseBody", body)
+		return upstreamError(resp.StatusCode, body)
+	}
+	// 协议相同且没有响应规则、响应脚本、内容安全检查时原样转发
+	if p.conversion.same() && len(p.conversion.responseRules) == 0 && len(p.conversion.responseScripts) == 0 && !p.guardrailResponding() {
+		return nil
+	}
+	headers := http.Header{}
+	if isStream(resp.Headers.Get("Content-Type")) {
+		stream, err := convert.NewStreamTranscoder(p.conversion.upstream, p.conversion.client, p.conversion.model)
+		if err != nil {
+			return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert response fail")
+		}
+		p.conversion.stream = stream
+		// 内容安全检查在其它响应处理之前，之后看到的是还原 token 后的内容
+		p.guardrailStream(stream)
+		p.transformStream(stream)
+		p.scriptStream(stream)
+		p.conversationStream(stream)
+		headers.Set("Content-Type", convert.StreamContentType(p.conversion.client))
+		headers.Set("Cache-Control", "no-cache")
+		resp.Headers = headers
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return apierror.From(err)
+	}
+	p.proxyTraceLog("UpstreamResponseBody", body)
+	general, err := convert.DecodeResponse(p.conversion.upstream, body)
+	if err != nil {
+		return apierror.Wrap(err, apierror.CodeUpstreamError, http.StatusBadGateway, false, "invalid upstream response")
+	}
+	if general.Model == "" {
+		general.Model = p.conversion.model
+	}
+	if err := p.guardrailResponse(general); err != nil {
+		return err
+	}
+	if err := p.transformResponse(general); err != nil {
+		return err
+	}
+	if err := p.scriptResponse(general); err != nil {
+		return err
+	}
+	p.conversationResponse(general)
+	p.conversationSave(general)
+	encoded, err := convert.EncodeResponse(p.conversion.client, general)
+	if err != nil {
+		return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert response fail")
+	}
+	if p.conversion.same() {
+		// 协议相同时只把修改写回上游响应体，通用格式没有的字段(system_fingerprint、logprobs 等)原样返回
+		encoded = convert.PatchResponse(p.conversion.client, body, encoded)
+	}
+	body = encoded
+	headers.Set("Content-Type", "application/json")
+	resp.Headers = headers
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// upstreamError 上游错误按客户端协议重新输出，429 与 5xx 可重试
+func upstreamError(statusCode int, body []byte) *apierror.Error {
+	retryable := statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	return apierror.New(apierror.CodeUpstreamError, statusCode, retryable, convert.UpstreamErrorMessage(body))
+}
+
+// streamEvents 需要转换时一个上游事件可能对应零到多个客户端事件
+func (p *ProxyDirect) streamEvents(event sse.Event) ([]sse.Event, error) {
+	if p.conversion == nil || p.conversion.stream == nil {
+		return []sse.Event{event}, nil
+	}
+	events, err := p.conversion.stream.Convert(event)
+	if err != nil {
+		return nil, apierror.Wrap(err, apierror.CodeUpstreamError, http.StatusBadGateway, false, streamErrorMessage(err))
+	}
+	if p.conversion.streamErr != nil {
+		return nil, p.conversion.streamErr
+	}
+	return events, nil
+}
+
+// streamFinish 结束时输出缓冲的内容，被拒绝时返回错误
+func (p *ProxyDirect) streamFinish() ([]sse.Event, error) {
+	if p.conversion == nil || p.conversion.stream == nil {
+		return nil, nil
+	}
+	events := p.conversion.stream.Finish()
+	if p.conversion.streamErr != nil {
+		return nil, p.conversion.streamErr
+	}
+	return events, nil
+}
+
+func streamErrorMessage(err error) string {
+	if upstreamErr, ok := err.(*convert.UpstreamError); ok {
+		return upstreamErr.Message
+	}
+	return "invalid upstream stream event"
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lijcoder/aiapi/transform"
+)
+
+// testTransforms 替换改写规则，测试结束后恢复
+func testTransforms(t *testing.T, config string) {
+	var rules []transform.Rule
+	if err := json.Unmarshal([]byte(config), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if err := transform.Validate(rules); err != nil {
+		t.Fatal(err)
+	}
+	saved := transformRules
+	transformRules = rules
+	t.Cleanup(func() { transformRules = saved })
+}
+
+func TestSameDialectTransformLossless(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+	testRoutes(t, ProxyDirectModelConfig{Type: "openai", Domain: server.URL}, ProxyDirectModelConfig{Type: "claude", Domain: server.URL})
+	testTransforms(t, `[{"actions":[{"op":"set","path":"generationConfig.temperature","value":0.2},
+		{"op":"clamp","path":"generationConfig.maxOutputTokens","max":100}]}]`)
+
+	for _, c := range []struct {
+		route, path, body, want string
+	}{
+		{
+			route: "openai",
+			path:  "v1/chat/completions",
+			body: `{"model":"gpt","temperature":1,"max_tokens":1000,"logit_bias":{"50256":-100},"metadata":{"user":"u1"},"store":true,` +
+				`"service_tier":"flex","prediction":{"type":"content","content":"x"},` +
+				`"messages":[{"role":"developer","content":"be brief"},{"role":"user","name":"alice","content":"hi"}]}`,
+			want: `{"model":"gpt","temperature":0.2,"max_tokens":100,"logit_bias":{"50256":-100},"metadata":{"user":"u1"},"store":true,` +
+				`"service_tier":"flex","prediction":{"type":"content","content":"x"},` +
+				`"messages":[{"role":"developer","content":"be brief"},{"role":"user","name":"alice","content":"hi"}]}`,
+		},
+		{
+			route: "claude",
+			path:  "v1/messages",
+			body: `{"model":"claude","max_tokens":1000,"temperature":1,"metadata":{"user_id":"u1"},"service_tier":"auto",` +
+				`"system":[{"type":"text","text":"be brief","cache_control":{"type":"ephemeral"}}],` +
+				`"messages":[{"role":"user","content":[{"type":"text","text":"hi","cache_control":{"type":"ephemeral"}}]}]}`,
+			want: `{"model":"claude","max_tokens":100,"temperature":0.2,"metadata":{"user_id":"u1"},"service_tier":"auto",` +
+				`"system":[{"type":"text","text":"be brief","cache_control":{"type":"ephemeral"}}],` +
+				`"messages":[{"role":"user","content":[{"type":"text","text":"hi","cache_control":{"type":"ephemeral"}}]}]}`,
+		},
+	} {
+		p, _ := testProxy(c.route, c.path, strings.NewReader(c.body), int64(len(c.body)))
+		if err := p.Direct(); err != nil {
+			t.Fatal(err)
+		}
+		// 除了规则修改的字段，其它内容按字节保留
+		if received != c.want {
+			t.Fatalf("%s 协议相同时应只修改规则改写的字段:\n%s\n%s", c.route, received, c.want)
+		}
+	}
+}
+
+func TestSameDialectResponseLossless(t *testing.T) {
+	upstream := `{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"gpt-4o","system_fingerprint":"fp_1","service_tier":"default",` +
+		`"choices":[{"index":0,"message":{"role":"assistant","content":"hi","refusal":null},"logprobs":{"content":[]},"finish_reason":"stop"}],` +
+		`"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`
+	server, _ := testUpstream(t, "application/json", upstream)
+	testRoutes(t, ProxyDirectModelConfig{Type: "openai", Domain: server.URL})
+	testTransforms(t, `[{"target":"response","actions":[{"op":"set","path":"model","value":"gpt-4o-renamed"}]}]`)
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	p, writer := testProxy("openai", "v1/chat/completions", strings.NewReader(body), int64(len(body)))
+	if err := p.Direct(); err != nil {
+		t.Fatal(err)
+	}
+	// 除了规则修改的字段，上游响应按字节保留
+	want := strings.Replace(upstream, `"model":"gpt-4o"`, `"model":"gpt-4o-renamed"`, 1)
+	if writer.body.String() != want {
+		t.Fatalf("协议相同时应只修改规则改写的字段:\n%s\n%s", writer.body.String(), want)
+	}
+}
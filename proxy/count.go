@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/tokenizer"
+)
+
+// countingTokens 协议相同、上游有计数接口且没有内容安全规则时直接转发，否则由网关转换或本地估算
+func (p *ProxyDirect) countingTokens() bool {
+	client, upstream := p.Dialect(), p.UpstreamDialect()
+	if client == "" || upstream == "" || !convert.CountTokensEndpoint(client, p.Request.Path) {
+		return false
+	}
+	return client != upstream || !convert.CountTokensSupported(upstream) || p.guardrailPossible()
+}
+
+// countTokens 上游有计数接口时转换后调用，否则使用本地估算并通过响应头标记
+func (p *ProxyDirect) countTokens() error {
+	client, upstream := p.Dialect(), p.UpstreamDialect()
+	req, err := convert.DecodeCountTokensRequest(client, p.Request.Path, p.Request.Body)
+	if err != nil {
+		return convertRequestError(err, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "invalid "+client+" count tokens request body"))
+	}
+	// 脱敏之后再计数，与实际发送给上游的内容一致
+	if err := p.guardrailInputs(req.Model, req); err != nil {
+		return err
+	}
+	if client != upstream {
+		req.Model = upstreamModel(p.modelConfig, req.Model)
+	}
+	var tokens int
+	if convert.CountTokensSupported(upstream) {
+		if tokens, err = p.upstreamCountTokens(upstream, req); err != nil {
+			return err
+		}
+	} else {
+		tokens = tokenizer.EstimateRequest(req)
+		p.proxyTraceLog("EstimateTokens", tokens)
+		p.Response.Header().Set(constant.HeaderTokenEstimate, "true")
+	}
+	body, err := convert.EncodeCountTokensResponse(client, tokens)
+	if err != nil {
+		return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert response fail")
+	}
+	p.proxyTraceLog("ResponseBody", body)
+	p.Response.Header().Set("Content-Type", "application/json")
+	p.Response.WriteStatusCode(http.StatusOK)
+	_, err = p.Response.Write(body)
+	p.proxyTraceLog("RequestEnd", "------")
+	return err
+}
+
+func (p *ProxyDirect) upstreamCountTokens(upstream string, req *general.Request) (int, error) {
+	path, body, err := convert.EncodeCountTokensRequest(upstream, req)
+	if err != nil {
+		return 0, convertRequestError(err, apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert request fail"))
+	}
+	p.proxyTraceLog("ConvertRequestPath", path)
+	p.proxyTraceLog("ConvertRequestBody", body)
+	headers := http.Header(p.modelConfig.Headers).Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	if headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", "application/json")
+	}
+	httpReq, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.modelConfig.Domain+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "build upstream request fail")
+	}
+	httpReq.Header = headers
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, apierror.From(err)
+	}
+	defer resp.Body.Close()
+	p.proxyTraceLog("ResponseStatusCode", resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, apierror.From(err)
+	}
+	p.proxyTraceLog("UpstreamResponseBody", data)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return 0, upstreamError(resp.StatusCode, data)
+	}
+	tokens, err := convert.DecodeCountTokensResponse(upstream, data)
+	if err != nil {
+		return 0, apierror.Wrap(err, apierror.CodeUpstreamError, http.StatusBadGateway, false, "invalid upstream response")
+	}
+	return tokens, nil
+}
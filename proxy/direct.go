@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,16 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/cache"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/guardrail"
+	"github.com/lijcoder/aiapi/injection"
+	"github.com/lijcoder/aiapi/ndjson"
 )
 
 var (
@@ -19,24 +29,76 @@ var (
 	modelConfig     []ProxyDirectModelConfig
 )
 
-func init() {
+// Init 读取 ~/.aiapi 下的配置文件，启动时在解析启动参数之后调用；测试不调用，直接设置需要的配置
+func Init() {
 	modelConfigFile = initModelConfigFilePath(".aiapi/model_direct.json")
 	modelConfig = initModelConfig()
+	loadGatewayKeys()
+	loadTransforms()
+	loadScripts()
+	loadGuardrails()
+	loadInjections()
 }
 
 type ProxyDirectModelConfig struct {
 	Type    string              `json:"type"`
 	Domain  string              `json:"domain"`
 	Headers map[string][]string `json:"headers"`
+	// 上游协议 openai/gemini/claude/responses/completions/ollama/ollama_generate，与客户端协议不同时转换请求与响应，为空时与客户端一致
+	// responses 表示上游使用 OpenAI Responses API，openai 表示上游只支持 chat completions，completions 表示上游只支持旧版 completions
+	// ollama 表示上游为 ollama 兼容服务，/api/generate 请求原样转发，其它协议转换为 /api/chat
+	Dialect string `json:"dialect"`
+	// 模型名映射，客户端模型名 -> 上游模型名，* 匹配所有模型，只在协议转换时生效
+	Models map[string]string `json:"models"`
+	// 请求体上限(MB)，0 使用启动参数默认值，负数不限制
+	MaxBodySize int `json:"maxBodySize"`
+	// 超时配置(秒)，0 使用启动参数默认值，负数关闭
+	Timeout           int `json:"timeout"`
+	StreamIdleTimeout int `json:"streamIdleTimeout"`
+	StreamHeartbeat   int `json:"streamHeartbeat"`
+	// 响应缓存，不配置时关闭
+	Cache *CacheConfig `json:"cache"`
+	// 语义缓存，不配置时关闭
+	SemanticCache *SemanticCacheConfig `json:"semanticCache"`
+	// 模型列表，不配置时只列出 models 映射中的模型
+	ModelList *ModelListConfig `json:"modelList"`
+	// embeddings 单次上游调用的输入条数上限，超过时拆分，0 使用上游协议的默认上限
+	EmbeddingBatchSize int `json:"embeddingBatchSize"`
+	// 服务端保存对话历史，供 previous_response_id 引用，不配置时关闭
+	Conversation *ConversationConfig `json:"conversation"`
 }
 
 type ProxyDirect struct {
 	Request       *ProxyDirectRequest
 	Response      ProxyDirectResponseWrite
 	proxyResponse *ProxyDirectResponse
+	modelConfig   ProxyDirectModelConfig
+	ctx           context.Context
+	passBody      *passThroughBody
+	cacheStore    cache.Store
+	cacheKey      string
+	cacheEntry    *cache.Entry
+	// 语义缓存未命中时记录，响应完成后写入索引
+	semanticIndex  cache.VectorIndex
+	semanticScope  string
+	semanticVector []float32
+	conversion     *conversion
+	// 需要保存的本轮对话，响应完成后写入
+	conversation *conversationRecord
+	// 客户端的流式响应为 NDJSON(ollama)，否则为 SSE
+	streamNdjson bool
+	// 内容安全规则的处理状态，没有规则生效时为空
+	guardrail *guardrail.Session
+	// 提示词注入检测结果，没有检测时为空
+	injection *injection.Verdict
+	// 网关内部发起的请求(审核模型)，不做提示词注入检测
+	internal bool
+	// 请求携带的网关 key，没有配置网关 key 或内部请求时为空
+	gatewayKey *GatewayKey
 }
 
 type ProxyDirectRequest struct {
+	Context     context.Context
 	Debug       bool
 	TraceId     string
 	Url         *url.URL
@@ -46,6 +108,11 @@ type ProxyDirectRequest struct {
 	Headers     http.Header
 	QueryParams map[string][]string
 	Body        []byte
+	// BodyReader 未读取的请求体，不需要缓存时直接流式转发给上游
+	BodyReader    io.Reader
+	ContentLength int64
+	// ReadDeadline 设置读取请求体的截止时间，为空时不设置；server 不设置全局 ReadTimeout，按路由的整体超时控制
+	ReadDeadline func(time.Time) error
 }
 
 type ProxyDirectResponse struct {
@@ -76,32 +143,112 @@ func (p *ProxyDirect) Direct() error {
 	p.proxyTraceLog("RequestMethod", p.Request.Method)
 	p.proxyTraceLog("RequestHeaders", p.Request.Headers)
 	p.proxyTraceLog("RequestQueryParams", p.Request.QueryParams)
-	p.proxyTraceLog("RequestBody", p.Request.Body)
 	// 通过 type 获取模型配置
 	modelConfig, flag := getModelConfig(p.Request.Type)
 	if !flag {
-		return errors.New("model config not found. type: " + p.Request.Type)
+		return apierror.New(apierror.CodeModelConfigNotFound, http.StatusNotFound, false, "model config not found. type: "+p.Request.Type)
+	}
+	p.modelConfig = modelConfig
+	// 配置了网关 key 时拒绝未携带或未知的 key，否则按 key 生效的规则可以通过不带 key 绕过
+	if GatewayKeyEnabled() && !p.internal {
+		key, ok := LookupGatewayKey(p.Request.Headers, p.Request.QueryParams)
+		if !ok {
+			return apierror.New(apierror.CodeUnauthorized, http.StatusUnauthorized, false, "invalid gateway key")
+		}
+		if !key.AllowRoute(p.modelConfig.Type) {
+			return routeForbidden(p.modelConfig.Type)
+		}
+		p.gatewayKey = key
+	}
+	ctx := p.Request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// 整体超时，替代 http server 全局的 WriteTimeout
+	if timeout := routeSeconds(modelConfig.Timeout, constant.REQUEST_TIMEOUT); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if p.Request.ReadDeadline != nil {
+			if err := p.Request.ReadDeadline(time.Now().Add(timeout)); err != nil {
+				slog.Warn("set request read deadline fail.", "type", p.Request.Type, "errStack", err)
+			}
+		}
+	}
+	p.ctx = ctx
+	bodyReader, contentLength, err := p.requestBody()
+	if err != nil {
+		return err
+	}
+	// 客户端请求的模型，之后的模型映射、改写规则不影响校验
+	if model := requestModel(p.Request.Path, p.Request.Body); model != "" && !p.gatewayKey.AllowModel(model) {
+		return modelForbidden(model)
+	}
+	if p.embedding() {
+		return p.embed()
+	}
+	if p.countingTokens() {
+		return p.countTokens()
+	}
+	// 内容安全规则无法检查的接口(文件、音频等)带请求体时拒绝，不能绕过规则
+	if p.guardrailPossible() && !p.converting() && p.Request.ContentLength != 0 {
+		return apierror.New(apierror.CodeGuardrailBlocked, http.StatusBadRequest, false, "request to this endpoint can not be checked by guardrails")
+	}
+	path := p.Request.Path
+	// 网关 key 只用于网关鉴权，不转发给上游
+	queryParams := withoutGatewayKey(p.Request.QueryParams)
+	if p.converting() {
+		path, bodyReader, contentLength, err = p.convertRequest()
+		if err != nil {
+			return err
+		}
+	}
+	// 缓存在脚本、改写规则、内容安全规则与注入检测之后查找，被拒绝的请求不会返回缓存的响应
+	if hit, err := p.cacheLookup(path); hit {
+		return err
 	}
-	domain := modelConfig.Domain
-	url := domain + "/" + p.Request.Path
-	bodyReader := io.NopCloser(bytes.NewReader(p.Request.Body))
-	req, error := http.NewRequest(p.Request.Method, url, bodyReader)
+	// 脚本可能改变路由，之后使用 p.modelConfig
+	headers := http.Header(p.modelConfig.Headers)
+	if p.conversion != nil {
+		// 客户端的查询参数属于客户端协议，不再转发；协议相同时仍然转发
+		if !p.conversion.same() {
+			queryParams = nil
+		}
+		headers = headers.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		if headers.Get("Content-Type") == "" {
+			headers.Set("Content-Type", "application/json")
+		}
+	}
+	domain := p.modelConfig.Domain
+	url := domain + "/" + path
+	req, error := http.NewRequestWithContext(ctx, p.Request.Method, url, bodyReader)
 	if error != nil {
-		return error
+		return apierror.Wrap(error, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "build upstream request fail")
 	}
-	// 添加查询参数
+	req.ContentLength = contentLength
+	// 添加查询参数，上游路径中已有的参数不重复添加
 	query := req.URL.Query()
-	for k, vs := range p.Request.QueryParams {
+	for k, vs := range queryParams {
+		if query.Has(k) {
+			continue
+		}
 		for _, v := range vs {
 			query.Add(k, v)
 		}
 	}
 	req.URL.RawQuery = query.Encode()
-	req.Header = modelConfig.Headers
+	req.Header = headers
 	client := &http.Client{}
 	resp, error := client.Do(req)
 	if error != nil {
-		return error
+		// 上游可能提前断开，超限错误以读取请求体时记录的为准
+		if p.passBody != nil && p.passBody.tooLarge() {
+			return requestTooLarge(limitBytes(p.modelConfig), error)
+		}
+		return apierror.From(error)
 	}
 	defer resp.Body.Close()
 	pdrs := ProxyDirectResponse{
@@ -113,12 +260,88 @@ func (p *ProxyDirect) Direct() error {
 	p.proxyTraceLog("ResponseStatusCode", pdrs.StatusCode)
 	p.proxyTraceLog("ResponseHeaders", pdrs.Headers)
 	p.proxyResponse = &pdrs
-	p.proxyResponseProcess()
+	err = p.proxyResponseProcess()
 	p.proxyTraceLog("RequestEnd", "------")
-	return nil
+	return err
+}
+
+// requestBody 请求体大小限制。需要调试采集时读取到内存，否则直接流式转发
+func (p *ProxyDirect) requestBody() (io.ReadCloser, int64, error) {
+	limit := limitBytes(p.modelConfig)
+	if limit > 0 && p.Request.ContentLength > limit {
+		return nil, 0, requestTooLarge(limit, nil)
+	}
+	if p.Request.BodyReader == nil {
+		p.proxyTraceLog("RequestBody", p.Request.Body)
+		return io.NopCloser(bytes.NewReader(p.Request.Body)), int64(len(p.Request.Body)), nil
+	}
+	reader := io.NopCloser(p.Request.BodyReader)
+	if limit > 0 {
+		reader = http.MaxBytesReader(nil, reader, limit)
+	}
+	if !p.needBody() {
+		// pass-through，长度未知时使用 chunked
+		contentLength := p.Request.ContentLength
+		if contentLength <= 0 {
+			contentLength = -1
+		}
+		p.passBody = &passThroughBody{ReadCloser: reader}
+		return p.passBody, contentLength, nil
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, 0, requestTooLarge(limit, err)
+		}
+		return nil, 0, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "read request body fail")
+	}
+	p.Request.Body = body
+	p.Request.BodyReader = nil
+	p.proxyTraceLog("RequestBody", body)
+	return io.NopCloser(bytes.NewReader(body)), int64(len(body)), nil
+}
+
+// needBody 是否需要把请求体读取到内存
+func (p *ProxyDirect) needBody() bool {
+	return p.Request.Debug || p.gatewayKey.modelRestricted() || p.cacheEnabled() || p.semanticCacheEnabled() || p.converting() || p.embedding() || p.countingTokens()
+}
+
+func limitBytes(modelConfig ProxyDirectModelConfig) int64 {
+	return int64(routeValue(modelConfig.MaxBodySize, constant.MAX_BODY_SIZE)) * 1024 * 1024
+}
+
+// passThroughBody 流式转发的请求体，记录读取错误
+type passThroughBody struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *passThroughBody) Read(data []byte) (int, error) {
+	n, err := b.ReadCloser.Read(data)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *passThroughBody) tooLarge() bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(b.err, &maxBytesErr)
+}
+
+func requestTooLarge(limit int64, err error) *apierror.Error {
+	return apierror.Wrap(err, apierror.CodeRequestTooLarge, http.StatusRequestEntityTooLarge, false,
+		"request body exceeds the limit of "+strconv.FormatInt(limit/1024/1024, 10)+"MB")
 }
 
 func (p *ProxyDirect) proxyResponseProcess() error {
+	upstreamContentType := p.proxyResponse.Headers.Get("Content-Type")
+	if p.conversion != nil {
+		if err := p.convertResponseHeader(); err != nil {
+			return err
+		}
+	}
 	// 设置 headers
 	for k, vs := range p.proxyResponse.Headers {
 		for _, v := range vs {
@@ -127,12 +350,13 @@ func (p *ProxyDirect) proxyResponseProcess() error {
 	}
 	// 设置状态码，写响应头
 	p.Response.WriteStatusCode(p.proxyResponse.StatusCode)
+	p.cacheRecordHeader()
 	// 根据 contentType 设置相应的响应格式
 	contentType := p.proxyResponse.Headers.Get("Content-Type")
-	sseContentType := "event-stream"
-	if strings.Contains(contentType, sseContentType) {
+	if isStream(contentType) {
 		// stream
-		return p.proxyResponseStream()
+		p.streamNdjson = strings.Contains(contentType, ndjson.ContentType)
+		return p.proxyResponseStream(upstreamContentType)
 	} else {
 		// no stream
 		return p.proxyResponseNoStream()
@@ -146,50 +370,10 @@ func (p *ProxyDirect) proxyResponseNoStream() error {
 	}
 	p.proxyTraceLog("ResponseBody", string(bodyBytes))
 	_, err = p.Response.Write(bodyBytes)
-	return err
-}
-
-func (p *ProxyDirect) proxyResponseStream() error {
-	buffer := bytes.NewBuffer(make([]byte, 0, 1024))
-	scratchBuf := make([]byte, 512)
-	sep := []byte("\n\n")
-	for {
-		n, err := p.proxyResponse.Body.Read(scratchBuf)
-		if n > 0 {
-			buffer.Write(scratchBuf[:n])
-			data := buffer.Bytes()
-			for {
-				idx := bytes.Index(data, sep)
-				if idx == -1 {
-					break
-				}
-				msgEnd := idx + 2
-				msg := data[:msgEnd]
-				p.proxyTraceLog("ResponseSSEBody", msg)
-				if _, writeErr := p.Response.Write(msg); writeErr != nil {
-					return writeErr
-				}
-				// 移除以处理的部分
-				data = data[msgEnd:]
-			}
-			buffer.Reset()
-			buffer.Write(data)
-		}
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-	}
-	if buffer.Len() > 0 {
-		remaining := buffer.Bytes()
-		p.proxyTraceLog("ResponseSSEBody", remaining)
-		if _, writeErr := p.Response.Write(remaining); writeErr != nil {
-			return writeErr
-		}
+	if err == nil {
+		p.cacheSave(bodyBytes)
 	}
-	return nil
+	return err
 }
 
 func (p *ProxyDirect) proxyTraceLog(title string, data any) {
@@ -210,6 +394,49 @@ func (p *ProxyDirect) proxyTraceLog(title string, data any) {
 	slog.Info(logData)
 }
 
+// Dialect 客户端协议，错误按该协议返回
+func (p *ProxyDirect) Dialect() string {
+	return Dialect(p.Request.Type, p.Request.Path)
+}
+
+// UpstreamDialect 上游协议，路由未配置时与客户端一致；ollama 服务同时提供 /api/chat 与 /api/generate
+func (p *ProxyDirect) UpstreamDialect() string {
+	client := p.Dialect()
+	if p.modelConfig.Dialect == constant.DialectOllama && client == constant.DialectOllamaGenerate {
+		return client
+	}
+	if p.modelConfig.Dialect != "" {
+		return p.modelConfig.Dialect
+	}
+	return client
+}
+
+// Dialect 根据请求路径推断客户端协议，无法识别时使用路由配置的协议
+func Dialect(modelType string, path string) string {
+	if dialect := constant.DetectDialect(path); dialect != "" {
+		return dialect
+	}
+	if config, ok := getModelConfig(modelType); ok {
+		return config.Dialect
+	}
+	return ""
+}
+
+// routeValue 路由配置优先，0 使用默认值，负数表示关闭(返回 0)
+func routeValue(route int, def int) int {
+	if route == 0 {
+		route = def
+	}
+	if route < 0 {
+		return 0
+	}
+	return route
+}
+
+func routeSeconds(route int, def int) time.Duration {
+	return time.Duration(routeValue(route, def)) * time.Second
+}
+
 func getModelConfig(modelType string) (ProxyDirectModelConfig, bool) {
 	for _, config := range modelConfig {
 		if config.Type == modelType {
@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+)
+
+// testRoutes 替换路由配置，测试结束后恢复
+func testRoutes(t *testing.T, routes ...ProxyDirectModelConfig) {
+	saved := modelConfig
+	modelConfig = routes
+	t.Cleanup(func() { modelConfig = saved })
+}
+
+// testUpstream 读取完整请求体后返回 body，记录收到的请求数
+func testUpstream(t *testing.T, contentType string, body string) (*httptest.Server, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if _, err := io.ReadAll(r.Body); err != nil {
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func testProxy(route string, path string, body io.Reader, contentLength int64) (*ProxyDirect, *bufferResponseWrite) {
+	writer := &bufferResponseWrite{header: http.Header{}}
+	return &ProxyDirect{
+		Request: &ProxyDirectRequest{
+			Type:          route,
+			Path:          path,
+			Method:        http.MethodPost,
+			Headers:       http.Header{"Content-Type": {"application/json"}},
+			QueryParams:   map[string][]string{},
+			BodyReader:    body,
+			ContentLength: contentLength,
+		},
+		Response: writer,
+	}, writer
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	server, calls := testUpstream(t, "application/json", `{"ok":true}`)
+	testRoutes(t, ProxyDirectModelConfig{Type: "up", Domain: server.URL, MaxBodySize: 1})
+	large := `{"model":"m","messages":[{"role":"user","content":"` + strings.Repeat("x", 1024*1024) + `"}]}`
+
+	for name, p := range map[string]*ProxyDirect{
+		// 声明的长度超过上限，不读取请求体
+		"content-length": func() *ProxyDirect {
+			p, _ := testProxy("up", "v1/chat/completions", strings.NewReader(large), int64(len(large)))
+			return p
+		}(),
+		// 长度未知，读取到内存时超限
+		"buffered": func() *ProxyDirect {
+			p, _ := testProxy("up", "v1/chat/completions", strings.NewReader(large), -1)
+			p.Request.Debug = true
+			return p
+		}(),
+		// 长度未知，流式转发给上游时超限
+		"pass-through": func() *ProxyDirect {
+			p, _ := testProxy("up", "v1/chat/completions", io.MultiReader(strings.NewReader(large)), -1)
+			return p
+		}(),
+	} {
+		err := p.Direct()
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeRequestTooLarge || apiErr.Status != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: 超过上限应返回 413: %v", name, err)
+		}
+		if !strings.Contains(string(apiErr.JSON(constant.DialectClaude)), "request body exceeds the limit of 1MB") {
+			t.Fatalf("%s: 错误信息应说明上限: %s", name, apiErr.JSON(constant.DialectClaude))
+		}
+	}
+	if calls.Load() > 1 {
+		t.Fatalf("只有流式转发会请求上游: %d", calls.Load())
+	}
+
+	// 未超限时原样转发
+	small := `{"model":"m","messages":[]}`
+	p, writer := testProxy("up", "v1/chat/completions", bytes.NewReader([]byte(small)), -1)
+	if err := p.Direct(); err != nil || writer.status != http.StatusOK || writer.body.String() != `{"ok":true}` {
+		t.Fatalf("未超限应正常转发: %v %d %s", err, writer.status, writer.body.String())
+	}
+}
+
+func TestGatewayKeyRequired(t *testing.T) {
+	server, calls := testUpstream(t, "application/json", `{"ok":true}`)
+	testRoutes(t, ProxyDirectModelConfig{Type: "up", Domain: server.URL})
+	saved := gatewayKeys
+	gatewayKeys = []GatewayKey{{Key: "sk-team", Name: "team"}}
+	t.Cleanup(func() { gatewayKeys = saved })
+
+	body := `{"model":"m","messages":[]}`
+	for name, credential := range map[string]string{"missing": "", "unknown": "Bearer sk-other"} {
+		p, _ := testProxy("up", "v1/chat/completions", strings.NewReader(body), int64(len(body)))
+		if credential != "" {
+			p.Request.Headers.Set("Authorization", credential)
+		}
+		var apiErr *apierror.Error
+		if err := p.Direct(); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+			t.Fatalf("%s: 未知的 key 应返回 401: %v", name, err)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("被拒绝的请求不应发送到上游: %d", calls.Load())
+	}
+
+	p, writer := testProxy("up", "v1/chat/completions", strings.NewReader(body), int64(len(body)))
+	p.Request.Headers.Set("x-api-key", "sk-team")
+	if err := p.Direct(); err != nil || writer.status != http.StatusOK {
+		t.Fatalf("已知的 key 应正常转发: %v %d", err, writer.status)
+	}
+}
+
+func TestGatewayKeyLimits(t *testing.T) {
+	server, calls := testUpstream(t, "application/json", `{"ok":true}`)
+	testRoutes(t, ProxyDirectModelConfig{Type: "up", Domain: server.URL}, ProxyDirectModelConfig{Type: "other", Domain: server.URL})
+	saved := gatewayKeys
+	gatewayKeys = []GatewayKey{{Key: "sk-team", Name: "team", Routes: []string{"up"}, Models: []string{"gpt-4o*", "gemini-*"}}}
+	t.Cleanup(func() { gatewayKeys = saved })
+
+	for name, c := range map[string]struct{ route, path, body string }{
+		"route":        {"other", "v1/chat/completions", `{"model":"gpt-4o","messages":[]}`},
+		"model":        {"up", "v1/chat/completions", `{"model":"o3","messages":[]}`},
+		"gemini model": {"up", "v1beta/models/learnlm-2.0:generateContent", `{"contents":[]}`},
+	} {
+		p, _ := testProxy(c.route, c.path, strings.NewReader(c.body), int64(len(c.body)))
+		p.Request.Headers.Set("Authorization", "Bearer sk-team")
+		err := p.Direct()
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeForbidden || apiErr.Status != http.StatusForbidden {
+			t.Fatalf("%s: 无权使用时应返回 403: %v", name, err)
+		}
+		if dialect := Dialect(c.route, c.path); !strings.Contains(string(apiErr.JSON(dialect)), "not allowed") {
+			t.Fatalf("%s: 应按客户端协议返回错误: %s", name, apiErr.JSON(dialect))
+		}
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("被拒绝的请求不应发送到上游: %d", calls.Load())
+	}
+
+	for path, body := range map[string]string{
+		"v1/chat/completions":                            `{"model":"gpt-4o-mini","messages":[]}`,
+		"v1beta/models/gemini-2.5-flash:generateContent": `{"contents":[]}`,
+	} {
+		p, writer := testProxy("up", path, strings.NewReader(body), int64(len(body)))
+		p.Request.Headers.Set("Authorization", "Bearer sk-team")
+		if err := p.Direct(); err != nil || writer.status != http.StatusOK {
+			t.Fatalf("%s: 允许的路由与模型应正常转发: %v %d", path, err, writer.status)
+		}
+	}
+}
+
+func TestGatewayKeyNotForwarded(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	t.Cleanup(server.Close)
+	testRoutes(t, ProxyDirectModelConfig{Type: "up", Domain: server.URL})
+	saved := gatewayKeys
+	gatewayKeys = []GatewayKey{{Key: "sk-team", Name: "team"}}
+	t.Cleanup(func() { gatewayKeys = saved })
+
+	body := `{"contents":[]}`
+	p, writer := testProxy("up", "v1beta/models/gemini-2.5-flash:generateContent", strings.NewReader(body), int64(len(body)))
+	p.Request.QueryParams = map[string][]string{"key": {"sk-team"}, "alt": {"sse"}}
+	if err := p.Direct(); err != nil || writer.status != http.StatusOK {
+		t.Fatalf("查询参数携带网关 key 应正常转发: %v %d", err, writer.status)
+	}
+	if query.Has("key") || query.Get("alt") != "sse" {
+		t.Fatalf("网关 key 不应转发给上游，其它参数保留: %v", query)
+	}
+
+	// 通过请求头鉴权时，查询参数中客户端自带的上游凭证原样转发
+	p, _ = testProxy("up", "v1beta/models/gemini-2.5-flash:generateContent", strings.NewReader(body), int64(len(body)))
+	p.Request.Headers.Set("x-goog-api-key", "sk-team")
+	p.Request.QueryParams = map[string][]string{"key": {"AIza-upstream"}}
+	if err := p.Direct(); err != nil || query.Get("key") != "AIza-upstream" {
+		t.Fatalf("上游凭证应转发: %v %v", err, query)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	server, _ := testUpstream(t, "application/json", `{"ok":true}`)
+	testRoutes(t, ProxyDirectModelConfig{Type: "up", Domain: server.URL, Timeout: 600})
+	body := `{"model":"m","messages":[]}`
+	p, _ := testProxy("up", "v1/chat/completions", strings.NewReader(body), int64(len(body)))
+	var deadline time.Time
+	p.Request.ReadDeadline = func(t time.Time) error {
+		deadline = t
+		return nil
+	}
+	if err := p.Direct(); err != nil {
+		t.Fatal(err)
+	}
+	// 请求体的读取截止时间按路由的整体超时，不受 server 全局超时限制
+	if remaining := time.Until(deadline); remaining < 590*time.Second || remaining > 600*time.Second {
+		t.Fatalf("读取截止时间应为路由超时: %v", remaining)
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// embedding 协议不同、配置了单次调用上限或者可能有内容安全规则时由网关处理 embeddings 请求，否则直接转发
+func (p *ProxyDirect) embedding() bool {
+	client, upstream := p.Dialect(), p.UpstreamDialect()
+	if client == "" || upstream == "" || !convert.EmbeddingEndpoint(client, p.Request.Path) {
+		return false
+	}
+	return client != upstream || p.modelConfig.EmbeddingBatchSize > 0 || p.guardrailPossible()
+}
+
+// embed 请求按上游单次调用的上限拆分，依次调用后合并为客户端协议的响应
+func (p *ProxyDirect) embed() error {
+	client, upstream := p.Dialect(), p.UpstreamDialect()
+	req, err := convert.DecodeEmbeddingRequest(client, p.Request.Path, p.Request.Body)
+	if err != nil {
+		return convertRequestError(err, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "invalid "+client+" embeddings request body"))
+	}
+	if err := p.guardrailEmbedding(req); err != nil {
+		return err
+	}
+	upstreamReq := *req
+	if client != upstream {
+		upstreamReq.Model = upstreamModel(p.modelConfig, req.Model)
+	}
+	size := p.modelConfig.EmbeddingBatchSize
+	if limit := convert.EmbeddingBatchLimit(upstream); size <= 0 || (limit > 0 && size > limit) {
+		size = limit
+	}
+	var resps []*general.EmbeddingResponse
+	for _, batch := range convert.SplitEmbeddingRequest(&upstreamReq, size) {
+		resp, err := p.embedBatch(upstream, batch)
+		if err != nil {
+			return err
+		}
+		resps = append(resps, resp)
+	}
+	resp := convert.MergeEmbeddingResponses(resps)
+	if resp.Model == "" || client != upstream {
+		resp.Model = req.Model
+	}
+	body, err := convert.EncodeEmbeddingResponse(client, req, resp)
+	if err != nil {
+		return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert response fail")
+	}
+	p.proxyTraceLog("ResponseBody", body)
+	p.Response.Header().Set("Content-Type", "application/json")
+	p.Response.WriteStatusCode(http.StatusOK)
+	_, err = p.Response.Write(body)
+	p.proxyTraceLog("RequestEnd", "------")
+	return err
+}
+
+func (p *ProxyDirect) embedBatch(upstream string, req *general.EmbeddingRequest) (*general.EmbeddingResponse, error) {
+	path, body, err := convert.EncodeEmbeddingRequest(upstream, req)
+	if err != nil {
+		return nil, convertRequestError(err, apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "convert request fail"))
+	}
+	p.proxyTraceLog("ConvertRequestPath", path)
+	p.proxyTraceLog("ConvertRequestBody", body)
+	headers := http.Header(p.modelConfig.Headers).Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	if headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", "application/json")
+	}
+	httpReq, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.modelConfig.Domain+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, apierror.Wrap(err, apierror.CodeInvalidRequest, http.StatusBadRequest, false, "build upstream request fail")
+	}
+	httpReq.Header = headers
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, apierror.From(err)
+	}
+	defer resp.Body.Close()
+	p.proxyTraceLog("ResponseStatusCode", resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, apierror.From(err)
+	}
+	p.proxyTraceLog("UpstreamResponseBody", data)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, upstreamError(resp.StatusCode, data)
+	}
+	result, err := convert.DecodeEmbeddingResponse(upstream, data)
+	if err != nil {
+		return nil, apierror.Wrap(err, apierror.CodeUpstreamError, http.StatusBadGateway, false, "invalid upstream response")
+	}
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/guardrail"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+var (
+	guardrailFile string
+	guardrails    *guardrail.Set
+)
+
+func loadGuardrails() {
+	guardrailFile = initModelConfigFilePath(".aiapi/guardrails.json")
+	guardrails = initGuardrails()
+}
+
+// initGuardrails 配置文件不存在时不启用内容安全规则
+func initGuardrails() *guardrail.Set {
+	content, err := os.ReadFile(guardrailFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("配置文件读取失败: " + guardrailFile + " 错误: " + err.Error())
+	}
+	var policies []guardrail.Policy
+	if err := json.Unmarshal(content, &policies); err != nil {
+		panic("配置文件解析失败: " + guardrailFile + " 错误: " + err.Error())
+	}
+	set, err := guardrail.New(policies)
+	if err != nil {
+		panic("配置文件校验失败: " + guardrailFile + " 错误: " + err.Error())
+	}
+	return set
+}
+
+// GuardrailRules 本次请求命中的内容安全规则，记录到访问日志
+func (p *ProxyDirect) GuardrailRules() []string {
+	if p.guardrail == nil {
+		return nil
+	}
+	return p.guardrail.Fired()
+}
+
+// guardrailPossible 与 transformPossible 相同，请求体解析之前不考虑模型条件
+func (p *ProxyDirect) guardrailPossible() bool {
+	return guardrails.Possible(p.transformScope(""))
+}
+
+// guardrailRequest 在发送到上游之前最后执行，历史对话、脚本与改写规则加入的内容同样检查
+// 返回 true 表示请求被修改或者需要处理响应
+func (p *ProxyDirect) guardrailRequest(req *general.Request) (bool, error) {
+	guard := guardrails.Select(p.transformScope(p.conversion.model))
+	if guard == nil {
+		return false, nil
+	}
+	p.guardrail = guard.NewSession()
+	changed, err := p.guardrail.CheckRequest(req)
+	p.proxyTraceLog("GuardrailRules", p.guardrail.Fired())
+	if err != nil {
+		return true, guardrailError(err)
+	}
+	return changed || p.guardrail.Responding(), nil
+}
+
+// guardrailInputs embeddings 与 count tokens 请求只检查输入，没有响应需要处理
+func (p *ProxyDirect) guardrailInputs(model string, req *general.Request) error {
+	guard := guardrails.Select(p.transformScope(model))
+	if guard == nil {
+		return nil
+	}
+	p.guardrail = guard.NewSession()
+	_, err := p.guardrail.CheckRequest(req)
+	p.proxyTraceLog("GuardrailRules", p.guardrail.Fired())
+	if err != nil {
+		return guardrailError(err)
+	}
+	return nil
+}
+
+// guardrailEmbedding 输入直接在 req 中修改；token 数组无法检查，有规则生效时拒绝
+func (p *ProxyDirect) guardrailEmbedding(req *general.EmbeddingRequest) error {
+	if len(req.Tokens) > 0 && guardrails.Select(p.transformScope(req.Model)) != nil {
+		return apierror.New(apierror.CodeGuardrailBlocked, http.StatusBadRequest, false, "token array input can not be checked by guardrails")
+	}
+	return p.guardrailInputs(req.Model, &general.Request{Contents: req.Inputs})
+}
+
+// guardrailResponding 是否需要检查响应或还原 token
+func (p *ProxyDirect) guardrailResponding() bool {
+	return p.guardrail != nil && p.guardrail.Responding()
+}
+
+// guardrailResponse 非流式响应在其它响应处理之前执行
+func (p *ProxyDirect) guardrailResponse(resp *general.Response) error {
+	if !p.guardrailResponding() {
+		return nil
+	}
+	if err := p.guardrail.CheckResponse(resp); err != nil {
+		return guardrailError(err)
+	}
+	return nil
+}
+
+// guardrailStream 流式响应逐个增量检查，命中 block 规则时中止流，由 streamEvents 返回错误事件
+func (p *ProxyDirect) guardrailStream(stream *convert.StreamConverter) {
+	if !p.guardrailResponding() {
+		return
+	}
+	stream.OnDelta(func(delta *general.Response) {
+		if p.conversion.streamErr != nil {
+			return
+		}
+		if err := p.guardrail.CheckDelta(delta); err != nil {
+			delta.Candidates = nil
+			p.conversion.streamErr = guardrailError(err)
+		}
+	})
+	stream.OnFinish(func() []*general.Response {
+		if p.conversion.streamErr != nil {
+			return nil
+		}
+		delta, err := p.guardrail.Finish()
+		if err != nil {
+			p.conversion.streamErr = guardrailError(err)
+			return nil
+		}
+		if delta == nil {
+			return nil
+		}
+		return []*general.Response{delta}
+	})
+}
+
+func guardrailError(err error) error {
+	var blocked *guardrail.BlockedError
+	if errors.As(err, &blocked) {
+		return apierror.Wrap(err, apierror.CodeGuardrailBlocked, http.StatusBadRequest, false, blocked.Error())
+	}
+	return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "guardrail check fail")
+}
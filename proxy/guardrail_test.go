@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/guardrail"
+)
+
+// testGuardrails 替换内容安全规则，测试结束后恢复
+func testGuardrails(t *testing.T, config string) {
+	var policies []guardrail.Policy
+	if err := json.Unmarshal([]byte(config), &policies); err != nil {
+		t.Fatal(err)
+	}
+	set, err := guardrail.New(policies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := guardrails
+	guardrails = set
+	t.Cleanup(func() { guardrails = saved })
+}
+
+func TestGuardrailNonGenerate(t *testing.T) {
+	var received atomic.Value
+	calls := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1]}],"model":"m"}`)
+	}))
+	defer server.Close()
+	testRoutes(t, ProxyDirectModelConfig{Type: "openai", Domain: server.URL}, ProxyDirectModelConfig{Type: "claude", Domain: server.URL})
+	testGuardrails(t, `[{"rules":[{"detector":"email","action":"redact"},{"name":"secret","words":["secret"],"action":"block"}]}]`)
+
+	// embeddings 输入脱敏后发送给上游
+	body := `{"model":"m","input":["mail a@example.com"]}`
+	p, writer := testProxy("openai", "v1/embeddings", strings.NewReader(body), int64(len(body)))
+	if err := p.Direct(); err != nil || writer.status != http.StatusOK {
+		t.Fatalf("embeddings 请求失败: %v %d", err, writer.status)
+	}
+	if got, _ := received.Load().(string); strings.Contains(got, "a@example.com") || !strings.Contains(got, "[REDACTED_EMAIL]") {
+		t.Fatalf("embeddings 输入应脱敏: %s", got)
+	}
+	calls.Store(0)
+
+	for name, c := range map[string]struct{ route, path, body string }{
+		// count tokens 输入命中拦截规则
+		"count_tokens": {"claude", "v1/messages/count_tokens", `{"model":"c","messages":[{"role":"user","content":"secret plan"}]}`},
+		// 无法解析的请求不能绕过规则
+		"decode": {"openai", "v1/chat/completions", `{"model":"m","messages":"secret"}`},
+		// 无法检查的接口
+		"other": {"openai", "v1/audio/transcriptions", `secret`},
+	} {
+		p, _ := testProxy(c.route, c.path, strings.NewReader(c.body), int64(len(c.body)))
+		var apiErr *apierror.Error
+		if err := p.Direct(); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+			t.Fatalf("%s: 应返回 400: %v", name, err)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("被拒绝的请求不应发送到上游: %d", calls.Load())
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/injection"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+var (
+	injectionFile string
+	injections    *injection.Set
+)
+
+func loadInjections() {
+	injectionFile = initModelConfigFilePath(".aiapi/injection.json")
+	injections = initInjections()
+}
+
+// initInjections 配置文件不存在时不启用提示词注入检测
+func initInjections() *injection.Set {
+	content, err := os.ReadFile(injectionFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("配置文件读取失败: " + injectionFile + " 错误: " + err.Error())
+	}
+	var policies []injection.Policy
+	if err := json.Unmarshal(content, &policies); err != nil {
+		panic("配置文件解析失败: " + injectionFile + " 错误: " + err.Error())
+	}
+	set, err := injection.New(policies)
+	if err != nil {
+		panic("配置文件校验失败: " + injectionFile + " 错误: " + err.Error())
+	}
+	return set
+}
+
+// 审核模型默认超时
+const moderationTimeout = 10 * time.Second
+
+// InjectionVerdict 本次请求的提示词注入检测结果，没有检测时为空
+func (p *ProxyDirect) InjectionVerdict() *injection.Verdict {
+	return p.injection
+}
+
+// injectionPossible 与 transformPossible 相同，请求体解析之前不考虑模型条件；网关内部的审核请求不再检测
+func (p *ProxyDirect) injectionPossible() bool {
+	return !p.internal && injections.Possible(p.transformScope(""))
+}
+
+// injectionScan 在内容安全规则之后执行，审核模型看到的是已经脱敏的内容；检测不修改请求
+// 审核模型调用失败时只使用本地规则的结果
+func (p *ProxyDirect) injectionScan(req *general.Request) error {
+	if p.internal {
+		return nil
+	}
+	scanner := injections.Select(p.transformScope(p.conversion.model))
+	if scanner == nil {
+		return nil
+	}
+	inputs := scanner.Inputs(req)
+	if len(inputs) == 0 {
+		return nil
+	}
+	var moderation injection.Classifier
+	if config := scanner.Moderation(); config != nil {
+		moderation = &gatewayModeration{config: config, traceId: p.Request.TraceId}
+	}
+	verdict, err := scanner.Scan(p.ctx, inputs, moderation)
+	if err != nil {
+		slog.Warn("injection moderation fail.", "type", p.Request.Type, "route", scanner.Moderation().Route, "errStack", err)
+	}
+	p.injection = &verdict
+	p.proxyTraceLog("Injection", verdict)
+	if !verdict.Flagged {
+		return nil
+	}
+	slog.Warn("prompt injection detected.", "type", p.Request.Type, "policy", verdict.Policy, "action", verdict.Action,
+		"score", verdict.Score, "signals", verdict.Signals)
+	switch verdict.Action {
+	case injection.ActionFlag:
+		p.Response.Header().Set(constant.HeaderInjectionScore, strconv.FormatFloat(verdict.Score, 'f', 2, 64))
+		p.Response.Header().Set(constant.HeaderInjectionRules, strings.Join(verdict.Signals, ","))
+	case injection.ActionBlock:
+		return apierror.New(apierror.CodeInjectionBlocked, http.StatusBadRequest, false, "request blocked by prompt injection scanner")
+	}
+	return nil
+}
+
+// gatewayModeration 按 openai chat completions 协议通过网关的路由调用审核模型，由路由配置转换协议与模型名
+type gatewayModeration struct {
+	config  *injection.Moderation
+	traceId string
+}
+
+func (m *gatewayModeration) Classify(ctx context.Context, inputs []injection.Input) (injection.Result, error) {
+	timeout := moderationTimeout
+	if m.config.Timeout > 0 {
+		timeout = time.Duration(m.config.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	system, text := injection.ModerationPrompt, injection.ModerationInput(inputs)
+	temperature := float32(0)
+	req := &general.Request{
+		Model:             m.config.Model,
+		SystemInstruction: &general.Content{Parts: []general.Part{{Text: &system}}},
+		Contents:          []general.Content{{Role: general.RoleUser, Parts: []general.Part{{Text: &text}}}},
+		GenerationConfig:  &general.GenerationConfig{Temperature: &temperature},
+	}
+	path, body, err := convert.EncodeRequest(constant.DialectOpenAI, req)
+	if err != nil {
+		return injection.Result{}, err
+	}
+	writer := &bufferResponseWrite{header: http.Header{}}
+	internal := &ProxyDirect{
+		Request: &ProxyDirectRequest{
+			Context:       ctx,
+			TraceId:       m.traceId,
+			Type:          m.config.Route,
+			Path:          path,
+			Method:        http.MethodPost,
+			Headers:       http.Header{"Content-Type": {"application/json"}},
+			QueryParams:   map[string][]string{},
+			Body:          body,
+			ContentLength: int64(len(body)),
+		},
+		Response: writer,
+		internal: true,
+	}
+	if err := internal.Direct(); err != nil {
+		return injection.Result{}, err
+	}
+	if writer.status >= http.StatusBadRequest {
+		return injection.Result{}, fmt.Errorf("moderation status %d: %s", writer.status, writer.body.String())
+	}
+	resp, err := convert.DecodeResponse(constant.DialectOpenAI, writer.body.Bytes())
+	if err != nil {
+		return injection.Result{}, err
+	}
+	var reply strings.Builder
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if part.Text != nil && (part.Thought == nil || !*part.Thought) {
+				reply.WriteString(*part.Text)
+			}
+		}
+	}
+	score, ok := injection.ParseScore(reply.String())
+	if !ok {
+		return injection.Result{}, fmt.Errorf("moderation reply without score: %q", reply.String())
+	}
+	return injection.Result{Score: score, Signals: []string{"moderation"}}, nil
+}
+
+// bufferResponseWrite 网关内部请求的响应写入内存
+type bufferResponseWrite struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferResponseWrite) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferResponseWrite) WriteStatusCode(statusCode int) {
+	w.status = statusCode
+}
+
+func (w *bufferResponseWrite) Write(body []byte) (int, error) {
+	return w.body.Write(body)
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/lijcoder/aiapi/apierror"
+)
+
+var (
+	gatewayKeyFile string
+	gatewayKeys    []GatewayKey
+)
+
+func loadGatewayKeys() {
+	gatewayKeyFile = initModelConfigFilePath(".aiapi/gateway_keys.json")
+	gatewayKeys = initGatewayKeys()
+}
+
+// GatewayKey 网关分发给调用方的 key，routes、models 为空时不限制
+type GatewayKey struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	// 允许使用的路由 type
+	Routes []string `json:"routes"`
+	// 允许使用的模型，支持 * ? 通配符
+	Models []string `json:"models"`
+	// 允许调用管理接口
+	Admin bool `json:"admin"`
+}
+
+// AllowRoute 是否允许使用该路由
+func (k *GatewayKey) AllowRoute(route string) bool {
+	return k == nil || len(k.Routes) == 0 || slices.Contains(k.Routes, route)
+}
+
+// AllowModel 是否允许使用该模型
+func (k *GatewayKey) AllowModel(model string) bool {
+	if k == nil || len(k.Models) == 0 {
+		return true
+	}
+	for _, pattern := range k.Models {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// modelRestricted 是否限制了模型，限制时需要读取请求体得到模型名
+func (k *GatewayKey) modelRestricted() bool {
+	return k != nil && len(k.Models) > 0
+}
+
+// GatewayKeyEnabled 是否配置了网关 key，没有配置时不校验；配置后代理请求与模型列表都必须携带已知的 key
+func GatewayKeyEnabled() bool {
+	return len(gatewayKeys) > 0
+}
+
+// LookupGatewayKey 按各协议 SDK 的习惯读取 key：Authorization Bearer、x-api-key、x-goog-api-key、查询参数 key
+func LookupGatewayKey(headers http.Header, queryParams map[string][]string) (*GatewayKey, bool) {
+	for _, candidate := range requestCredentials(headers, queryParams) {
+		if candidate == "" {
+			continue
+		}
+		for i := range gatewayKeys {
+			if gatewayKeys[i].Key == candidate {
+				return &gatewayKeys[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// AdminKey 是否携带管理员 key，没有配置网关 key 时管理接口不可用
+func AdminKey(headers http.Header, queryParams map[string][]string) bool {
+	key, ok := LookupGatewayKey(headers, queryParams)
+	return ok && key.Admin
+}
+
+// withoutGatewayKey 去掉查询参数 key 中的网关 key，其它值(客户端自带的上游凭证)保留
+func withoutGatewayKey(queryParams map[string][]string) map[string][]string {
+	values, ok := queryParams["key"]
+	if !ok || !GatewayKeyEnabled() {
+		return queryParams
+	}
+	var kept []string
+	for _, value := range values {
+		if !slices.ContainsFunc(gatewayKeys, func(key GatewayKey) bool { return key.Key == value }) {
+			kept = append(kept, value)
+		}
+	}
+	result := make(map[string][]string, len(queryParams))
+	for name, values := range queryParams {
+		if name != "key" {
+			result[name] = values
+		}
+	}
+	if len(kept) > 0 {
+		result["key"] = kept
+	}
+	return result
+}
+
+// requestCredentials 请求中可能携带的凭证，未携带的为空字符串
+func requestCredentials(headers http.Header, queryParams map[string][]string) []string {
+	var candidates []string
+	if auth := headers.Get("Authorization"); auth != "" {
+		candidates = append(candidates, strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+	}
+	candidates = append(candidates, headers.Get("x-api-key"), headers.Get("x-goog-api-key"))
+	return append(candidates, queryParams["key"]...)
+}
+
+// initGatewayKeys 配置文件不存在时不启用网关 key
+func initGatewayKeys() []GatewayKey {
+	content, err := os.ReadFile(gatewayKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("配置文件读取失败: " + gatewayKeyFile + " 错误: " + err.Error())
+	}
+	var keys []GatewayKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		panic("配置文件解析失败: " + gatewayKeyFile + " 错误: " + err.Error())
+	}
+	return keys
+}
+
+// requestModel 请求使用的模型：gemini 在路径 models/{model}:method 中，其它协议在请求体的 model 字段；无法得知时返回空，只校验路由
+func requestModel(requestPath string, body []byte) string {
+	if _, rest, ok := strings.Cut(requestPath, "models/"); ok {
+		if model, _, ok := strings.Cut(rest, ":"); ok {
+			return model
+		}
+	}
+	var request struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+	return request.Model
+}
+
+func routeForbidden(route string) *apierror.Error {
+	return apierror.New(apierror.CodeForbidden, http.StatusForbidden, false, "gateway key is not allowed to use route: "+route)
+}
+
+func modelForbidden(model string) *apierror.Error {
+	return apierror.New(apierror.CodeForbidden, http.StatusForbidden, false, "gateway key is not allowed to use model: "+model)
+}
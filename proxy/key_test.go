@@ -0,0 +1,22 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAdminKey(t *testing.T) {
+	saved := gatewayKeys
+	gatewayKeys = []GatewayKey{{Key: "sk-admin", Name: "ops", Admin: true}, {Key: "sk-team", Name: "team"}}
+	t.Cleanup(func() { gatewayKeys = saved })
+
+	for credential, want := range map[string]bool{"Bearer sk-admin": true, "Bearer sk-team": false, "Bearer sk-other": false, "": false} {
+		headers := http.Header{}
+		if credential != "" {
+			headers.Set("Authorization", credential)
+		}
+		if got := AdminKey(headers, nil); got != want {
+			t.Fatalf("%q 管理员校验结果 %v，应为 %v", credential, got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/claude"
+	"github.com/lijcoder/aiapi/messages/gemini"
+	"github.com/lijcoder/aiapi/messages/openai"
+)
+
+const (
+	defaultModelListTtl   = 300
+	modelListFetchTimeout = 10 * time.Second
+	claudeDefaultVersion  = "2023-06-01"
+)
+
+// ModelListConfig 路由的模型列表，静态模型与上游拉取的模型合并
+type ModelListConfig struct {
+	Models []string `json:"models"`
+	// 是否从上游模型列表接口拉取
+	Fetch bool `json:"fetch"`
+	// 上游模型列表缓存时间(秒)，0 使用默认值 300
+	Ttl int `json:"ttl"`
+}
+
+// modelInfo 模型列表中的一项，route 为提供该模型的路由
+type modelInfo struct {
+	Id          string
+	DisplayName string
+	Route       string
+}
+
+// upstreamModels 上游模型列表缓存，拉取失败时继续使用过期的列表
+type upstreamModels struct {
+	mu        sync.Mutex
+	models    []modelInfo
+	fetchedAt time.Time
+}
+
+var upstreamModelCache sync.Map
+
+// ModelsDialect 模型列表的响应格式，v1beta 为 gemini，带 anthropic-version 请求头为 claude
+func ModelsDialect(path string, headers http.Header) string {
+	if strings.Contains(path, "v1beta/") {
+		return constant.DialectGemini
+	}
+	if headers.Get("anthropic-version") != "" {
+		return constant.DialectClaude
+	}
+	return constant.DialectOpenAI
+}
+
+// ListModels 汇总所有路由的模型，按调用方 key 过滤后以客户端协议的格式返回
+func ListModels(ctx context.Context, path string, headers http.Header, queryParams map[string][]string) ([]byte, error) {
+	var key *GatewayKey
+	if GatewayKeyEnabled() {
+		var ok bool
+		if key, ok = LookupGatewayKey(headers, queryParams); !ok {
+			return nil, apierror.New(apierror.CodeUnauthorized, http.StatusUnauthorized, false, "invalid gateway key")
+		}
+	}
+	models := collectModels(ctx, key)
+	switch ModelsDialect(path, headers) {
+	case constant.DialectGemini:
+		return json.Marshal(geminiModelList(models, queryParams))
+	case constant.DialectClaude:
+		result := claude.ModelList{Data: []claude.Model{}}
+		for _, model := range models {
+			result.Data = append(result.Data, claude.Model{Type: "model", Id: model.Id, DisplayName: model.DisplayName})
+		}
+		if len(models) > 0 {
+			result.FirstId, result.LastId = &models[0].Id, &models[len(models)-1].Id
+		}
+		return json.Marshal(result)
+	}
+	result := openai.ModelList{Object: "list", Data: []openai.Model{}}
+	for _, model := range models {
+		result.Data = append(result.Data, openai.Model{Id: model.Id, Object: "model", OwnedBy: model.Route})
+	}
+	return json.Marshal(result)
+}
+
+// collectModels 按路由配置顺序合并，同名模型以先出现的路由为准
+func collectModels(ctx context.Context, key *GatewayKey) []modelInfo {
+	fetched := make([][]modelInfo, len(modelConfig))
+	var wg sync.WaitGroup
+	for i, config := range modelConfig {
+		if !key.AllowRoute(config.Type) || config.ModelList == nil || !config.ModelList.Fetch {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetched[i] = cachedUpstreamModels(ctx, config)
+		}()
+	}
+	wg.Wait()
+	var result []modelInfo
+	seen := map[string]bool{}
+	add := func(model modelInfo) {
+		if seen[model.Id] || !key.AllowModel(model.Id) {
+			return
+		}
+		seen[model.Id] = true
+		result = append(result, model)
+	}
+	for i, config := range modelConfig {
+		if !key.AllowRoute(config.Type) {
+			continue
+		}
+		for _, id := range staticModels(config) {
+			add(modelInfo{Id: id, Route: config.Type})
+		}
+		for _, model := range fetched[i] {
+			add(model)
+		}
+	}
+	return result
+}
+
+// staticModels 静态配置的模型与模型映射中的客户端模型名
+func staticModels(config ProxyDirectModelConfig) []string {
+	var result []string
+	if config.ModelList != nil {
+		result = append(result, config.ModelList.Models...)
+	}
+	var mapped []string
+	for model := range config.Models {
+		if model != "*" {
+			mapped = append(mapped, model)
+		}
+	}
+	slices.Sort(mapped)
+	return append(result, mapped...)
+}
+
+func cachedUpstreamModels(ctx context.Context, config ProxyDirectModelConfig) []modelInfo {
+	value, _ := upstreamModelCache.LoadOrStore(config.Type, &upstreamModels{})
+	cached := value.(*upstreamModels)
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+	ttl := time.Duration(routeValue(config.ModelList.Ttl, defaultModelListTtl)) * time.Second
+	if !cached.fetchedAt.IsZero() && time.Since(cached.fetchedAt) < ttl {
+		return cached.models
+	}
+	models, err := fetchUpstreamModels(ctx, config)
+	if err != nil {
+		slog.Warn("fetch upstream models fail.", "type", config.Type, "errStack", err)
+		return cached.models
+	}
+	cached.models, cached.fetchedAt = models, time.Now()
+	return models
+}
+
+// fetchUpstreamModels 按上游协议调用模型列表接口
+func fetchUpstreamModels(ctx context.Context, config ProxyDirectModelConfig) ([]modelInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, modelListFetchTimeout)
+	defer cancel()
+	var result []modelInfo
+	switch config.Dialect {
+	case constant.DialectGemini:
+		pageToken := ""
+		for {
+			var list gemini.ListModelsResponse
+			path := "v1beta/models?pageSize=1000"
+			if pageToken != "" {
+				path += "&pageToken=" + url.QueryEscape(pageToken)
+			}
+			if err := getUpstreamJson(ctx, config, path, &list); err != nil {
+				return nil, err
+			}
+			for _, model := range list.Models {
+				result = append(result, modelInfo{Id: strings.TrimPrefix(model.Name, "models/"), DisplayName: model.DisplayName, Route: config.Type})
+			}
+			if pageToken = list.NextPageToken; pageToken == "" {
+				return result, nil
+			}
+		}
+	case constant.DialectClaude:
+		var list claude.ModelList
+		if err := getUpstreamJson(ctx, config, "v1/models?limit=1000", &list); err != nil {
+			return nil, err
+		}
+		for _, model := range list.Data {
+			result = append(result, modelInfo{Id: model.Id, DisplayName: model.DisplayName, Route: config.Type})
+		}
+	default:
+		var list openai.ModelList
+		if err := getUpstreamJson(ctx, config, "v1/models", &list); err != nil {
+			return nil, err
+		}
+		for _, model := range list.Data {
+			result = append(result, modelInfo{Id: model.Id, Route: config.Type})
+		}
+	}
+	return result, nil
+}
+
+func getUpstreamJson(ctx context.Context, config ProxyDirectModelConfig, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Domain+"/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = http.Header(config.Headers).Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	if config.Dialect == constant.DialectClaude && req.Header.Get("anthropic-version") == "" {
+		req.Header.Set("anthropic-version", claudeDefaultVersion)
+	}
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("list models fail. status: %d, body: %s", resp.StatusCode, data)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// geminiModelList 支持 pageSize、pageToken 分页，pageToken 为起始位置
+func geminiModelList(models []modelInfo, queryParams map[string][]string) gemini.ListModelsResponse {
+	start, size := 0, len(models)
+	if token := firstQuery(queryParams, "pageToken"); token != "" {
+		start, _ = strconv.Atoi(token)
+		start = min(max(start, 0), len(models))
+	}
+	if pageSize, _ := strconv.Atoi(firstQuery(queryParams, "pageSize")); pageSize > 0 {
+		size = pageSize
+	}
+	end := min(start+size, len(models))
+	result := gemini.ListModelsResponse{Models: []gemini.Model{}}
+	for _, model := range models[start:end] {
+		result.Models = append(result.Models, gemini.Model{
+			Name:                       "models/" + model.Id,
+			BaseModelId:                model.Id,
+			DisplayName:                model.DisplayName,
+			SupportedGenerationMethods: []string{"generateContent", "streamGenerateContent", "countTokens"},
+		})
+	}
+	if end < len(models) {
+		result.NextPageToken = strconv.Itoa(end)
+	}
+	return result
+}
+
+func firstQuery(queryParams map[string][]string, name string) string {
+	if values := queryParams[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
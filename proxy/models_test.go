@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lijcoder/aiapi/constant"
+)
+
+func TestFetchGeminiModelPages(t *testing.T) {
+	// 分页 token 包含查询参数中的特殊字符
+	token := "a+b/c=&pageSize=1"
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Query().Get("pageToken"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("pageToken") == "" {
+			w.Write([]byte(`{"models":[{"name":"models/a"}],"nextPageToken":"` + token + `"}`))
+			return
+		}
+		w.Write([]byte(`{"models":[{"name":"models/b"}]}`))
+	}))
+	defer server.Close()
+
+	models, err := fetchUpstreamModels(context.Background(), ProxyDirectModelConfig{Type: "gem", Domain: server.URL, Dialect: constant.DialectGemini})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[1].Id != "b" || len(received) != 2 || received[1] != token {
+		t.Fatalf("分页 token 应原样传给上游: %+v %q", models, received)
+	}
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/script"
+)
+
+// scriptStore Init 之前为空，不读写文件
+var scriptStore = &script.Store{}
+
+func loadScripts() {
+	file := initModelConfigFilePath(".aiapi/scripts.json")
+	store, err := script.Load(file)
+	if err != nil {
+		panic("配置文件加载失败: " + file + " 错误: " + err.Error())
+	}
+	scriptStore = store
+}
+
+// Scripts 脚本由管理接口维护，修改后立即生效
+func Scripts() *script.Store {
+	return scriptStore
+}
+
+// 认证信息不传给脚本
+var scriptHiddenHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "X-Goog-Api-Key", "Cookie"}
+
+// scriptLimits 启动参数在 init 之后解析，每次调用时读取
+func scriptLimits() script.Limits {
+	return script.Limits{
+		MaxSteps: uint64(max(constant.SCRIPT_MAX_STEPS, 0)),
+		Timeout:  time.Duration(max(constant.SCRIPT_TIMEOUT, 0)) * time.Millisecond,
+	}
+}
+
+// scriptPossible 与 transformPossible 相同，请求体解析之前不考虑模型条件
+func (p *ProxyDirect) scriptPossible() bool {
+	return scriptStore.Possible(p.transformScope(""))
+}
+
+// scriptRequest 按顺序执行请求钩子，拒绝时返回错误，改变路由时切换上游配置
+// 返回 true 表示请求被修改或者有响应钩子，需要经过通用格式
+func (p *ProxyDirect) scriptRequest(req *general.Request) (bool, error) {
+	scope := p.transformScope(p.conversion.model)
+	hooks := scriptStore.Select(script.HookRequest, scope)
+	p.conversion.responseScripts = scriptStore.Select(script.HookResponse, scope)
+	if len(hooks) == 0 && len(p.conversion.responseScripts) == 0 {
+		return false, nil
+	}
+	var names []string
+	for _, name := range append(script.Names(hooks), script.Names(p.conversion.responseScripts)...) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	p.proxyTraceLog("Scripts", names)
+	p.Response.Header().Set(constant.HeaderScripts, strings.Join(names, ","))
+
+	p.conversion.scriptMeta = script.Meta{
+		Route:    scope.Route,
+		Model:    scope.Model,
+		Key:      scope.Key,
+		Dialect:  p.conversion.client,
+		Upstream: p.conversion.upstream,
+		Method:   p.Request.Method,
+		Path:     p.Request.Path,
+		Headers:  map[string]string{},
+		Stream:   req.Stream,
+	}
+	for name, values := range p.Request.Headers {
+		if len(values) > 0 && !slices.Contains(scriptHiddenHeaders, http.CanonicalHeaderKey(name)) {
+			p.conversion.scriptMeta.Headers[strings.ToLower(name)] = values[0]
+		}
+	}
+	changed := len(p.conversion.responseScripts) > 0
+	route := ""
+	for _, hook := range hooks {
+		result, err := hook.RunRequest(p.ctx, req, p.conversion.scriptMeta, scriptLimits())
+		if err != nil {
+			return true, apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "script request fail")
+		}
+		if result.Reject != nil {
+			p.proxyTraceLog("ScriptReject", hook.Name)
+			return true, apierror.New(apierror.CodeScriptRejected, result.Reject.Status, false, result.Reject.Message)
+		}
+		changed = changed || result.Changed
+		if result.Route != "" {
+			route = result.Route
+		}
+	}
+	if route != "" && route != p.modelConfig.Type {
+		// 脚本不能把请求转到 key 无权使用的路由
+		if !p.gatewayKey.AllowRoute(route) {
+			return true, routeForbidden(route)
+		}
+		config, ok := getModelConfig(route)
+		if !ok {
+			return true, apierror.New(apierror.CodeModelConfigNotFound, http.StatusInternalServerError, false, "script reroute config not found. type: "+route)
+		}
+		p.proxyTraceLog("ScriptReroute", route)
+		p.Response.Header().Set(constant.HeaderRoute, route)
+		p.modelConfig = config
+		p.conversion.upstream = p.UpstreamDialect()
+	}
+	return changed, nil
+}
+
+// scriptResponse 非流式响应执行响应钩子
+func (p *ProxyDirect) scriptResponse(resp *general.Response) error {
+	for _, hook := range p.conversion.responseScripts {
+		result, err := hook.RunResponse(p.ctx, resp, p.conversion.scriptMeta, scriptLimits())
+		if err != nil {
+			return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "script response fail")
+		}
+		if result.Reject != nil {
+			p.proxyTraceLog("ScriptReject", hook.Name)
+			return apierror.New(apierror.CodeScriptRejected, result.Reject.Status, false, result.Reject.Message)
+		}
+	}
+	return nil
+}
+
+// scriptStream 流式响应对每个增量执行响应钩子，执行失败时保留原增量；拒绝时中止流，由 streamEvents 返回错误事件
+func (p *ProxyDirect) scriptStream(stream *convert.StreamConverter) {
+	hooks := p.conversion.responseScripts
+	if len(hooks) == 0 {
+		return
+	}
+	meta := p.conversion.scriptMeta
+	meta.Stream = true
+	stream.OnDelta(func(delta *general.Response) {
+		if p.conversion.streamErr != nil {
+			return
+		}
+		for _, hook := range hooks {
+			result, err := hook.RunResponse(p.ctx, delta, meta, scriptLimits())
+			if err != nil {
+				slog.Warn("script stream response fail.", "type", p.Request.Type, "script", hook.Name, "errStack", err)
+				continue
+			}
+			if result.Reject != nil {
+				p.proxyTraceLog("ScriptReject", hook.Name)
+				p.conversion.streamErr = apierror.New(apierror.CodeScriptRejected, result.Reject.Status, false, result.Reject.Message)
+				return
+			}
+		}
+		meta.Index++
+	})
+}
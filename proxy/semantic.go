@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lijcoder/aiapi/cache"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+const defaultSemanticThreshold = 0.95
+
+type SemanticCacheConfig struct {
+	Enable bool `json:"enable"`
+	// 余弦相似度阈值，默认 0.95，可按模型单独配置
+	Threshold       float32            `json:"threshold"`
+	ModelThresholds map[string]float32 `json:"modelThresholds"`
+	// 向量化接口，不配置时使用本地实现
+	Embedding *EmbeddingConfig `json:"embedding"`
+	// 过期时间(秒)，0 不过期
+	Ttl int `json:"ttl"`
+	// 索引中向量总数上限，0 不限制
+	MaxEntries       int  `json:"maxEntries"`
+	IncludeTools     bool `json:"includeTools"`
+	NonDeterministic bool `json:"nonDeterministic"`
+}
+
+// EmbeddingConfig OpenAI 兼容的 embeddings 接口
+type EmbeddingConfig struct {
+	Url     string              `json:"url"`
+	Model   string              `json:"model"`
+	Headers map[string][]string `json:"headers"`
+}
+
+type semanticCache struct {
+	index    cache.VectorIndex
+	embedder cache.Embedder
+}
+
+var semanticCaches sync.Map
+
+func getSemanticCache(modelType string, config *SemanticCacheConfig) *semanticCache {
+	if sc, ok := semanticCaches.Load(modelType); ok {
+		return sc.(*semanticCache)
+	}
+	var embedder cache.Embedder = &cache.LocalEmbedder{}
+	if config.Embedding != nil && config.Embedding.Url != "" {
+		embedder = &cache.HttpEmbedder{
+			Url:     config.Embedding.Url,
+			Model:   config.Embedding.Model,
+			Headers: config.Embedding.Headers,
+		}
+	}
+	sc := &semanticCache{
+		index:    cache.NewMemoryIndex(time.Duration(config.Ttl)*time.Second, config.MaxEntries),
+		embedder: embedder,
+	}
+	actual, _ := semanticCaches.LoadOrStore(modelType, sc)
+	return actual.(*semanticCache)
+}
+
+func (p *ProxyDirect) semanticCacheEnabled() bool {
+	return p.modelConfig.SemanticCache != nil && p.modelConfig.SemanticCache.Enable
+}
+
+// semanticCacheLookup 对最后一轮用户输入向量化，其余部分必须完全一致
+func (p *ProxyDirect) semanticCacheLookup(req *general.Request) (bool, error) {
+	if !p.semanticCacheEnabled() {
+		return false, nil
+	}
+	config := p.modelConfig.SemanticCache
+	text, history, ok := splitLastUserTurn(req)
+	if !ok || !cacheable(req, config.IncludeTools, config.NonDeterministic) {
+		p.Response.Header().Set(constant.HeaderSemanticCache, cacheBypass)
+		return false, nil
+	}
+	sc := getSemanticCache(p.modelConfig.Type, config)
+	vector, err := sc.embedder.Embed(p.ctx, text)
+	if err != nil {
+		slog.Warn("semantic cache embed fail.", "type", p.Request.Type, "errStack", err)
+		p.Response.Header().Set(constant.HeaderSemanticCache, cacheBypass)
+		return false, nil
+	}
+	scope := cache.Key(p.Dialect(), p.modelConfig.Type, p.transformScope("").Key, p.Request.Path, req.Model, history)
+	entry, score, found := sc.index.Search(scope, vector)
+	if found {
+		p.Response.Header().Set(constant.HeaderSemanticCacheScore, strconv.FormatFloat(float64(score), 'f', 4, 32))
+	}
+	if found && score >= semanticThreshold(config, req.Model) {
+		p.proxyTraceLog("ResponseSemanticCache", cacheHit)
+		p.Response.Header().Set(constant.HeaderSemanticCache, cacheHit)
+		return true, p.cacheReplay(entry)
+	}
+	p.Response.Header().Set(constant.HeaderSemanticCache, cacheMiss)
+	p.semanticIndex = sc.index
+	p.semanticScope = scope
+	p.semanticVector = vector
+	if p.cacheEntry == nil {
+		p.cacheEntry = &cache.Entry{StatusCode: http.StatusOK}
+	}
+	return false, nil
+}
+
+func semanticThreshold(config *SemanticCacheConfig, model string) float32 {
+	if threshold, ok := config.ModelThresholds[model]; ok {
+		return threshold
+	}
+	if config.Threshold > 0 {
+		return config.Threshold
+	}
+	return defaultSemanticThreshold
+}
+
+// splitLastUserTurn 拆分出最后一轮用户文本，其余部分作为比较范围
+func splitLastUserTurn(req *general.Request) (string, general.Request, bool) {
+	history := *req
+	if len(req.Contents) == 0 {
+		return "", history, false
+	}
+	last := req.Contents[len(req.Contents)-1]
+	if last.Role != general.RoleUser {
+		return "", history, false
+	}
+	text := ""
+	for _, part := range last.Parts {
+		if part.Text != nil {
+			text += *part.Text
+		} else {
+			// 包含函数结果等非文本内容时不做语义匹配
+			return "", history, false
+		}
+	}
+	if text == "" {
+		return "", history, false
+	}
+	history.Contents = req.Contents[:len(req.Contents)-1]
+	return text, history, true
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/ndjson"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+type streamResult struct {
+	event sse.Event
+	err   error
+}
+
+// isStream SSE 与 NDJSON 都是流式响应
+func isStream(contentType string) bool {
+	return strings.Contains(contentType, sse.ContentType) || strings.Contains(contentType, ndjson.ContentType)
+}
+
+// streamDecoder SSE 与 NDJSON 的解析器，NDJSON 的每一行作为事件的 data
+type streamDecoder interface {
+	Next() (sse.Event, error)
+}
+
+func newStreamDecoder(contentType string, body io.Reader) streamDecoder {
+	if strings.Contains(contentType, ndjson.ContentType) {
+		return ndjson.NewDecoder(body)
+	}
+	return sse.NewDecoder(body)
+}
+
+// marshalEvent 按客户端的流式格式输出事件，NDJSON 没有注释，心跳返回 nil
+func (p *ProxyDirect) marshalEvent(event sse.Event) []byte {
+	if p.streamNdjson {
+		return ndjson.Marshal(event)
+	}
+	return sse.Marshal(event)
+}
+
+// proxyResponseStream 转发 SSE(NDJSON) 事件，upstreamContentType 决定上游事件的解析方式
+func (p *ProxyDirect) proxyResponseStream(upstreamContentType string) error {
+	decoder := newStreamDecoder(upstreamContentType, p.proxyResponse.Body)
+	heartbeatInterval := routeSeconds(p.modelConfig.StreamHeartbeat, constant.STREAM_HEARTBEAT)
+	idleTimeout := routeSeconds(p.modelConfig.StreamIdleTimeout, constant.STREAM_IDLE_TIMEOUT)
+	return p.streamLoop(decoder, heartbeatInterval, idleTimeout)
+}
+
+// streamLoop 上游静默期间按间隔发送心跳注释，上游空闲或整体超时(p.ctx)时发送对应协议的错误事件并结束
+func (p *ProxyDirect) streamLoop(decoder streamDecoder, heartbeatInterval, idleTimeout time.Duration) error {
+	events := make(chan streamResult)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			event, err := decoder.Next()
+			select {
+			case events <- streamResult{event: event, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := newStreamTimer(heartbeatInterval)
+	defer heartbeat.Stop()
+	idle := newStreamTimer(idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case result := <-events:
+			if result.err != nil {
+				if result.err == io.EOF {
+					events, finishErr := p.streamFinish()
+					if finishErr != nil {
+						return p.proxyStreamError(apierror.From(finishErr))
+					}
+					for _, event := range events {
+						if writeErr := p.proxyStreamWrite(event); writeErr != nil {
+							return writeErr
+						}
+					}
+					p.cacheSave(nil)
+					p.conversationStreamSave()
+					return nil
+				}
+				if p.ctx.Err() != nil {
+					return p.proxyStreamContextDone()
+				}
+				return p.proxyStreamError(apierror.Wrap(result.err, apierror.CodeStreamInterrupted,
+					http.StatusBadGateway, true, "upstream stream interrupted"))
+			}
+			events, convertErr := p.streamEvents(result.event)
+			if convertErr != nil {
+				return p.proxyStreamError(apierror.From(convertErr))
+			}
+			for _, event := range events {
+				if writeErr := p.proxyStreamWrite(event); writeErr != nil {
+					return writeErr
+				}
+			}
+			heartbeat.Reset(heartbeatInterval)
+			idle.Reset(idleTimeout)
+		case <-heartbeat.C:
+			if msg := p.marshalEvent(sse.Event{Comments: []string{"keep-alive"}}); msg != nil {
+				p.proxyTraceLog("ResponseSSEHeartbeat", msg)
+				if _, writeErr := p.Response.Write(msg); writeErr != nil {
+					return writeErr
+				}
+			}
+			heartbeat.Reset(heartbeatInterval)
+		case <-idle.C:
+			return p.proxyStreamError(apierror.New(apierror.CodeStreamIdleTimeout, http.StatusGatewayTimeout,
+				true, "upstream stream idle for "+idleTimeout.String()))
+		case <-p.ctx.Done():
+			return p.proxyStreamContextDone()
+		}
+	}
+}
+
+func (p *ProxyDirect) proxyStreamWrite(event sse.Event) error {
+	msg := p.marshalEvent(event)
+	p.proxyTraceLog("ResponseSSEBody", msg)
+	if _, err := p.Response.Write(msg); err != nil {
+		return err
+	}
+	p.cacheRecordEvent(event)
+	return nil
+}
+
+// proxyStreamContextDone 整体超时发送错误事件，客户端断开则直接结束
+func (p *ProxyDirect) proxyStreamContextDone() error {
+	if errors.Is(p.ctx.Err(), context.DeadlineExceeded) {
+		return p.proxyStreamError(apierror.Wrap(p.ctx.Err(), apierror.CodeUpstreamTimeout, http.StatusGatewayTimeout,
+			true, "stream exceeded the request timeout"))
+	}
+	return apierror.From(p.ctx.Err())
+}
+
+// proxyStreamError 响应头已经写出，只能通过对应协议的错误事件通知客户端
+func (p *ProxyDirect) proxyStreamError(apiErr *apierror.Error) error {
+	event := apiErr.Event(p.Dialect())
+	msg := p.marshalEvent(event)
+	p.proxyTraceLog("ResponseSSEError", msg)
+	if _, err := p.Response.Write(msg); err != nil {
+		return err
+	}
+	return apiErr
+}
+
+// streamTimer 间隔为 0 时不触发
+type streamTimer struct {
+	*time.Timer
+}
+
+func newStreamTimer(d time.Duration) *streamTimer {
+	timer := time.NewTimer(d)
+	if d <= 0 {
+		timer.Stop()
+	}
+	return &streamTimer{Timer: timer}
+}
+
+func (t *streamTimer) Reset(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t.Timer.Reset(d)
+}
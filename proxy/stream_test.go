@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/sse"
+)
+
+// testDecoder 每个事件之前等待 delay，事件用完后立即返回 io.EOF
+type testDecoder struct {
+	events []string
+	delay  time.Duration
+}
+
+func (d *testDecoder) Next() (sse.Event, error) {
+	if len(d.events) == 0 {
+		return sse.Event{}, io.EOF
+	}
+	time.Sleep(d.delay)
+	data := d.events[0]
+	d.events = d.events[1:]
+	return sse.Event{Data: data, HasData: true}, nil
+}
+
+// testStreamProxy claude 客户端的流式代理，timeout 为整体超时，0 不限制
+func testStreamProxy(t *testing.T, timeout time.Duration) (*ProxyDirect, *bufferResponseWrite) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		t.Cleanup(cancel)
+	}
+	writer := &bufferResponseWrite{header: http.Header{}}
+	p := &ProxyDirect{
+		Request:  &ProxyDirectRequest{Type: "test", Path: "v1/messages", Headers: http.Header{}},
+		Response: writer,
+		ctx:      ctx,
+	}
+	return p, writer
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	p, writer := testStreamProxy(t, 0)
+	decoder := &testDecoder{events: []string{`{"n":1}`, `{"n":2}`}, delay: 80 * time.Millisecond}
+	if err := p.streamLoop(decoder, 20*time.Millisecond, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	body := writer.body.String()
+	if !strings.Contains(body, ": keep-alive\n") || !strings.HasSuffix(body, "data: {\"n\":2}\n\n") {
+		t.Fatalf("上游静默期间应发送心跳并转发全部事件:\n%s", body)
+	}
+	if first := strings.Index(body, ": keep-alive"); first > strings.Index(body, `{"n":1}`) {
+		t.Fatalf("第一个事件之前应发送心跳:\n%s", body)
+	}
+
+	// NDJSON 没有注释，不发送心跳
+	p, writer = testStreamProxy(t, 0)
+	p.streamNdjson = true
+	decoder = &testDecoder{events: []string{`{"n":1}`}, delay: 60 * time.Millisecond}
+	if err := p.streamLoop(decoder, 10*time.Millisecond, 0); err != nil {
+		t.Fatal(err)
+	}
+	if body := writer.body.String(); body != "{\"n\":1}\n" {
+		t.Fatalf("NDJSON 不应发送心跳: %q", body)
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	p, writer := testStreamProxy(t, 0)
+	decoder := &testDecoder{events: []string{`{"n":1}`}, delay: time.Second}
+	err := p.streamLoop(decoder, 0, 50*time.Millisecond)
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeStreamIdleTimeout || !apiErr.Retryable {
+		t.Fatalf("上游空闲应返回 stream_idle_timeout: %v", err)
+	}
+	if body := writer.body.String(); !strings.HasPrefix(body, "event: error\ndata: ") || !strings.Contains(body, `"type":"error"`) {
+		t.Fatalf("应发送 claude 错误事件: %q", body)
+	}
+}
+
+func TestStreamDeadline(t *testing.T) {
+	p, writer := testStreamProxy(t, 120*time.Millisecond)
+	// 上游持续输出，空闲超时不会触发，由整体超时结束
+	decoder := &testDecoder{events: slices.Repeat([]string{`{"n":1}`}, 50), delay: 20 * time.Millisecond}
+	err := p.streamLoop(decoder, 0, 50*time.Millisecond)
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeUpstreamTimeout {
+		t.Fatalf("整体超时应返回 upstream_timeout: %v", err)
+	}
+	body := writer.body.String()
+	if last := strings.LastIndex(body, `data: {"n":1}`); last < 0 || strings.Index(body, "event: error\ndata: ") < last {
+		t.Fatalf("超时前的事件应转发，最后发送错误事件:\n%s", body)
+	}
+
+	// 客户端断开时不发送错误事件
+	p, writer = testStreamProxy(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	p.ctx = ctx
+	time.AfterFunc(50*time.Millisecond, cancel)
+	decoder = &testDecoder{events: []string{`{"n":1}`}, delay: time.Second}
+	if err := p.streamLoop(decoder, 0, 0); !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeClientClosed || writer.body.Len() != 0 {
+		t.Fatalf("客户端断开应直接结束: %v %q", err, writer.body.String())
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lijcoder/aiapi/apierror"
+	"github.com/lijcoder/aiapi/constant"
+	"github.com/lijcoder/aiapi/convert"
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/transform"
+)
+
+var (
+	transformFile  string
+	transformRules []transform.Rule
+)
+
+func loadTransforms() {
+	transformFile = initModelConfigFilePath(".aiapi/transforms.json")
+	transformRules = initTransformRules()
+}
+
+// initTransformRules 配置文件不存在时不启用改写规则
+func initTransformRules() []transform.Rule {
+	content, err := os.ReadFile(transformFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("配置文件读取失败: " + transformFile + " 错误: " + err.Error())
+	}
+	var rules []transform.Rule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		panic("配置文件解析失败: " + transformFile + " 错误: " + err.Error())
+	}
+	if err := transform.Validate(rules); err != nil {
+		panic("配置文件校验失败: " + transformFile + " 错误: " + err.Error())
+	}
+	return rules
+}
+
+// transformScope 规则按路由、客户端请求的模型、网关 key 的名称匹配，脚本改变路由后按新路由匹配
+func (p *ProxyDirect) transformScope(model string) transform.Scope {
+	scope := transform.Scope{Route: p.modelConfig.Type, Model: model}
+	if key, ok := LookupGatewayKey(p.Request.Headers, p.Request.QueryParams); ok {
+		scope.Key = key.Name
+	}
+	return scope
+}
+
+// transformPossible 协议相同时请求体未解析，先不考虑模型条件判断是否可能有规则生效
+func (p *ProxyDirect) transformPossible() bool {
+	if len(transformRules) == 0 {
+		return false
+	}
+	scope := p.transformScope("")
+	return slices.ContainsFunc(transformRules, func(rule transform.Rule) bool {
+		match := rule.Match
+		match.Models = nil
+		return match.Matches(scope)
+	})
+}
+
+// transformRequest 选出本次请求生效的规则并改写请求，响应规则保存到 conversion 中
+// 返回 false 表示没有规则生效
+func (p *ProxyDirect) transformRequest(req *general.Request) (bool, error) {
+	if len(transformRules) == 0 {
+		return false, nil
+	}
+	scope := p.transformScope(p.conversion.model)
+	rules := transform.Select(transformRules, transform.TargetRequest, scope)
+	p.conversion.responseRules = transform.Select(transformRules, transform.TargetResponse, scope)
+	if len(rules) == 0 && len(p.conversion.responseRules) == 0 {
+		return false, nil
+	}
+	names := append(transform.Names(rules), transform.Names(p.conversion.responseRules)...)
+	p.proxyTraceLog("TransformRules", names)
+	p.Response.Header().Set(constant.HeaderTransforms, strings.Join(names, ","))
+	if len(rules) == 0 {
+		return true, nil
+	}
+	if err := transform.ApplyRequest(rules, req); err != nil {
+		return true, apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "transform request fail")
+	}
+	return true, nil
+}
+
+// transformResponse 非流式响应执行响应规则
+func (p *ProxyDirect) transformResponse(resp *general.Response) error {
+	if len(p.conversion.responseRules) == 0 {
+		return nil
+	}
+	if err := transform.ApplyResponse(p.conversion.responseRules, resp); err != nil {
+		return apierror.Wrap(err, apierror.CodeInternal, http.StatusInternalServerError, false, "transform response fail")
+	}
+	return nil
+}
+
+// transformStream 流式响应对每个增量执行响应规则，响应头已经写出，失败时保留原增量
+func (p *ProxyDirect) transformStream(stream *convert.StreamConverter) {
+	rules := p.conversion.responseRules
+	if len(rules) == 0 {
+		return
+	}
+	stream.OnDelta(func(delta *general.Response) {
+		if err := transform.ApplyResponse(rules, delta); err != nil {
+			slog.Warn("transform stream response fail.", "type", p.Request.Type, "errStack", err)
+		}
+	})
+}
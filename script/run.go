@@ -0,0 +1,330 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Limits 单次调用的限制，超过时中止脚本
+type Limits struct {
+	// 执行步数上限，限制 CPU 占用，0 不限制
+	MaxSteps uint64
+	// 执行时间上限，0 不限制
+	Timeout time.Duration
+}
+
+// 顶层代码只在编译时执行一次
+var compileLimits = Limits{MaxSteps: 1_000_000, Timeout: time.Second}
+
+var fileOptions = &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true}
+
+// Meta 请求信息，脚本中为只读的 dict
+type Meta struct {
+	// 路由 type(上游服务)
+	Route string `json:"route"`
+	// 客户端请求的模型
+	Model string `json:"model"`
+	// 网关 key 的名称
+	Key      string `json:"key"`
+	Dialect  string `json:"dialect"`
+	Upstream string `json:"upstream"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	// 请求头，名称为小写，不包含认证信息
+	Headers map[string]string `json:"headers"`
+	Stream  bool              `json:"stream"`
+	// 流式响应增量的序号，从 0 开始
+	Index int `json:"index"`
+}
+
+// Result 脚本的处理结果
+type Result struct {
+	// message 是否被修改
+	Changed bool
+	// 非空时拒绝请求
+	Reject *Reject
+	// 非空时改为发送到该路由
+	Route string
+}
+
+type Reject struct {
+	Status  int
+	Message string
+}
+
+// RunRequest 执行 on_request，拒绝时不修改 req
+func (h *Hook) RunRequest(ctx context.Context, req *general.Request, meta Meta, limits Limits) (Result, error) {
+	var out general.Request
+	result, err := h.run(ctx, h.onRequest, req, &out, meta, limits)
+	if err != nil {
+		return Result{}, err
+	}
+	if result.Changed {
+		*req = out
+	}
+	return result, nil
+}
+
+// RunResponse 执行 on_response，不能改变路由
+func (h *Hook) RunResponse(ctx context.Context, resp *general.Response, meta Meta, limits Limits) (Result, error) {
+	var out general.Response
+	result, err := h.run(ctx, h.onResponse, resp, &out, meta, limits)
+	if err != nil {
+		return Result{}, err
+	}
+	if result.Route != "" {
+		return Result{}, fmt.Errorf("script %s: reroute is only allowed in %s", h.Name, HookRequest)
+	}
+	if result.Changed {
+		*resp = out
+	}
+	return result, nil
+}
+
+func (h *Hook) run(ctx context.Context, fn starlark.Callable, in any, out any, meta Meta, limits Limits) (Result, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return Result{}, err
+	}
+	message, err := decodeValue(data)
+	if err != nil {
+		return Result{}, err
+	}
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return Result{}, err
+	}
+	metaValue, err := decodeValue(metaData)
+	if err != nil {
+		return Result{}, err
+	}
+	metaValue.Freeze()
+
+	thread, stop := newThread(ctx, h.Name, limits)
+	defer stop()
+	value, err := starlark.Call(thread, fn, starlark.Tuple{message, metaValue}, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("script %s: %w", h.Name, err)
+	}
+	var result Result
+	switch v := value.(type) {
+	case starlark.NoneType:
+	case *starlark.Dict:
+		message = v
+	case *rejectValue:
+		result.Reject = &Reject{Status: v.status, Message: v.message}
+		return result, nil
+	case *rerouteValue:
+		result.Route = v.route
+	default:
+		return Result{}, fmt.Errorf("script %s: %s returns %s, want None, dict, reject() or reroute()", h.Name, fn.Name(), value.Type())
+	}
+
+	goValue, err := toGo(message, 0)
+	if err != nil {
+		return Result{}, fmt.Errorf("script %s: %w", h.Name, err)
+	}
+	changed, err := json.Marshal(goValue)
+	if err != nil {
+		return Result{}, fmt.Errorf("script %s: %w", h.Name, err)
+	}
+	if err := json.Unmarshal(changed, out); err != nil {
+		return Result{}, fmt.Errorf("script %s: returned message is invalid: %w", h.Name, err)
+	}
+	// 重新序列化后比较，字段顺序与原消息一致
+	if changed, err = json.Marshal(out); err != nil {
+		return Result{}, err
+	}
+	result.Changed = !bytes.Equal(changed, data)
+	return result, nil
+}
+
+func execFile(name string, source string) (starlark.StringDict, error) {
+	thread, stop := newThread(context.Background(), name, compileLimits)
+	defer stop()
+	return starlark.ExecFileOptions(fileOptions, thread, name+".star", source, predeclared)
+}
+
+// newThread 步数超限时 starlark 返回错误，超时或请求取消时中止执行
+func newThread(ctx context.Context, name string, limits Limits) (*starlark.Thread, func()) {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			slog.Info("script print.", "script", name, "msg", msg)
+		},
+	}
+	if limits.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(limits.MaxSteps)
+	}
+	var stops []func() bool
+	if limits.Timeout > 0 {
+		timer := time.AfterFunc(limits.Timeout, func() {
+			thread.Cancel("timeout after " + limits.Timeout.String())
+		})
+		stops = append(stops, timer.Stop)
+	}
+	stops = append(stops, context.AfterFunc(ctx, func() {
+		thread.Cancel(context.Cause(ctx).Error())
+	}))
+	return thread, func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// 脚本可以使用的内置函数
+var predeclared = starlark.StringDict{
+	"reject":  starlark.NewBuiltin("reject", reject),
+	"reroute": starlark.NewBuiltin("reroute", reroute),
+	"json":    starlarkjson.Module,
+}
+
+// reject(message, status=403)
+func reject(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var message string
+	status := http.StatusForbidden
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "message", &message, "status?", &status); err != nil {
+		return nil, err
+	}
+	if status < http.StatusBadRequest || status > 599 {
+		return nil, fmt.Errorf("%s: status must be 4xx or 5xx, got %d", fn.Name(), status)
+	}
+	return &rejectValue{status: status, message: message}, nil
+}
+
+// reroute(route)
+func reroute(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var route string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "route", &route); err != nil {
+		return nil, err
+	}
+	if route == "" {
+		return nil, fmt.Errorf("%s: route is required", fn.Name())
+	}
+	return &rerouteValue{route: route}, nil
+}
+
+type rejectValue struct {
+	status  int
+	message string
+}
+
+func (r *rejectValue) String() string        { return fmt.Sprintf("reject(%q, %d)", r.message, r.status) }
+func (r *rejectValue) Type() string          { return "reject" }
+func (r *rejectValue) Freeze()               {}
+func (r *rejectValue) Truth() starlark.Bool  { return starlark.True }
+func (r *rejectValue) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", r.Type()) }
+
+type rerouteValue struct {
+	route string
+}
+
+func (r *rerouteValue) String() string        { return fmt.Sprintf("reroute(%q)", r.route) }
+func (r *rerouteValue) Type() string          { return "reroute" }
+func (r *rerouteValue) Freeze()               {}
+func (r *rerouteValue) Truth() starlark.Bool  { return starlark.True }
+func (r *rerouteValue) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", r.Type()) }
+
+// decodeValue JSON 转换为 starlark 值，整数保持为 int
+func decodeValue(data []byte) (starlark.Value, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return toValue(value), nil
+}
+
+func toValue(value any) starlark.Value {
+	switch v := value.(type) {
+	case bool:
+		return starlark.Bool(v)
+	case string:
+		return starlark.String(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i)
+		}
+		f, _ := v.Float64()
+		return starlark.Float(f)
+	case []any:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, elem := range v {
+			elems = append(elems, toValue(elem))
+		}
+		return starlark.NewList(elems)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			_ = dict.SetKey(starlark.String(key), toValue(v[key]))
+		}
+		return dict
+	}
+	return starlark.None
+}
+
+// toGo 只支持能表示为 JSON 的值，depth 防止自引用的 dict、list
+func toGo(value starlark.Value, depth int) (any, error) {
+	if depth > 64 {
+		return nil, fmt.Errorf("message is too deeply nested")
+	}
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		return v.BigInt(), nil
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List, starlark.Tuple:
+		list := v.(starlark.Indexable)
+		elems := make([]any, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			elem, err := toGo(list.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	case *starlark.Dict:
+		result := make(map[string]any, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("message keys must be strings, got %s", item[0].Type())
+			}
+			elem, err := toGo(item[1], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = elem
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("message contains unsupported type %s", value.Type())
+}
@@ -0,0 +1,230 @@
+package script
+
+/*
+Starlark 脚本钩子，声明式改写规则无法覆盖的场景使用
+脚本定义以下函数，至少定义一个:
+  on_request(message, meta)  请求发送到上游之前调用
+  on_response(message, meta) 非流式响应调用一次，流式响应对每个增量调用
+message 为通用格式(general.Request、general.Response)的 JSON 表示，meta 为请求信息(只读)
+函数返回值:
+  None              使用(可能已原地修改的) message
+  dict              替换 message
+  reject(msg, 403)  拒绝请求，按客户端协议返回错误
+  reroute("route")  改为发送到其它路由，只能在 on_request 中使用
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/lijcoder/aiapi/transform"
+	"go.starlark.net/starlark"
+)
+
+// 钩子函数名
+const (
+	HookRequest  = "on_request"
+	HookResponse = "on_response"
+)
+
+// Script 匹配条件与改写规则相同
+type Script struct {
+	Name     string          `json:"name"`
+	Match    transform.Match `json:"match"`
+	Source   string          `json:"source"`
+	Disabled bool            `json:"disabled"`
+}
+
+// Hook 编译后的脚本，全局变量已冻结，可以并发调用
+type Hook struct {
+	Script
+	onRequest  starlark.Callable
+	onResponse starlark.Callable
+}
+
+// Store 脚本按配置顺序执行，修改后写回文件
+type Store struct {
+	file  string
+	mu    sync.RWMutex
+	hooks []*Hook
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Load 文件不存在时为空
+func Load(file string) (*Store, error) {
+	store := &Store{file: file}
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var scripts []Script
+	if err := json.Unmarshal(content, &scripts); err != nil {
+		return nil, err
+	}
+	for _, script := range scripts {
+		if slices.ContainsFunc(store.hooks, func(hook *Hook) bool { return hook.Name == script.Name }) {
+			return nil, fmt.Errorf("script %s: duplicate name", script.Name)
+		}
+		hook, err := Compile(script)
+		if err != nil {
+			return nil, err
+		}
+		store.hooks = append(store.hooks, hook)
+	}
+	return store, nil
+}
+
+// Compile 检查名称并执行脚本的顶层代码，取出钩子函数
+func Compile(script Script) (*Hook, error) {
+	if !namePattern.MatchString(script.Name) {
+		return nil, fmt.Errorf("script %q: name must match %s", script.Name, namePattern)
+	}
+	globals, err := execFile(script.Name, script.Source)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", script.Name, err)
+	}
+	hook := &Hook{Script: script}
+	for name, target := range map[string]*starlark.Callable{HookRequest: &hook.onRequest, HookResponse: &hook.onResponse} {
+		value, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := value.(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("script %s: %s is not a function", script.Name, name)
+		}
+		*target = fn
+	}
+	if hook.onRequest == nil && hook.onResponse == nil {
+		return nil, fmt.Errorf("script %s: %s or %s is required", script.Name, HookRequest, HookResponse)
+	}
+	return hook, nil
+}
+
+// List 按执行顺序返回所有脚本
+func (s *Store) List() []Script {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scripts := make([]Script, 0, len(s.hooks))
+	for _, hook := range s.hooks {
+		scripts = append(scripts, hook.Script)
+	}
+	return scripts
+}
+
+func (s *Store) Get(name string) (Script, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.index(name); i >= 0 {
+		return s.hooks[i].Script, true
+	}
+	return Script{}, false
+}
+
+// Put 编译通过后替换同名脚本，不存在时追加到最后，写文件失败时不修改
+func (s *Store) Put(script Script) error {
+	hook, err := Compile(script)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks := slices.Clone(s.hooks)
+	if i := s.index(script.Name); i >= 0 {
+		hooks[i] = hook
+	} else {
+		hooks = append(hooks, hook)
+	}
+	return s.save(hooks)
+}
+
+// Delete 脚本不存在时返回 false
+func (s *Store) Delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(name)
+	if i < 0 {
+		return false, nil
+	}
+	return true, s.save(slices.Delete(slices.Clone(s.hooks), i, i+1))
+}
+
+// Possible 是否存在可能生效的脚本，不考虑模型条件，用于请求体解析之前的判断
+func (s *Store) Possible(scope transform.Scope) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.ContainsFunc(s.hooks, func(hook *Hook) bool {
+		match := hook.Match
+		match.Models = nil
+		return !hook.Disabled && match.Matches(scope)
+	})
+}
+
+// Select 按配置顺序返回定义了钩子函数 name 且满足匹配条件的脚本
+func (s *Store) Select(name string, scope transform.Scope) []*Hook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var hooks []*Hook
+	for _, hook := range s.hooks {
+		if !hook.Disabled && hook.function(name) != nil && hook.Match.Matches(scope) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// Names 脚本名称，用于日志与响应头
+func Names(hooks []*Hook) []string {
+	names := make([]string, 0, len(hooks))
+	for _, hook := range hooks {
+		names = append(names, hook.Name)
+	}
+	return names
+}
+
+func (s *Store) index(name string) int {
+	return slices.IndexFunc(s.hooks, func(hook *Hook) bool { return hook.Name == name })
+}
+
+func (s *Store) save(hooks []*Hook) error {
+	scripts := make([]Script, 0, len(hooks))
+	for _, hook := range hooks {
+		scripts = append(scripts, hook.Script)
+	}
+	data, err := json.MarshalIndent(scripts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o755); err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		return err
+	}
+	s.hooks = hooks
+	return nil
+}
+
+func (h *Hook) function(name string) starlark.Callable {
+	switch name {
+	case HookRequest:
+		return h.onRequest
+	case HookResponse:
+		return h.onResponse
+	}
+	return nil
+}
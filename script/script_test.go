@@ -0,0 +1,152 @@
+package script
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lijcoder/aiapi/messages/general"
+	"github.com/lijcoder/aiapi/transform"
+)
+
+var testLimits = Limits{MaxSteps: 100000, Timeout: time.Second}
+
+func TestRunRequest(t *testing.T) {
+	hook, err := Compile(Script{Name: "route", Source: `
+def on_request(message, meta):
+    if meta["key"] == "banned":
+        return reject("key is banned", 429)
+    config = message.setdefault("generationConfig", {})
+    config["maxOutputTokens"] = min(config.get("maxOutputTokens", 4096), 1024)
+    if meta["model"].startswith("cheap-"):
+        return reroute("backup")
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxTokens := 8192
+	req := &general.Request{Model: "cheap-1", GenerationConfig: &general.GenerationConfig{MaxOutputTokens: &maxTokens}}
+	result, err := hook.RunRequest(context.Background(), req, Meta{Model: "cheap-1"}, testLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Changed || result.Route != "backup" || *req.GenerationConfig.MaxOutputTokens != 1024 {
+		t.Fatalf("脚本执行结果错误: %+v %+v", result, req.GenerationConfig)
+	}
+	// 没有修改时 Changed 为 false
+	result, _ = hook.RunRequest(context.Background(), req, Meta{Model: "m"}, testLimits)
+	if result.Changed || result.Route != "" {
+		t.Fatalf("未修改的请求不应标记为修改: %+v", result)
+	}
+	result, _ = hook.RunRequest(context.Background(), req, Meta{Key: "banned"}, testLimits)
+	if result.Reject == nil || result.Reject.Status != 429 || result.Reject.Message != "key is banned" {
+		t.Fatalf("拒绝结果错误: %+v", result)
+	}
+
+	// 返回不符合通用格式的消息时报错且不修改请求
+	bad, _ := Compile(Script{Name: "bad", Source: `
+def on_request(message, meta):
+    return {"generationConfig": {"maxOutputTokens": "many"}}
+`})
+	if _, err := bad.RunRequest(context.Background(), req, Meta{}, testLimits); err == nil || *req.GenerationConfig.MaxOutputTokens != 1024 {
+		t.Fatalf("非法消息应返回错误: %v", err)
+	}
+}
+
+func TestRunResponse(t *testing.T) {
+	hook, err := Compile(Script{Name: "mask", Source: `
+def on_response(message, meta):
+    for candidate in message.get("candidates", []):
+        for part in candidate["content"]["parts"]:
+            if "text" in part:
+                part["text"] = part["text"].replace("secret", "******")
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "the secret is 42"
+	resp := &general.Response{Candidates: []general.Candidate{{Content: &general.Content{Role: "assistant", Parts: []general.Part{{Text: &text}}}}}}
+	if _, err := hook.RunResponse(context.Background(), resp, Meta{Stream: true}, testLimits); err != nil {
+		t.Fatal(err)
+	}
+	if got := *resp.Candidates[0].Content.Parts[0].Text; got != "the ****** is 42" {
+		t.Fatalf("响应改写错误: %s", got)
+	}
+	reroute, _ := Compile(Script{Name: "reroute", Source: `def on_response(message, meta): return reroute("x")`})
+	if _, err := reroute.RunResponse(context.Background(), resp, Meta{}, testLimits); err == nil {
+		t.Fatal("响应钩子不能改变路由")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	hook, err := Compile(Script{Name: "loop", Source: `
+def on_request(message, meta):
+    while True:
+        pass
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = hook.RunRequest(context.Background(), &general.Request{}, Meta{}, Limits{MaxSteps: 10000})
+	if err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Fatalf("超过步数上限应中止: %v", err)
+	}
+	start := time.Now()
+	_, err = hook.RunRequest(context.Background(), &general.Request{}, Meta{}, Limits{Timeout: 50 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timeout") || time.Since(start) > time.Second {
+		t.Fatalf("超时应中止: %v", err)
+	}
+	// 顶层代码同样有限制
+	if _, err := Compile(Script{Name: "top", Source: "while True:\n    pass\n"}); err == nil {
+		t.Fatal("顶层死循环应编译失败")
+	}
+}
+
+func TestStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "scripts.json")
+	store, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []Script{
+		{Name: "a b", Source: "def on_request(message, meta): pass"},
+		{Name: "empty", Source: "x = 1"},
+		{Name: "syntax", Source: "def on_request(:"},
+	} {
+		if err := store.Put(script); err == nil {
+			t.Fatalf("非法脚本应保存失败: %s", script.Name)
+		}
+	}
+	gem := Script{Name: "gem", Match: transform.Match{Routes: []string{"gem"}, Models: []string{"gemini-*"}}, Source: "def on_request(message, meta): pass"}
+	all := Script{Name: "all", Source: "def on_response(message, meta): pass"}
+	if err := store.Put(gem); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(all); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Possible(transform.Scope{Route: "gem"}) || len(store.Select(HookRequest, transform.Scope{Route: "gem", Model: "gpt"})) != 0 {
+		t.Fatal("匹配条件错误")
+	}
+	if names := Names(store.Select(HookResponse, transform.Scope{Route: "up"})); len(names) != 1 || names[0] != "all" {
+		t.Fatalf("只选出定义了对应钩子的脚本: %v", names)
+	}
+
+	// 重新加载后保持顺序
+	gem.Disabled = true
+	if err := store.Put(gem); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := store.Delete("all"); !ok || err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	store, err = Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scripts := store.List(); len(scripts) != 1 || !scripts[0].Disabled || store.Possible(transform.Scope{Route: "gem"}) {
+		t.Fatalf("重新加载结果错误: %+v", scripts)
+	}
+}
@@ -0,0 +1,256 @@
+package sse
+
+/*
+Server-Sent Events 编解码
+https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+*/
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const ContentType = "text/event-stream"
+
+var bom = []byte("\xef\xbb\xbf")
+
+// Event 一个完整的 SSE 事件
+type Event struct {
+	Id       string
+	Event    string
+	Data     string
+	Retry    int
+	Comments []string
+	// HasData data 字段是否出现过，用于区分 "data:" 与没有 data 的事件
+	HasData bool
+	// HasId id 字段是否出现过，"id:" 为空值时表示重置 last event id
+	HasId bool
+}
+
+// IsComment 只包含注释的事件，常见于心跳
+func (e *Event) IsComment() bool {
+	return len(e.Comments) > 0 && !e.HasData && e.Event == "" && !e.HasId && e.Retry == 0
+}
+
+// Decoder 流式 SSE 解析
+// 兼容 \n、\r\n、\r 三种换行；末尾未以空行结束的事件在 EOF 时仍然下发，避免上游漏写结尾空行时丢数据
+type Decoder struct {
+	r      io.Reader
+	buf    []byte
+	start  int
+	end    int
+	err    error
+	skipLF bool
+	bom    bool
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, buf: make([]byte, 4096)}
+}
+
+// Next 返回下一个事件，流结束返回 io.EOF
+func (d *Decoder) Next() (Event, error) {
+	var event Event
+	var data strings.Builder
+	pending := false
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			if err == io.EOF && (pending || line != "") {
+				if line != "" {
+					d.processLine(line, &event, &data)
+				}
+				if d.finish(&event, &data) {
+					return event, nil
+				}
+			}
+			return Event{}, err
+		}
+		if line == "" {
+			if d.finish(&event, &data) {
+				return event, nil
+			}
+			event = Event{}
+			data.Reset()
+			pending = false
+			continue
+		}
+		d.processLine(line, &event, &data)
+		pending = true
+	}
+}
+
+func (d *Decoder) finish(event *Event, data *strings.Builder) bool {
+	if !event.HasData && event.Event == "" && !event.HasId && event.Retry == 0 && len(event.Comments) == 0 {
+		return false
+	}
+	// 去掉最后一个 data 行追加的换行
+	event.Data = strings.TrimSuffix(data.String(), "\n")
+	return true
+}
+
+func (d *Decoder) processLine(line string, event *Event, data *strings.Builder) {
+	if strings.HasPrefix(line, ":") {
+		event.Comments = append(event.Comments, strings.TrimPrefix(line[1:], " "))
+		return
+	}
+	field, value, found := strings.Cut(line, ":")
+	if found {
+		value = strings.TrimPrefix(value, " ")
+	}
+	switch field {
+	case "event":
+		event.Event = value
+	case "data":
+		data.WriteString(value)
+		data.WriteByte('\n')
+		event.HasData = true
+	case "id":
+		// 包含 NULL 的 id 按规范忽略
+		if !strings.ContainsRune(value, 0) {
+			event.Id = value
+			event.HasId = true
+		}
+	case "retry":
+		if retry, err := strconv.Atoi(value); err == nil && retry >= 0 && isDigits(value) {
+			event.Retry = retry
+		}
+	}
+}
+
+// readLine 读取一行，不包含行尾
+func (d *Decoder) readLine() (string, error) {
+	for {
+		if d.skipLF && d.start < d.end {
+			if d.buf[d.start] == '\n' {
+				d.start++
+			}
+			d.skipLF = false
+		}
+		if !d.bom {
+			// 流开头的 BOM 需要去掉，数据不足时先继续读取
+			if d.end-d.start < len(bom) && d.err == nil && bytes.HasPrefix(bom, d.buf[d.start:d.end]) {
+				d.fill()
+				continue
+			}
+			d.bom = true
+			if bytes.HasPrefix(d.buf[d.start:d.end], bom) {
+				d.start += len(bom)
+			}
+		}
+		if idx := bytes.IndexAny(d.buf[d.start:d.end], "\r\n"); idx >= 0 {
+			lineEnd := d.start + idx
+			line := string(d.buf[d.start:lineEnd])
+			d.start = lineEnd + 1
+			if d.buf[lineEnd] == '\r' {
+				// \r 之后的 \n 可能还没有读到，不能阻塞等待
+				d.skipLF = true
+			}
+			return line, nil
+		}
+		if d.err != nil {
+			line := string(d.buf[d.start:d.end])
+			d.start = d.end
+			return line, d.err
+		}
+		d.fill()
+	}
+}
+
+func (d *Decoder) fill() {
+	if d.start > 0 {
+		copy(d.buf, d.buf[d.start:d.end])
+		d.end -= d.start
+		d.start = 0
+	}
+	if d.end == len(d.buf) {
+		newBuf := make([]byte, len(d.buf)*2)
+		copy(newBuf, d.buf[:d.end])
+		d.buf = newBuf
+	}
+	n, err := d.r.Read(d.buf[d.end:])
+	d.end += n
+	if err != nil {
+		d.err = err
+	}
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Encoder SSE 编码
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode 写入一个完整事件，data 中的换行拆成多个 data 行
+func (e *Encoder) Encode(event Event) error {
+	_, err := e.w.Write(Marshal(event))
+	return err
+}
+
+// Comment 写入注释事件，用于心跳
+func (e *Encoder) Comment(text string) error {
+	return e.Encode(Event{Comments: []string{text}})
+}
+
+// Marshal 事件序列化为 SSE 字节
+func Marshal(event Event) []byte {
+	var buf bytes.Buffer
+	for _, comment := range event.Comments {
+		for _, line := range splitLines(comment) {
+			buf.WriteString(": ")
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	if event.Event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(singleLine(event.Event))
+		buf.WriteByte('\n')
+	}
+	if event.HasId || event.Id != "" {
+		buf.WriteString("id: ")
+		buf.WriteString(strings.ReplaceAll(singleLine(event.Id), "\x00", ""))
+		buf.WriteByte('\n')
+	}
+	if event.Retry > 0 {
+		buf.WriteString("retry: ")
+		buf.WriteString(strconv.Itoa(event.Retry))
+		buf.WriteByte('\n')
+	}
+	if event.HasData || event.Data != "" {
+		for _, line := range splitLines(event.Data) {
+			buf.WriteString("data: ")
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
+
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
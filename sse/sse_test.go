@@ -0,0 +1,126 @@
+package sse
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func decodeAll(t testing.TB, r io.Reader) []Event {
+	decoder := NewDecoder(r)
+	var events []Event
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []Event
+	}{
+		{
+			name:  "lf",
+			input: "data: a\n\ndata: b\n\n",
+			want:  []Event{{Data: "a", HasData: true}, {Data: "b", HasData: true}},
+		},
+		{
+			name:  "crlf",
+			input: "data: a\r\n\r\nevent: x\r\ndata: b\r\n\r\n",
+			want:  []Event{{Data: "a", HasData: true}, {Event: "x", Data: "b", HasData: true}},
+		},
+		{
+			name:  "cr",
+			input: "data: a\r\rdata: b\r\r",
+			want:  []Event{{Data: "a", HasData: true}, {Data: "b", HasData: true}},
+		},
+		{
+			name:  "multi line data",
+			input: "data: line1\ndata:line2\ndata\n\n",
+			want:  []Event{{Data: "line1\nline2\n", HasData: true}},
+		},
+		{
+			name:  "fields",
+			input: ": ping\nevent: message_start\nid: 7\nretry: 3000\nretry: x\nfoo: bar\ndata: {}\n\n",
+			want: []Event{{
+				Id: "7", HasId: true, Event: "message_start", Retry: 3000,
+				Comments: []string{"ping"}, Data: "{}", HasData: true,
+			}},
+		},
+		{
+			name:  "comment only",
+			input: ":keep-alive\n\n",
+			want:  []Event{{Comments: []string{"keep-alive"}}},
+		},
+		{
+			name:  "trailing partial frame",
+			input: "data: a\n\ndata: b",
+			want:  []Event{{Data: "a", HasData: true}, {Data: "b", HasData: true}},
+		},
+		{
+			name:  "bom and blank frames",
+			input: "\xef\xbb\xbf\n\n\ndata: a\n\n",
+			want:  []Event{{Data: "a", HasData: true}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := decodeAll(t, bytes.NewReader([]byte(c.input)))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("解析结果不一致\n got: %+v\nwant: %+v", got, c.want)
+			}
+			// 逐字节读取，覆盖 \r\n 被拆开的情况
+			got = decodeAll(t, iotest.OneByteReader(bytes.NewReader([]byte(c.input))))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("逐字节解析结果不一致\n got: %+v\nwant: %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	if err := encoder.Encode(Event{Event: "delta", Data: "a\nb", HasData: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Comment("heartbeat"); err != nil {
+		t.Fatal(err)
+	}
+	want := "event: delta\ndata: a\ndata: b\n\n: heartbeat\n\n"
+	if buf.String() != want {
+		t.Fatalf("编码结果不一致: %q", buf.String())
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add([]byte("data: a\n\n"))
+	f.Add([]byte("data: a\r\n\r\nevent: b\rdata: c\r\r"))
+	f.Add([]byte(": c\nid: 1\nretry: 10\ndata\ndata: x\n"))
+	f.Add([]byte("\xef\xbb\xbfdata:\x00\n\n"))
+	f.Fuzz(func(t *testing.T, input []byte) {
+		events := decodeAll(t, bytes.NewReader(input))
+		// 重新编码后再解析，结果必须一致
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		again := decodeAll(t, iotest.OneByteReader(&buf))
+		if !reflect.DeepEqual(events, again) {
+			t.Fatalf("编解码不一致\n first: %+v\nsecond: %+v", events, again)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package tokenizer
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:generate go run download.go
+
+// encodings 目录下为 tiktoken 格式的词表，每行为 base64 编码的 token 与 rank，由 download.go 下载并按 SHA256SUMS 校验
+//
+//go:embed encodings
+var encodingFiles embed.FS
+
+// Encoding BPE 编码：预切分规则与 token rank 表
+type Encoding struct {
+	name  string
+	split func(text string) []string
+	ranks func() map[string]int
+}
+
+var (
+	Cl100kBase = newEncoding("cl100k_base", splitCl100k)
+	O200kBase  = newEncoding("o200k_base", splitO200k)
+)
+
+// o200k_base 的模型名前缀，其它模型(包括非 openai 模型)按 cl100k_base 计数
+var o200kModels = []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "gpt-oss", "o1", "o3", "o4"}
+
+func newEncoding(name string, split func(string) []string) *Encoding {
+	// 词表较大，第一次计数时再加载
+	return &Encoding{name: name, split: split, ranks: sync.OnceValue(func() map[string]int { return loadRanks(name) })}
+}
+
+// ForModel 按模型名选择编码，模型名可以带 models/、openai/ 等前缀
+func ForModel(model string) *Encoding {
+	model = strings.ToLower(model[strings.LastIndex(model, "/")+1:])
+	for _, prefix := range o200kModels {
+		if strings.HasPrefix(model, prefix) {
+			return O200kBase
+		}
+	}
+	return Cl100kBase
+}
+
+// loadRanks 没有嵌入词表时返回空，计数退化为按预切分片段估算
+func loadRanks(name string) map[string]int {
+	data, err := encodingFiles.ReadFile("encodings/" + name + ".tiktoken")
+	if err != nil {
+		return nil
+	}
+	ranks := make(map[string]int, bytes.Count(data, []byte("\n")))
+	for line := range bytes.Lines(data) {
+		token, rank, ok := bytes.Cut(bytes.TrimSpace(line), []byte(" "))
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			panic("词表解析失败: " + name + " 错误: " + err.Error())
+		}
+		n, err := strconv.Atoi(string(rank))
+		if err != nil {
+			panic("词表解析失败: " + name + " 错误: " + err.Error())
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks
+}
+
+// Name 编码名称
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Exact 是否嵌入了词表，没有词表时 Count 为估算值
+func (e *Encoding) Exact() bool {
+	return len(e.ranks()) > 0
+}
+
+// Count 文本的 token 数，与 tiktoken encode_ordinary 的结果长度一致，特殊 token 按普通文本计数
+func (e *Encoding) Count(text string) int {
+	ranks := e.ranks()
+	total := 0
+	for _, piece := range e.split(text) {
+		if len(ranks) == 0 {
+			total += estimatePiece(piece)
+			continue
+		}
+		total += bytePairCount(ranks, piece)
+	}
+	return total
+}
+
+// bytePairCount 从单个字节开始，每次合并 rank 最小的相邻片段(相同时取最左边)，没有可以合并的片段时返回片段数
+func bytePairCount(ranks map[string]int, piece string) int {
+	if _, ok := ranks[piece]; ok {
+		return 1
+	}
+	// parts 为各片段的起始位置，最后一项为结尾
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+	for len(parts) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(parts); i++ {
+			if rank, ok := ranks[piece[parts[i]:parts[i+2]]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = slices.Delete(parts, best+1, best+2)
+	}
+	return len(parts) - 1
+}
+
+// estimatePiece 没有词表时按平均每 4 个字节一个 token 估算，每个片段至少一个 token
+func estimatePiece(piece string) int {
+	return max(1, ceilDiv(len(piece), bytesPerToken))
+}
+
+func ceilDiv(a int, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,73 @@
+//go:build ignore
+
+// 下载 tiktoken 词表到 encodings 目录，按 encodings/SHA256SUMS 校验，由 go generate ./tokenizer 调用
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const baseUrl = "https://openaipublic.blob.core.windows.net/encodings/"
+
+func main() {
+	sums, err := os.Open(filepath.Join("encodings", "SHA256SUMS"))
+	if err != nil {
+		fail(err)
+	}
+	defer sums.Close()
+	scanner := bufio.NewScanner(sums)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if err := download(fields[1], fields[0]); err != nil {
+			fail(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail(err)
+	}
+}
+
+// download 已经下载且校验通过的词表不重复下载
+func download(name string, sum string) error {
+	target := filepath.Join("encodings", name)
+	if data, err := os.ReadFile(target); err == nil && checksum(data) == sum {
+		return nil
+	}
+	resp, err := http.Get(baseUrl + name)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: %s", name, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if got := checksum(data); got != sum {
+		return fmt.Errorf("download %s: sha256 %s, want %s", name, got, sum)
+	}
+	return os.WriteFile(target, data, 0o644)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
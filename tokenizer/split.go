@@ -0,0 +1,185 @@
+package tokenizer
+
+/*
+tiktoken 的预切分正则，BPE 只在切分出的片段内合并。正则使用了 Go regexp 不支持的 (?!\S)，
+这里按正则从左到右、分支依次尝试、量词贪心回退的匹配顺序手工实现
+
+cl100k_base:
+(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+
+o200k_base:
+[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+*/
+
+import (
+	"strings"
+	"unicode"
+)
+
+func splitCl100k(text string) []string {
+	return split(text, func(runes []rune, i int) int {
+		if end := contraction(runes, i); end > i {
+			return end
+		}
+		letters := func(s int) int { return span(runes, s, unicode.IsLetter) }
+		if end := prefixed(runes, i, letters); end > i {
+			return end
+		}
+		if end := numbers(runes, i); end > i {
+			return end
+		}
+		if end := symbols(runes, i, "\r\n"); end > i {
+			return end
+		}
+		return whitespace(runes, i)
+	})
+}
+
+func splitO200k(text string) []string {
+	return split(text, func(runes []rune, i int) int {
+		// 单词后可以带英文缩写
+		word := func(match func(runes []rune, s int) int) func(int) int {
+			return func(s int) int {
+				end := match(runes, s)
+				if end == s {
+					return s
+				}
+				if c := contraction(runes, end); c > end {
+					return c
+				}
+				return end
+			}
+		}
+		if end := prefixed(runes, i, word(upperLower)); end > i {
+			return end
+		}
+		if end := prefixed(runes, i, word(upperThenLower)); end > i {
+			return end
+		}
+		if end := numbers(runes, i); end > i {
+			return end
+		}
+		if end := symbols(runes, i, "\r\n/"); end > i {
+			return end
+		}
+		return whitespace(runes, i)
+	})
+}
+
+// split match 返回从 i 开始的片段结尾
+func split(text string, match func(runes []rune, i int) int) []string {
+	runes := []rune(text)
+	var pieces []string
+	for i := 0; i < len(runes); {
+		end := max(match(runes, i), i+1)
+		pieces = append(pieces, string(runes[i:end]))
+		i = end
+	}
+	return pieces
+}
+
+// span 从 s 开始连续满足 in 的字符的结尾
+func span(runes []rune, s int, in func(rune) bool) int {
+	for s < len(runes) && in(runes[s]) {
+		s++
+	}
+	return s
+}
+
+// contraction (?i:'s|'t|'re|'ve|'m|'ll|'d)
+func contraction(runes []rune, i int) int {
+	if i+1 >= len(runes) || runes[i] != '\'' {
+		return i
+	}
+	switch unicode.ToLower(runes[i+1]) {
+	case 's', 't', 'm', 'd':
+		return i + 2
+	}
+	if i+2 < len(runes) {
+		switch strings.ToLower(string(runes[i+1 : i+3])) {
+		case "re", "ve", "ll":
+			return i + 3
+		}
+	}
+	return i
+}
+
+// prefixed [^\r\n\p{L}\p{N}]? 后接 match，先尝试带一个前缀字符，不匹配时不带前缀
+func prefixed(runes []rune, i int, match func(s int) int) int {
+	if r := runes[i]; r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		if end := match(i + 1); end > i+1 {
+			return end
+		}
+	}
+	return match(i)
+}
+
+// upperLower [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+，后半部分不匹配时前半部分逐个回退
+func upperLower(runes []rune, s int) int {
+	for a := span(runes, s, upper); a >= s; a-- {
+		if end := span(runes, a, lower); end > a {
+			return end
+		}
+	}
+	return s
+}
+
+// upperThenLower [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*
+func upperThenLower(runes []rune, s int) int {
+	a := span(runes, s, upper)
+	if a == s {
+		return s
+	}
+	return span(runes, a, lower)
+}
+
+func upper(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+func lower(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// numbers \p{N}{1,3}
+func numbers(runes []rune, i int) int {
+	end := i
+	for end < len(runes) && end-i < 3 && unicode.IsNumber(runes[end]) {
+		end++
+	}
+	return end
+}
+
+// symbols " ?[^\s\p{L}\p{N}]+" 后接 trailing 中的字符
+func symbols(runes []rune, i int, trailing string) int {
+	s := i
+	if runes[s] == ' ' && s+1 < len(runes) && symbol(runes[s+1]) {
+		s++
+	}
+	end := span(runes, s, symbol)
+	if end == s {
+		return i
+	}
+	return span(runes, end, func(r rune) bool { return strings.ContainsRune(trailing, r) })
+}
+
+func symbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// whitespace \s*[\r\n]+|\s+(?!\S)|\s+：包含换行时到最后一个换行为止；
+// 后面还有其它字符时留下最后一个空白，与下一个单词或符号合并
+func whitespace(runes []rune, i int) int {
+	end := span(runes, i, unicode.IsSpace)
+	for j := end - 1; j >= i; j-- {
+		if runes[j] == '\r' || runes[j] == '\n' {
+			return j + 1
+		}
+	}
+	if end < len(runes) && end-1 > i {
+		return end - 1
+	}
+	return end
+}
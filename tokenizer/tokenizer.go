@@ -0,0 +1,79 @@
+package tokenizer
+
+/*
+本地 token 计数，上游没有 token 计数接口时使用，限流与配额的 TPM 预检也可以复用
+文本按 tiktoken 的 cl100k_base/o200k_base 预切分后用 BPE 合并计数，与 openai 模型的实际结果一致；
+其它厂商的模型没有公开词表，按 cl100k_base 计数，结果只作为估算。消息、工具定义的格式开销按 openai 对话格式估算
+词表由 go generate ./tokenizer 下载到 encodings 目录后嵌入，没有词表时按预切分片段的字节数估算
+*/
+
+import (
+	"encoding/json"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// 估算常量，参考 openai 对话格式：每条消息固定开销 3，回复开头固定开销 3
+const (
+	messageTokens = 3
+	replyTokens   = 3
+	// 图片、音视频等媒体按 gemini 单张图片的固定值估算
+	mediaTokens = 258
+	// 没有词表时平均每个 token 的字节数
+	bytesPerToken = 4
+)
+
+// Count 按 cl100k_base 计算文本的 token 数
+func Count(text string) int {
+	return Cl100kBase.Count(text)
+}
+
+// EstimateRequest 估算通用请求的输入 token 数，包含系统提示词、消息与工具定义
+func EstimateRequest(req *general.Request) int {
+	encoding := ForModel(req.Model)
+	total := replyTokens
+	if req.SystemInstruction != nil {
+		total += estimateContent(encoding, *req.SystemInstruction)
+	}
+	for _, content := range req.Contents {
+		total += estimateContent(encoding, content)
+	}
+	for _, tool := range req.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			total += encoding.Count(declaration.Name) + encoding.Count(declaration.Description) + countJson(encoding, declaration.Parameters)
+		}
+	}
+	return total
+}
+
+func estimateContent(encoding *Encoding, content general.Content) int {
+	total := messageTokens
+	for _, part := range content.Parts {
+		switch {
+		case part.Text != nil:
+			total += encoding.Count(*part.Text)
+		case part.InlineData != nil, part.FileData != nil:
+			total += mediaTokens
+		case part.FunctionCall != nil:
+			total += encoding.Count(part.FunctionCall.Name) + countJson(encoding, part.FunctionCall.Args)
+		case part.FunctionResponse != nil:
+			total += encoding.Count(part.FunctionResponse.Name) + countJson(encoding, part.FunctionResponse.Response)
+		case part.ExecutableCode != nil:
+			total += encoding.Count(part.ExecutableCode.Code)
+		case part.CodeExecutionResult != nil:
+			total += encoding.Count(part.CodeExecutionResult.Output)
+		}
+	}
+	return total
+}
+
+func countJson(encoding *Encoding, v any) int {
+	if v == nil {
+		return 0
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return encoding.Count(string(data))
+}
@@ -0,0 +1,124 @@
+package tokenizer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		encoding *Encoding
+		text     string
+		want     []string
+	}{
+		{Cl100kBase, "Hello world", []string{"Hello", " world"}},
+		{Cl100kBase, "I'm here, don't", []string{"I", "'m", " here", ",", " don", "'t"}},
+		{Cl100kBase, "12345 67", []string{"123", "45", " ", "67"}},
+		{Cl100kBase, "a  b\n\n  c  ", []string{"a", " ", " b", "\n\n", " ", " c", "  "}},
+		{Cl100kBase, "fmt.Println(\"hi\")\n}", []string{"fmt", ".Println", "(\"", "hi", "\")\n", "}"}},
+		{Cl100kBase, "你好，世界", []string{"你好", "，世界"}},
+		{O200kBase, "HelloWorld JSONParser", []string{"Hello", "World", " JSONParser"}},
+		{O200kBase, "don't path/to\n", []string{"don't", " path", "/to", "\n"}},
+		{O200kBase, "a//\nb", []string{"a", "//\n", "b"}},
+	}
+	for _, c := range cases {
+		if got := c.encoding.split(c.text); !slices.Equal(got, c.want) {
+			t.Fatalf("%s %q 切分为 %q，期望 %q", c.encoding.Name(), c.text, got, c.want)
+		}
+	}
+}
+
+func TestBytePairCount(t *testing.T) {
+	ranks := map[string]int{"a": 0, "b": 1, "c": 2, "ab": 3, "bc": 4, "abc": 5, "cc": 6}
+	cases := map[string]int{
+		"abc": 1,
+		// ab 的 rank 小于 bc，先合并 ab，之后 ab+c 合并为 abc
+		"abcc": 2,
+		// 两个 ab 先合并，之后 ab+c 合并为 abc，没有 cab，结果为 abc、c、ab
+		"abccab": 3,
+		"":       0,
+	}
+	for piece, want := range cases {
+		if got := bytePairCount(ranks, piece); got != want {
+			t.Fatalf("%q 合并为 %d 个 token，期望 %d", piece, got, want)
+		}
+	}
+	// rank 表中没有的字节各自计为一个 token
+	if got := bytePairCount(map[string]int{"x": 0}, "yz"); got != 2 {
+		t.Fatalf("未知字节计数错误: %d", got)
+	}
+}
+
+// TestReferenceCount 与 tiktoken 的计数结果对比，需要先执行 go generate ./tokenizer 下载词表
+func TestReferenceCount(t *testing.T) {
+	cases := []struct {
+		encoding *Encoding
+		text     string
+		want     int
+	}{
+		{Cl100kBase, "hello world", 2},
+		{Cl100kBase, "Hello, world!", 4},
+		{Cl100kBase, "tiktoken is great!", 6},
+		{Cl100kBase, "The quick brown fox jumps over the lazy dog.", 10},
+		{O200kBase, "hello world", 2},
+		{O200kBase, "The quick brown fox jumps over the lazy dog.", 10},
+	}
+	for _, c := range cases {
+		if !c.encoding.Exact() {
+			t.Skipf("没有嵌入 %s 词表", c.encoding.Name())
+		}
+		if got := c.encoding.Count(c.text); got != c.want {
+			t.Fatalf("%s %q 计数 %d，期望 %d", c.encoding.Name(), c.text, got, c.want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	if n := Count(""); n != 0 {
+		t.Fatalf("空文本计数应为 0: %d", n)
+	}
+	// 数字每 3 位一个片段，词表中都有对应的 token
+	if n := Count("12345678"); n != 3 {
+		t.Fatalf("数字计数错误: %d", n)
+	}
+	text := "The quick brown fox jumps over the lazy dog."
+	if n := Count(text); n < len(Cl100kBase.split(text)) || n > len(text) {
+		t.Fatalf("%q 计数 %d 超出范围", text, n)
+	}
+}
+
+func TestForModel(t *testing.T) {
+	for model, want := range map[string]*Encoding{
+		"gpt-4o-mini":           O200kBase,
+		"openai/gpt-5":          O200kBase,
+		"o3-mini":               O200kBase,
+		"gpt-4-turbo":           Cl100kBase,
+		"gpt-3.5-turbo":         Cl100kBase,
+		"claude-sonnet-4":       Cl100kBase,
+		"models/gemini-2.5-pro": Cl100kBase,
+	} {
+		if got := ForModel(model); got != want {
+			t.Fatalf("%s 应使用 %s: %s", model, want.Name(), got.Name())
+		}
+	}
+}
+
+func TestEstimateRequest(t *testing.T) {
+	text := "What is the weather like in Paris today?"
+	req := &general.Request{Model: "gpt-4o", Contents: []general.Content{{Role: general.RoleUser, Parts: []general.Part{{Text: &text}}}}}
+	base := EstimateRequest(req)
+	if base != replyTokens+messageTokens+O200kBase.Count(text) {
+		t.Fatalf("消息估算错误: %d", base)
+	}
+	req.Tools = []general.Tool{{FunctionDeclarations: []general.FunctionDeclaration{{
+		Name:        "get_weather",
+		Description: "Get the current weather",
+		Parameters:  general.ParametersJsonSchema{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	}}}}
+	req.Contents[0].Parts = append(req.Contents[0].Parts, general.Part{InlineData: &general.Blob{MimeType: "image/png", Data: "AAAA"}})
+	if n := EstimateRequest(req); n <= base+mediaTokens {
+		t.Fatalf("工具与图片没有计入: %d", n)
+	}
+}
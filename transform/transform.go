@@ -0,0 +1,328 @@
+package transform
+
+/*
+声明式的请求、响应改写规则
+规则作用于通用格式(general.Request、general.Response)的 JSON 表示，路径使用通用格式的字段名，与客户端、上游协议无关
+路径以 . 分隔，数字表示数组下标，* 表示数组或对象的所有元素，例如:
+  generationConfig.maxOutputTokens
+  systemInstruction
+  candidates.*.finishReason
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+// 规则作用对象
+const (
+	TargetRequest  = "request"
+	TargetResponse = "response"
+)
+
+// 改写操作
+const (
+	// OpSet 设置字段，中间层不存在时创建
+	OpSet = "set"
+	// OpDelete 删除字段
+	OpDelete = "delete"
+	// OpDefault 字段不存在或为 null 时设置
+	OpDefault = "default"
+	// OpClamp 数值字段限制在 [min, max] 之间，字段不存在时不处理
+	OpClamp = "clamp"
+)
+
+// Rule 匹配条件全部满足时按顺序执行 actions
+type Rule struct {
+	Name  string `json:"name"`
+	Match Match  `json:"match"`
+	// request 或 response，为空时为 request
+	Target  string   `json:"target"`
+	Actions []Action `json:"actions"`
+}
+
+// Match 为空的条件不限制
+type Match struct {
+	// 路由 type(上游服务)
+	Routes []string `json:"routes"`
+	// 客户端请求的模型名，支持 * ? 通配符
+	Models []string `json:"models"`
+	// 网关 key 的名称，支持 * ? 通配符
+	Keys []string `json:"keys"`
+}
+
+type Action struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Min   *float64        `json:"min,omitempty"`
+	Max   *float64        `json:"max,omitempty"`
+}
+
+// Scope 请求的匹配信息
+type Scope struct {
+	Route string
+	Model string
+	Key   string
+}
+
+// Matches 是否满足匹配条件
+func (m Match) Matches(scope Scope) bool {
+	return (len(m.Routes) == 0 || slices.Contains(m.Routes, scope.Route)) &&
+		matchPatterns(m.Models, scope.Model) && matchPatterns(m.Keys, scope.Key)
+}
+
+func matchPatterns(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// target 为空时为 request
+func (r Rule) target() string {
+	if r.Target == "" {
+		return TargetRequest
+	}
+	return r.Target
+}
+
+// Validate 检查配置，配置文件加载时调用
+func Validate(rules []Rule) error {
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		if target := rule.target(); target != TargetRequest && target != TargetResponse {
+			return fmt.Errorf("rule %s: unknown target %s", name, target)
+		}
+		for _, action := range rule.Actions {
+			if action.Path == "" {
+				return fmt.Errorf("rule %s: path is required", name)
+			}
+			switch action.Op {
+			case OpSet, OpDefault:
+				if len(action.Value) == 0 {
+					return fmt.Errorf("rule %s: %s %s requires value", name, action.Op, action.Path)
+				}
+			case OpClamp:
+				if action.Min == nil && action.Max == nil {
+					return fmt.Errorf("rule %s: clamp %s requires min or max", name, action.Path)
+				}
+			case OpDelete:
+			default:
+				return fmt.Errorf("rule %s: unknown op %s", name, action.Op)
+			}
+		}
+	}
+	return nil
+}
+
+// Select 按配置顺序返回作用于 target 且满足匹配条件的规则
+func Select(rules []Rule, target string, scope Scope) []Rule {
+	var result []Rule
+	for _, rule := range rules {
+		if rule.target() == target && rule.Match.Matches(scope) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// Names 规则名称，用于日志与响应头
+func Names(rules []Rule) []string {
+	var names []string
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// ApplyRequest 按顺序执行规则，改写后的结果不能解析为通用请求时返回错误且不修改 req
+func ApplyRequest(rules []Rule, req *general.Request) error {
+	var result general.Request
+	if err := apply(rules, req, &result); err != nil {
+		return err
+	}
+	*req = result
+	return nil
+}
+
+// ApplyResponse 流式响应对每个增量响应执行，set 等操作在每个增量上都会生效
+func ApplyResponse(rules []Rule, resp *general.Response) error {
+	var result general.Response
+	if err := apply(rules, resp, &result); err != nil {
+		return err
+	}
+	*resp = result
+	return nil
+}
+
+func apply(rules []Rule, in any, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		for _, action := range rule.Actions {
+			if doc, err = action.apply(doc); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("transformed message is invalid: %w", err)
+	}
+	return nil
+}
+
+func (a Action) apply(doc any) (any, error) {
+	var value any
+	if len(a.Value) > 0 {
+		if err := json.Unmarshal(a.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", a.Path, err)
+		}
+	}
+	return update(doc, strings.Split(a.Path, "."), func(current any, exists bool) (any, bool) {
+		switch a.Op {
+		case OpSet:
+			return clone(value), true
+		case OpDefault:
+			if exists && current != nil {
+				return current, true
+			}
+			return clone(value), true
+		case OpClamp:
+			number, ok := current.(float64)
+			if !ok {
+				return current, exists
+			}
+			if a.Min != nil && number < *a.Min {
+				number = *a.Min
+			}
+			if a.Max != nil && number > *a.Max {
+				number = *a.Max
+			}
+			return number, true
+		}
+		return nil, false
+	})
+}
+
+// update 按路径找到字段后由 fn 返回新值，fn 返回 false 时删除字段
+// set、default 时创建不存在的对象，数组下标越界时不处理
+func update(node any, keys []string, fn func(current any, exists bool) (any, bool)) (any, error) {
+	key, rest := keys[0], keys[1:]
+	switch current := node.(type) {
+	case map[string]any:
+		if key == "*" {
+			for k, v := range current {
+				if err := updateChild(current, k, v, true, rest, fn); err != nil {
+					return nil, err
+				}
+			}
+			return current, nil
+		}
+		v, ok := current[key]
+		return current, updateChild(current, key, v, ok, rest, fn)
+	case []any:
+		if key == "*" {
+			for i := len(current) - 1; i >= 0; i-- {
+				if len(rest) == 0 {
+					if v, keep := fn(current[i], true); keep {
+						current[i] = v
+					} else {
+						current = slices.Delete(current, i, i+1)
+					}
+					continue
+				}
+				v, err := update(current[i], rest, fn)
+				if err != nil {
+					return nil, err
+				}
+				current[i] = v
+			}
+			return current, nil
+		}
+		i, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an array index", key)
+		}
+		if i < 0 || i >= len(current) {
+			return current, nil
+		}
+		if len(rest) == 0 {
+			if v, keep := fn(current[i], true); keep {
+				current[i] = v
+				return current, nil
+			}
+			return slices.Delete(current, i, i+1), nil
+		}
+		v, err := update(current[i], rest, fn)
+		if err != nil {
+			return nil, err
+		}
+		current[i] = v
+		return current, nil
+	case nil:
+		// 中间层不存在，只有 set、default 需要创建
+		if _, keep := fn(nil, false); !keep || key == "*" {
+			return nil, nil
+		}
+		if _, err := strconv.Atoi(key); err == nil {
+			return nil, nil
+		}
+		return update(map[string]any{}, keys, fn)
+	}
+	return node, nil
+}
+
+func updateChild(parent map[string]any, key string, value any, exists bool, rest []string, fn func(current any, exists bool) (any, bool)) error {
+	if len(rest) == 0 {
+		if v, keep := fn(value, exists); keep {
+			parent[key] = v
+		} else {
+			delete(parent, key)
+		}
+		return nil
+	}
+	v, err := update(value, rest, fn)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		parent[key] = v
+	}
+	return nil
+}
+
+// clone 同一个值设置到多个位置时不能共享
+func clone(value any) any {
+	data, _ := json.Marshal(value)
+	var result any
+	_ = json.Unmarshal(data, &result)
+	return result
+}
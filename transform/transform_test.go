@@ -0,0 +1,72 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lijcoder/aiapi/messages/general"
+)
+
+func TestApplyRequest(t *testing.T) {
+	var rules []Rule
+	if err := json.Unmarshal([]byte(`[
+		{"name":"cap","match":{"routes":["gem"],"models":["gemini-*"]},"actions":[
+			{"op":"clamp","path":"generationConfig.maxOutputTokens","max":1024},
+			{"op":"default","path":"generationConfig.temperature","value":0.3},
+			{"op":"delete","path":"generationConfig.topK"}]},
+		{"name":"system","match":{"keys":["team-*"]},"actions":[
+			{"op":"default","path":"systemInstruction","value":{"role":"system","parts":[{"text":"be brief"}]}},
+			{"op":"set","path":"model","value":"gemini-2.5-pro"},
+			{"op":"set","path":"contents.*.role","value":"user"}]},
+		{"name":"response","target":"response","actions":[{"op":"set","path":"model","value":"x"}]}]`), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(rules); err != nil {
+		t.Fatal(err)
+	}
+	selected := Select(rules, TargetRequest, Scope{Route: "gem", Model: "gemini-2.5-flash", Key: "team-a"})
+	if names := Names(selected); len(names) != 2 || names[0] != "cap" || names[1] != "system" {
+		t.Fatalf("规则匹配错误: %v", names)
+	}
+	if len(Select(rules, TargetRequest, Scope{Route: "up", Model: "gemini-2.5-flash"})) != 0 {
+		t.Fatal("路由与 key 不匹配时不应选中")
+	}
+
+	maxTokens, topK := 8192, 40
+	text := "hi"
+	req := &general.Request{
+		Model:            "gemini-2.5-flash",
+		Contents:         []general.Content{{Role: "assistant", Parts: []general.Part{{Text: &text}}}, {Role: "user"}},
+		GenerationConfig: &general.GenerationConfig{MaxOutputTokens: &maxTokens, TopK: &topK},
+	}
+	if err := ApplyRequest(selected, req); err != nil {
+		t.Fatal(err)
+	}
+	config := req.GenerationConfig
+	if *config.MaxOutputTokens != 1024 || *config.Temperature != 0.3 || config.TopK != nil {
+		t.Fatalf("生成配置改写错误: %+v", config)
+	}
+	if req.Model != "gemini-2.5-pro" || *req.SystemInstruction.Parts[0].Text != "be brief" || req.Contents[0].Role != "user" {
+		t.Fatalf("请求改写错误: %+v", req)
+	}
+
+	// 改写结果不符合通用格式时返回错误且不修改请求
+	bad := []Rule{{Name: "bad", Actions: []Action{{Op: OpSet, Path: "generationConfig.maxOutputTokens", Value: json.RawMessage(`"many"`)}}}}
+	if err := ApplyRequest(bad, req); err == nil || *req.GenerationConfig.MaxOutputTokens != 1024 {
+		t.Fatalf("非法改写应返回错误: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, rule := range []Rule{
+		{Target: "both", Actions: []Action{{Op: OpDelete, Path: "model"}}},
+		{Actions: []Action{{Op: "rename", Path: "model"}}},
+		{Actions: []Action{{Op: OpSet, Path: "model"}}},
+		{Actions: []Action{{Op: OpClamp, Path: "generationConfig.topP"}}},
+		{Actions: []Action{{Op: OpDelete}}},
+	} {
+		if err := Validate([]Rule{rule}); err == nil {
+			t.Fatalf("配置错误应校验失败: %+v", rule)
+		}
+	}
+}